@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/braintrustdata/braintrust-x-go/braintrust"
@@ -96,3 +97,115 @@ func GetOrCreateExperiment(experimentName, projectName string) (string, error) {
 
 	return experiment.ID, nil
 }
+
+// ExperimentEvent is a row of an experiment, like the span of an eval case
+type ExperimentEvent struct {
+	ID         string                 `json:"id"`
+	SpanID     string                 `json:"span_id,omitempty"`
+	RootSpanID string                 `json:"root_span_id,omitempty"`
+	Input      interface{}            `json:"input"`
+	Output     interface{}            `json:"output"`
+	Expected   interface{}            `json:"expected,omitempty"`
+	Metadata   interface{}            `json:"metadata,omitempty"`
+	Scores     map[string]interface{} `json:"scores,omitempty"`
+	Tags       []string               `json:"tags,omitempty"`
+}
+
+// ExperimentFetchRequest represents the request payload for fetching experiment events
+type ExperimentFetchRequest struct {
+	Limit  int    `json:"limit,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// ExperimentFetchResponse represents the response from fetching experiment events
+type ExperimentFetchResponse struct {
+	Events []json.RawMessage `json:"events"`
+	Cursor string            `json:"cursor,omitempty"`
+}
+
+// FetchExperimentEvents retrieves events from an experiment
+func FetchExperimentEvents(experimentID string, req ExperimentFetchRequest) (*ExperimentFetchResponse, error) {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	config := braintrust.GetConfig()
+
+	httpReq, err := http.NewRequest("POST", fmt.Sprintf("%s/v1/experiment/%s/fetch", config.APIURL, experimentID), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+config.APIKey)
+
+	client := &http.Client{}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var result ExperimentFetchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// ExperimentEvents fetches the events of an experiment from the Braintrust API with
+// pagination. Attachments logged in them can be found with attachment.References and
+// read back with attachment.Reference.Open.
+type ExperimentEvents struct {
+	ExperimentID string
+	events       []json.RawMessage
+	index        int
+	cursor       string
+	exhausted    bool
+}
+
+// NewExperimentEvents creates an ExperimentEvents that fetches the events of the given
+// experiment ID
+func NewExperimentEvents(experimentID string) *ExperimentEvents {
+	return &ExperimentEvents{ExperimentID: experimentID}
+}
+
+// Next returns the next ExperimentEvent, fetching more data as needed. It returns
+// io.EOF after the last event.
+func (e *ExperimentEvents) Next() (ExperimentEvent, error) {
+	var event ExperimentEvent
+	err := e.NextAs(&event)
+	return event, err
+}
+
+// NextAs unmarshals the next event into the given struct type
+func (e *ExperimentEvents) NextAs(target interface{}) error {
+	if e.index >= len(e.events) && !e.exhausted {
+		resp, err := FetchExperimentEvents(e.ExperimentID, ExperimentFetchRequest{Limit: 100, Cursor: e.cursor})
+		if err != nil {
+			return fmt.Errorf("failed to fetch experiment events: %w", err)
+		}
+		e.events = resp.Events
+		e.index = 0
+		e.cursor = resp.Cursor
+		// If no cursor is returned or no events, we've exhausted the experiment
+		if resp.Cursor == "" || len(resp.Events) == 0 {
+			e.exhausted = true
+		}
+	}
+
+	if e.index >= len(e.events) {
+		return io.EOF
+	}
+
+	if err := json.Unmarshal(e.events[e.index], target); err != nil {
+		return fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+	e.index++
+	return nil
+}
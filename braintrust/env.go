@@ -1,13 +1,18 @@
 package braintrust
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
 
 	"go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal"
 )
 
 var (
@@ -15,6 +20,14 @@ var (
 	cachedConfig  *Config
 )
 
+func init() {
+	internal.ClearConfigCache = func() {
+		configCacheMu.Lock()
+		defer configCacheMu.Unlock()
+		cachedConfig = nil
+	}
+}
+
 // Option is used to configure the Braintrust GetConfig function.
 type Option func(*Config)
 
@@ -88,6 +101,183 @@ func WithBlockingLogin(enabled bool) Option {
 	}
 }
 
+// RedactDetector is a built-in detector of sensitive data that is redacted from spans.
+type RedactDetector string
+
+const (
+	// RedactEmail redacts email addresses.
+	RedactEmail RedactDetector = "email"
+	// RedactPhone redacts phone numbers.
+	RedactPhone RedactDetector = "phone"
+	// RedactCreditCard redacts credit card numbers.
+	RedactCreditCard RedactDetector = "credit_card"
+	// RedactBearerToken redacts bearer tokens and API keys like "sk-...".
+	RedactBearerToken RedactDetector = "bearer_token"
+)
+
+// RedactRule replaces the matches of a regular expression in the strings logged on spans.
+type RedactRule struct {
+	Pattern     string // a regular expression, in the syntax of the regexp package
+	Replacement string // may refer to submatches like "$1" (default: "[REDACTED]")
+}
+
+// RedactFunc is called with the key of each redacted span attribute, like
+// "braintrust.input_json", and its decoded JSON value, after the other redaction
+// rules are applied. It returns the value to log. It's also called with the string
+// attributes of span events, like "exception.message", and "status.description".
+type RedactFunc func(key string, value any) any
+
+// WithRedactDetectors redacts the data found by built-in detectors from the input,
+// output, expected and metadata of spans before they are exported.
+// Environment variable: BRAINTRUST_REDACT_DETECTORS, a comma-separated list like
+// "email,phone", or "all"
+func WithRedactDetectors(detectors ...RedactDetector) Option {
+	return func(c *Config) {
+		c.RedactDetectors = detectors
+	}
+}
+
+// WithRedactRules redacts the matches of regular expressions from the input, output,
+// expected and metadata of spans before they are exported.
+// Environment variable: BRAINTRUST_REDACT_PATTERNS, a regular expression or a JSON
+// array of them
+func WithRedactRules(rules ...RedactRule) Option {
+	return func(c *Config) {
+		c.RedactRules = rules
+	}
+}
+
+// WithRedactPaths masks whole values in the input, output, expected and metadata of
+// spans at JSONPaths like "$.password", "$.messages[*].content" or "$..api_key".
+// Environment variable: BRAINTRUST_REDACT_PATHS, a comma-separated list of paths
+func WithRedactPaths(paths ...string) Option {
+	return func(c *Config) {
+		c.RedactPaths = paths
+	}
+}
+
+// WithRedactFunc sets a function that redacts the input, output, expected and
+// metadata of spans before they are exported.
+func WithRedactFunc(fn RedactFunc) Option {
+	return func(c *Config) {
+		c.RedactFunc = fn
+	}
+}
+
+// LargeAttributeMode is how span attributes larger than the max attribute size are handled.
+type LargeAttributeMode string
+
+const (
+	// LargeAttributeTruncate truncates large attributes, and replaces inline data URLs
+	// in them with a marker. It is the default.
+	LargeAttributeTruncate LargeAttributeMode = "truncate"
+	// LargeAttributeAttachment uploads large attributes as attachments and logs a
+	// reference to them instead. Inline data URLs, like the ones from
+	// attachment.Base64URL, are always uploaded as attachments.
+	LargeAttributeAttachment LargeAttributeMode = "attachment"
+)
+
+// WithMaxAttributeSize sets the max size in bytes of the input, output and expected
+// of spans. Larger values are handled as set by [WithLargeAttributeMode], so spans
+// don't exceed export size limits. 0 means no limit, which is the default.
+// Environment variable: BRAINTRUST_MAX_ATTRIBUTE_SIZE
+func WithMaxAttributeSize(size int) Option {
+	return func(c *Config) {
+		c.MaxAttributeSize = size
+	}
+}
+
+// WithLargeAttributeMode sets how attributes larger than the max attribute size are
+// handled (default: LargeAttributeTruncate).
+// Environment variable: BRAINTRUST_LARGE_ATTRIBUTE_MODE
+func WithLargeAttributeMode(mode LargeAttributeMode) Option {
+	return func(c *Config) {
+		c.LargeAttributeMode = mode
+	}
+}
+
+// WithExportQueueDir makes spans be written to a write-ahead log in dir before they are
+// exported, so they survive network outages and restarts, and are sent when
+// connectivity returns. Empty, the default, disables it. Its counters, like dropped
+// spans, are returned by trace.ExportQueueStats.
+// Environment variable: BRAINTRUST_EXPORT_QUEUE_DIR
+func WithExportQueueDir(dir string) Option {
+	return func(c *Config) {
+		c.ExportQueueDir = dir
+	}
+}
+
+// WithExportQueueMaxBytes sets the disk budget of the export queue. When it is full,
+// the oldest spans are dropped (default: 256MB).
+// Environment variable: BRAINTRUST_EXPORT_QUEUE_MAX_BYTES
+func WithExportQueueMaxBytes(n int64) Option {
+	return func(c *Config) {
+		c.ExportQueueMaxBytes = n
+	}
+}
+
+// WithStreamingEvents adds a "first_token" event to the spans of streaming LLM
+// responses, at the time their first output chunk was received. Streaming spans have
+// time_to_first_token and other latency metrics either way (default: false).
+// Environment variable: BRAINTRUST_STREAMING_EVENTS
+func WithStreamingEvents(enabled bool) Option {
+	return func(c *Config) {
+		c.StreamingEvents = enabled
+	}
+}
+
+// SpanRoute sends the spans it matches to a project or experiment, and optionally to
+// another org. A route matches a span if all of its conditions that are set match.
+// Spans inherit the route of their parent span, and spans with a parent set by
+// trace.SetParent aren't routed.
+type SpanRoute struct {
+	// SpanName matches the span name. It can be a pattern like "openai.*", in the
+	// syntax of path.Match.
+	SpanName string
+	// Scope matches the name of the span's instrumentation scope, e.g. the tracer name.
+	// It can be a pattern.
+	Scope string
+	// Attributes match attributes the span was started with. Values are compared as
+	// strings.
+	Attributes map[string]string
+	// ContextKey matches spans started with a context that has a value for this key.
+	// If ContextValue is set, the value must be equal to it.
+	ContextKey   any
+	ContextValue any
+	// Match is a custom condition.
+	Match func(ctx context.Context, span trace.ReadOnlySpan) bool
+
+	// Where matching spans go. Exactly one is required.
+	ProjectName  string
+	ProjectID    string
+	ExperimentID string
+
+	// APIKey sends matching spans with another API key, e.g. one for another org,
+	// through their own exporter. Their offloaded payloads are uploaded with it too.
+	APIKey string
+	// APIURL is the API URL used with APIKey (default: the config's API URL).
+	APIURL string
+	// OrgName is the org of APIKey, used in links. It is looked up if empty.
+	OrgName string
+	// Exporter sends matching spans to this exporter instead of the default one.
+	Exporter trace.SpanExporter
+}
+
+// WithSpanRoutes sets rules that send spans to other projects, experiments or orgs
+// than the default one. The first route that matches a span is used.
+//
+// Example:
+//
+//	braintrust.WithSpanRoutes(
+//		braintrust.SpanRoute{Attributes: map[string]string{"team": "search"}, ProjectName: "search"},
+//		braintrust.SpanRoute{Scope: "billing/*", ProjectName: "billing", APIKey: billingKey},
+//	)
+func WithSpanRoutes(routes ...SpanRoute) Option {
+	return func(c *Config) {
+		c.SpanRoutes = routes
+	}
+}
+
 // Config holds the configuration for the Braintrust SDK
 type Config struct {
 	APIKey                string
@@ -98,9 +288,27 @@ type Config struct {
 	EnableTraceConsoleLog bool
 	FilterAISpans         bool
 	SpanFilterFuncs       []SpanFilterFunc
+	SpanRoutes            []SpanRoute
 	OrgName               string
 	BlockingLogin         bool
 
+	// Redaction of sensitive data from spans
+	RedactDetectors []RedactDetector
+	RedactRules     []RedactRule
+	RedactPaths     []string
+	RedactFunc      RedactFunc
+
+	// Handling of attributes that are too large to export
+	MaxAttributeSize   int
+	LargeAttributeMode LargeAttributeMode
+
+	// Persistent queue of spans waiting to be exported
+	ExportQueueDir      string
+	ExportQueueMaxBytes int64
+
+	// Span events marking the first chunk of streaming responses
+	StreamingEvents bool
+
 	// SpanProcessor allows overriding the default SpanProcessor (primarily for testing)
 	SpanProcessor trace.SpanProcessor
 }
@@ -129,6 +337,15 @@ func (c Config) String() string {
   EnableTraceConsoleLog: %t
   FilterAISpans: %t
   SpanFilterFuncs: %d
+  SpanRoutes: %d
+  RedactDetectors: %v
+  RedactRules: %d
+  RedactPaths: %v
+  MaxAttributeSize: %d
+  LargeAttributeMode: %s
+  ExportQueueDir: %s
+  ExportQueueMaxBytes: %d
+  StreamingEvents: %t
   SpanProcessor: %s`,
 		apiKey,
 		c.APIURL,
@@ -139,6 +356,15 @@ func (c Config) String() string {
 		c.EnableTraceConsoleLog,
 		c.FilterAISpans,
 		len(c.SpanFilterFuncs),
+		len(c.SpanRoutes),
+		c.RedactDetectors,
+		len(c.RedactRules),
+		c.RedactPaths,
+		c.MaxAttributeSize,
+		c.LargeAttributeMode,
+		c.ExportQueueDir,
+		c.ExportQueueMaxBytes,
+		c.StreamingEvents,
 		hasSpanProcessor,
 	)
 }
@@ -157,6 +383,14 @@ func (c Config) String() string {
 //   - `BRAINTRUST_DEFAULT_PROJECT`: Default project name (default: "default-go-project")
 //   - `BRAINTRUST_ENABLE_TRACE_CONSOLE_LOG`: Enable console logging for traces (default: false)
 //   - `BRAINTRUST_OTEL_FILTER_AI_SPANS`: Filter to keep only AI-related spans (default: false)
+//   - `BRAINTRUST_REDACT_DETECTORS`: Built-in detectors of data to redact from spans, like "email,phone" or "all"
+//   - `BRAINTRUST_REDACT_PATTERNS`: A regular expression, or a JSON array of them, to redact from spans
+//   - `BRAINTRUST_REDACT_PATHS`: Comma-separated JSONPaths of values to mask in spans
+//   - `BRAINTRUST_MAX_ATTRIBUTE_SIZE`: Max size in bytes of span inputs, outputs and expected values (default: no limit)
+//   - `BRAINTRUST_LARGE_ATTRIBUTE_MODE`: How larger values are handled, "truncate" or "attachment" (default: "truncate")
+//   - `BRAINTRUST_EXPORT_QUEUE_DIR`: Directory of a write-ahead log that spans are queued in before export (default: disabled)
+//   - `BRAINTRUST_EXPORT_QUEUE_MAX_BYTES`: Disk budget of the export queue (default: 256MB)
+//   - `BRAINTRUST_STREAMING_EVENTS`: Add a "first_token" event to streaming LLM spans (default: false)
 //   - `BRAINTRUST_DEBUG`: Enable debug logging (default: false)
 func GetConfig(opts ...Option) Config {
 	// Check cache first
@@ -179,7 +413,7 @@ func GetConfig(opts ...Option) Config {
 	config.APIKey = strings.TrimSpace(config.APIKey)
 
 	// Cache this config (only if not running tests)
-	if !testing.Testing() {
+	if !testing.Testing() || internal.CacheConfig.Load() {
 		configCacheMu.Lock()
 		if cachedConfig == nil {
 			cachedConfig = &config
@@ -200,7 +434,64 @@ func buildConfigFromEnv() Config {
 		EnableTraceConsoleLog: getEnvBool("BRAINTRUST_ENABLE_TRACE_CONSOLE_LOG", false),
 		FilterAISpans:         getEnvBool("BRAINTRUST_OTEL_FILTER_AI_SPANS", false),
 		OrgName:               getEnvString("BRAINTRUST_ORG_NAME", ""),
+		RedactDetectors:       getEnvRedactDetectors("BRAINTRUST_REDACT_DETECTORS"),
+		RedactRules:           getEnvRedactRules("BRAINTRUST_REDACT_PATTERNS"),
+		RedactPaths:           getEnvList("BRAINTRUST_REDACT_PATHS"),
+		MaxAttributeSize:      getEnvInt("BRAINTRUST_MAX_ATTRIBUTE_SIZE", 0),
+		LargeAttributeMode:    LargeAttributeMode(getEnvString("BRAINTRUST_LARGE_ATTRIBUTE_MODE", string(LargeAttributeTruncate))),
+		ExportQueueDir:        getEnvString("BRAINTRUST_EXPORT_QUEUE_DIR", ""),
+		ExportQueueMaxBytes:   int64(getEnvInt("BRAINTRUST_EXPORT_QUEUE_MAX_BYTES", 0)),
+		StreamingEvents:       getEnvBool("BRAINTRUST_STREAMING_EVENTS", false),
+	}
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if i, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			return i
+		}
+	}
+	return defaultValue
+}
+
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getEnvRedactDetectors(key string) []RedactDetector {
+	var detectors []RedactDetector
+	for _, name := range getEnvList(key) {
+		if strings.ToLower(name) == "all" {
+			return []RedactDetector{RedactEmail, RedactPhone, RedactCreditCard, RedactBearerToken}
+		}
+		detectors = append(detectors, RedactDetector(strings.ToLower(name)))
+	}
+	return detectors
+}
+
+func getEnvRedactRules(key string) []RedactRule {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+	// a single pattern, or a JSON array of them
+	patterns := []string{value}
+	if strings.HasPrefix(value, "[") {
+		if err := json.Unmarshal([]byte(value), &patterns); err != nil {
+			patterns = []string{value}
+		}
+	}
+	rules := make([]RedactRule, len(patterns))
+	for i, pattern := range patterns {
+		rules[i] = RedactRule{Pattern: pattern}
 	}
+	return rules
 }
 
 func getEnvString(key, defaultValue string) string {
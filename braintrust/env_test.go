@@ -86,3 +86,62 @@ func TestGetEnvBool(t *testing.T) {
 		})
 	}
 }
+
+func TestGetConfig_RedactEnvironmentValues(t *testing.T) {
+	t.Setenv("BRAINTRUST_REDACT_DETECTORS", "Email, phone")
+	t.Setenv("BRAINTRUST_REDACT_PATTERNS", `secret-\d+`)
+	t.Setenv("BRAINTRUST_REDACT_PATHS", "$.password, $..api_key")
+
+	config := GetConfig()
+	assert.Equal(t, []RedactDetector{RedactEmail, RedactPhone}, config.RedactDetectors)
+	assert.Equal(t, []RedactRule{{Pattern: `secret-\d+`}}, config.RedactRules)
+	assert.Equal(t, []string{"$.password", "$..api_key"}, config.RedactPaths)
+
+	t.Setenv("BRAINTRUST_REDACT_DETECTORS", "all")
+	t.Setenv("BRAINTRUST_REDACT_PATTERNS", `["a,b", "c"]`)
+	config = GetConfig()
+	assert.Len(t, config.RedactDetectors, 4)
+	assert.Equal(t, []RedactRule{{Pattern: "a,b"}, {Pattern: "c"}}, config.RedactRules)
+}
+
+func TestGetConfig_LargeAttributeEnvironmentValues(t *testing.T) {
+	t.Setenv("BRAINTRUST_MAX_ATTRIBUTE_SIZE", "")
+	t.Setenv("BRAINTRUST_LARGE_ATTRIBUTE_MODE", "")
+	config := GetConfig()
+	assert.Equal(t, 0, config.MaxAttributeSize)
+	assert.Equal(t, LargeAttributeTruncate, config.LargeAttributeMode)
+
+	t.Setenv("BRAINTRUST_MAX_ATTRIBUTE_SIZE", "1048576")
+	t.Setenv("BRAINTRUST_LARGE_ATTRIBUTE_MODE", "attachment")
+	config = GetConfig()
+	assert.Equal(t, 1048576, config.MaxAttributeSize)
+	assert.Equal(t, LargeAttributeAttachment, config.LargeAttributeMode)
+}
+
+func TestGetConfig_ExportQueue(t *testing.T) {
+	t.Setenv("BRAINTRUST_EXPORT_QUEUE_DIR", "")
+	t.Setenv("BRAINTRUST_EXPORT_QUEUE_MAX_BYTES", "")
+	config := GetConfig()
+	assert.Empty(t, config.ExportQueueDir)
+	assert.Equal(t, int64(0), config.ExportQueueMaxBytes)
+
+	t.Setenv("BRAINTRUST_EXPORT_QUEUE_DIR", "/var/lib/spans")
+	t.Setenv("BRAINTRUST_EXPORT_QUEUE_MAX_BYTES", "1048576")
+	config = GetConfig()
+	assert.Equal(t, "/var/lib/spans", config.ExportQueueDir)
+	assert.Equal(t, int64(1048576), config.ExportQueueMaxBytes)
+
+	config = GetConfig(WithExportQueueDir("/tmp/spans"), WithExportQueueMaxBytes(42))
+	assert.Equal(t, "/tmp/spans", config.ExportQueueDir)
+	assert.Equal(t, int64(42), config.ExportQueueMaxBytes)
+}
+
+func TestGetConfig_StreamingEvents(t *testing.T) {
+	t.Setenv("BRAINTRUST_STREAMING_EVENTS", "")
+	assert.False(t, GetConfig().StreamingEvents)
+
+	t.Setenv("BRAINTRUST_STREAMING_EVENTS", "true")
+	assert.True(t, GetConfig().StreamingEvents)
+
+	assert.False(t, GetConfig(WithStreamingEvents(false)).StreamingEvents)
+}
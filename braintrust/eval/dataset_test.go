@@ -1,7 +1,13 @@
 package eval
 
 import (
+	"encoding/json"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/attachment"
 )
 
 func TestGetDatasetByID(t *testing.T) {
@@ -80,3 +86,28 @@ func TestDatasetInfo(t *testing.T) {
 		t.Errorf("Expected Name 'test-dataset', got %s", info.Name)
 	}
 }
+
+func TestCase_Attachments(t *testing.T) {
+	image := attachment.Reference{Type: attachment.ReferenceType, Filename: "a.png", ContentType: attachment.ImagePNG, Key: "k1"}
+	doc := attachment.Reference{Type: attachment.ReferenceType, Filename: "b.pdf", ContentType: attachment.PDF, Key: "k2"}
+
+	// a dataset row, decoded into a case like the dataset iterator does
+	row, err := json.Marshal(map[string]any{
+		"input":    map[string]any{"question": "what is it?", "image": image},
+		"expected": map[string]any{"source": doc},
+	})
+	require.NoError(t, err)
+	var event struct {
+		Input    map[string]any `json:"input"`
+		Expected struct {
+			Source attachment.Reference `json:"source"`
+		} `json:"expected"`
+	}
+	require.NoError(t, json.Unmarshal(row, &event))
+	c := Case[map[string]any, struct {
+		Source attachment.Reference `json:"source"`
+	}]{Input: event.Input, Expected: event.Expected}
+
+	assert.Equal(t, []attachment.Reference{image, doc}, c.Attachments())
+	assert.Empty(t, Case[string, string]{Input: "hi"}.Attachments())
+}
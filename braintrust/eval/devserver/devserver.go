@@ -0,0 +1,453 @@
+// Package devserver exposes evals over HTTP so they can be run from the Braintrust
+// UI. The playground lists the registered evals and their parameters, and runs them
+// with its own parameters and data. Each run creates an experiment and logs to it
+// through the usual span pipeline, so tracing must be set up as for [eval.Run].
+//
+// Example:
+//
+//	server := devserver.New(devserver.Opts{})
+//	err := server.Register(&devserver.Evaluator[string, string]{
+//	    Name:    "greeter",
+//	    Project: "my-project",
+//	    Task: func(ctx context.Context, input string) (string, error) {
+//	        var greeting string
+//	        _ = devserver.GetParameters(ctx).Decode("greeting", &greeting)
+//	        return greeting + ", " + input, nil
+//	    },
+//	    Scorers: scorers,
+//	    Cases:   cases,
+//	    Parameters: map[string]devserver.Parameter{
+//	        "greeting": {Type: devserver.ParameterData, Default: "Hello"},
+//	    },
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	log.Fatal(server.ListenAndServe(":8300"))
+//
+// Requests must carry a Braintrust API key in the x-bt-auth-token or Authorization
+// header, of a user or service account of the server's org. The key is checked against
+// the Braintrust API, but runs log with the credentials tracing was set up with.
+package devserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/auth"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/log"
+)
+
+// DefaultAddr is the address the Braintrust UI expects a dev server on.
+const DefaultAddr = "localhost:8300"
+
+// defaultMaxRequestBytes is the default max size of request bodies.
+const defaultMaxRequestBytes = 16 << 20
+
+// errBadRequest marks errors caused by an invalid run request.
+var errBadRequest = errors.New("bad request")
+
+var defaultAllowedOrigins = []string{
+	"https://www.braintrust.dev",
+	"https://www.braintrustdata.com",
+	"https://*.preview.braintrust.dev",
+}
+
+var allowedHeaders = strings.Join([]string{
+	"Content-Type",
+	"Authorization",
+	"X-Amz-Date",
+	"X-Api-Key",
+	"X-Amz-Security-Token",
+	"x-bt-auth-token",
+	"x-bt-parent",
+	"x-bt-org-name",
+	"x-bt-stream-fmt",
+	"x-bt-use-cache",
+	"x-bt-use-gateway",
+	"x-stainless-os",
+	"x-stainless-lang",
+	"x-stainless-package-version",
+	"x-stainless-runtime",
+	"x-stainless-runtime-version",
+	"x-stainless-arch",
+}, ", ")
+
+// Opts configures a [Server].
+type Opts struct {
+	// OrgName restricts the server to requests from this org. It defaults to the org
+	// of the global Braintrust config, or without one, the org its API key logs in to.
+	OrgName string
+
+	// MaxRequestBytes is the max size of request bodies (default: 16MB).
+	MaxRequestBytes int64
+
+	// AllowedOrigins are extra origins allowed to call the server, on top of the
+	// Braintrust app. Origins may contain a "*" wildcard, e.g. "https://*.example.com".
+	AllowedOrigins []string
+
+	// Authenticate checks a request's API key and org name. It defaults to logging
+	// in to Braintrust with the key.
+	Authenticate func(ctx context.Context, apiKey, orgName string) error
+}
+
+// Server serves registered evals to the Braintrust UI. It implements [http.Handler],
+// so it can be mounted on an existing mux or tested with httptest.
+type Server struct {
+	opts    Opts
+	origins []string
+
+	orgMu   sync.Mutex
+	orgName string // the org requests must be from, once it is known
+
+	mu    sync.RWMutex
+	evals map[string]Definition
+}
+
+// New creates a server with no evals registered.
+func New(opts Opts) *Server {
+	config := braintrust.GetConfig()
+	if opts.Authenticate == nil {
+		appURL := config.AppURL
+		opts.Authenticate = func(_ context.Context, apiKey, orgName string) error {
+			return login(appURL, apiKey, orgName)
+		}
+	}
+	if opts.MaxRequestBytes <= 0 {
+		opts.MaxRequestBytes = defaultMaxRequestBytes
+	}
+	if opts.OrgName == "" {
+		opts.OrgName = config.OrgName
+	}
+	origins := append([]string{}, defaultAllowedOrigins...)
+	if appURL := config.AppURL; appURL != "" {
+		origins = append(origins, strings.TrimSuffix(appURL, "/"))
+	}
+	origins = append(origins, opts.AllowedOrigins...)
+
+	return &Server{
+		opts:    opts,
+		origins: origins,
+		orgName: opts.OrgName,
+		evals:   map[string]Definition{},
+	}
+}
+
+// Register adds evals to the server. It returns an error if an eval is invalid or
+// its name is already registered.
+func (s *Server) Register(defs ...Definition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, def := range defs {
+		if err := def.validate(); err != nil {
+			return err
+		}
+		if _, ok := s.evals[def.evalName()]; ok {
+			return fmt.Errorf("evaluator %q is already registered", def.evalName())
+		}
+		s.evals[def.evalName()] = def
+	}
+	return nil
+}
+
+// ListenAndServe serves the evals on addr, or [DefaultAddr] if addr is empty.
+func (s *Server) ListenAndServe(addr string) error {
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	log.Debugf("devserver: listening on %s", addr)
+	server := &http.Server{Addr: addr, Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	return server.ListenAndServe()
+}
+
+// ServeHTTP implements [http.Handler].
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.setCORSHeaders(w, r)
+	if r.Method == http.MethodOptions {
+		if r.Header.Get("Access-Control-Request-Private-Network") == "true" {
+			w.Header().Set("Access-Control-Allow-Private-Network", "true")
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.opts.MaxRequestBytes)
+
+	switch {
+	case r.URL.Path == "/" && r.Method == http.MethodGet:
+		_, _ = w.Write([]byte("Hello, world!"))
+	case r.URL.Path == "/list" && (r.Method == http.MethodGet || r.Method == http.MethodPost):
+		s.authenticated(s.handleList)(w, r)
+	case r.URL.Path == "/eval" && r.Method == http.MethodPost:
+		s.authenticated(s.handleEval)(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) setCORSHeaders(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" || !s.allowedOrigin(origin) {
+		return
+	}
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Set("Access-Control-Allow-Credentials", "true")
+	h.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	h.Set("Access-Control-Allow-Headers", allowedHeaders)
+	h.Set("Access-Control-Expose-Headers", "x-bt-cursor, x-bt-found-existing-experiment, x-bt-span-id, x-bt-span-export")
+	h.Set("Access-Control-Max-Age", "86400")
+	h.Add("Vary", "Origin")
+}
+
+func (s *Server) allowedOrigin(origin string) bool {
+	for _, allowed := range s.origins {
+		if allowed == origin {
+			return true
+		}
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok &&
+			len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticated rejects requests without a valid API key of the server's org.
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKey := r.Header.Get("x-bt-auth-token")
+		if apiKey == "" {
+			apiKey = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if apiKey == "" {
+			http.Error(w, "missing API key", http.StatusUnauthorized)
+			return
+		}
+
+		orgName, err := s.org()
+		if err != nil {
+			log.Warnf("devserver: failed to find the org of the server: %v", err)
+			http.Error(w, "failed to find the org of the server", http.StatusInternalServerError)
+			return
+		}
+		if requested := r.Header.Get("x-bt-org-name"); requested != "" && requested != orgName {
+			http.Error(w, fmt.Sprintf("this server only accepts requests for org %q", orgName), http.StatusForbidden)
+			return
+		}
+
+		if err := s.opts.Authenticate(r.Context(), apiKey, orgName); err != nil {
+			log.Debugf("devserver: authentication failed: %v", err)
+			http.Error(w, "invalid API key", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// org returns the org requests must be from. Without an org name in the options or
+// the global config, it's the org the global config's API key logs in to.
+func (s *Server) org() (string, error) {
+	s.orgMu.Lock()
+	defer s.orgMu.Unlock()
+	if s.orgName != "" {
+		return s.orgName, nil
+	}
+	result, err := braintrust.Login()
+	if err != nil {
+		return "", err
+	}
+	s.orgName = result.OrgName
+	return s.orgName, nil
+}
+
+// login checks a caller's API key by logging in to Braintrust with it. It doesn't use
+// the global config, whose API key is the server's. Successful logins are cached.
+func login(appURL, apiKey, orgName string) error {
+	if apiKey == auth.TestAPIKey {
+		// it logs in to any org without checking anything
+		return errors.New("the test API key isn't accepted")
+	}
+	_, err := auth.Login(auth.Options{APIKey: apiKey, AppURL: appURL, OrgName: orgName})
+	return err
+}
+
+func (s *Server) handleList(w http.ResponseWriter, _ *http.Request) {
+	s.mu.RLock()
+	list := make(map[string]evalDescription, len(s.evals))
+	for name, def := range s.evals {
+		list[name] = def.describe()
+	}
+	s.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleEval(w http.ResponseWriter, r *http.Request) {
+	var req runRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), status)
+		return
+	}
+
+	s.mu.RLock()
+	def, ok := s.evals[req.Name]
+	s.mu.RUnlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("evaluator %q not found", req.Name), http.StatusNotFound)
+		return
+	}
+
+	if !req.Stream {
+		summary, err := def.run(r.Context(), &req, func(progressEvent) {})
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		writeJSON(w, http.StatusOK, summary)
+		return
+	}
+
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sse.send("start", map[string]any{"name": req.Name})
+	summary, err := def.run(r.Context(), &req, func(e progressEvent) {
+		sse.send("progress", e)
+	})
+	if err != nil {
+		sse.send("error", err.Error())
+	} else {
+		sse.send("summary", summary)
+	}
+	sse.send("done", nil)
+}
+
+func errorStatus(err error) int {
+	if errors.Is(err, errBadRequest) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warnf("devserver: failed to write response: %v", err)
+	}
+}
+
+// sseWriter writes server-sent events. It is safe for concurrent use, because
+// parallel evals report progress from several goroutines.
+type sseWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming is not supported")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &sseWriter{w: w, flusher: flusher}, nil
+}
+
+func (s *sseWriter) send(event string, data any) {
+	payload := ""
+	if data != nil {
+		payload = mustJSON(data)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		log.Debugf("devserver: failed to write %s event: %v", event, err)
+		return
+	}
+	s.flusher.Flush()
+}
+
+// runRequest is the body of a request to run an eval.
+type runRequest struct {
+	Name           string         `json:"name"`
+	Parameters     map[string]any `json:"parameters"`
+	Data           *runData       `json:"data"`
+	ExperimentName string         `json:"experiment_name"`
+	ProjectID      string         `json:"project_id"`
+	Stream         bool           `json:"stream"`
+}
+
+// runData is the data to run an eval on: inline rows, a dataset ID, or a dataset
+// name in a project.
+type runData struct {
+	Data        []json.RawMessage `json:"data"`
+	DatasetID   string            `json:"dataset_id"`
+	ProjectName string            `json:"project_name"`
+	DatasetName string            `json:"dataset_name"`
+}
+
+// progressEvent reports the output of one case of a run.
+type progressEvent struct {
+	ID         string `json:"id"`
+	ObjectType string `json:"object_type"`
+	Format     string `json:"format"`
+	OutputType string `json:"output_type"`
+	Name       string `json:"name"`
+	Event      string `json:"event"`
+	Data       string `json:"data"`
+}
+
+// Summary describes a finished run.
+type Summary struct {
+	ProjectName    string                  `json:"projectName,omitempty"`
+	ProjectID      string                  `json:"projectId,omitempty"`
+	ExperimentID   string                  `json:"experimentId"`
+	ExperimentName string                  `json:"experimentName"`
+	ExperimentURL  string                  `json:"experimentUrl,omitempty"`
+	Scores         map[string]ScoreSummary `json:"scores"`
+	// Error joins the errors from the run's cases, if any failed.
+	Error string `json:"error,omitempty"`
+}
+
+// ScoreSummary is the average of a score across a run.
+type ScoreSummary struct {
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+type evalDescription struct {
+	Parameters map[string]parameterDescription `json:"parameters"`
+	Scores     []scoreDescription              `json:"scores"`
+}
+
+type parameterDescription struct {
+	Type        ParameterType  `json:"type"`
+	Description string         `json:"description,omitempty"`
+	Default     any            `json:"default,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+}
+
+type scoreDescription struct {
+	Name string `json:"name"`
+}
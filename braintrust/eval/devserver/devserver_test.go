@@ -0,0 +1,376 @@
+package devserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/eval"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/auth"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/oteltest"
+)
+
+const (
+	testAPIKey  = "devserver-test-key"
+	otherOrgKey = "devserver-other-org-key"
+)
+
+// newFakeAPI returns a fake Braintrust API that accepts testAPIKey and registers
+// projects and experiments. otherOrgKey logs in to another org.
+func newFakeAPI(t *testing.T) {
+	t.Helper()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/apikey/login" && r.Header.Get("Authorization") == "Bearer "+otherOrgKey {
+			_, _ = w.Write([]byte(`{"org_info": [{"id": "org-2", "name": "other-org"}]}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+testAPIKey {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/api/apikey/login":
+			_, _ = w.Write([]byte(`{"org_info": [{"id": "org-1", "name": "test-org"}]}`))
+		case "/v1/project":
+			_, _ = fmt.Fprintf(w, `{"id": "proj-1", "name": %q}`, body["name"])
+		case "/v1/experiment":
+			_, _ = fmt.Fprintf(w, `{"id": "exp-1", "name": %q, "project_id": %q}`, body["name"], body["project_id"])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(api.Close)
+	t.Setenv("BRAINTRUST_API_KEY", testAPIKey)
+	t.Setenv("BRAINTRUST_API_URL", api.URL)
+	t.Setenv("BRAINTRUST_APP_URL", api.URL)
+}
+
+func newGreeter() *Evaluator[string, string] {
+	return &Evaluator[string, string]{
+		Name:    "greeter",
+		Project: "test-project",
+		Task: func(ctx context.Context, input string) (string, error) {
+			if input == "" {
+				return "", fmt.Errorf("no name")
+			}
+			var greeting string
+			if err := GetParameters(ctx).Decode("greeting", &greeting); err != nil {
+				return "", err
+			}
+			return greeting + ", " + input, nil
+		},
+		Scorers: []eval.Scorer[string, string]{
+			eval.NewScorer("exact", func(_ context.Context, _ string, expected, result string, _ eval.Metadata) (eval.Scores, error) {
+				if expected == result {
+					return eval.S(1), nil
+				}
+				return eval.S(0), nil
+			}),
+		},
+		Cases: []eval.Case[string, string]{{Input: "World", Expected: "Hello, World"}},
+		Parameters: map[string]Parameter{
+			"greeting": {Type: ParameterData, Description: "How to greet", Default: "Hello"},
+		},
+	}
+}
+
+func newTestServer(t *testing.T, defs ...Definition) *httptest.Server {
+	t.Helper()
+	s := New(Opts{})
+	require.NoError(t, s.Register(defs...))
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func do(t *testing.T, method, url, apiKey string, body any) *http.Response {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		require.NoError(t, err)
+		r = strings.NewReader(string(b))
+	}
+	req, err := http.NewRequest(method, url, r)
+	require.NoError(t, err)
+	if apiKey != "" {
+		req.Header.Set("x-bt-auth-token", apiKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+type sseEvent struct {
+	event string
+	data  string
+}
+
+func readEvents(t *testing.T, resp *http.Response) []sseEvent {
+	t.Helper()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	var events []sseEvent
+	for _, chunk := range strings.Split(strings.TrimSpace(string(body)), "\n\n") {
+		var e sseEvent
+		for _, line := range strings.Split(chunk, "\n") {
+			if v, ok := strings.CutPrefix(line, "event: "); ok {
+				e.event = v
+			} else if v, ok := strings.CutPrefix(line, "data: "); ok {
+				e.data = v
+			}
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestServer_List(t *testing.T) {
+	newFakeAPI(t)
+	server := newTestServer(t, newGreeter())
+
+	resp := do(t, http.MethodGet, server.URL+"/list", testAPIKey, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var list map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	assert.Equal(t, map[string]any{
+		"greeter": map[string]any{
+			"parameters": map[string]any{
+				"greeting": map[string]any{
+					"type":        "data",
+					"description": "How to greet",
+					"default":     "Hello",
+					"schema":      map[string]any{"type": "string"},
+				},
+			},
+			"scores": []any{map[string]any{"name": "exact"}},
+		},
+	}, list)
+}
+
+func TestServer_Auth(t *testing.T) {
+	newFakeAPI(t)
+	server := newTestServer(t, newGreeter())
+
+	resp := do(t, http.MethodGet, server.URL+"/list", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = do(t, http.MethodGet, server.URL+"/list", "wrong-key", nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// keys of other orgs are rejected, even without an org in the config
+	resp = do(t, http.MethodPost, server.URL+"/eval", otherOrgKey, map[string]any{"name": "greeter"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/list", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testAPIKey)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// servers restricted to an org reject other orgs
+	s := New(Opts{OrgName: "test-org"})
+	orgServer := httptest.NewServer(s)
+	defer orgServer.Close()
+	req, err = http.NewRequest(http.MethodGet, orgServer.URL+"/list", nil)
+	require.NoError(t, err)
+	req.Header.Set("x-bt-auth-token", testAPIKey)
+	req.Header.Set("x-bt-org-name", "other-org")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestServer_AuthWithCachedConfig(t *testing.T) {
+	newFakeAPI(t)
+	// programs cache the config, with the server's API key
+	internal.PrimeConfigCache(t)
+	require.Equal(t, testAPIKey, braintrust.GetConfig().APIKey)
+	server := newTestServer(t, newGreeter())
+
+	for _, key := range []string{"wrong-key", otherOrgKey, auth.TestAPIKey} {
+		resp := do(t, http.MethodGet, server.URL+"/list", key, nil)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, key)
+	}
+	resp := do(t, http.MethodGet, server.URL+"/list", testAPIKey, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestServer_CORS(t *testing.T) {
+	s := New(Opts{AllowedOrigins: []string{"http://localhost:*"}})
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	preflight := func(origin string) *http.Response {
+		req, err := http.NewRequest(http.MethodOptions, server.URL+"/eval", nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Private-Network", "true")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	for _, origin := range []string{"https://www.braintrust.dev", "https://pr-123.preview.braintrust.dev", "http://localhost:3000"} {
+		resp := preflight(origin)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Equal(t, origin, resp.Header.Get("Access-Control-Allow-Origin"), origin)
+		assert.Contains(t, resp.Header.Get("Access-Control-Allow-Headers"), "x-bt-auth-token")
+		assert.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Private-Network"))
+	}
+
+	resp := preflight("https://evil.example.com")
+	assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+}
+
+func TestServer_EvalStream(t *testing.T) {
+	newFakeAPI(t)
+	_, exporter := oteltest.Setup(t, braintrust.WithOrgName("test-org"))
+	server := newTestServer(t, newGreeter())
+
+	resp := do(t, http.MethodPost, server.URL+"/eval", testAPIKey, map[string]any{
+		"name":            "greeter",
+		"experiment_name": "remote-run",
+		"parameters":      map[string]any{"greeting": "Hi"},
+		"data": map[string]any{"data": []any{
+			map[string]any{"input": "World", "expected": "Hi, World"},
+			map[string]any{"input": "Go", "expected": "Hello, Go"},
+			map[string]any{"input": "", "expected": ""},
+		}},
+		"stream": true,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := readEvents(t, resp)
+	require.Len(t, events, 6)
+	assert.Equal(t, "start", events[0].event)
+	assert.Equal(t, "done", events[5].event)
+
+	var outputs []string
+	for _, e := range events[1:4] {
+		require.Equal(t, "progress", e.event)
+		var p progressEvent
+		require.NoError(t, json.Unmarshal([]byte(e.data), &p))
+		assert.Equal(t, "greeter", p.Name)
+		assert.Equal(t, "task", p.ObjectType)
+		assert.NotEmpty(t, p.ID)
+		outputs = append(outputs, p.Event+" "+p.Data)
+	}
+	assert.Equal(t, []string{`json_delta "Hi, World"`, `json_delta "Hi, Go"`, `error "no name"`}, outputs)
+
+	require.Equal(t, "summary", events[4].event)
+	var summary Summary
+	require.NoError(t, json.Unmarshal([]byte(events[4].data), &summary))
+	assert.Equal(t, "exp-1", summary.ExperimentID)
+	assert.Equal(t, "remote-run", summary.ExperimentName)
+	assert.Equal(t, map[string]ScoreSummary{"exact": {Name: "exact", Score: 0.5}}, summary.Scores)
+	assert.Contains(t, summary.Error, "no name")
+
+	spans := exporter.Flush()
+	require.NotEmpty(t, spans)
+	for _, span := range spans {
+		span.AssertAttrEquals("braintrust.parent", "experiment_id:exp-1")
+	}
+}
+
+func TestServer_Eval(t *testing.T) {
+	newFakeAPI(t)
+	_, exporter := oteltest.Setup(t, braintrust.WithOrgName("test-org"))
+	server := newTestServer(t, newGreeter())
+
+	// without data or parameters, the evaluator's defaults are used
+	resp := do(t, http.MethodPost, server.URL+"/eval", testAPIKey, map[string]any{"name": "greeter"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var summary Summary
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&summary))
+	assert.Equal(t, "greeter", summary.ExperimentName)
+	assert.Equal(t, map[string]ScoreSummary{"exact": {Name: "exact", Score: 1}}, summary.Scores)
+	assert.Empty(t, summary.Error)
+	exporter.Flush()
+
+	resp = do(t, http.MethodPost, server.URL+"/eval", testAPIKey, map[string]any{"name": "missing"})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = do(t, http.MethodPost, server.URL+"/eval", testAPIKey, map[string]any{
+		"name":       "greeter",
+		"parameters": map[string]any{"tone": "formal"},
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = do(t, http.MethodPost, server.URL+"/eval", testAPIKey, map[string]any{
+		"name": "greeter",
+		"data": map[string]any{"data": []any{map[string]any{"input": 42}}},
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestServer_MaxRequestBytes(t *testing.T) {
+	newFakeAPI(t)
+	s := New(Opts{MaxRequestBytes: 100})
+	require.NoError(t, s.Register(newGreeter()))
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	resp := do(t, http.MethodPost, server.URL+"/eval", testAPIKey, map[string]any{
+		"name": "greeter",
+		"data": map[string]any{"data": []any{map[string]any{"input": strings.Repeat("a", 100)}}},
+	})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestServer_Register(t *testing.T) {
+	s := New(Opts{})
+	require.NoError(t, s.Register(newGreeter()))
+	assert.ErrorContains(t, s.Register(newGreeter()), "already registered")
+
+	noTask := newGreeter()
+	noTask.Name, noTask.Task = "no-task", nil
+	assert.ErrorContains(t, s.Register(noTask), "Task is required")
+
+	badParam := newGreeter()
+	badParam.Name = "bad-param"
+	badParam.Parameters = map[string]Parameter{"x": {}}
+	assert.ErrorContains(t, s.Register(badParam), "type is required")
+}
+
+func TestResolveParameters(t *testing.T) {
+	defs := map[string]Parameter{
+		"greeting": {Type: ParameterData, Default: "Hello"},
+		"prompt":   {Type: ParameterPrompt},
+	}
+
+	params, err := resolveParameters(defs, map[string]any{"prompt": map[string]any{"model": "gpt-4o"}})
+	require.NoError(t, err)
+	assert.Equal(t, Parameters{"greeting": "Hello", "prompt": map[string]any{"model": "gpt-4o"}}, params)
+
+	var prompt struct{ Model string }
+	require.NoError(t, params.Decode("prompt", &prompt))
+	assert.Equal(t, "gpt-4o", prompt.Model)
+	assert.Error(t, params.Decode("missing", &prompt))
+
+	_, err = resolveParameters(defs, nil)
+	assert.ErrorContains(t, err, `parameter "prompt" is required`)
+
+	assert.Nil(t, GetParameters(context.Background()))
+}
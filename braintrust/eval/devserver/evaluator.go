@@ -0,0 +1,249 @@
+package devserver
+
+// this file adapts generic evals to the untyped requests the dev server handles.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/eval"
+)
+
+// Evaluator is an eval that can be run from the Braintrust UI. Unlike [eval.Opts], it
+// doesn't name an experiment or consume a [eval.Cases] iterator, because every run
+// creates a new experiment and can bring its own data.
+type Evaluator[I, R any] struct {
+	// Name identifies the eval in the UI. It must be unique within a server.
+	Name string
+
+	// Provide either Project name or Project ID. Runs can override the project.
+	Project   string
+	ProjectID string
+
+	// Required
+	Task    eval.Task[I, R]
+	Scorers []eval.Scorer[I, R]
+
+	// Cases or Dataset are used when a run doesn't provide its own data.
+	Cases   []eval.Case[I, R]
+	Dataset string
+
+	// Parameters the UI can set for each run. Tasks read them with [GetParameters].
+	Parameters map[string]Parameter
+
+	Parallelism int // Number of goroutines (default: 1)
+}
+
+// Definition is an eval that can be registered with a [Server]. It is implemented
+// by [*Evaluator].
+type Definition interface {
+	evalName() string
+	validate() error
+	describe() evalDescription
+	run(ctx context.Context, req *runRequest, progress func(progressEvent)) (*Summary, error)
+}
+
+var _ Definition = (*Evaluator[string, string])(nil)
+
+func (e *Evaluator[I, R]) evalName() string {
+	return e.Name
+}
+
+func (e *Evaluator[I, R]) validate() error {
+	if e.Name == "" {
+		return fmt.Errorf("evaluator name is required")
+	}
+	if e.Task == nil {
+		return fmt.Errorf("evaluator %q: Task is required", e.Name)
+	}
+	if len(e.Scorers) == 0 {
+		return fmt.Errorf("evaluator %q: at least one Scorer is required", e.Name)
+	}
+	for name, p := range e.Parameters {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("evaluator %q: parameter %q: %w", e.Name, name, err)
+		}
+	}
+	return nil
+}
+
+// describe returns the eval as it is listed to the UI.
+func (e *Evaluator[I, R]) describe() evalDescription {
+	params := make(map[string]parameterDescription, len(e.Parameters))
+	for name, p := range e.Parameters {
+		params[name] = p.describe()
+	}
+	scores := make([]scoreDescription, len(e.Scorers))
+	for i, s := range e.Scorers {
+		scores[i] = scoreDescription{Name: s.Name()}
+	}
+	return evalDescription{Parameters: params, Scores: scores}
+}
+
+func (e *Evaluator[I, R]) run(ctx context.Context, req *runRequest, progress func(progressEvent)) (*Summary, error) {
+	params, err := resolveParameters(e.Parameters, req.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	ctx = withParameters(ctx, params)
+
+	var totals scoreTotals
+	opts := eval.Opts[I, R]{
+		Project:     e.Project,
+		ProjectID:   e.ProjectID,
+		Experiment:  req.ExperimentName,
+		Parallelism: e.Parallelism,
+		Quiet:       true,
+		Task:        e.progressTask(progress),
+		Scorers:     make([]eval.Scorer[I, R], len(e.Scorers)),
+	}
+	for i, s := range e.Scorers {
+		opts.Scorers[i] = &totalingScorer[I, R]{Scorer: s, totals: &totals}
+	}
+	if opts.Experiment == "" {
+		opts.Experiment = e.Name
+	}
+	if req.ProjectID != "" {
+		opts.Project, opts.ProjectID = "", req.ProjectID
+	}
+	if err := e.resolveData(req.Data, &opts); err != nil {
+		return nil, err
+	}
+
+	result, err := eval.Run(ctx, opts)
+	if result == nil {
+		return nil, err
+	}
+
+	summary := &Summary{
+		ProjectName:    opts.Project,
+		ProjectID:      opts.ProjectID,
+		ExperimentID:   result.ID(),
+		ExperimentName: result.Name(),
+		Scores:         totals.averages(),
+	}
+	summary.ExperimentURL, _ = result.Permalink()
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	return summary, nil
+}
+
+// resolveData sets the source of the run's cases: the request's data if it has
+// any, and the evaluator's defaults otherwise.
+func (e *Evaluator[I, R]) resolveData(data *runData, opts *eval.Opts[I, R]) error {
+	switch {
+	case data != nil && data.Data != nil:
+		cases := make([]eval.Case[I, R], len(data.Data))
+		for i, raw := range data.Data {
+			var row struct {
+				Input    I             `json:"input"`
+				Expected R             `json:"expected"`
+				Metadata eval.Metadata `json:"metadata"`
+				Tags     []string      `json:"tags"`
+			}
+			if err := json.Unmarshal(raw, &row); err != nil {
+				return fmt.Errorf("%w: invalid data row %d: %w", errBadRequest, i, err)
+			}
+			cases[i] = eval.Case[I, R]{Input: row.Input, Expected: row.Expected, Metadata: row.Metadata, Tags: row.Tags}
+		}
+		opts.Cases = eval.NewCases(cases)
+	case data != nil && data.DatasetID != "":
+		opts.DatasetID = data.DatasetID
+	case data != nil && data.DatasetName != "":
+		cases, err := eval.GetDataset[I, R](data.ProjectName, data.DatasetName)
+		if err != nil {
+			return err
+		}
+		opts.Cases = cases
+	case e.Cases != nil:
+		opts.Cases = eval.NewCases(e.Cases)
+	case e.Dataset != "":
+		opts.Dataset = e.Dataset
+	default:
+		return fmt.Errorf("%w: evaluator %q has no default data, so the run must provide some", errBadRequest, e.Name)
+	}
+	return nil
+}
+
+// progressTask wraps the evaluator's task to report each result as it finishes.
+func (e *Evaluator[I, R]) progressTask(progress func(progressEvent)) eval.Task[I, R] {
+	return func(ctx context.Context, input I) (R, error) {
+		result, err := e.Task(ctx, input)
+
+		event := progressEvent{
+			ID:         oteltrace.SpanFromContext(ctx).SpanContext().SpanID().String(),
+			ObjectType: "task",
+			Format:     "code",
+			OutputType: "completion",
+			Name:       e.Name,
+		}
+		if err != nil {
+			event.Event, event.Data = "error", mustJSON(err.Error())
+		} else {
+			event.Event, event.Data = "json_delta", mustJSON(result)
+		}
+		progress(event)
+
+		return result, err
+	}
+}
+
+// totalingScorer wraps a scorer to total its scores for the run's summary.
+type totalingScorer[I, R any] struct {
+	eval.Scorer[I, R]
+	totals *scoreTotals
+}
+
+func (s *totalingScorer[I, R]) Run(ctx context.Context, input I, expected, result R, meta eval.Metadata) (eval.Scores, error) {
+	scores, err := s.Scorer.Run(ctx, input, expected, result, meta)
+	for _, score := range scores {
+		name := score.Name
+		if name == "" {
+			name = s.Name()
+		}
+		s.totals.add(name, score.Score)
+	}
+	return scores, err
+}
+
+// scoreTotals sums scores by name. It is safe for concurrent use.
+type scoreTotals struct {
+	mu     sync.Mutex
+	sums   map[string]float64
+	counts map[string]int
+}
+
+func (t *scoreTotals) add(name string, score float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sums == nil {
+		t.sums = map[string]float64{}
+		t.counts = map[string]int{}
+	}
+	t.sums[name] += score
+	t.counts[name]++
+}
+
+func (t *scoreTotals) averages() map[string]ScoreSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	averages := make(map[string]ScoreSummary, len(t.sums))
+	for name, sum := range t.sums {
+		averages[name] = ScoreSummary{Name: name, Score: sum / float64(t.counts[name])}
+	}
+	return averages
+}
+
+func mustJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprintf("%v", v))
+	}
+	return string(b)
+}
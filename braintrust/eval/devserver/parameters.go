@@ -0,0 +1,128 @@
+package devserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// ParameterType is the kind of a [Parameter].
+type ParameterType string
+
+const (
+	// ParameterData is a JSON value, described by a JSON schema.
+	ParameterData ParameterType = "data"
+	// ParameterPrompt is a prompt the UI lets users edit. Its value is the prompt data.
+	ParameterPrompt ParameterType = "prompt"
+)
+
+// Parameter is a value the Braintrust UI can set for each run of an eval.
+type Parameter struct {
+	Type        ParameterType
+	Description string
+	// Default is used when a run doesn't set the parameter. Parameters without a
+	// default are required.
+	Default any
+	// Schema is the JSON schema of a data parameter. If it's nil, the schema is
+	// inferred from the type of Default.
+	Schema map[string]any
+}
+
+func (p Parameter) validate() error {
+	switch p.Type {
+	case ParameterData, ParameterPrompt:
+		return nil
+	case "":
+		return fmt.Errorf("type is required")
+	default:
+		return fmt.Errorf("unknown type %q", p.Type)
+	}
+}
+
+func (p Parameter) describe() parameterDescription {
+	d := parameterDescription{Type: p.Type, Description: p.Description, Default: p.Default}
+	if p.Type == ParameterData {
+		d.Schema = p.Schema
+		if d.Schema == nil && p.Default != nil {
+			d.Schema = schemaOf(reflect.TypeOf(p.Default))
+		}
+	}
+	return d
+}
+
+// schemaOf returns a shallow JSON schema for a Go type.
+func schemaOf(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array"}
+	default:
+		return map[string]any{"type": "object"}
+	}
+}
+
+// Parameters are the parameter values of a run, keyed by name.
+type Parameters map[string]any
+
+// Decode decodes the named parameter into v, which should be a pointer.
+func (p Parameters) Decode(name string, v any) error {
+	value, ok := p[name]
+	if !ok {
+		return fmt.Errorf("parameter %q not set", name)
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode parameter %q: %w", name, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("failed to decode parameter %q: %w", name, err)
+	}
+	return nil
+}
+
+type parametersKey struct{}
+
+// GetParameters returns the parameters of the run the context belongs to, or nil if
+// the context isn't part of a dev server run.
+func GetParameters(ctx context.Context) Parameters {
+	p, _ := ctx.Value(parametersKey{}).(Parameters)
+	return p
+}
+
+func withParameters(ctx context.Context, p Parameters) context.Context {
+	return context.WithValue(ctx, parametersKey{}, p)
+}
+
+// resolveParameters fills in defaults and checks that required parameters are set
+// and no unknown parameters are.
+func resolveParameters(defs map[string]Parameter, values map[string]any) (Parameters, error) {
+	params := make(Parameters, len(defs))
+	for name, value := range values {
+		if _, ok := defs[name]; !ok {
+			return nil, fmt.Errorf("%w: unknown parameter %q", errBadRequest, name)
+		}
+		params[name] = value
+	}
+	for name, def := range defs {
+		if _, ok := params[name]; ok {
+			continue
+		}
+		if def.Default == nil {
+			return nil, fmt.Errorf("%w: parameter %q is required", errBadRequest, name)
+		}
+		params[name] = def.Default
+	}
+	return params, nil
+}
@@ -45,6 +45,7 @@ import (
 	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/auth"
 	"github.com/braintrustdata/braintrust-x-go/braintrust/log"
 	bttrace "github.com/braintrustdata/braintrust-x-go/braintrust/trace"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/attachment"
 )
 
 var (
@@ -171,6 +172,7 @@ func (e *Eval[I, R]) Run(ctx context.Context) (*Result, error) {
 	}
 
 	ctx = bttrace.SetParent(ctx, e.parent)
+	ctx, costs := bttrace.ContextWithCostTracker(ctx)
 
 	// Scale buffer size with parallelism to avoid blocking, but cap at 100
 	bufferSize := min(e.goroutines*2, 100)
@@ -213,6 +215,7 @@ func (e *Eval[I, R]) Run(ctx context.Context) (*Result, error) {
 
 	permalink, _ := e.Permalink() // err not super important here
 	result := newResult(e.key, err, permalink, elapsed)
+	result.estimatedCost = costs.EstimatedCost()
 	if !e.quiet {
 		fmt.Println(result.String())
 	}
@@ -381,6 +384,8 @@ type Result struct {
 	err       error
 	elapsed   time.Duration
 	permalink string
+	// estimatedCost is the sum of the estimated costs of the eval's LLM calls.
+	estimatedCost float64
 	// TODO: Will be populated with span data, scores, errors, etc. in future iterations
 }
 
@@ -408,6 +413,13 @@ func (r *Result) Name() string {
 	return r.key.Name
 }
 
+// EstimatedCost returns the estimated cost, in US dollars, of the LLM calls made by
+// the eval's tasks and scorers. It's the sum of the estimated_cost metrics of their
+// spans, so calls to models without a price (see the pricing package) aren't counted.
+func (r *Result) EstimatedCost() float64 {
+	return r.estimatedCost
+}
+
 // ID returns the experiment ID.
 func (r *Result) ID() string {
 	return r.key.ExperimentID
@@ -430,8 +442,11 @@ func (r *Result) String() string {
 		fmt.Sprintf("Name: %s", r.key.Name),
 		fmt.Sprintf("Project: %s", projectDisplay),
 		fmt.Sprintf("Duration: %.1fs", r.elapsed.Seconds()),
-		fmt.Sprintf("Link: %s", link),
 	}
+	if r.estimatedCost > 0 {
+		lines = append(lines, fmt.Sprintf("Estimated cost: $%.4f", r.estimatedCost))
+	}
+	lines = append(lines, fmt.Sprintf("Link: %s", link))
 	if linkErr != nil {
 		log.Warnf("Failed to generate permalink: %v", linkErr)
 	}
@@ -544,6 +559,13 @@ type Case[I, R any] struct {
 	Metadata Metadata
 }
 
+// Attachments returns the attachment references in the case's input, expected result
+// and metadata, like the ones of dataset rows logged with attachments. Read them with
+// [attachment.Reference.Open].
+func (c Case[I, R]) Attachments() []attachment.Reference {
+	return attachment.References([]any{c.Input, c.Expected, c.Metadata})
+}
+
 // Score represents the result of a scorer evaluation.
 type Score struct {
 	Name     string         `json:"name"`
@@ -11,12 +11,14 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/codes"
 
 	"github.com/braintrustdata/braintrust-x-go/braintrust"
 	"github.com/braintrustdata/braintrust-x-go/braintrust/api"
 	"github.com/braintrustdata/braintrust-x-go/braintrust/internal"
 	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/oteltest"
+	bttrace "github.com/braintrustdata/braintrust-x-go/braintrust/trace"
 )
 
 var (
@@ -1552,6 +1554,40 @@ func TestResult_String(t *testing.T) {
 
 	// Verify duration shows tenths of seconds (0.1s for 50ms)
 	assert.Contains(str2, "Duration: 0.1s", "String output should show duration with tenths of seconds")
+	assert.NotContains(str2, "Estimated cost", "String output should omit unknown costs")
+
+	result2.estimatedCost = 0.01234
+	assert.Contains(result2.String(), "Estimated cost: $0.0123")
+}
+
+func TestEval_EstimatedCost(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+	key := newKey("proj-name", "proj-123", "exp-123")
+
+	// each LLM call costs its input in cents
+	llm := func(ctx context.Context, cents int) {
+		_, span := otel.Tracer("llm").Start(ctx, "llm")
+		defer span.End()
+		require.NoError(t, bttrace.SetMetrics(span, map[string]float64{"prompt_tokens": 10, "estimated_cost": float64(cents) / 100}))
+	}
+	task := func(ctx context.Context, x int) (int, error) {
+		llm(ctx, x)
+		return x, nil
+	}
+	scorers := []Scorer[int, int]{
+		NewScorer("judge", func(ctx context.Context, _, _, _ int, _ Metadata) (Scores, error) {
+			llm(ctx, 1)
+			return S(1), nil
+		}),
+	}
+
+	eval := New(key, NewCases([]Case[int, int]{{Input: 2}, {Input: 3}}), task, scorers)
+	eval.setParallelism(2)
+	eval.quiet = true
+	result, err := eval.Run(context.Background())
+	require.NoError(t, err)
+	assert.InDelta(t, 0.07, result.EstimatedCost(), 1e-9)
+	assert.Len(t, exporter.Flush(), 10)
 }
 
 func TestEval_CaseMetadataLogging(t *testing.T) {
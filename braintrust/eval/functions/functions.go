@@ -21,6 +21,45 @@
 //
 //	scorer, err := functions.GetScorer[string, string]("my-project", "my-scorer")
 //
+// # Invoking Functions
+//
+// Use Invoke to call a hosted function from anywhere in your app. The server-side
+// trace nests under the span in the context:
+//
+//	answer, err := functions.Invoke[Question, Answer](ctx, functions.InvokeOpts{
+//	    Project: "my-project",
+//	    Slug:    "answer-question",
+//	}, question)
+//
+// # Streaming
+//
+// Use InvokeStream to stream text, JSON and tool call deltas from a hosted prompt:
+//
+//	stream, err := functions.InvokeStream(ctx, functions.InvokeOpts{Project: "my-project", Slug: "my-prompt"}, input)
+//
+// # Local Tools
+//
+// Hosted prompts can call tools implemented in Go. Set Tools on InvokeOpts and the
+// tools the function calls run locally, each in a "tool" span, until it returns a
+// final answer:
+//
+//	weather := functions.NewLocalTool("get_weather", "Get the current weather", getWeather)
+//	answer, err := functions.Invoke[string, string](ctx, functions.InvokeOpts{
+//	    Project: "my-project",
+//	    Slug:    "weather-bot",
+//	    Tools:   functions.NewToolRegistry(weather),
+//	}, "What's the weather in Paris?")
+//
+// # Pushing Functions
+//
+// Use Push to keep prompts, scorers and tools defined in Go in sync with a project.
+// Push only writes definitions that differ from the server, and DryRun reports the
+// diff without writing:
+//
+//	results, err := functions.Push(ctx, functions.PushOpts{Project: "my-project"},
+//	    &functions.Prompt{Name: "Greeter", Slug: "greeter", Model: "gpt-4o-mini", Messages: msgs},
+//	)
+//
 // See the package example for a complete usage demonstration.
 package functions
 
@@ -201,83 +240,18 @@ func queryFunctions(ctx context.Context, opts Opts) ([]Function, error) {
 
 // createFunction creates a new function via the Braintrust API
 func createFunction(projectName, name, slug, description string, functionData map[string]any) (string, error) {
-	config := braintrust.GetConfig()
-	if config.APIKey == "" {
-		return "", fmt.Errorf("BRAINTRUST_API_KEY is required")
-	}
-
-	// Register/get project
-	project, err := api.RegisterProject(projectName)
-	if err != nil {
-		return "", fmt.Errorf("failed to register project: %w", err)
-	}
-	projectID := project.ID
-
-	// Build the request payload
 	payload := map[string]any{
-		"project_id":    projectID,
 		"name":          name,
 		"slug":          slug,
 		"function_type": "scorer",
 		"function_data": functionData,
 	}
-
-	if description != "" {
-		payload["description"] = description
-	}
-
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal payload: %w", err)
-	}
-
-	// Create the API request
-	url := fmt.Sprintf("%s/v1/function", config.APIURL)
-	req, err := http.NewRequest("POST", url, bytes.NewReader(payloadBytes))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+config.APIKey)
-
-	resp, err := defaultHTTPClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Parse the response
-	var createdFunction Function
-	if err := json.NewDecoder(resp.Body).Decode(&createdFunction); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	return createdFunction.ID, nil
+	return createFunctionFromPayload(projectName, description, payload)
 }
 
 // createFunctionWithPromptData creates a function with full prompt_data structure
 func createFunctionWithPromptData(projectName, name, slug, description string, promptData map[string]any) (string, error) {
-	config := braintrust.GetConfig()
-	if config.APIKey == "" {
-		return "", fmt.Errorf("BRAINTRUST_API_KEY is required")
-	}
-
-	// Register/get project
-	project, err := api.RegisterProject(projectName)
-	if err != nil {
-		return "", fmt.Errorf("failed to register project: %w", err)
-	}
-	projectID := project.ID
-
-	// Build the request payload with prompt_data
 	payload := map[string]any{
-		"project_id":    projectID,
 		"name":          name,
 		"slug":          slug,
 		"function_type": "scorer",
@@ -286,108 +260,46 @@ func createFunctionWithPromptData(projectName, name, slug, description string, p
 		},
 		"prompt_data": promptData,
 	}
-
-	if description != "" {
-		payload["description"] = description
-	}
-
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal payload: %w", err)
-	}
-
-	// Create the API request
-	url := fmt.Sprintf("%s/v1/function", config.APIURL)
-	req, err := http.NewRequest("POST", url, bytes.NewReader(payloadBytes))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+config.APIKey)
-
-	resp, err := defaultHTTPClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Parse the response
-	var createdFunction Function
-	if err := json.NewDecoder(resp.Body).Decode(&createdFunction); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	return createdFunction.ID, nil
+	return createFunctionFromPayload(projectName, description, payload)
 }
 
 // createPrompt creates a prompt function (not a scorer) for use in evals/tasks
 func createPrompt(projectName, name, slug, description string, promptData map[string]any) (string, error) {
-	config := braintrust.GetConfig()
-	if config.APIKey == "" {
-		return "", fmt.Errorf("BRAINTRUST_API_KEY is required")
-	}
-
-	// Register/get project
-	project, err := api.RegisterProject(projectName)
-	if err != nil {
-		return "", fmt.Errorf("failed to register project: %w", err)
-	}
-	projectID := project.ID
-
-	// Build the request payload for a prompt (not scorer)
 	// Note: function_type should be null/omitted for prompts, not "prompt"
 	payload := map[string]any{
-		"project_id": projectID,
-		"name":       name,
-		"slug":       slug,
+		"name": name,
+		"slug": slug,
 		"function_data": map[string]any{
 			"type": "prompt",
 		},
 		"prompt_data": promptData,
 	}
+	return createFunctionFromPayload(projectName, description, payload)
+}
 
-	if description != "" {
-		payload["description"] = description
+// createFunctionFromPayload registers the project, fills in the project ID and
+// description, and creates the function.
+func createFunctionFromPayload(projectName, description string, payload map[string]any) (string, error) {
+	config := braintrust.GetConfig()
+	if config.APIKey == "" {
+		return "", fmt.Errorf("BRAINTRUST_API_KEY is required")
 	}
 
-	payloadBytes, err := json.Marshal(payload)
+	// Register/get project
+	project, err := api.RegisterProject(projectName)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal payload: %w", err)
+		return "", fmt.Errorf("failed to register project: %w", err)
 	}
+	payload["project_id"] = project.ID
 
-	// Create the API request
-	url := fmt.Sprintf("%s/v1/function", config.APIURL)
-	req, err := http.NewRequest("POST", url, bytes.NewReader(payloadBytes))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+	if description != "" {
+		payload["description"] = description
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+config.APIKey)
-
-	resp, err := defaultHTTPClient.Do(req)
+	createdFunction, err := saveFunction(context.Background(), config, http.MethodPost, payload)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return "", err
 	}
-
-	// Parse the response
-	var createdFunction Function
-	if err := json.NewDecoder(resp.Body).Decode(&createdFunction); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
-	}
-
 	return createdFunction.ID, nil
 }
 
@@ -441,53 +353,58 @@ func GetTask[I, R any](opts Opts) eval.Task[I, R] {
 			var zero R
 			return zero, err
 		}
+		return convertOutput[R](result)
+	}
+}
 
-		// Try direct type assertion first (works for simple types like string, int, etc.)
-		typedResult, ok := result.(R)
-		if ok {
-			return typedResult, nil
-		}
-
-		// For complex types (structs) or type mismatches, we need to convert via JSON
-		var zero R
-
-		// If result is a string, it might be a JSON string that needs parsing
-		// This handles cases where the LLM returns JSON as a string
-		if resultStr, ok := result.(string); ok {
-			// Try to unmarshal the string as JSON
-			if err := json.Unmarshal([]byte(resultStr), &zero); err != nil {
-				// If unmarshaling fails and R is string type (including custom string types),
-				// return the string as-is. This handles cases where GetTask[string, string]
-				// or GetTask[CustomString, CustomString] receives a plain string.
-				// Use reflection to check if the underlying type is string to support type aliases.
-				if reflect.TypeOf(zero).Kind() == reflect.String {
-					// Use reflection to convert the string to the target type (handles custom string types)
-					resultValue := reflect.ValueOf(resultStr)
-					typedValue := resultValue.Convert(reflect.TypeOf(zero))
-					typedResult, ok := typedValue.Interface().(R)
-					if !ok {
-						return zero, fmt.Errorf("failed to convert string to type %T", zero)
-					}
-					return typedResult, nil
+// convertOutput converts the decoded output of an invocation to R. JSON strings
+// are parsed, and string outputs can be converted to custom string types.
+func convertOutput[R any](result any) (R, error) {
+	// Try direct type assertion first (works for simple types like string, int, etc.)
+	typedResult, ok := result.(R)
+	if ok {
+		return typedResult, nil
+	}
+
+	// For complex types (structs) or type mismatches, we need to convert via JSON
+	var zero R
+
+	// If result is a string, it might be a JSON string that needs parsing
+	// This handles cases where the LLM returns JSON as a string
+	if resultStr, ok := result.(string); ok {
+		// Try to unmarshal the string as JSON
+		if err := json.Unmarshal([]byte(resultStr), &zero); err != nil {
+			// If unmarshaling fails and R is string type (including custom string types),
+			// return the string as-is. This handles cases where GetTask[string, string]
+			// or GetTask[CustomString, CustomString] receives a plain string.
+			// Use reflection to check if the underlying type is string to support type aliases.
+			if reflect.TypeOf(zero).Kind() == reflect.String {
+				// Use reflection to convert the string to the target type (handles custom string types)
+				resultValue := reflect.ValueOf(resultStr)
+				typedValue := resultValue.Convert(reflect.TypeOf(zero))
+				typedResult, ok := typedValue.Interface().(R)
+				if !ok {
+					return zero, fmt.Errorf("failed to convert string to type %T", zero)
 				}
-				return zero, fmt.Errorf("failed to unmarshal JSON string to type %T: %w", zero, err)
+				return typedResult, nil
 			}
-			return zero, nil
-		}
-
-		// Otherwise, result is likely a map[string]any from JSON parsing
-		// Marshal and unmarshal to convert to the target type
-		jsonBytes, err := json.Marshal(result)
-		if err != nil {
-			return zero, fmt.Errorf("failed to marshal result to JSON: %w", err)
+			return zero, fmt.Errorf("failed to unmarshal JSON string to type %T: %w", zero, err)
 		}
+		return zero, nil
+	}
 
-		if err := json.Unmarshal(jsonBytes, &zero); err != nil {
-			return zero, fmt.Errorf("failed to unmarshal result to type %T: %w", zero, err)
-		}
+	// Otherwise, result is likely a map[string]any from JSON parsing
+	// Marshal and unmarshal to convert to the target type
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return zero, fmt.Errorf("failed to marshal result to JSON: %w", err)
+	}
 
-		return zero, nil
+	if err := json.Unmarshal(jsonBytes, &zero); err != nil {
+		return zero, fmt.Errorf("failed to unmarshal result to type %T: %w", zero, err)
 	}
+
+	return zero, nil
 }
 
 func (f *functionScorer[I, R]) Run(ctx context.Context, input I, expected, result R, meta eval.Metadata) (eval.Scores, error) {
@@ -530,23 +447,82 @@ func (f *functionScorer[I, R]) Run(ctx context.Context, input I, expected, resul
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("function invocation failed with status %d: %s", resp.StatusCode, string(body))
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	// Parse the response
-	var response struct {
-		Score float64 `json:"score"`
+	if resp.StatusCode != http.StatusOK {
+		return nil, &InvokeError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	return parseScores(f.name, body)
+}
+
+// parseScores converts a scorer's response into Scores. Scorers can return a number,
+// a score object ({"name", "score", "metadata"}), a list of either, or null. Null
+// scores mean the scorer chose not to score the case, so they are skipped. Scores
+// without a name default to the scorer's name.
+func parseScores(defaultName string, body []byte) (eval.Scores, error) {
+	var raw any
+	if err := json.Unmarshal(body, &raw); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	// Return the score
-	return eval.Scores{{
-		Name:  f.name,
-		Score: response.Score,
-	}}, nil
+	items, ok := raw.([]any)
+	if !ok {
+		items = []any{raw}
+	}
+
+	scores := eval.Scores{}
+	for _, item := range items {
+		score, ok, err := parseScore(defaultName, item)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			scores = append(scores, score)
+		}
+	}
+	return scores, nil
+}
+
+// parseScore converts a single score value. It returns false for null scores.
+func parseScore(defaultName string, v any) (eval.Score, bool, error) {
+	switch v := v.(type) {
+	case nil:
+		return eval.Score{}, false, nil
+	case float64:
+		return eval.Score{Name: defaultName, Score: v}, true, nil
+	case bool:
+		// some scorers return pass/fail
+		score := 0.0
+		if v {
+			score = 1
+		}
+		return eval.Score{Name: defaultName, Score: score}, true, nil
+	case map[string]any:
+		value, ok := v["score"]
+		if !ok {
+			return eval.Score{}, false, fmt.Errorf("score object is missing 'score' field")
+		}
+		if value == nil {
+			return eval.Score{}, false, nil
+		}
+		num, ok := value.(float64)
+		if !ok {
+			return eval.Score{}, false, fmt.Errorf("score must be a number, got %T", value)
+		}
+
+		score := eval.Score{Name: defaultName, Score: num}
+		if name, ok := v["name"].(string); ok && name != "" {
+			score.Name = name
+		}
+		if metadata, ok := v["metadata"].(map[string]any); ok {
+			score.Metadata = metadata
+		}
+		return score, true, nil
+	default:
+		return eval.Score{}, false, fmt.Errorf("unexpected score type %T", v)
+	}
 }
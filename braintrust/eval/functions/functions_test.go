@@ -2,13 +2,18 @@ package functions
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/eval"
 )
 
 const testProjectName = "test-go-functions"
@@ -454,3 +459,66 @@ func TestGetTaskWithComplexType(t *testing.T) {
 	assert.Equal("Alice", result.Name)
 	t.Logf("Struct result: %+v", result)
 }
+
+func TestParseScores(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected eval.Scores
+	}{
+		{"number", `0.5`, eval.Scores{{Name: "scorer", Score: 0.5}}},
+		{"bool", `true`, eval.Scores{{Name: "scorer", Score: 1}}},
+		{"null", `null`, eval.Scores{}},
+		{"object without name", `{"score": 0.25}`, eval.Scores{{Name: "scorer", Score: 0.25}}},
+		{
+			"object with metadata",
+			`{"name": "Factuality", "score": 0.6, "metadata": {"rationale": "mostly right", "choice": "B"}}`,
+			eval.Scores{{Name: "Factuality", Score: 0.6, Metadata: map[string]any{"rationale": "mostly right", "choice": "B"}}},
+		},
+		{"object with null score", `{"name": "Skipped", "score": null}`, eval.Scores{}},
+		{
+			"array",
+			`[{"name": "a", "score": 1}, 0.5, null, {"name": "b", "score": 0, "metadata": {"x": 1}}]`,
+			eval.Scores{
+				{Name: "a", Score: 1},
+				{Name: "scorer", Score: 0.5},
+				{Name: "b", Score: 0, Metadata: map[string]any{"x": float64(1)}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scores, err := parseScores("scorer", []byte(tt.body))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, scores)
+		})
+	}
+
+	for _, body := range []string{`"pass"`, `{"name": "x"}`, `{"score": "high"}`, `not json`} {
+		_, err := parseScores("scorer", []byte(body))
+		assert.Error(t, err, body)
+	}
+}
+
+func TestFunctionScorerRun_ScoreObjects(t *testing.T) {
+	var payload map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/function/fn-123/invoke", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		_, _ = w.Write([]byte(`[{"name": "Relevance", "score": 0.9, "metadata": {"rationale": "on topic"}}, {"name": "Tone", "score": 0.4}]`))
+	}))
+	defer server.Close()
+	t.Setenv("BRAINTRUST_API_KEY", "test-key")
+	t.Setenv("BRAINTRUST_API_URL", server.URL)
+
+	scorer := newFunctionScorer[string, string]("my-scorer", "fn-123")
+	scores, err := scorer.Run(context.Background(), "input", "expected", "output", eval.Metadata{"k": "v"})
+	require.NoError(t, err)
+	assert.Equal(t, eval.Scores{
+		{Name: "Relevance", Score: 0.9, Metadata: map[string]any{"rationale": "on topic"}},
+		{Name: "Tone", Score: 0.4},
+	}, scores)
+	assert.Equal(t, map[string]any{"input": "input", "expected": "expected", "output": "output"}, payload["input"])
+	assert.Equal(t, map[string]any{"k": "v"}, payload["metadata"])
+}
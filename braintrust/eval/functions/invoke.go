@@ -11,8 +11,12 @@ import (
 
 	"go.opentelemetry.io/otel"
 	attr "go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
 
 	"github.com/braintrustdata/braintrust-x-go/braintrust"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/logobject"
+	bttrace "github.com/braintrustdata/braintrust-x-go/braintrust/trace"
 )
 
 // defaultHTTPClient is a shared HTTP client with reasonable timeouts.
@@ -21,6 +25,102 @@ var defaultHTTPClient = &http.Client{
 	Timeout: 60 * time.Second,
 }
 
+// InvokeMode controls how a function that calls tools returns its output.
+type InvokeMode string
+
+const (
+	// InvokeModeAuto lets the server decide how to return the output.
+	InvokeModeAuto InvokeMode = "auto"
+	// InvokeModeParallel returns tool calls in parallel instead of running them one at a time.
+	InvokeModeParallel InvokeMode = "parallel"
+)
+
+// InvokeOpts provides options for [Invoke] and [InvokeStream].
+type InvokeOpts struct {
+	// Project identity (either/or)
+	Project   string
+	ProjectID string
+
+	// Function identity (either/or)
+	Slug       string
+	FunctionID string
+
+	// Query modifiers
+	Version     string
+	Environment string
+
+	// Messages are appended to the prompt's messages, e.g. to continue a conversation.
+	Messages []Message
+	// Mode controls how tool calls are returned (default: server decides).
+	Mode InvokeMode
+	// Strict makes the server fail if the input is missing variables used by the prompt.
+	Strict bool
+	// Metadata is passed through to the server-side function trace.
+	Metadata map[string]any
+
+	// Parent is where the server logs the function's trace. Defaults to the parent in
+	// the context (see trace.SetParent).
+	Parent *bttrace.Parent
+	// ParentSpan is the span the server-side trace nests under. Defaults to the
+	// "function: <slug>" span created by the invocation.
+	ParentSpan oteltrace.SpanContext
+
+	// Tools are run locally when the function calls them, and their results are sent
+	// back until the function finishes. Mode defaults to parallel when Tools is set.
+	Tools *ToolRegistry
+	// MaxToolRounds limits how many times the function can call tools (default: 10).
+	MaxToolRounds int
+}
+
+// InvokeError is returned when the server rejects a function invocation.
+type InvokeError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *InvokeError) Error() string {
+	return fmt.Sprintf("function invocation failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Invoke calls a Braintrust function with the given input and converts the output
+// to O. The server handles all templating and LLM execution, and its trace nests
+// under the span in ctx.
+//
+// Example:
+//
+//	answer, err := functions.Invoke[Question, Answer](ctx, functions.InvokeOpts{
+//	    Project: "my-project",
+//	    Slug:    "answer-question",
+//	}, Question{Text: "What is 2+2?"})
+func Invoke[I, O any](ctx context.Context, opts InvokeOpts, input I) (O, error) {
+	result, err := invoke(ctx, opts.invokeOptions(input))
+	if err != nil {
+		var zero O
+		return zero, err
+	}
+	return convertOutput[O](result)
+}
+
+func (o InvokeOpts) invokeOptions(input any) invokeOptions {
+	return invokeOptions{
+		Project:     o.Project,
+		ProjectID:   o.ProjectID,
+		Slug:        o.Slug,
+		FunctionID:  o.FunctionID,
+		Version:     o.Version,
+		Environment: o.Environment,
+		Messages:    o.Messages,
+		Mode:        o.Mode,
+		Strict:      o.Strict,
+		Metadata:    o.Metadata,
+		Parent:      o.Parent,
+		ParentSpan:  o.ParentSpan,
+		Tools:       o.Tools,
+		MaxRounds:   o.MaxToolRounds,
+		Input:       input,
+	}
+}
+
 // invokeOptions provides options for invoking a Braintrust function.
 type invokeOptions struct {
 	// Project identity (either/or)
@@ -35,6 +135,18 @@ type invokeOptions struct {
 	Version     string
 	Environment string
 
+	// Request options
+	Messages   []Message
+	Mode       InvokeMode
+	Strict     bool
+	Metadata   map[string]any
+	Parent     *bttrace.Parent
+	ParentSpan oteltrace.SpanContext
+
+	// Local tool loop
+	Tools     *ToolRegistry
+	MaxRounds int
+
 	// Input data to pass to the function
 	Input any
 }
@@ -43,15 +155,132 @@ type invokeOptions struct {
 // The server handles all templating and LLM execution.
 // Returns the output from the function invocation.
 func invoke(ctx context.Context, opts invokeOptions) (any, error) {
-	// Validate that we have enough information to identify the function
+	if opts.Tools != nil {
+		return invokeWithTools(ctx, opts)
+	}
+	return invokeOnce(ctx, opts)
+}
+
+// invokeWithTools invokes the function, runs any tools it calls and invokes it again
+// with the results, until it returns an output that isn't a tool call.
+func invokeWithTools(ctx context.Context, opts invokeOptions) (any, error) {
+	opts = withToolDefaults(opts)
+	for round := 0; ; round++ {
+		output, err := invokeOnce(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		calls := parseToolCalls(output)
+		if len(calls) == 0 {
+			return output, nil
+		}
+		if round >= opts.MaxRounds {
+			return nil, fmt.Errorf("function still calling tools after %d rounds", opts.MaxRounds)
+		}
+
+		results, err := runToolCalls(ctx, opts.Tools, calls)
+		if err != nil {
+			return nil, err
+		}
+		opts.Messages = append(opts.Messages, results...)
+	}
+}
+
+// withToolDefaults sets the defaults for the local tool loop. It copies the messages
+// so appending tool results never modifies the caller's slice.
+func withToolDefaults(opts invokeOptions) invokeOptions {
+	if opts.Mode == "" {
+		opts.Mode = InvokeModeParallel
+	}
+	if opts.MaxRounds <= 0 {
+		opts.MaxRounds = defaultMaxToolRounds
+	}
+	opts.Messages = append([]Message(nil), opts.Messages...)
+	return opts
+}
+
+// invokeOnce makes a single function invocation.
+func invokeOnce(ctx context.Context, opts invokeOptions) (any, error) {
+	if err := validateInvokeOptions(opts); err != nil {
+		return nil, err
+	}
+
+	ctx, span := startInvokeSpan(ctx, opts)
+	defer span.End()
+
+	output, err := sendInvokeRequest(ctx, opts)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	return output, nil
+}
+
+// sendInvokeRequest invokes the function and decodes its output.
+func sendInvokeRequest(ctx context.Context, opts invokeOptions) (any, error) {
+	config := braintrust.GetConfig()
+	if config.APIKey == "" {
+		return nil, fmt.Errorf("BRAINTRUST_API_KEY is required")
+	}
+
+	req, err := newInvokeRequest(ctx, config, opts, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Execute request
+	resp, err := defaultHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to invoke function: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// Read response
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// Check status code
+	if resp.StatusCode != http.StatusOK {
+		return nil, &InvokeError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	// Parse response - try as object first, then as raw value
+	var response map[string]any
+	if err := json.Unmarshal(body, &response); err == nil {
+		// Response is an object, extract output field
+		output, ok := response["output"]
+		if !ok {
+			return nil, fmt.Errorf("response missing 'output' field")
+		}
+		return output, nil
+	}
+
+	// Response is not an object, try parsing as raw JSON value (string, number, etc.)
+	var output any
+	if err := json.Unmarshal(body, &output); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return output, nil
+}
+
+// validateInvokeOptions checks that we have enough information to identify the function.
+func validateInvokeOptions(opts invokeOptions) error {
 	if opts.FunctionID == "" && opts.Slug == "" {
-		return nil, fmt.Errorf("either FunctionID or Slug must be specified")
+		return fmt.Errorf("either FunctionID or Slug must be specified")
 	}
 	if opts.FunctionID == "" && opts.Project == "" && opts.ProjectID == "" {
-		return nil, fmt.Errorf("either FunctionID or Project/ProjectID must be specified")
+		return fmt.Errorf("either FunctionID or Project/ProjectID must be specified")
 	}
+	return nil
+}
 
-	// Create a span for the function invocation
+// startInvokeSpan starts the "function: <slug>" span that wraps an invocation.
+func startInvokeSpan(ctx context.Context, opts invokeOptions) (context.Context, oteltrace.Span) {
 	tracer := otel.GetTracerProvider().Tracer("braintrust.functions")
 	spanName := opts.Slug
 	if spanName == "" {
@@ -61,7 +290,6 @@ func invoke(ctx context.Context, opts invokeOptions) (any, error) {
 		spanName = "unknown"
 	}
 	ctx, span := tracer.Start(ctx, fmt.Sprintf("function: %s", spanName))
-	defer span.End()
 
 	// Set Braintrust span attributes to mark this as a function invocation
 	spanAttrs := map[string]any{"type": "function"}
@@ -87,40 +315,71 @@ func invoke(ctx context.Context, opts invokeOptions) (any, error) {
 		span.SetAttributes(attr.String("braintrust.metadata", string(metadataJSON)))
 	}
 
-	config := braintrust.GetConfig()
-	if config.APIKey == "" {
-		return nil, fmt.Errorf("BRAINTRUST_API_KEY is required")
+	return ctx, span
+}
+
+// resolveFunctionID returns the function ID, looking it up by project and slug if
+// it wasn't provided directly.
+func resolveFunctionID(ctx context.Context, opts invokeOptions) (string, error) {
+	if opts.FunctionID != "" {
+		return opts.FunctionID, nil
 	}
 
-	// Resolve function ID if not provided directly
-	functionID := opts.FunctionID
-	if functionID == "" {
-		// Query for function by project+slug
-		functions, err := queryFunctions(ctx, Opts{
-			Project:     opts.Project,
-			ProjectID:   opts.ProjectID,
-			Slug:        opts.Slug,
-			Version:     opts.Version,
-			Environment: opts.Environment,
-			Limit:       1,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to query function: %w", err)
-		}
-		if len(functions) == 0 {
-			projectInfo := opts.Project
-			if projectInfo == "" {
-				projectInfo = opts.ProjectID
-			}
-			return nil, fmt.Errorf("function not found: project=%s slug=%s", projectInfo, opts.Slug)
+	// Query for function by project+slug
+	functions, err := queryFunctions(ctx, Opts{
+		Project:     opts.Project,
+		ProjectID:   opts.ProjectID,
+		Slug:        opts.Slug,
+		Version:     opts.Version,
+		Environment: opts.Environment,
+		Limit:       1,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to query function: %w", err)
+	}
+	if len(functions) == 0 {
+		projectInfo := opts.Project
+		if projectInfo == "" {
+			projectInfo = opts.ProjectID
 		}
-		functionID = functions[0].ID
+		return "", fmt.Errorf("function not found: project=%s slug=%s", projectInfo, opts.Slug)
+	}
+	return functions[0].ID, nil
+}
+
+// newInvokeRequest builds the POST request to the function's invoke endpoint.
+func newInvokeRequest(ctx context.Context, config braintrust.Config, opts invokeOptions, stream bool) (*http.Request, error) {
+	functionID, err := resolveFunctionID(ctx, opts)
+	if err != nil {
+		return nil, err
 	}
 
 	// Build request payload
 	payload := map[string]any{
 		"input": opts.Input,
 	}
+	if stream {
+		payload["stream"] = true
+	}
+	if len(opts.Messages) > 0 {
+		payload["messages"] = opts.Messages
+	}
+	if opts.Mode != "" {
+		payload["mode"] = opts.Mode
+	}
+	if opts.Strict {
+		payload["strict"] = true
+	}
+	if len(opts.Metadata) > 0 {
+		payload["metadata"] = opts.Metadata
+	}
+	parent, err := invokeParent(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if parent != nil {
+		payload["parent"] = parent
+	}
 
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
@@ -136,41 +395,47 @@ func invoke(ctx context.Context, opts invokeOptions) (any, error) {
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+config.APIKey)
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
 
-	// Execute request
-	resp, err := defaultHTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to invoke function: %w", err)
+	return req, nil
+}
+
+// invokeParent builds the parent the server logs the function's trace under, so it
+// nests under our span. It returns nil if there is no Braintrust parent to log to.
+func invokeParent(ctx context.Context, opts invokeOptions) (map[string]any, error) {
+	var parent bttrace.Parent
+	if opts.Parent != nil {
+		parent = *opts.Parent
+	} else {
+		ok, p := bttrace.GetParent(ctx)
+		if !ok {
+			return nil, nil
+		}
+		parent = p
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
+	objectType, objectID, err := logobject.Resolve(string(parent.Type), parent.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
-
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("function invocation failed with status %d: %s", resp.StatusCode, string(body))
+	result := map[string]any{
+		"object_type": objectType,
+		"object_id":   objectID,
 	}
 
-	// Parse response - try as object first, then as raw value
-	var response map[string]any
-	if err := json.Unmarshal(body, &response); err == nil {
-		// Response is an object, extract output field
-		output, ok := response["output"]
-		if !ok {
-			return nil, fmt.Errorf("response missing 'output' field")
-		}
-		return output, nil
+	sc := opts.ParentSpan
+	if !sc.IsValid() {
+		sc = oteltrace.SpanContextFromContext(ctx)
 	}
-
-	// Response is not an object, try parsing as raw JSON value (string, number, etc.)
-	var output any
-	if err := json.Unmarshal(body, &output); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if sc.IsValid() {
+		result["row_ids"] = map[string]any{
+			"id":           sc.SpanID().String(),
+			"span_id":      sc.SpanID().String(),
+			"root_span_id": sc.TraceID().String(),
+		}
 	}
 
-	return output, nil
+	return result, nil
 }
@@ -2,8 +2,21 @@ package functions
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/oteltest"
+	bttrace "github.com/braintrustdata/braintrust-x-go/braintrust/trace"
 )
 
 func TestInvoke(t *testing.T) {
@@ -51,3 +64,120 @@ func TestInvoke(t *testing.T) {
 		}
 	})
 }
+
+// newInvokeServer returns a server that records invoke payloads and responds with the given body.
+func newInvokeServer(t *testing.T, status int, body string) *[]map[string]any {
+	t.Helper()
+	var payloads []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads = append(payloads, payload)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("BRAINTRUST_API_KEY", "test-key")
+	t.Setenv("BRAINTRUST_API_URL", server.URL)
+	return &payloads
+}
+
+func TestInvoke_Typed(t *testing.T) {
+	assert := assert.New(t)
+	type answer struct {
+		Value int `json:"value"`
+	}
+	payloads := newInvokeServer(t, http.StatusOK, `{"output": {"value": 4}}`)
+	tracer, exporter := oteltest.Setup(t, braintrust.WithOrgName("test-org"))
+
+	ctx := bttrace.SetParent(context.Background(), bttrace.Parent{Type: bttrace.ParentTypeExperimentID, ID: "exp-1"})
+	ctx, parentSpan := tracer.Start(ctx, "request")
+	result, err := Invoke[string, answer](ctx, InvokeOpts{
+		FunctionID: "fn-123",
+		Messages:   []Message{{Role: "user", Content: "and show your work"}},
+		Mode:       InvokeModeParallel,
+		Strict:     true,
+		Metadata:   map[string]any{"user_id": "u1"},
+	}, "2+2")
+	parentSpan.End()
+	require.NoError(t, err)
+	assert.Equal(answer{Value: 4}, result)
+
+	spans := exporter.Flush()
+	require.Len(t, spans, 2)
+	fnSpan := spans[0]
+	assert.Equal("function: fn-123", fnSpan.Name())
+	assert.Equal(parentSpan.SpanContext().SpanID(), fnSpan.Stub.Parent.SpanID())
+
+	require.Len(t, *payloads, 1)
+	payload := (*payloads)[0]
+	assert.Equal("2+2", payload["input"])
+	assert.Equal([]any{map[string]any{"role": "user", "content": "and show your work"}}, payload["messages"])
+	assert.Equal("parallel", payload["mode"])
+	assert.Equal(true, payload["strict"])
+	assert.Equal(map[string]any{"user_id": "u1"}, payload["metadata"])
+	assert.Equal(map[string]any{
+		"object_type": "experiment",
+		"object_id":   "exp-1",
+		"row_ids": map[string]any{
+			"id":           fnSpan.Stub.SpanContext.SpanID().String(),
+			"span_id":      fnSpan.Stub.SpanContext.SpanID().String(),
+			"root_span_id": fnSpan.Stub.SpanContext.TraceID().String(),
+		},
+	}, payload["parent"])
+}
+
+func TestInvoke_ExplicitParent(t *testing.T) {
+	payloads := newInvokeServer(t, http.StatusOK, `"ok"`)
+	oteltest.Setup(t, braintrust.WithOrgName("test-org"))
+
+	sc := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID: oteltrace.TraceID{1},
+		SpanID:  oteltrace.SpanID{2},
+	})
+	result, err := Invoke[string, string](context.Background(), InvokeOpts{
+		FunctionID: "fn-123",
+		Parent:     &bttrace.Parent{Type: bttrace.ParentTypeProjectID, ID: "proj-1"},
+		ParentSpan: sc,
+	}, "hi")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", result)
+
+	assert.Equal(t, map[string]any{
+		"object_type": "project_logs",
+		"object_id":   "proj-1",
+		"row_ids": map[string]any{
+			"id":           sc.SpanID().String(),
+			"span_id":      sc.SpanID().String(),
+			"root_span_id": sc.TraceID().String(),
+		},
+	}, (*payloads)[0]["parent"])
+}
+
+func TestInvoke_NoParent(t *testing.T) {
+	payloads := newInvokeServer(t, http.StatusOK, `"ok"`)
+	oteltest.Setup(t, braintrust.WithOrgName("test-org"))
+
+	_, err := Invoke[string, string](context.Background(), InvokeOpts{FunctionID: "fn-123"}, "hi")
+	require.NoError(t, err)
+	payload := (*payloads)[0]
+	assert.NotContains(t, payload, "parent")
+	assert.NotContains(t, payload, "mode")
+	assert.NotContains(t, payload, "strict")
+}
+
+func TestInvoke_Error(t *testing.T) {
+	newInvokeServer(t, http.StatusBadRequest, `{"error": "missing variable"}`)
+	_, exporter := oteltest.Setup(t, braintrust.WithOrgName("test-org"))
+
+	_, err := Invoke[string, string](context.Background(), InvokeOpts{FunctionID: "fn-123", Strict: true}, "hi")
+	var invokeErr *InvokeError
+	require.True(t, errors.As(err, &invokeErr))
+	assert.Equal(t, http.StatusBadRequest, invokeErr.StatusCode)
+	assert.Equal(t, `{"error": "missing variable"}`, invokeErr.Body)
+
+	// the span records the failure
+	span := exporter.FlushOne()
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Equal(t, err.Error(), span.Status().Description)
+}
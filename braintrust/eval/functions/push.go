@@ -0,0 +1,580 @@
+package functions
+
+// this file defines prompts, scorers and tools in Go and pushes them to Braintrust.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/api"
+)
+
+// Message is a single chat message in a prompt template. Content may use
+// mustache templates like {{input}}, which the server fills in on invoke.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+
+	// Set on assistant messages that call tools, and on the tool messages that
+	// answer them.
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// ToolRef references another Braintrust function that a prompt can call as a tool.
+// Set FunctionID, or Slug (optionally with ProjectID, which defaults to the push project).
+type ToolRef struct {
+	FunctionID string
+	ProjectID  string
+	Slug       string
+}
+
+// Prompt defines a hosted prompt that can be invoked as a task.
+type Prompt struct {
+	Name        string
+	Slug        string
+	Description string
+	Model       string
+	Messages    []Message
+	Params      map[string]any // Model parameters like temperature or max_tokens
+	Tools       []ToolRef
+	LocalTools  *ToolRegistry // Tools implemented in Go, see NewLocalTool
+}
+
+// Scorer defines a code-free LLM-as-a-judge scorer. The model picks one of the
+// choices in ChoiceScores and the scorer returns the matching score.
+type Scorer struct {
+	Name         string
+	Slug         string
+	Description  string
+	Model        string
+	Messages     []Message
+	Params       map[string]any
+	ChoiceScores map[string]float64
+	UseCoT       bool // Ask the model to reason before choosing
+}
+
+// Tool defines a code-free tool backed by a prompt. Parameters is the JSON schema
+// of the tool's input.
+type Tool struct {
+	Name        string
+	Slug        string
+	Description string
+	Model       string
+	Messages    []Message
+	Params      map[string]any
+	Parameters  map[string]any
+}
+
+// Definition is a function that can be pushed to Braintrust with [Push]. It is
+// implemented by [Prompt], [Scorer] and [Tool].
+type Definition interface {
+	slug() string
+	payload(projectID string) (functionPayload, error)
+}
+
+// PushOpts configures [Push].
+type PushOpts struct {
+	// Project identity (either/or)
+	Project   string
+	ProjectID string
+
+	// DryRun computes the diff against the server without writing anything.
+	DryRun bool
+}
+
+// PushAction describes what [Push] did (or would do) with a definition.
+type PushAction string
+
+const (
+	// PushActionCreate means the function did not exist and was created.
+	PushActionCreate PushAction = "create"
+	// PushActionUpdate means the function existed and was replaced.
+	PushActionUpdate PushAction = "update"
+	// PushActionUnchanged means the server already matched the definition.
+	PushActionUnchanged PushAction = "unchanged"
+)
+
+// PushResult is the outcome of pushing a single definition.
+type PushResult struct {
+	Slug   string
+	ID     string // Empty for creates in dry-run mode
+	Action PushAction
+	Diff   []string // Human readable changes against the server version
+}
+
+// Push upserts the given definitions into a project by slug. It compares each
+// definition with the current server version and only writes the ones that changed,
+// so it is safe to run on every deploy.
+//
+// Example:
+//
+//	results, err := functions.Push(ctx, functions.PushOpts{Project: "my-project"},
+//	    &functions.Prompt{
+//	        Name:  "Greeter",
+//	        Slug:  "greeter",
+//	        Model: "gpt-4o-mini",
+//	        Messages: []functions.Message{
+//	            {Role: "system", Content: "You greet people."},
+//	            {Role: "user", Content: "Say hi to {{input}}"},
+//	        },
+//	    },
+//	)
+func Push(ctx context.Context, opts PushOpts, defs ...Definition) ([]PushResult, error) {
+	config := braintrust.GetConfig()
+	if config.APIKey == "" {
+		return nil, fmt.Errorf("BRAINTRUST_API_KEY is required")
+	}
+	if opts.Project == "" && opts.ProjectID == "" {
+		return nil, fmt.Errorf("either Project or ProjectID must be specified")
+	}
+
+	// Don't create projects on dry runs, only look them up. If the project doesn't
+	// exist, every definition is a create.
+	projectID := opts.ProjectID
+	if projectID == "" && opts.DryRun {
+		id, err := findProjectID(ctx, config, opts.Project)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up project: %w", err)
+		}
+		projectID = id
+	} else if projectID == "" {
+		project, err := api.RegisterProject(opts.Project)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register project: %w", err)
+		}
+		projectID = project.ID
+	}
+
+	results := make([]PushResult, 0, len(defs))
+	for _, def := range defs {
+		result, err := pushDefinition(ctx, config, opts, projectID, def)
+		if err != nil {
+			return results, fmt.Errorf("failed to push %q: %w", def.slug(), err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func pushDefinition(ctx context.Context, config braintrust.Config, opts PushOpts, projectID string, def Definition) (PushResult, error) {
+	payload, err := def.payload(projectID)
+	if err != nil {
+		return PushResult{}, err
+	}
+	result := PushResult{Slug: payload.Slug}
+
+	existing, err := getFunctionRecord(ctx, config, opts.Project, projectID, payload.Slug)
+	if err != nil {
+		return result, err
+	}
+
+	if existing == nil {
+		result.Action = PushActionCreate
+		result.Diff = []string{fmt.Sprintf("+ %s", payload.Slug)}
+	} else {
+		result.ID, _ = existing["id"].(string)
+		result.Diff = diffPayload(payload, existing)
+		result.Action = PushActionUpdate
+		if len(result.Diff) == 0 {
+			result.Action = PushActionUnchanged
+		}
+	}
+
+	if opts.DryRun || result.Action == PushActionUnchanged {
+		return result, nil
+	}
+
+	saved, err := saveFunction(ctx, config, http.MethodPut, payload)
+	if err != nil {
+		return result, err
+	}
+	result.ID = saved.ID
+	return result, nil
+}
+
+// functionPayload is the body of a create/replace function request.
+type functionPayload struct {
+	ProjectID      string         `json:"project_id"`
+	Name           string         `json:"name"`
+	Slug           string         `json:"slug"`
+	Description    string         `json:"description,omitempty"`
+	FunctionType   string         `json:"function_type,omitempty"`
+	FunctionData   map[string]any `json:"function_data"`
+	PromptData     *promptData    `json:"prompt_data,omitempty"`
+	FunctionSchema map[string]any `json:"function_schema,omitempty"`
+}
+
+type promptData struct {
+	Prompt        promptBlock    `json:"prompt"`
+	Options       *promptOptions `json:"options,omitempty"`
+	Parser        *promptParser  `json:"parser,omitempty"`
+	ToolFunctions []toolFunction `json:"tool_functions,omitempty"`
+}
+
+type promptBlock struct {
+	Type     string    `json:"type"`
+	Messages []Message `json:"messages"`
+	Tools    string    `json:"tools,omitempty"` // JSON-encoded tool definitions
+}
+
+type promptOptions struct {
+	Model  string         `json:"model,omitempty"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
+type promptParser struct {
+	Type         string             `json:"type"`
+	UseCoT       bool               `json:"use_cot"`
+	ChoiceScores map[string]float64 `json:"choice_scores"`
+}
+
+type toolFunction struct {
+	Type      string `json:"type"`
+	ID        string `json:"id,omitempty"`
+	ProjectID string `json:"project_id,omitempty"`
+	Slug      string `json:"slug,omitempty"`
+}
+
+func (p *Prompt) slug() string { return p.Slug }
+
+func (p *Prompt) payload(projectID string) (functionPayload, error) {
+	if err := validateDefinition(p.Name, p.Slug, p.Messages); err != nil {
+		return functionPayload{}, err
+	}
+
+	pd := newPromptData(p.Model, p.Messages, p.Params)
+	for _, tool := range p.Tools {
+		switch {
+		case tool.FunctionID != "":
+			pd.ToolFunctions = append(pd.ToolFunctions, toolFunction{Type: "function", ID: tool.FunctionID})
+		case tool.Slug != "":
+			toolProjectID := tool.ProjectID
+			if toolProjectID == "" {
+				toolProjectID = projectID
+			}
+			pd.ToolFunctions = append(pd.ToolFunctions, toolFunction{Type: "slug", ProjectID: toolProjectID, Slug: tool.Slug})
+		default:
+			return functionPayload{}, fmt.Errorf("tool reference needs a FunctionID or Slug")
+		}
+	}
+	if p.LocalTools != nil {
+		tools, err := json.Marshal(p.LocalTools.Definitions())
+		if err != nil {
+			return functionPayload{}, fmt.Errorf("failed to encode local tools: %w", err)
+		}
+		pd.Prompt.Tools = string(tools)
+	}
+
+	// function_type is omitted for prompts, not "prompt"
+	return functionPayload{
+		ProjectID:    projectID,
+		Name:         p.Name,
+		Slug:         p.Slug,
+		Description:  p.Description,
+		FunctionData: map[string]any{"type": "prompt"},
+		PromptData:   pd,
+	}, nil
+}
+
+func (s *Scorer) slug() string { return s.Slug }
+
+func (s *Scorer) payload(projectID string) (functionPayload, error) {
+	if err := validateDefinition(s.Name, s.Slug, s.Messages); err != nil {
+		return functionPayload{}, err
+	}
+	if len(s.ChoiceScores) == 0 {
+		return functionPayload{}, fmt.Errorf("scorer %q needs at least one choice score", s.Slug)
+	}
+
+	pd := newPromptData(s.Model, s.Messages, s.Params)
+	pd.Parser = &promptParser{
+		Type:         "llm_classifier",
+		UseCoT:       s.UseCoT,
+		ChoiceScores: s.ChoiceScores,
+	}
+
+	return functionPayload{
+		ProjectID:    projectID,
+		Name:         s.Name,
+		Slug:         s.Slug,
+		Description:  s.Description,
+		FunctionType: "scorer",
+		FunctionData: map[string]any{"type": "prompt"},
+		PromptData:   pd,
+	}, nil
+}
+
+func (t *Tool) slug() string { return t.Slug }
+
+func (t *Tool) payload(projectID string) (functionPayload, error) {
+	if err := validateDefinition(t.Name, t.Slug, t.Messages); err != nil {
+		return functionPayload{}, err
+	}
+
+	fp := functionPayload{
+		ProjectID:    projectID,
+		Name:         t.Name,
+		Slug:         t.Slug,
+		Description:  t.Description,
+		FunctionType: "tool",
+		FunctionData: map[string]any{"type": "prompt"},
+		PromptData:   newPromptData(t.Model, t.Messages, t.Params),
+	}
+	if t.Parameters != nil {
+		fp.FunctionSchema = map[string]any{"parameters": t.Parameters}
+	}
+	return fp, nil
+}
+
+func newPromptData(model string, messages []Message, params map[string]any) *promptData {
+	pd := &promptData{
+		Prompt: promptBlock{Type: "chat", Messages: messages},
+	}
+	if model != "" || len(params) > 0 {
+		pd.Options = &promptOptions{Model: model, Params: params}
+	}
+	return pd
+}
+
+func validateDefinition(name, slug string, messages []Message) error {
+	if slug == "" {
+		return fmt.Errorf("slug is required")
+	}
+	if name == "" {
+		return fmt.Errorf("name is required for %q", slug)
+	}
+	if len(messages) == 0 {
+		return fmt.Errorf("at least one message is required for %q", slug)
+	}
+	return nil
+}
+
+// findProjectID returns the ID of the project with the given name, or "" if it doesn't
+// exist. Unlike api.RegisterProject, it never creates the project.
+func findProjectID(ctx context.Context, config braintrust.Config, name string) (string, error) {
+	params := url.Values{}
+	params.Add("project_name", name)
+	params.Add("limit", "1")
+
+	fullURL := fmt.Sprintf("%s/v1/project?%s", config.APIURL, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+config.APIKey)
+
+	resp, err := defaultHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to make request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		Objects []struct {
+			ID string `json:"id"`
+		} `json:"objects"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(response.Objects) == 0 {
+		return "", nil
+	}
+	return response.Objects[0].ID, nil
+}
+
+// getFunctionRecord returns the raw server version of the function with the given
+// slug, or nil if it doesn't exist.
+func getFunctionRecord(ctx context.Context, config braintrust.Config, projectName, projectID, slug string) (map[string]any, error) {
+	params := url.Values{}
+	if projectID != "" {
+		params.Add("project_id", projectID)
+	} else {
+		params.Add("project_name", projectName)
+	}
+	params.Add("slug", slug)
+	params.Add("limit", "1")
+
+	fullURL := fmt.Sprintf("%s/v1/function?%s", config.APIURL, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+config.APIKey)
+
+	resp, err := defaultHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		Objects []map[string]any `json:"objects"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(response.Objects) == 0 {
+		return nil, nil
+	}
+	return response.Objects[0], nil
+}
+
+// saveFunction sends a function payload to the API. POST creates a function, PUT
+// creates or replaces it.
+func saveFunction(ctx context.Context, config braintrust.Config, method string, payload any) (*Function, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v1/function", config.APIURL)
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payloadBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+config.APIKey)
+
+	resp, err := defaultHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var saved Function
+	if err := json.NewDecoder(resp.Body).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &saved, nil
+}
+
+// managedKeys are the keys of the objects of a function that Push manages, by path
+// (with "[]" for list items). Managed keys on the server that a payload doesn't have,
+// like an optional field removed from a definition, are changes. Other keys on the
+// server are its own (ids, timestamps, etc), and are ignored. A nil list means every
+// key is managed.
+var managedKeys = map[string][]string{
+	"":                              {"name", "slug", "description", "function_type", "function_data", "prompt_data", "function_schema"},
+	"prompt_data":                   {"prompt", "options", "parser", "tool_functions"},
+	"prompt_data.prompt":            {"type", "messages", "tools"},
+	"prompt_data.prompt.messages[]": {"role", "content", "tool_calls", "tool_call_id"},
+	"prompt_data.options":           {"model", "params"},
+	"prompt_data.options.params":    nil,
+}
+
+var listIndex = regexp.MustCompile(`\[\d+\]`)
+
+// diffPayload compares a payload with the server version. The fields we send are
+// compared, and so are the managed keys the server has but the payload doesn't.
+func diffPayload(payload functionPayload, existing map[string]any) []string {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return []string{fmt.Sprintf("~ unable to encode payload: %v", err)}
+	}
+	var want map[string]any
+	if err := json.Unmarshal(b, &want); err != nil {
+		return []string{fmt.Sprintf("~ unable to decode payload: %v", err)}
+	}
+	// the project never changes for a slug lookup, and the server may omit it.
+	delete(want, "project_id")
+
+	var diff []string
+	diffValues("", want, existing, &diff)
+	return diff
+}
+
+func diffValues(path string, want, got any, diff *[]string) {
+	wantMap, wantIsMap := want.(map[string]any)
+	gotMap, gotIsMap := got.(map[string]any)
+	if wantIsMap && gotIsMap {
+		keys := make([]string, 0, len(wantMap))
+		for k := range wantMap {
+			keys = append(keys, k)
+		}
+		for k, v := range gotMap {
+			if _, ok := wantMap[k]; !ok && v != nil && isManaged(path, k) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffValues(joinPath(path, k), wantMap[k], gotMap[k], diff)
+		}
+		return
+	}
+
+	wantList, wantIsList := want.([]any)
+	gotList, gotIsList := got.([]any)
+	if wantIsList && gotIsList && len(wantList) == len(gotList) {
+		for i := range wantList {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), wantList[i], gotList[i], diff)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		*diff = append(*diff, fmt.Sprintf("~ %s: %s -> %s", path, formatValue(got), formatValue(want)))
+	}
+}
+
+// isManaged returns whether key is a managed key of the object at path.
+func isManaged(path, key string) bool {
+	keys, ok := managedKeys[listIndex.ReplaceAllString(path, "[]")]
+	if !ok {
+		return false
+	}
+	return keys == nil || slices.Contains(keys, key)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func formatValue(v any) string {
+	if v == nil {
+		return "<none>"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+var (
+	_ Definition = &Prompt{}
+	_ Definition = &Scorer{}
+	_ Definition = &Tool{}
+)
@@ -0,0 +1,252 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFunctionServer is an in-memory stand-in for the project and function endpoints.
+type fakeFunctionServer struct {
+	mu        sync.Mutex
+	project   bool                      // whether the project was created
+	functions map[string]map[string]any // slug => function
+	writes    int
+}
+
+func newFakeFunctionServer(t *testing.T) *fakeFunctionServer {
+	t.Helper()
+	fs := &fakeFunctionServer{functions: map[string]map[string]any{}}
+	server := httptest.NewServer(http.HandlerFunc(fs.handle))
+	t.Cleanup(server.Close)
+	t.Setenv("BRAINTRUST_API_KEY", "test-key")
+	t.Setenv("BRAINTRUST_API_URL", server.URL)
+	return fs
+}
+
+func (fs *fakeFunctionServer) handle(w http.ResponseWriter, r *http.Request) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/v1/project" && r.Method == http.MethodPost:
+		fs.project = true
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": "proj-1", "name": "test"})
+	case r.URL.Path == "/v1/project" && r.Method == http.MethodGet:
+		objects := []map[string]any{}
+		if fs.project && r.URL.Query().Get("project_name") == "test" {
+			objects = append(objects, map[string]any{"id": "proj-1", "name": "test"})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"objects": objects})
+	case r.URL.Path == "/v1/function" && r.Method == http.MethodGet:
+		objects := []map[string]any{}
+		if fn, ok := fs.functions[r.URL.Query().Get("slug")]; ok {
+			objects = append(objects, fn)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"objects": objects})
+	case r.URL.Path == "/v1/function" && r.Method == http.MethodPut:
+		var fn map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&fn); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slug, _ := fn["slug"].(string)
+		fn["id"] = "fn-" + slug
+		fn["_xact_id"] = "1000"
+		fs.functions[slug] = fn
+		fs.writes++
+		_ = json.NewEncoder(w).Encode(fn)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (fs *fakeFunctionServer) get(slug string) map[string]any {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.functions[slug]
+}
+
+func (fs *fakeFunctionServer) writeCount() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.writes
+}
+
+func testPrompt() *Prompt {
+	return &Prompt{
+		Name:  "Greeter",
+		Slug:  "greeter",
+		Model: "gpt-4o-mini",
+		Messages: []Message{
+			{Role: "system", Content: "You greet people."},
+			{Role: "user", Content: "Say hi to {{input}}"},
+		},
+		Params: map[string]any{"temperature": 0},
+		Tools:  []ToolRef{{Slug: "lookup"}},
+	}
+}
+
+func TestPush(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	fs := newFakeFunctionServer(t)
+	ctx := context.Background()
+	opts := PushOpts{Project: "test"}
+
+	scorer := &Scorer{
+		Name:         "Polite",
+		Slug:         "polite",
+		Model:        "gpt-4o-mini",
+		Messages:     []Message{{Role: "user", Content: "Is {{output}} polite? Answer yes or no."}},
+		ChoiceScores: map[string]float64{"yes": 1, "no": 0},
+		UseCoT:       true,
+	}
+	tool := &Tool{
+		Name:       "Lookup",
+		Slug:       "lookup",
+		Messages:   []Message{{Role: "user", Content: "Look up {{query}}"}},
+		Parameters: map[string]any{"type": "object", "properties": map[string]any{"query": map[string]any{"type": "string"}}},
+	}
+
+	// first push creates everything
+	results, err := Push(ctx, opts, testPrompt(), scorer, tool)
+	require.NoError(err)
+	require.Len(results, 3)
+	for _, r := range results {
+		assert.Equal(PushActionCreate, r.Action)
+		assert.Equal("fn-"+r.Slug, r.ID)
+	}
+	assert.Equal(3, fs.writeCount())
+
+	prompt := fs.get("greeter")
+	assert.Nil(prompt["function_type"])
+	assert.Equal("proj-1", prompt["project_id"])
+	promptData := prompt["prompt_data"].(map[string]any)
+	assert.Equal(map[string]any{"model": "gpt-4o-mini", "params": map[string]any{"temperature": float64(0)}}, promptData["options"])
+	assert.Equal([]any{map[string]any{"type": "slug", "project_id": "proj-1", "slug": "lookup"}}, promptData["tool_functions"])
+
+	assert.Equal("scorer", fs.get("polite")["function_type"])
+	parser := fs.get("polite")["prompt_data"].(map[string]any)["parser"]
+	assert.Equal(map[string]any{"type": "llm_classifier", "use_cot": true, "choice_scores": map[string]any{"yes": float64(1), "no": float64(0)}}, parser)
+
+	assert.Equal("tool", fs.get("lookup")["function_type"])
+	assert.NotNil(fs.get("lookup")["function_schema"])
+
+	// pushing the same definitions again is a no-op
+	results, err = Push(ctx, opts, testPrompt(), scorer, tool)
+	require.NoError(err)
+	for _, r := range results {
+		assert.Equal(PushActionUnchanged, r.Action, r.Diff)
+		assert.Empty(r.Diff)
+	}
+	assert.Equal(3, fs.writeCount())
+
+	// changing a definition only updates that one
+	changed := testPrompt()
+	changed.Model = "gpt-4o"
+	results, err = Push(ctx, opts, changed, scorer)
+	require.NoError(err)
+	assert.Equal(PushActionUpdate, results[0].Action)
+	assert.Equal([]string{`~ prompt_data.options.model: "gpt-4o-mini" -> "gpt-4o"`}, results[0].Diff)
+	assert.Equal(PushActionUnchanged, results[1].Action)
+	assert.Equal(4, fs.writeCount())
+}
+
+func TestPush_DryRun(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	fs := newFakeFunctionServer(t)
+	ctx := context.Background()
+
+	results, err := Push(ctx, PushOpts{Project: "test", DryRun: true}, testPrompt())
+	require.NoError(err)
+	assert.Equal(PushActionCreate, results[0].Action)
+	assert.Empty(results[0].ID)
+	assert.Equal(0, fs.writeCount())
+
+	_, err = Push(ctx, PushOpts{Project: "test"}, testPrompt())
+	require.NoError(err)
+
+	// the project is looked up by name, so its slug tool refs match the server's
+	results, err = Push(ctx, PushOpts{Project: "test", DryRun: true}, testPrompt())
+	require.NoError(err)
+	assert.Equal(PushActionUnchanged, results[0].Action)
+	assert.Empty(results[0].Diff)
+
+	changed := testPrompt()
+	changed.Messages[1].Content = "Say hello to {{input}}"
+	results, err = Push(ctx, PushOpts{ProjectID: "proj-1", DryRun: true}, changed)
+	require.NoError(err)
+	assert.Equal(PushActionUpdate, results[0].Action)
+	assert.Equal("fn-greeter", results[0].ID)
+	assert.Equal([]string{`~ prompt_data.prompt.messages[1].content: "Say hi to {{input}}" -> "Say hello to {{input}}"`}, results[0].Diff)
+	assert.Equal(1, fs.writeCount())
+}
+
+func TestPush_Validation(t *testing.T) {
+	newFakeFunctionServer(t)
+	ctx := context.Background()
+
+	_, err := Push(ctx, PushOpts{}, testPrompt())
+	assert.Error(t, err)
+
+	_, err = Push(ctx, PushOpts{Project: "test"}, &Prompt{Name: "No slug", Messages: []Message{{Role: "user", Content: "hi"}}})
+	assert.Error(t, err)
+
+	_, err = Push(ctx, PushOpts{Project: "test"}, &Scorer{Name: "No choices", Slug: "s", Messages: []Message{{Role: "user", Content: "hi"}}})
+	assert.Error(t, err)
+
+	_, err = Push(ctx, PushOpts{Project: "test"}, &Prompt{Name: "Bad tool", Slug: "p", Messages: []Message{{Role: "user", Content: "hi"}}, Tools: []ToolRef{{}}})
+	assert.Error(t, err)
+}
+
+func TestPush_RemovedFields(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	fs := newFakeFunctionServer(t)
+	ctx := context.Background()
+	opts := PushOpts{Project: "test"}
+
+	prompt := testPrompt()
+	prompt.Description = "Greets people"
+	_, err := Push(ctx, opts, prompt)
+	require.NoError(err)
+	assert.Equal(1, fs.writeCount())
+
+	// removing optional fields is a change, so the server doesn't keep them
+	removed := testPrompt()
+	removed.Params = nil
+	removed.Tools = nil
+	results, err := Push(ctx, opts, removed)
+	require.NoError(err)
+	assert.Equal(PushActionUpdate, results[0].Action)
+	assert.Equal([]string{
+		`~ description: "Greets people" -> <none>`,
+		`~ prompt_data.options.params: {"temperature":0} -> <none>`,
+		`~ prompt_data.tool_functions: [{"project_id":"proj-1","slug":"lookup","type":"slug"}] -> <none>`,
+	}, results[0].Diff)
+	assert.Equal(2, fs.writeCount())
+	assert.Nil(fs.get("greeter")["description"])
+
+	// a removed param is a change too
+	results, err = Push(ctx, opts, prompt)
+	require.NoError(err)
+	assert.Equal(PushActionUpdate, results[0].Action)
+	prompt.Params = map[string]any{}
+	results, err = Push(ctx, opts, prompt)
+	require.NoError(err)
+	assert.Equal(PushActionUpdate, results[0].Action)
+	assert.Equal([]string{`~ prompt_data.options.params: {"temperature":0} -> <none>`}, results[0].Diff)
+
+	// keys the server adds aren't changes
+	results, err = Push(ctx, opts, prompt)
+	require.NoError(err)
+	assert.Equal(PushActionUnchanged, results[0].Action, results[0].Diff)
+}
@@ -0,0 +1,423 @@
+package functions
+
+// this file consumes the server-sent event stream of a streaming function invocation.
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	attr "go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+)
+
+// streamingHTTPClient is used for streaming invocations. It has no overall timeout
+// because streams can run for a long time; use the context to cancel them.
+var streamingHTTPClient = &http.Client{}
+
+// DeltaType is the type of a streamed [Delta].
+type DeltaType string
+
+const (
+	// DeltaText is a chunk of text output.
+	DeltaText DeltaType = "text_delta"
+	// DeltaReasoning is a chunk of the model's reasoning.
+	DeltaReasoning DeltaType = "reasoning_delta"
+	// DeltaJSON is a fragment of JSON output. Fragments are only valid JSON once joined.
+	DeltaJSON DeltaType = "json_delta"
+	// DeltaToolCall is a complete tool call requested by the function.
+	DeltaToolCall DeltaType = "tool_call"
+	// DeltaError is an error reported by the server during the stream.
+	DeltaError DeltaType = "error"
+	// DeltaDone marks the end of the stream.
+	DeltaDone DeltaType = "done"
+)
+
+// Delta is a single event from a streaming function invocation.
+type Delta struct {
+	Type     DeltaType
+	Data     string    // Text, reasoning or JSON fragment, or the error message
+	ToolCall *ToolCall // Set for DeltaToolCall
+}
+
+// ToolCall is a tool call requested by a hosted function.
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string // JSON-encoded arguments
+}
+
+// MarshalJSON encodes the tool call in the OpenAI format, so it can be sent back
+// to the function in an assistant message.
+func (tc ToolCall) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"id":   tc.ID,
+		"type": "function",
+		"function": map[string]any{
+			"name":      tc.Name,
+			"arguments": tc.Arguments,
+		},
+	})
+}
+
+// Stream is a streaming function invocation. Call Next until it returns io.EOF,
+// then Output returns the aggregated output. A Stream is not safe for concurrent use.
+//
+// If InvokeOpts.Tools is set, the stream runs the tools the function calls and
+// continues with a new invocation, so a single Stream can span several rounds. Each
+// round has its own "function: <slug>" span, and DeltaDone is only returned at the end.
+type Stream struct {
+	ctx    context.Context
+	opts   invokeOptions
+	rounds int
+
+	// the current round
+	span    trace.Span
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	text    strings.Builder
+	json    strings.Builder
+	calls   []*ToolCall // tool calls to run before the next round
+	done    bool
+
+	pending []Delta
+	output  any
+	err     error
+}
+
+// InvokeStream invokes a Braintrust function and streams its output. The
+// "function: <slug>" span ends when the stream ends or is closed, and records the
+// aggregated output.
+//
+// Example:
+//
+//	stream, err := functions.InvokeStream(ctx, functions.InvokeOpts{Project: "my-project", Slug: "my-prompt"}, input)
+//	if err != nil {
+//	    return err
+//	}
+//	defer stream.Close()
+//	for {
+//	    delta, err := stream.Next()
+//	    if err == io.EOF {
+//	        break
+//	    }
+//	    if err != nil {
+//	        return err
+//	    }
+//	    if delta.Type == functions.DeltaText {
+//	        fmt.Print(delta.Data)
+//	    }
+//	}
+func InvokeStream(ctx context.Context, opts InvokeOpts, input any) (*Stream, error) {
+	return invokeStream(ctx, opts.invokeOptions(input))
+}
+
+func invokeStream(ctx context.Context, opts invokeOptions) (*Stream, error) {
+	if err := validateInvokeOptions(opts); err != nil {
+		return nil, err
+	}
+	if opts.Tools != nil {
+		opts = withToolDefaults(opts)
+	}
+
+	s := &Stream{ctx: ctx, opts: opts}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open starts a new round of the stream.
+func (s *Stream) open() error {
+	ctx, span := startInvokeSpan(s.ctx, s.opts)
+
+	// fail ends the span, because on success the stream owns it.
+	fail := func(err error) error {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return err
+	}
+
+	config := braintrust.GetConfig()
+	if config.APIKey == "" {
+		return fail(fmt.Errorf("BRAINTRUST_API_KEY is required"))
+	}
+
+	req, err := newInvokeRequest(ctx, config, s.opts, true)
+	if err != nil {
+		return fail(err)
+	}
+
+	resp, err := streamingHTTPClient.Do(req)
+	if err != nil {
+		return fail(fmt.Errorf("failed to invoke function: %w", err))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return fail(&InvokeError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	// deltas are small, but errors and final JSON payloads can be large.
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	s.span = span
+	s.body = resp.Body
+	s.scanner = scanner
+	s.text.Reset()
+	s.json.Reset()
+	s.calls = nil
+	s.done = false
+	return nil
+}
+
+// Next returns the next delta in the stream. It returns io.EOF after the
+// DeltaDone delta has been returned.
+func (s *Stream) Next() (Delta, error) {
+	for {
+		if len(s.pending) > 0 {
+			d := s.pending[0]
+			s.pending = s.pending[1:]
+			return d, nil
+		}
+		if s.done {
+			if s.err != nil {
+				return Delta{}, s.err
+			}
+			if len(s.calls) > 0 {
+				if err := s.nextRound(); err != nil {
+					s.err = err
+				}
+				continue
+			}
+			return Delta{}, io.EOF
+		}
+
+		event, data, err := s.readEvent()
+		if err != nil {
+			s.finish(err)
+			continue
+		}
+		s.handleEvent(event, data)
+	}
+}
+
+// nextRound runs the tools called in the current round and streams the function's
+// response to their results.
+func (s *Stream) nextRound() error {
+	_ = s.body.Close()
+
+	s.rounds++
+	if s.rounds > s.opts.MaxRounds {
+		return fmt.Errorf("function still calling tools after %d rounds", s.opts.MaxRounds)
+	}
+
+	results, err := runToolCalls(s.ctx, s.opts.Tools, s.calls)
+	if err != nil {
+		return err
+	}
+	s.opts.Messages = append(s.opts.Messages, results...)
+	return s.open()
+}
+
+// Output returns the aggregated output of the stream: the parsed JSON value if the
+// function produced JSON, and the concatenated text otherwise. It is only set once
+// Next has returned io.EOF.
+func (s *Stream) Output() any {
+	return s.output
+}
+
+// errStreamClosed is the error of a stream closed before it was done.
+var errStreamClosed = errors.New("stream closed before the function was done")
+
+// Close stops reading the stream and ends its span. If the stream isn't done, the
+// span records the partial output and is marked as cancelled with an error status.
+// It is safe to call Close after the stream is done.
+func (s *Stream) Close() error {
+	if !s.done {
+		s.cancel()
+	}
+	s.calls = nil
+	return s.body.Close()
+}
+
+// readEvent reads the next server-sent event. It returns io.EOF if the stream ends
+// without a done event.
+func (s *Stream) readEvent() (event, data string, err error) {
+	var dataLines []string
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		switch {
+		case line == "":
+			if event != "" || len(dataLines) > 0 {
+				return event, strings.Join(dataLines, "\n"), nil
+			}
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			dataLines = append(dataLines, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		return "", "", err
+	}
+	if event != "" || len(dataLines) > 0 {
+		return event, strings.Join(dataLines, "\n"), nil
+	}
+	return "", "", io.EOF
+}
+
+func (s *Stream) handleEvent(event, data string) {
+	switch DeltaType(event) {
+	case DeltaText, DeltaReasoning:
+		// text is JSON-encoded so it can contain newlines.
+		var text string
+		if err := json.Unmarshal([]byte(data), &text); err != nil {
+			text = data
+		}
+		if DeltaType(event) == DeltaText {
+			s.text.WriteString(text)
+		}
+		s.pending = append(s.pending, Delta{Type: DeltaType(event), Data: text})
+	case DeltaJSON:
+		s.json.WriteString(data)
+		s.pending = append(s.pending, Delta{Type: DeltaJSON, Data: data})
+	case DeltaError:
+		var msg string
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			msg = data
+		}
+		s.span.AddEvent("exception", trace.WithAttributes(
+			attr.String("exception.type", "StreamError"),
+			attr.String("exception.message", msg),
+		))
+		s.span.SetStatus(codes.Error, msg)
+		s.pending = append(s.pending, Delta{Type: DeltaError, Data: msg})
+	case DeltaDone:
+		s.finish(nil)
+	default:
+		// progress, console and start events aren't surfaced.
+	}
+}
+
+// finish aggregates the output, queues tool calls and the done delta, and ends the span.
+func (s *Stream) finish(err error) {
+	if s.done {
+		return
+	}
+	s.done = true
+
+	if err != nil && err != io.EOF {
+		s.err = err
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+		s.span.End()
+		return
+	}
+
+	s.output = s.aggregate()
+	calls := parseToolCalls(s.output)
+	for _, tc := range calls {
+		s.pending = append(s.pending, Delta{Type: DeltaToolCall, ToolCall: tc})
+	}
+	if s.opts.Tools != nil && len(calls) > 0 {
+		// Next will run the tools and start the next round
+		s.calls = calls
+	} else {
+		s.pending = append(s.pending, Delta{Type: DeltaDone})
+	}
+
+	s.setOutput(s.output)
+	s.span.End()
+}
+
+// cancel ends the span of a stream closed before it was done, with the partial output.
+// Next returns errStreamClosed after it.
+func (s *Stream) cancel() {
+	s.done = true
+	s.err = errStreamClosed
+	s.setOutput(s.aggregate())
+	s.span.RecordError(errStreamClosed)
+	s.span.SetStatus(codes.Error, "cancelled: "+errStreamClosed.Error())
+	s.span.End()
+}
+
+// aggregate returns the output of the current round so far: the parsed JSON value if
+// the function produced JSON, and the concatenated text otherwise.
+func (s *Stream) aggregate() any {
+	if s.json.Len() == 0 {
+		return s.text.String()
+	}
+	var v any
+	if err := json.Unmarshal([]byte(s.json.String()), &v); err != nil {
+		return s.json.String()
+	}
+	return v
+}
+
+func (s *Stream) setOutput(output any) {
+	if b, err := json.Marshal(output); err == nil {
+		s.span.SetAttributes(attr.String("braintrust.output_json", string(b)))
+	}
+}
+
+// parseToolCalls extracts tool calls from a function's output. Functions that stop to
+// call tools return them as a list in the OpenAI format
+// ({"id", "type": "function", "function": {"name", "arguments"}}) or as flat
+// {"id", "type": "function", "name", "arguments"} objects. Other lists, like
+// [{"name": "Alice"}], are output, so every item must have an id and a function
+// object, or the "function" type.
+func parseToolCalls(output any) []*ToolCall {
+	list, ok := output.([]any)
+	if !ok {
+		return nil
+	}
+
+	var calls []*ToolCall
+	for _, item := range list {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil
+		}
+		id, _ := m["id"].(string)
+		typ, _ := m["type"].(string)
+		fn, hasFunction := m["function"].(map[string]any)
+		if !(id != "" && hasFunction) && typ != "function" {
+			return nil
+		}
+		fields := m
+		if hasFunction {
+			fields = fn
+		}
+		name, _ := fields["name"].(string)
+		if name == "" {
+			return nil
+		}
+		tc := &ToolCall{ID: id, Name: name}
+		switch args := fields["arguments"].(type) {
+		case string:
+			tc.Arguments = args
+		case nil:
+			tc.Arguments = "{}"
+		default:
+			b, err := json.Marshal(args)
+			if err != nil {
+				return nil
+			}
+			tc.Arguments = string(b)
+		}
+		calls = append(calls, tc)
+	}
+	return calls
+}
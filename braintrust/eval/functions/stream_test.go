@@ -0,0 +1,173 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/oteltest"
+)
+
+// newSSEServer returns a server that answers invoke requests with the given events.
+func newSSEServer(t *testing.T, events ...string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/function/fn-123/invoke" {
+			http.NotFound(w, r)
+			return
+		}
+		var payload map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload["stream"] != true {
+			http.Error(w, "expected a streaming request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			_, _ = fmt.Fprint(w, e)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("BRAINTRUST_API_KEY", "test-key")
+	t.Setenv("BRAINTRUST_API_URL", server.URL)
+}
+
+func readAll(t *testing.T, stream *Stream) []Delta {
+	t.Helper()
+	var deltas []Delta
+	for {
+		d, err := stream.Next()
+		if err == io.EOF {
+			return deltas
+		}
+		require.NoError(t, err)
+		deltas = append(deltas, d)
+	}
+}
+
+func TestInvokeStream_Text(t *testing.T) {
+	assert := assert.New(t)
+	newSSEServer(t,
+		"event: start\ndata: \n\n",
+		"event: text_delta\ndata: \"Hello\"\n\n",
+		"event: text_delta\ndata: \", world\\n\"\n\n",
+		"event: done\ndata: \n\n",
+	)
+	_, exporter := oteltest.Setup(t, braintrust.WithOrgName("test-org"))
+
+	stream, err := InvokeStream(context.Background(), InvokeOpts{FunctionID: "fn-123"}, "hi")
+	require.NoError(t, err)
+	defer func() { _ = stream.Close() }()
+
+	deltas := readAll(t, stream)
+	assert.Equal([]Delta{
+		{Type: DeltaText, Data: "Hello"},
+		{Type: DeltaText, Data: ", world\n"},
+		{Type: DeltaDone},
+	}, deltas)
+	assert.Equal("Hello, world\n", stream.Output())
+
+	span := exporter.FlushOne()
+	assert.Equal("function: fn-123", span.Name())
+	assert.Equal("Hello, world\n", span.Output())
+}
+
+func TestInvokeStream_JSONAndToolCalls(t *testing.T) {
+	assert := assert.New(t)
+	newSSEServer(t,
+		"event: json_delta\ndata: [{\"id\":\"call_1\",\"type\":\"function\",\n\n",
+		"event: json_delta\ndata: \"function\":{\"name\":\"lookup\",\"arguments\":\"{\\\"q\\\":\\\"go\\\"}\"}}]\n\n",
+		"event: done\ndata: \n\n",
+	)
+	_, exporter := oteltest.Setup(t, braintrust.WithOrgName("test-org"))
+
+	stream, err := InvokeStream(context.Background(), InvokeOpts{FunctionID: "fn-123"}, "hi")
+	require.NoError(t, err)
+
+	deltas := readAll(t, stream)
+	require.Len(t, deltas, 4)
+	assert.Equal(DeltaJSON, deltas[0].Type)
+	assert.Equal(DeltaJSON, deltas[1].Type)
+	assert.Equal(Delta{Type: DeltaToolCall, ToolCall: &ToolCall{ID: "call_1", Name: "lookup", Arguments: `{"q":"go"}`}}, deltas[2])
+	assert.Equal(DeltaDone, deltas[3].Type)
+	assert.NoError(stream.Close())
+
+	span := exporter.FlushOne()
+	output, ok := span.Output().([]any)
+	require.True(t, ok)
+	assert.Len(output, 1)
+}
+
+func TestInvokeStream_Error(t *testing.T) {
+	assert := assert.New(t)
+	newSSEServer(t,
+		"event: text_delta\ndata: \"partial\"\n\n",
+		"event: error\ndata: \"rate limited\"\n\n",
+		"event: done\ndata: \n\n",
+	)
+	_, exporter := oteltest.Setup(t, braintrust.WithOrgName("test-org"))
+
+	stream, err := InvokeStream(context.Background(), InvokeOpts{FunctionID: "fn-123"}, "hi")
+	require.NoError(t, err)
+
+	deltas := readAll(t, stream)
+	assert.Equal([]Delta{
+		{Type: DeltaText, Data: "partial"},
+		{Type: DeltaError, Data: "rate limited"},
+		{Type: DeltaDone},
+	}, deltas)
+
+	span := exporter.FlushOne()
+	assert.Equal(codes.Error, span.Status().Code)
+	assert.Equal("rate limited", span.Status().Description)
+}
+
+func TestInvokeStream_CloseEarly(t *testing.T) {
+	newSSEServer(t,
+		"event: text_delta\ndata: \"one\"\n\n",
+		"event: text_delta\ndata: \"two\"\n\n",
+	)
+	_, exporter := oteltest.Setup(t, braintrust.WithOrgName("test-org"))
+
+	stream, err := InvokeStream(context.Background(), InvokeOpts{FunctionID: "fn-123"}, "hi")
+	require.NoError(t, err)
+
+	d, err := stream.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "one", d.Data)
+	require.NoError(t, stream.Close())
+	_, err = stream.Next()
+	assert.ErrorIs(t, err, errStreamClosed)
+
+	// the partial output is recorded, but the span isn't a success
+	span := exporter.FlushOne()
+	assert.Equal(t, "one", span.Output())
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Equal(t, "cancelled: stream closed before the function was done", span.Status().Description)
+}
+
+func TestInvokeStream_HTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	defer server.Close()
+	t.Setenv("BRAINTRUST_API_KEY", "test-key")
+	t.Setenv("BRAINTRUST_API_URL", server.URL)
+	_, exporter := oteltest.Setup(t, braintrust.WithOrgName("test-org"))
+
+	_, err := InvokeStream(context.Background(), InvokeOpts{FunctionID: "fn-123"}, "hi")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "403")
+
+	span := exporter.FlushOne()
+	assert.Equal(t, codes.Error, span.Status().Code)
+}
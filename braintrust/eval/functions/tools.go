@@ -0,0 +1,304 @@
+package functions
+
+// this file runs tools requested by hosted functions in the local Go process.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	attr "go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// defaultMaxToolRounds is the default number of times a function can call tools
+// before we give up.
+const defaultMaxToolRounds = 10
+
+// LocalTool is a tool implemented in Go that hosted functions can call. Create one
+// with [NewLocalTool].
+type LocalTool struct {
+	name        string
+	description string
+	parameters  map[string]any
+	call        func(ctx context.Context, arguments string) (any, error)
+}
+
+// NewLocalTool creates a tool with the given name and handler. The JSON schema of the
+// tool's parameters is derived from I, which should be a struct. Field names come
+// from `json` tags, fields without `omitempty` are required, and a `description`
+// tag documents a field for the model.
+//
+// Example:
+//
+//	type WeatherInput struct {
+//	    City string `json:"city" description:"The city to get the weather for"`
+//	}
+//
+//	weather := functions.NewLocalTool("get_weather", "Get the current weather",
+//	    func(ctx context.Context, in WeatherInput) (string, error) {
+//	        return "sunny", nil
+//	    })
+func NewLocalTool[I, O any](name, description string, handler func(ctx context.Context, input I) (O, error)) *LocalTool {
+	return &LocalTool{
+		name:        name,
+		description: description,
+		parameters:  jsonSchemaFor(reflect.TypeOf((*I)(nil)).Elem()),
+		call: func(ctx context.Context, arguments string) (any, error) {
+			var input I
+			if strings.TrimSpace(arguments) != "" {
+				if err := json.Unmarshal([]byte(arguments), &input); err != nil {
+					return nil, fmt.Errorf("invalid arguments for tool %q: %w", name, err)
+				}
+			}
+			return handler(ctx, input)
+		},
+	}
+}
+
+// Name returns the tool's name.
+func (t *LocalTool) Name() string {
+	return t.name
+}
+
+// Parameters returns the JSON schema of the tool's parameters.
+func (t *LocalTool) Parameters() map[string]any {
+	return t.parameters
+}
+
+// Definition returns the tool in the OpenAI function calling format.
+func (t *LocalTool) Definition() map[string]any {
+	function := map[string]any{
+		"name":       t.name,
+		"parameters": t.parameters,
+	}
+	if t.description != "" {
+		function["description"] = t.description
+	}
+	return map[string]any{
+		"type":     "function",
+		"function": function,
+	}
+}
+
+// ToolRegistry holds the local tools available to hosted functions. Set it on
+// [InvokeOpts] to run the tools a function calls, and feed the results back to the
+// function until it finishes. It is safe for concurrent use.
+type ToolRegistry struct {
+	mu    sync.RWMutex
+	tools map[string]*LocalTool
+}
+
+// NewToolRegistry creates a registry with the given tools.
+func NewToolRegistry(tools ...*LocalTool) *ToolRegistry {
+	r := &ToolRegistry{tools: make(map[string]*LocalTool, len(tools))}
+	for _, t := range tools {
+		r.Register(t)
+	}
+	return r
+}
+
+// Register adds a tool to the registry, replacing any tool with the same name.
+func (r *ToolRegistry) Register(tool *LocalTool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tools[tool.name] = tool
+}
+
+// Get returns the tool with the given name.
+func (r *ToolRegistry) Get(name string) (*LocalTool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+// Definitions returns the definitions of all tools, sorted by name.
+func (r *ToolRegistry) Definitions() []map[string]any {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	defs := make([]map[string]any, len(names))
+	for i, name := range names {
+		defs[i] = r.tools[name].Definition()
+	}
+	return defs
+}
+
+// runToolCalls runs the given tool calls and returns the messages to send back to
+// the function: the assistant message that requested the calls and one tool message
+// per result. Tool errors are sent back to the function so it can recover, but
+// unknown tools are an error.
+func runToolCalls(ctx context.Context, registry *ToolRegistry, calls []*ToolCall) ([]Message, error) {
+	assistant := Message{Role: "assistant"}
+	for _, call := range calls {
+		assistant.ToolCalls = append(assistant.ToolCalls, *call)
+	}
+	messages := []Message{assistant}
+
+	for _, call := range calls {
+		tool, ok := registry.Get(call.Name)
+		if !ok {
+			return nil, fmt.Errorf("no local tool registered for %q", call.Name)
+		}
+		messages = append(messages, Message{
+			Role:       "tool",
+			ToolCallID: call.ID,
+			Content:    runTool(ctx, tool, call),
+		})
+	}
+	return messages, nil
+}
+
+// runTool runs a single tool in a "tool" span and returns the content to send back.
+func runTool(ctx context.Context, tool *LocalTool, call *ToolCall) string {
+	tracer := otel.GetTracerProvider().Tracer("braintrust.functions")
+	ctx, span := tracer.Start(ctx, tool.name)
+	defer span.End()
+
+	spanAttrs, _ := json.Marshal(map[string]any{"type": "tool"})
+	span.SetAttributes(attr.String("braintrust.span_attributes", string(spanAttrs)))
+	span.SetAttributes(attr.String("braintrust.input_json", jsonOrString(call.Arguments)))
+	metadata, _ := json.Marshal(map[string]any{"tool_call_id": call.ID})
+	span.SetAttributes(attr.String("braintrust.metadata", string(metadata)))
+
+	result, err := tool.call(ctx, call.Arguments)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Sprintf("error: %v", err)
+	}
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Sprintf("error: failed to encode result: %v", err)
+	}
+	span.SetAttributes(attr.String("braintrust.output_json", string(b)))
+
+	// send strings as-is rather than JSON-encoded
+	if s, ok := result.(string); ok {
+		return s
+	}
+	return string(b)
+}
+
+// jsonOrString returns s if it is valid JSON and a JSON encoded string otherwise.
+func jsonOrString(s string) string {
+	if json.Valid([]byte(s)) {
+		return s
+	}
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonSchemaFor derives a JSON schema from a Go type.
+func jsonSchemaFor(t reflect.Type) map[string]any {
+	return schemaFor(t, map[reflect.Type]bool{})
+}
+
+func schemaFor(t reflect.Type, seen map[reflect.Type]bool) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte is encoded as a base64 string
+			return map[string]any{"type": "string"}
+		}
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			// recursive types can't be expressed without refs, so allow anything.
+			return map[string]any{}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		properties := map[string]any{}
+		required := []string{}
+		addStructFields(t, seen, properties, &required)
+
+		schema := map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		// interfaces and anything else can hold any JSON value
+		return map[string]any{}
+	}
+}
+
+func addStructFields(t reflect.Type, seen map[reflect.Type]bool, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		// embedded structs without a name are flattened, like encoding/json does
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addStructFields(ft, seen, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := schemaFor(field.Type, seen)
+		if desc := field.Tag.Get("description"); desc != "" {
+			schema["description"] = desc
+		}
+		properties[name] = schema
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			*required = append(*required, name)
+		}
+	}
+}
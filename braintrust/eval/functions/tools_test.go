@@ -0,0 +1,341 @@
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/oteltest"
+)
+
+type weatherInput struct {
+	City  string `json:"city" description:"The city to get the weather for"`
+	Units string `json:"units,omitempty"`
+}
+
+func newWeatherTool(calls *[]weatherInput) *LocalTool {
+	return NewLocalTool("get_weather", "Get the current weather",
+		func(_ context.Context, in weatherInput) (map[string]any, error) {
+			*calls = append(*calls, in)
+			if in.City == "" {
+				return nil, fmt.Errorf("city is required")
+			}
+			return map[string]any{"city": in.City, "forecast": "sunny"}, nil
+		})
+}
+
+func TestJSONSchemaFor(t *testing.T) {
+	type Base struct {
+		ID string `json:"id"`
+	}
+	type Node struct {
+		Children []Node `json:"children,omitempty"`
+	}
+	type input struct {
+		Base
+		Name     string            `json:"name" description:"Who to greet"`
+		Count    int               `json:"count,omitempty"`
+		Ratio    *float64          `json:"ratio"`
+		Tags     []string          `json:"tags"`
+		Labels   map[string]bool   `json:"labels,omitempty"`
+		When     time.Time         `json:"when"`
+		Raw      []byte            `json:"raw,omitempty"`
+		Any      any               `json:"any,omitempty"`
+		Tree     Node              `json:"tree,omitempty"`
+		Skipped  string            `json:"-"`
+		NoTag    bool              //nolint:revive
+		internal string            //nolint:unused
+		Nested   map[string][]Base `json:"nested,omitempty"`
+	}
+
+	expected := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id":     map[string]any{"type": "string"},
+			"name":   map[string]any{"type": "string", "description": "Who to greet"},
+			"count":  map[string]any{"type": "integer"},
+			"ratio":  map[string]any{"type": "number"},
+			"tags":   map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"labels": map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "boolean"}},
+			"when":   map[string]any{"type": "string", "format": "date-time"},
+			"raw":    map[string]any{"type": "string"},
+			"any":    map[string]any{},
+			"tree": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"children": map[string]any{"type": "array", "items": map[string]any{}},
+				},
+				"additionalProperties": false,
+			},
+			"NoTag": map[string]any{"type": "boolean"},
+			"nested": map[string]any{"type": "object", "additionalProperties": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type":                 "object",
+					"properties":           map[string]any{"id": map[string]any{"type": "string"}},
+					"required":             []string{"id"},
+					"additionalProperties": false,
+				},
+			}},
+		},
+		"required":             []string{"id", "name", "ratio", "tags", "when", "NoTag"},
+		"additionalProperties": false,
+	}
+
+	var in input
+	_ = in.internal
+	assert.Equal(t, expected, NewLocalTool("t", "", func(context.Context, input) (string, error) { return "", nil }).Parameters())
+}
+
+func TestToolRegistry_Definitions(t *testing.T) {
+	var calls []weatherInput
+	registry := NewToolRegistry(newWeatherTool(&calls))
+	registry.Register(NewLocalTool("add", "", func(_ context.Context, in struct{ A, B int }) (int, error) {
+		return in.A + in.B, nil
+	}))
+
+	defs := registry.Definitions()
+	require.Len(t, defs, 2)
+	assert.Equal(t, "add", defs[0]["function"].(map[string]any)["name"])
+	assert.NotContains(t, defs[0]["function"], "description")
+	assert.Equal(t, map[string]any{
+		"type": "function",
+		"function": map[string]any{
+			"name":        "get_weather",
+			"description": "Get the current weather",
+			"parameters":  registry.tools["get_weather"].Parameters(),
+		},
+	}, defs[1])
+
+	_, ok := registry.Get("missing")
+	assert.False(t, ok)
+}
+
+// newToolLoopServer returns a server that asks for the weather until it sees a tool
+// result, then answers with the tool result.
+func newToolLoopServer(t *testing.T, stream bool) *[]map[string]any {
+	t.Helper()
+	var mu sync.Mutex
+	var payloads []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		mu.Lock()
+		payloads = append(payloads, payload)
+		mu.Unlock()
+
+		var toolResult string
+		if messages, ok := payload["messages"].([]any); ok {
+			last := messages[len(messages)-1].(map[string]any)
+			if last["role"] == "tool" {
+				toolResult, _ = last["content"].(string)
+			}
+		}
+
+		toolCalls := `[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]`
+		switch {
+		case stream && toolResult == "":
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprintf(w, "event: json_delta\ndata: %s\n\nevent: done\ndata: \n\n", toolCalls)
+		case stream:
+			answer, _ := json.Marshal("The weather is " + toolResult)
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprintf(w, "event: text_delta\ndata: %s\n\nevent: done\ndata: \n\n", answer)
+		case toolResult == "":
+			_, _ = fmt.Fprintf(w, `{"output": %s}`, toolCalls)
+		default:
+			answer, _ := json.Marshal("The weather is " + toolResult)
+			_, _ = fmt.Fprintf(w, `{"output": %s}`, answer)
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("BRAINTRUST_API_KEY", "test-key")
+	t.Setenv("BRAINTRUST_API_URL", server.URL)
+	return &payloads
+}
+
+func assertToolLoopPayloads(t *testing.T, payloads []map[string]any) {
+	t.Helper()
+	require.Len(t, payloads, 2)
+	assert.Equal(t, "parallel", payloads[0]["mode"])
+	assert.NotContains(t, payloads[0], "messages")
+	assert.Equal(t, []any{
+		map[string]any{
+			"role":    "assistant",
+			"content": "",
+			"tool_calls": []any{map[string]any{
+				"id":       "call_1",
+				"type":     "function",
+				"function": map[string]any{"name": "get_weather", "arguments": `{"city":"Paris"}`},
+			}},
+		},
+		map[string]any{
+			"role":         "tool",
+			"content":      `{"city":"Paris","forecast":"sunny"}`,
+			"tool_call_id": "call_1",
+		},
+	}, payloads[1]["messages"])
+}
+
+func assertToolSpan(t *testing.T, span oteltest.Span) {
+	t.Helper()
+	assert.Equal(t, "get_weather", span.Name())
+	span.AssertJSONAttrEquals("braintrust.span_attributes", map[string]any{"type": "tool"})
+	assert.Equal(t, map[string]any{"city": "Paris"}, span.Input())
+	assert.Equal(t, map[string]any{"city": "Paris", "forecast": "sunny"}, span.Output())
+	assert.Equal(t, map[string]any{"tool_call_id": "call_1"}, span.Metadata())
+}
+
+func TestParseToolCalls(t *testing.T) {
+	tests := map[string]struct {
+		output string
+		want   []*ToolCall
+	}{
+		"openai format": {
+			output: `[{"id": "c1", "function": {"name": "get_weather", "arguments": "{}"}}]`,
+			want:   []*ToolCall{{ID: "c1", Name: "get_weather", Arguments: "{}"}},
+		},
+		"flat": {
+			output: `[{"id": "c1", "type": "function", "name": "get_weather", "arguments": {"city": "Paris"}}]`,
+			want:   []*ToolCall{{ID: "c1", Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+		},
+		"objects with names":   {output: `[{"name": "Alice"}, {"name": "Bob"}]`},
+		"objects with ids":     {output: `[{"id": "1", "name": "Alice"}]`},
+		"some tool calls only": {output: `[{"id": "c1", "function": {"name": "get_weather"}}, {"name": "Alice"}]`},
+		"text":                 {output: `"hello"`},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var output any
+			require.NoError(t, json.Unmarshal([]byte(tt.output), &output))
+			assert.Equal(t, tt.want, parseToolCalls(output))
+		})
+	}
+}
+
+func TestInvoke_LocalTools(t *testing.T) {
+	payloads := newToolLoopServer(t, false)
+	_, exporter := oteltest.Setup(t, braintrust.WithOrgName("test-org"))
+
+	var calls []weatherInput
+	result, err := Invoke[string, string](context.Background(), InvokeOpts{
+		FunctionID: "fn-123",
+		Tools:      NewToolRegistry(newWeatherTool(&calls)),
+	}, "What's the weather in Paris?")
+	require.NoError(t, err)
+	assert.Equal(t, `The weather is {"city":"Paris","forecast":"sunny"}`, result)
+	assert.Equal(t, []weatherInput{{City: "Paris"}}, calls)
+	assertToolLoopPayloads(t, *payloads)
+
+	spans := exporter.Flush()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "function: fn-123", spans[0].Name())
+	assertToolSpan(t, spans[1])
+	assert.Equal(t, "function: fn-123", spans[2].Name())
+}
+
+func TestInvokeStream_LocalTools(t *testing.T) {
+	payloads := newToolLoopServer(t, true)
+	_, exporter := oteltest.Setup(t, braintrust.WithOrgName("test-org"))
+
+	var calls []weatherInput
+	stream, err := InvokeStream(context.Background(), InvokeOpts{
+		FunctionID: "fn-123",
+		Tools:      NewToolRegistry(newWeatherTool(&calls)),
+	}, "What's the weather in Paris?")
+	require.NoError(t, err)
+	defer func() { _ = stream.Close() }()
+
+	var types []DeltaType
+	for {
+		d, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		types = append(types, d.Type)
+	}
+	assert.Equal(t, []DeltaType{DeltaJSON, DeltaToolCall, DeltaText, DeltaDone}, types)
+	assert.Equal(t, `The weather is {"city":"Paris","forecast":"sunny"}`, stream.Output())
+	assertToolLoopPayloads(t, *payloads)
+
+	spans := exporter.Flush()
+	require.Len(t, spans, 3)
+	assertToolSpan(t, spans[1])
+}
+
+func TestInvoke_LocalToolErrors(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "city is required") {
+			_, _ = w.Write([]byte(`{"output": "sorry"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"output": [{"id": "c1", "type": "function", "name": "get_weather", "arguments": {}}]}`))
+	}))
+	defer server.Close()
+	t.Setenv("BRAINTRUST_API_KEY", "test-key")
+	t.Setenv("BRAINTRUST_API_URL", server.URL)
+	_, exporter := oteltest.Setup(t, braintrust.WithOrgName("test-org"))
+
+	// tool errors are sent back to the function
+	var calls []weatherInput
+	result, err := Invoke[string, string](context.Background(), InvokeOpts{
+		FunctionID: "fn-123",
+		Tools:      NewToolRegistry(newWeatherTool(&calls)),
+	}, "weather?")
+	require.NoError(t, err)
+	assert.Equal(t, "sorry", result)
+	spans := exporter.Flush()
+	require.Len(t, spans, 3)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+
+	// unknown tools fail the invocation
+	_, err = Invoke[string, string](context.Background(), InvokeOpts{
+		FunctionID: "fn-123",
+		Tools:      NewToolRegistry(),
+	}, "weather?")
+	assert.ErrorContains(t, err, `no local tool registered for "get_weather"`)
+	exporter.Flush()
+
+	// functions that never stop calling tools are cut off
+	requests = 0
+	_, err = Invoke[string, string](context.Background(), InvokeOpts{
+		FunctionID:    "fn-123",
+		Tools:         NewToolRegistry(NewLocalTool("get_weather", "", func(context.Context, weatherInput) (string, error) { return "ok", nil })),
+		MaxToolRounds: 2,
+	}, "weather?")
+	assert.ErrorContains(t, err, "after 2 rounds")
+	assert.Equal(t, 3, requests)
+}
+
+func TestPush_LocalTools(t *testing.T) {
+	fs := newFakeFunctionServer(t)
+	var calls []weatherInput
+	registry := NewToolRegistry(newWeatherTool(&calls))
+
+	prompt := testPrompt()
+	prompt.LocalTools = registry
+	_, err := Push(context.Background(), PushOpts{Project: "test"}, prompt)
+	require.NoError(t, err)
+
+	encoded := fs.get("greeter")["prompt_data"].(map[string]any)["prompt"].(map[string]any)["tools"].(string)
+	var tools []map[string]any
+	require.NoError(t, json.Unmarshal([]byte(encoded), &tools))
+	require.Len(t, tools, 1)
+	assert.Equal(t, "get_weather", tools[0]["function"].(map[string]any)["name"])
+}
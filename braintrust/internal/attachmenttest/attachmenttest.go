@@ -0,0 +1,173 @@
+// Package attachmenttest provides a local stand-in for the attachment endpoints of
+// the Braintrust API, for tests.
+package attachmenttest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Upload is an attachment uploaded to the server.
+type Upload struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+	Status      string // the reported upload_status, e.g. "done"
+	APIKey      string // the API key the upload was requested with
+}
+
+// Server is a fake Braintrust API that stores attachments and experiment rows in memory. Signed URLs
+// point back to the server. Set BRAINTRUST_API_URL and BRAINTRUST_APP_URL to its
+// URL to use it with the global config.
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	uploads     map[string]*Upload
+	experiments map[string][]any
+	requests    []string
+	failures    []int
+}
+
+// NewServer starts a server that is closed when the test ends.
+func NewServer(t *testing.T) *Server {
+	t.Helper()
+	s := &Server{uploads: map[string]*Upload{}, experiments: map[string][]any{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Uploads returns the attachments that were uploaded, by key.
+func (s *Server) Uploads() map[string]Upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uploads := make(map[string]Upload, len(s.uploads))
+	for key, u := range s.uploads {
+		if u.Data != nil {
+			uploads[key] = *u
+		}
+	}
+	return uploads
+}
+
+// AddExperimentRows adds rows to an experiment, which are returned by its fetch endpoint.
+func (s *Server) AddExperimentRows(experimentID string, rows ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.experiments[experimentID] = append(s.experiments[experimentID], rows...)
+}
+
+// Requests returns the method and path of every request, like "PUT /upload/{key}".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Fail makes the next requests fail with the given status codes, in order.
+func (s *Server) Fail(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, statuses...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	if len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+		http.Error(w, "injected failure", status)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/apikey/login":
+		writeJSON(w, map[string]any{"org_info": []map[string]string{{"id": "test-org-id", "name": "test-org"}}})
+
+	case r.Method == http.MethodPost && r.URL.Path == "/attachment":
+		var req struct {
+			Key         string `json:"key"`
+			Filename    string `json:"filename"`
+			ContentType string `json:"content_type"`
+			OrgID       string `json:"org_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Key == "" || req.OrgID == "" {
+			http.Error(w, "key and org_id are required", http.StatusBadRequest)
+			return
+		}
+		if _, ok := s.uploads[req.Key]; !ok {
+			s.uploads[req.Key] = &Upload{}
+		}
+		s.uploads[req.Key].Filename = req.Filename
+		s.uploads[req.Key].ContentType = req.ContentType
+		s.uploads[req.Key].APIKey = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		writeJSON(w, map[string]any{
+			"signedUrl": s.URL + "/upload/" + req.Key,
+			"headers":   map[string]string{"x-ms-blob-type": "BlockBlob"},
+		})
+
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/upload/"):
+		u, ok := s.uploads[strings.TrimPrefix(r.URL.Path, "/upload/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		u.Data = data
+
+	case r.Method == http.MethodPost && r.URL.Path == "/attachment/status":
+		var req struct {
+			Key    string `json:"key"`
+			Status struct {
+				UploadStatus string `json:"upload_status"`
+			} `json:"status"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if u, ok := s.uploads[req.Key]; ok {
+			u.Status = req.Status.UploadStatus
+		}
+
+	case r.Method == http.MethodGet && r.URL.Path == "/attachment":
+		if u, ok := s.uploads[key]; !ok || u.Status != "done" {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, map[string]any{"downloadUrl": s.URL + "/download/" + key})
+
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/v1/experiment/") && strings.HasSuffix(r.URL.Path, "/fetch"):
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/experiment/"), "/fetch")
+		rows, ok := s.experiments[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, map[string]any{"events": rows})
+
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/download/"):
+		u, ok := s.uploads[strings.TrimPrefix(r.URL.Path, "/download/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", u.ContentType)
+		_, _ = w.Write(u.Data)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,25 @@
+package internal
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+// CacheConfig makes braintrust.GetConfig cache its config in tests, as it does in
+// programs. ClearConfigCache is set by the braintrust package.
+var (
+	CacheConfig      atomic.Bool
+	ClearConfigCache func()
+)
+
+// PrimeConfigCache makes braintrust.GetConfig cache the config of its next call until
+// the test ends, so tests see the config that programs do.
+func PrimeConfigCache(t *testing.T) {
+	t.Helper()
+	ClearConfigCache()
+	CacheConfig.Store(true)
+	t.Cleanup(func() {
+		CacheConfig.Store(false)
+		ClearConfigCache()
+	})
+}
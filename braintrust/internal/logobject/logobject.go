@@ -0,0 +1,59 @@
+// Package logobject resolves the Braintrust objects, like experiments and project
+// logs, that spans with a parent are logged to.
+package logobject
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/api"
+)
+
+// Object types of the Braintrust API.
+const (
+	Experiment  = "experiment"
+	ProjectLogs = "project_logs"
+)
+
+// registerProject is api.RegisterProject, replaced in tests.
+var registerProject = api.RegisterProject
+
+// projectIDs caches project name => ID lookups.
+var projectIDs sync.Map
+
+// Resolve returns the type and ID of the object spans with a parent are logged to.
+// parentType is the type of a trace.Parent: "experiment_id", "project_id" or
+// "project_name". Project names are looked up once, and their IDs cached.
+func Resolve(parentType, id string) (objectType, objectID string, err error) {
+	switch parentType {
+	case "experiment_id":
+		// experiment parents may be formatted as "project-name/experiment-id"
+		if i := strings.LastIndex(id, "/"); i >= 0 {
+			id = id[i+1:]
+		}
+		return Experiment, id, nil
+	case "project_id":
+		return ProjectLogs, id, nil
+	case "project_name":
+		projectID, err := lookupProjectID(id)
+		if err != nil {
+			return "", "", err
+		}
+		return ProjectLogs, projectID, nil
+	default:
+		return "", "", fmt.Errorf("unsupported parent type: %s", parentType)
+	}
+}
+
+func lookupProjectID(name string) (string, error) {
+	if id, ok := projectIDs.Load(name); ok {
+		return id.(string), nil
+	}
+	project, err := registerProject(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve project %q: %w", name, err)
+	}
+	projectIDs.Store(name, project.ID)
+	return project.ID, nil
+}
@@ -0,0 +1,46 @@
+package logobject
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/api"
+)
+
+func TestResolve(t *testing.T) {
+	original := registerProject
+	t.Cleanup(func() { registerProject = original })
+	var registered []string
+	registerProject = func(name string) (*api.Project, error) {
+		registered = append(registered, name)
+		if name == "missing" {
+			return nil, errors.New("not found")
+		}
+		return &api.Project{ID: "id-" + name}, nil
+	}
+
+	for _, tc := range []struct {
+		parentType, id       string
+		objectType, objectID string
+	}{
+		{"experiment_id", "exp-1", Experiment, "exp-1"},
+		{"experiment_id", "my-project/exp-1", Experiment, "exp-1"},
+		{"project_id", "proj-1", ProjectLogs, "proj-1"},
+		{"project_name", "resolve-test", ProjectLogs, "id-resolve-test"},
+		{"project_name", "resolve-test", ProjectLogs, "id-resolve-test"},
+	} {
+		objectType, objectID, err := Resolve(tc.parentType, tc.id)
+		require.NoError(t, err)
+		assert.Equal(t, tc.objectType, objectType)
+		assert.Equal(t, tc.objectID, objectID)
+	}
+	assert.Equal(t, []string{"resolve-test"}, registered, "project IDs are cached")
+
+	_, _, err := Resolve("project_name", "missing")
+	assert.ErrorContains(t, err, `failed to resolve project "missing"`)
+	_, _, err = Resolve("dataset", "d")
+	assert.ErrorContains(t, err, "unsupported parent type")
+}
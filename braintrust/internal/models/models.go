@@ -0,0 +1,79 @@
+// Package models looks up values by model name, like the prices and tokenizers of
+// models.
+package models
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// versionSuffix matches the suffixes of versions and aliases of a model: dates like
+// "-2024-08-06", "-20240307" and "-0613", versions like "-001", "-latest" and
+// "-preview".
+var versionSuffix = regexp.MustCompile(`-(\d{4}-\d{2}-\d{2}|\d{8}|\d{4}|\d{3}|latest|preview)$`)
+
+// Registry maps model names to values. It's safe for concurrent use.
+//
+// A model without a value of its own uses the value of its name without version
+// suffixes, so "gpt-4o-2024-08-06" and "gpt-4o-latest" have the value of "gpt-4o".
+// Other variants, like "o3-pro" or "gpt-4o-transcribe", don't use the value of the
+// model they start with, because they're different models.
+type Registry[T any] struct {
+	mu     sync.RWMutex
+	values map[string]T
+}
+
+// NewRegistry returns a registry with the given values.
+func NewRegistry[T any](values map[string]T) *Registry[T] {
+	r := &Registry[T]{values: make(map[string]T, len(values))}
+	for model, v := range values {
+		r.values[Normalize(model)] = v
+	}
+	return r
+}
+
+// Set sets the value of a model, replacing its previous value.
+func (r *Registry[T]) Set(model string, v T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.values == nil {
+		r.values = map[string]T{}
+	}
+	r.values[Normalize(model)] = v
+}
+
+// Delete deletes the value of a model.
+func (r *Registry[T]) Delete(model string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.values, Normalize(model))
+}
+
+// Lookup returns the value of a model, or false if it has none. Provider prefixes like
+// "openai/" or "models/" are ignored.
+func (r *Registry[T]) Lookup(model string) (T, bool) {
+	model = Normalize(model)
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for {
+		if v, ok := r.values[model]; ok {
+			return v, true
+		}
+		base := versionSuffix.ReplaceAllString(model, "")
+		if base == model {
+			var zero T
+			return zero, false
+		}
+		model = base
+	}
+}
+
+// Normalize returns the canonical form of a model name.
+func Normalize(model string) string {
+	return strings.ToLower(strings.TrimSpace(model))
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_Lookup(t *testing.T) {
+	r := NewRegistry(map[string]int{"GPT-4o": 1, "gpt-4o-mini": 2, "claude-3-haiku": 3})
+	r.Set("gemini-2.0-flash", 4)
+
+	for model, want := range map[string]int{
+		"gpt-4o":                      1,
+		"openai/gpt-4o-2024-08-06":    1,
+		"gpt-4o-mini-2024-07-18":      2,
+		"claude-3-haiku-20240307":     3,
+		"models/gemini-2.0-flash-001": 4,
+		"gpt-4o-latest":               1,
+		"gpt-4o-preview-2024-12-17":   1,
+	} {
+		v, ok := r.Lookup(model)
+		assert.True(t, ok, model)
+		assert.Equal(t, want, v, model)
+	}
+
+	for _, model := range []string{"", "gpt-4o-transcribe", "gpt-4o-mini-tts", "gpt-4o2", "gpt"} {
+		_, ok := r.Lookup(model)
+		assert.False(t, ok, model)
+	}
+
+	r.Delete("gpt-4o")
+	_, ok := r.Lookup("gpt-4o-latest")
+	assert.False(t, ok)
+}
@@ -0,0 +1,54 @@
+// Package retry retries failed requests to the Braintrust API.
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/log"
+)
+
+// initialBackoff is the delay before the first retry. It doubles after each retry.
+var initialBackoff = 100 * time.Millisecond
+
+// StatusError is implemented by errors of responses with an unsuccessful status code.
+type StatusError interface {
+	error
+	StatusCode() int
+}
+
+// Do calls fn until it succeeds, retrying up to maxRetries times with exponential
+// backoff. Network errors, server errors and 429s are retried. Other errors with a
+// status code, and errors after ctx is done, are returned right away.
+func Do(ctx context.Context, maxRetries int, fn func() error) error {
+	backoff := initialBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if !Retryable(ctx, err) || attempt >= maxRetries {
+			return err
+		}
+
+		log.Debugf("retrying after error: %v", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Retryable returns whether a failed request should be retried.
+func Retryable(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var statusErr StatusError
+	if !errors.As(err, &statusErr) {
+		return true
+	}
+	code := statusErr.StatusCode()
+	return code >= 500 || code == http.StatusTooManyRequests
+}
@@ -0,0 +1,66 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type statusError int
+
+func (e statusError) Error() string   { return http.StatusText(int(e)) }
+func (e statusError) StatusCode() int { return int(e) }
+
+func TestDo(t *testing.T) {
+	original := initialBackoff
+	t.Cleanup(func() { initialBackoff = original })
+	initialBackoff = time.Millisecond
+
+	for name, tc := range map[string]struct {
+		err   error
+		calls int
+	}{
+		"success":       {nil, 1},
+		"network error": {errors.New("connection refused"), 3},
+		"server error":  {statusError(http.StatusBadGateway), 3},
+		"rate limited":  {statusError(http.StatusTooManyRequests), 3},
+		"client error":  {statusError(http.StatusBadRequest), 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			err := Do(context.Background(), 2, func() error {
+				calls++
+				return tc.err
+			})
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.calls, calls)
+		})
+	}
+
+	calls := 0
+	err := Do(context.Background(), 2, func() error {
+		calls++
+		if calls < 2 {
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestDo_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	err := Do(ctx, 3, func() error {
+		calls++
+		return ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+}
@@ -14,6 +14,13 @@
 //   - Custom scenarios not covered by auto-instrumentation
 //   - Writing instrumentation for new providers
 //
+// Attachments can be inlined into spans as base64 data URLs, or uploaded to
+// Braintrust with [Upload] or an [Uploader], which log a small [Reference] instead.
+// Uploads run in the background and are deduplicated by filename and content. References in
+// dataset rows, like the cases of evals, and in experiment rows, fetched with
+// api.NewExperimentEvents, are found with [References] or decoded into Reference
+// fields, and read back with [Reference.Open].
+//
 // For more information, see: https://www.braintrust.dev/docs/guides/attachments
 package attachment
 
@@ -23,7 +30,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"path"
+	"path/filepath"
 )
 
 // Common MIME types for attachments
@@ -40,6 +50,7 @@ const (
 // Attachments are single-use - once consumed, subsequent calls will error.
 type Attachment struct {
 	contentType string
+	filename    string
 	reader      io.Reader
 	consumed    bool
 }
@@ -59,18 +70,18 @@ func FromBytes(contentType string, data []byte) *Attachment {
 	return FromReader(contentType, bytes.NewReader(data))
 }
 
-// FromFile reads a file and creates an attachment.
+// FromFile reads a file and creates an attachment named after the file.
 // The file is read into memory and closed before returning.
 func FromFile(contentType string, path string) (*Attachment, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
 	}
-	return FromBytes(contentType, data), nil
+	return FromBytes(contentType, data).WithFilename(filepath.Base(path)), nil
 }
 
 // FromURL fetches a URL and creates an attachment.
-// Content type is derived from the Content-Type header.
+// Content type is derived from the Content-Type header, and the filename from the URL path.
 // Returns an error if the request fails or status is not 200 OK.
 func FromURL(url string) (*Attachment, error) {
 	resp, err := http.Get(url)
@@ -97,7 +108,30 @@ func FromURL(url string) (*Attachment, error) {
 		return nil, fmt.Errorf("failed to read response body from %s: %w", url, err)
 	}
 
-	return FromBytes(contentType, data), nil
+	att := FromBytes(contentType, data)
+	if u, err := neturl.Parse(url); err == nil {
+		if name := path.Base(u.Path); name != "/" && name != "." {
+			att.filename = name
+		}
+	}
+	return att, nil
+}
+
+// WithFilename sets the filename the attachment is uploaded with, and returns the
+// attachment. Attachments from files and URLs are named after them by default.
+func (a *Attachment) WithFilename(filename string) *Attachment {
+	a.filename = filename
+	return a
+}
+
+// Filename returns the attachment's filename, which may be empty.
+func (a *Attachment) Filename() string {
+	return a.filename
+}
+
+// ContentType returns the attachment's MIME type.
+func (a *Attachment) ContentType() string {
+	return a.contentType
 }
 
 // Base64URL returns the attachment as a data URL string.
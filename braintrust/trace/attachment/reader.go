@@ -0,0 +1,167 @@
+package attachment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/retry"
+)
+
+// AsReference returns the attachment reference in a decoded JSON value, like a field
+// of a dataset or experiment row, and whether it is one.
+func AsReference(v any) (Reference, bool) {
+	switch t := v.(type) {
+	case Reference:
+		return t, t.Type == ReferenceType
+	case *Reference:
+		if t == nil {
+			return Reference{}, false
+		}
+		return *t, t.Type == ReferenceType
+	case map[string]any:
+		if t["type"] != ReferenceType {
+			return Reference{}, false
+		}
+		ref := Reference{Type: ReferenceType}
+		ref.Filename, _ = t["filename"].(string)
+		ref.ContentType, _ = t["content_type"].(string)
+		ref.Key, _ = t["key"].(string)
+		return ref, ref.Key != ""
+	}
+	return Reference{}, false
+}
+
+// References returns the attachment references anywhere in a value, like the input of
+// a dataset row or the output of an experiment row, in the order they appear. The value can be decoded JSON or a typed
+// value, like a struct with Reference fields.
+//
+// Example:
+//
+//	for _, ref := range attachment.References(row.Input) {
+//		data, err := ref.ReadAll(ctx)
+//		...
+//	}
+func References(v any) []Reference {
+	var refs []Reference
+	var walk func(v any)
+	walk = func(v any) {
+		if ref, ok := AsReference(v); ok {
+			refs = append(refs, ref)
+			return
+		}
+		switch t := v.(type) {
+		case map[string]any:
+			// visit keys in a stable order
+			keys := make([]string, 0, len(t))
+			for k := range t {
+				keys = append(keys, k)
+			}
+			slices.Sort(keys)
+			for _, k := range keys {
+				walk(t[k])
+			}
+		case []any:
+			for _, child := range t {
+				walk(child)
+			}
+		case json.RawMessage:
+			var decoded any
+			if json.Unmarshal(t, &decoded) == nil {
+				walk(decoded)
+			}
+		case nil, string, bool, float64, json.Number:
+		default:
+			// typed values are walked as the JSON they're logged as
+			data, err := json.Marshal(t)
+			if err != nil {
+				return
+			}
+			var decoded any
+			if json.Unmarshal(data, &decoded) == nil {
+				walk(decoded)
+			}
+		}
+	}
+	walk(v)
+	return refs
+}
+
+// Open downloads the referenced attachment from Braintrust, using the global
+// Braintrust config. The caller must close the returned reader.
+func (r Reference) Open(ctx context.Context) (io.ReadCloser, error) {
+	if r.Key == "" {
+		return nil, fmt.Errorf("attachment reference has no key")
+	}
+	config := braintrust.GetConfig()
+	client := apiClient{
+		apiKey:     config.APIKey,
+		apiURL:     config.APIURL,
+		appURL:     config.AppURL,
+		orgName:    config.OrgName,
+		maxRetries: 3,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+	orgID, err := client.orgID()
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("key", r.Key)
+	params.Set("filename", r.Filename)
+	params.Set("content_type", r.ContentType)
+	params.Set("org_id", orgID)
+
+	var meta struct {
+		DownloadURL string `json:"downloadUrl"`
+	}
+	err = retry.Do(ctx, client.maxRetries, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, client.apiURL+"/attachment?"+params.Encode(), nil)
+		if err != nil {
+			return fmt.Errorf("error creating request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+client.apiKey)
+		return client.doJSON(req, &meta)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get download URL for attachment %s: %w", r.Filename, err)
+	}
+	if meta.DownloadURL == "" {
+		return nil, fmt.Errorf("no download URL for attachment %s", r.Filename)
+	}
+
+	var resp *http.Response
+	err = retry.Do(ctx, client.maxRetries, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.DownloadURL, nil)
+		if err != nil {
+			return fmt.Errorf("error creating download request: %w", err)
+		}
+		resp, err = client.do(req)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download attachment %s: %w", r.Filename, err)
+	}
+	return resp.Body, nil
+}
+
+// ReadAll downloads the referenced attachment and returns its data.
+func (r Reference) ReadAll(ctx context.Context) ([]byte, error) {
+	body, err := r.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment %s: %w", r.Filename, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,523 @@
+package attachment
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/auth"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/retry"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/log"
+)
+
+// ReferenceType is the type of an attachment reference in logged JSON.
+const ReferenceType = "braintrust_attachment"
+
+// Reference points to an attachment uploaded to Braintrust. It is logged in place of
+// the attachment's data, and rendered by the Braintrust UI. Use [Reference.Open] to
+// read it back.
+type Reference struct {
+	Type        string `json:"type"` // always ReferenceType
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Key         string `json:"key"`
+}
+
+// ParseDataURL returns the content type and decoded data of a base64 data URL, like
+// the ones returned by [Attachment.Base64URL]. It returns false if s isn't one.
+func ParseDataURL(s string) (contentType string, data []byte, ok bool) {
+	rest, found := strings.CutPrefix(s, "data:")
+	if !found {
+		return "", nil, false
+	}
+	header, payload, found := strings.Cut(rest, ",")
+	if !found {
+		return "", nil, false
+	}
+	contentType, found = strings.CutSuffix(header, ";base64")
+	if !found {
+		return "", nil, false
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", nil, false
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return contentType, data, true
+}
+
+// UploaderOpts configures an [Uploader]. Empty fields default to the global
+// Braintrust config.
+type UploaderOpts struct {
+	APIKey     string
+	APIURL     string
+	AppURL     string
+	OrgName    string
+	MaxRetries int          // Retries for failed requests (default: 3)
+	HTTPClient *http.Client // default: a client with a 60s timeout
+}
+
+// maxUploadKeys is how many keys of recent uploads an [Uploader] remembers, to skip
+// uploading them again.
+var maxUploadKeys = 10000
+
+// Uploader uploads attachments to Braintrust in the background. Attachments are
+// stored under a key derived from their filename, content type and content, so the
+// same file is only uploaded once, however often it is logged. It is safe for concurrent use.
+type Uploader struct {
+	client apiClient
+
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	keys *keySet // uploads that are running or done
+	errs []error
+}
+
+// NewUploader creates an uploader.
+func NewUploader(opts UploaderOpts) *Uploader {
+	opts = opts.withDefaults()
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 60 * time.Second}
+	}
+	return &Uploader{
+		client: apiClient{
+			apiKey:     opts.APIKey,
+			apiURL:     opts.APIURL,
+			appURL:     opts.AppURL,
+			orgName:    opts.OrgName,
+			maxRetries: opts.MaxRetries,
+			httpClient: opts.HTTPClient,
+		},
+		keys: newKeySet(maxUploadKeys),
+	}
+}
+
+// withDefaults returns the options with empty fields, except HTTPClient, set to their
+// defaults.
+func (opts UploaderOpts) withDefaults() UploaderOpts {
+	config := braintrust.GetConfig()
+	if opts.APIKey == "" {
+		opts.APIKey = config.APIKey
+	}
+	if opts.APIURL == "" {
+		opts.APIURL = config.APIURL
+	}
+	if opts.AppURL == "" {
+		opts.AppURL = config.AppURL
+	}
+	if opts.OrgName == "" {
+		opts.OrgName = config.OrgName
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	} else if opts.MaxRetries == 0 {
+		opts.MaxRetries = 3
+	}
+	return opts
+}
+
+// sharedUploaders are the uploaders returned by SharedUploader, by their options.
+var (
+	sharedUploadersMu sync.Mutex
+	sharedUploaders   = map[UploaderOpts]*Uploader{}
+)
+
+// SharedUploader returns the uploader with the given options, creating it on first
+// use, so attachments uploaded to the same org are deduplicated together, however many
+// uploads share it. Its uploads are waited for by [Flush].
+func SharedUploader(opts UploaderOpts) *Uploader {
+	opts = opts.withDefaults()
+	sharedUploadersMu.Lock()
+	defer sharedUploadersMu.Unlock()
+	u, ok := sharedUploaders[opts]
+	if !ok {
+		u = NewUploader(opts)
+		sharedUploaders[opts] = u
+	}
+	return u
+}
+
+// Upload uploads an attachment in the background with an uploader that uses the
+// global Braintrust config, and returns its reference. Call [Flush] before your
+// program exits; the trace package does this when its tracer provider is flushed or
+// shut down. The attachment is consumed.
+//
+// Example:
+//
+//	ref, err := attachment.Upload(attachment.FromBytes(attachment.ImagePNG, data))
+//	if err != nil {
+//		return err
+//	}
+//	span.Log(trace.LogEvent{Input: map[string]any{"image": ref}})
+func Upload(a *Attachment) (Reference, error) {
+	return SharedUploader(UploaderOpts{}).UploadAttachment(a)
+}
+
+// Flush waits for the uploads started by [Upload] and the uploaders returned by
+// [SharedUploader] to finish, and returns the errors of failed uploads.
+func Flush(ctx context.Context) error {
+	sharedUploadersMu.Lock()
+	uploaders := make([]*Uploader, 0, len(sharedUploaders))
+	for _, u := range sharedUploaders {
+		uploaders = append(uploaders, u)
+	}
+	sharedUploadersMu.Unlock()
+
+	var errs []error
+	for _, u := range uploaders {
+		errs = append(errs, u.Flush(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// UploadAttachment reads an attachment and starts uploading it in the background. It
+// returns the attachment's reference, which can be logged right away. The attachment
+// is consumed. Attachments that aren't in memory, like ones from [FromReader], are
+// streamed to a temporary file, which is removed once they are uploaded.
+func (u *Uploader) UploadAttachment(a *Attachment) (Reference, error) {
+	if a.consumed {
+		return Reference{}, fmt.Errorf("attachment already consumed")
+	}
+	a.consumed = true
+
+	filename, contentType := uploadNames(a.filename, a.contentType)
+	h := newContentHash(filename, contentType)
+	var body uploadBody
+	if r, ok := a.reader.(*bytes.Reader); ok {
+		// the data is in memory already
+		size, err := io.Copy(h, r)
+		if err == nil {
+			_, err = r.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			return Reference{}, fmt.Errorf("failed to read attachment: %w", err)
+		}
+		body = uploadBody{r: r, size: size}
+	} else {
+		f, err := os.CreateTemp("", "braintrust-attachment-*")
+		if err != nil {
+			return Reference{}, fmt.Errorf("failed to create a temporary file for the attachment: %w", err)
+		}
+		remove := func() {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+		size, err := io.Copy(io.MultiWriter(f, h), a.reader)
+		if err != nil {
+			remove()
+			return Reference{}, fmt.Errorf("failed to read attachment: %w", err)
+		}
+		body = uploadBody{r: f, size: size, cleanup: remove}
+	}
+	return u.start(newReference(filename, contentType, h), body), nil
+}
+
+// Upload starts uploading data in the background and returns its reference, which can
+// be logged right away. If filename is empty, one is made from the content type.
+// Failed requests are retried, and uploads that still fail are logged and returned
+// by [Uploader.Flush].
+func (u *Uploader) Upload(filename, contentType string, data []byte) Reference {
+	filename, contentType = uploadNames(filename, contentType)
+	h := newContentHash(filename, contentType)
+	h.Write(data)
+	return u.start(newReference(filename, contentType, h), uploadBody{r: bytes.NewReader(data), size: int64(len(data))})
+}
+
+// uploadBody is the content of an upload. It's read again when requests are retried.
+type uploadBody struct {
+	r    io.ReadSeeker
+	size int64
+	// cleanup, if set, is called once the content isn't needed anymore.
+	cleanup func()
+}
+
+// uploadNames returns the filename and content type an attachment is uploaded with.
+func uploadNames(filename, contentType string) (string, string) {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if filename == "" {
+		filename = defaultFilename(contentType)
+	}
+	return filename, contentType
+}
+
+func newReference(filename, contentType string, h hash.Hash) Reference {
+	return Reference{
+		Type:        ReferenceType,
+		Filename:    filename,
+		ContentType: contentType,
+		Key:         hashKey(h),
+	}
+}
+
+// start uploads the body in the background, unless it was uploaded already.
+func (u *Uploader) start(ref Reference, body uploadBody) Reference {
+	if body.cleanup == nil {
+		body.cleanup = func() {}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.keys.has(ref.Key) {
+		body.cleanup()
+		return ref
+	}
+	u.keys.add(ref.Key)
+
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		defer body.cleanup()
+		if err := u.upload(context.Background(), ref, body); err != nil {
+			log.Warnf("failed to upload attachment %s: %v", ref.Filename, err)
+			u.mu.Lock()
+			u.keys.remove(ref.Key) // so logging it again retries
+			u.errs = append(u.errs, err)
+			u.mu.Unlock()
+		}
+	}()
+	return ref
+}
+
+// Flush waits for started uploads to finish, and returns the errors of failed uploads
+// since the last flush.
+func (u *Uploader) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		u.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	err := errors.Join(u.errs...)
+	u.errs = nil
+	return err
+}
+
+// upload requests a signed URL for the attachment, uploads the data to it, and
+// reports the upload's status to Braintrust.
+func (u *Uploader) upload(ctx context.Context, ref Reference, body uploadBody) error {
+	client := u.client
+	orgID, err := client.orgID()
+	if err != nil {
+		return err
+	}
+
+	var signed struct {
+		SignedURL string            `json:"signedUrl"`
+		Headers   map[string]string `json:"headers"`
+	}
+	err = client.postJSON(ctx, "/attachment", map[string]any{
+		"key":          ref.Key,
+		"filename":     ref.Filename,
+		"content_type": ref.ContentType,
+		"org_id":       orgID,
+	}, &signed)
+	if err != nil {
+		return err
+	}
+	if signed.SignedURL == "" {
+		return fmt.Errorf("no signed URL for attachment")
+	}
+
+	uploadErr := retry.Do(ctx, client.maxRetries, func() error {
+		if _, err := body.r.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("error reading attachment: %w", err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, signed.SignedURL, io.NopCloser(body.r))
+		if err != nil {
+			return fmt.Errorf("error creating upload request: %w", err)
+		}
+		req.ContentLength = body.size
+		req.Header.Set("Content-Type", ref.ContentType)
+		for k, v := range signed.Headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := client.do(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	})
+
+	status := map[string]any{"upload_status": "done"}
+	if uploadErr != nil {
+		status = map[string]any{"upload_status": "error", "error_message": uploadErr.Error()}
+	}
+	err = client.postJSON(ctx, "/attachment/status", map[string]any{
+		"key":    ref.Key,
+		"org_id": orgID,
+		"status": status,
+	}, nil)
+	if uploadErr != nil {
+		return uploadErr
+	}
+	return err
+}
+
+// newContentHash returns the hash an attachment's key is made from, after its content
+// is written to it. Keys are UUIDs made from a hash of the filename, content type and
+// content, so identical attachments share a key. The filename is part of it because
+// the stored attachment has the filename of its first upload.
+func newContentHash(filename, contentType string) hash.Hash {
+	h := sha256.New()
+	h.Write([]byte(filename))
+	h.Write([]byte{0})
+	h.Write([]byte(contentType))
+	h.Write([]byte{0})
+	return h
+}
+
+// hashKey returns the key of an attachment whose content was written to its hash.
+func hashKey(h hash.Hash) string {
+	b := h.Sum(nil)[:16]
+	b[6] = (b[6] & 0x0f) | 0x80 // version 8, a custom UUID
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// keySet is a set of keys that forgets the least recently used ones past its size.
+type keySet struct {
+	size  int
+	order *list.List // most recently used first
+	elems map[string]*list.Element
+}
+
+func newKeySet(size int) *keySet {
+	return &keySet{size: size, order: list.New(), elems: map[string]*list.Element{}}
+}
+
+func (s *keySet) has(key string) bool {
+	e, ok := s.elems[key]
+	if ok {
+		s.order.MoveToFront(e)
+	}
+	return ok
+}
+
+func (s *keySet) add(key string) {
+	s.elems[key] = s.order.PushFront(key)
+	for s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.elems, oldest.Value.(string))
+	}
+}
+
+func (s *keySet) remove(key string) {
+	if e, ok := s.elems[key]; ok {
+		s.order.Remove(e)
+		delete(s.elems, key)
+	}
+}
+
+// defaultFilename returns a filename for a content type, like "image.png" for "image/png".
+func defaultFilename(contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	kind, subtype, _ := strings.Cut(strings.TrimSpace(mediaType), "/")
+	if kind == "" {
+		return "attachment"
+	}
+	if subtype == "" {
+		return kind
+	}
+	return kind + "." + subtype
+}
+
+// apiClient makes requests to the attachment endpoints of the Braintrust API.
+type apiClient struct {
+	apiKey, apiURL, appURL, orgName string
+	maxRetries                      int
+	httpClient                      *http.Client
+}
+
+// orgID returns the ID of the org attachments are stored in.
+func (c apiClient) orgID() (string, error) {
+	state, err := auth.Login(auth.Options{AppURL: c.appURL, APIKey: c.apiKey, OrgName: c.orgName})
+	if err != nil {
+		return "", fmt.Errorf("failed to login: %w", err)
+	}
+	return state.OrgID, nil
+}
+
+// postJSON posts a JSON payload to the API and decodes the response into result, if
+// it isn't nil.
+func (c apiClient) postJSON(ctx context.Context, path string, payload, result any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling request: %w", err)
+	}
+	return retry.Do(ctx, c.maxRetries, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL+path, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("error creating request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+		return c.doJSON(req, result)
+	})
+}
+
+// doJSON sends a request and decodes the response into result, if it isn't nil.
+func (c apiClient) doJSON(req *http.Request, result any) error {
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("error decoding response from %s: %w", req.URL.Path, err)
+	}
+	return nil
+}
+
+// do sends a request, and returns a *statusError if the response isn't a success.
+func (c apiClient) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to %s: %w", req.URL.Path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, &statusError{path: req.URL.Path, statusCode: resp.StatusCode, body: string(body)}
+	}
+	return resp, nil
+}
+
+type statusError struct {
+	path       string
+	statusCode int
+	body       string
+}
+
+func (e *statusError) StatusCode() int { return e.statusCode }
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code from %s: [%d] %s", e.path, e.statusCode, strings.TrimSpace(e.body))
+}
@@ -0,0 +1,245 @@
+package attachment
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/api"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/attachmenttest"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/auth"
+)
+
+func newTestUploader(t *testing.T) (*Uploader, *attachmenttest.Server) {
+	t.Helper()
+	server := attachmenttest.NewServer(t)
+	t.Setenv("BRAINTRUST_API_KEY", auth.TestAPIKey)
+	t.Setenv("BRAINTRUST_API_URL", server.URL)
+	t.Setenv("BRAINTRUST_APP_URL", server.URL)
+	return NewUploader(UploaderOpts{}), server
+}
+
+func TestParseDataURL(t *testing.T) {
+	url, err := FromBytes(ImagePNG, []byte("png bytes")).Base64URL()
+	require.NoError(t, err)
+
+	contentType, data, ok := ParseDataURL(url)
+	assert.True(t, ok)
+	assert.Equal(t, ImagePNG, contentType)
+	assert.Equal(t, []byte("png bytes"), data)
+
+	for _, s := range []string{"hello", "data:image/png,raw", "data:image/png;base64,!!!", "https://example.com/a.png"} {
+		_, _, ok := ParseDataURL(s)
+		assert.False(t, ok, s)
+	}
+}
+
+func TestUploader(t *testing.T) {
+	uploader, server := newTestUploader(t)
+
+	ref := uploader.Upload("cat.png", ImagePNG, []byte("png bytes"))
+	assert.Equal(t, Reference{Type: ReferenceType, Filename: "cat.png", ContentType: ImagePNG, Key: ref.Key}, ref)
+	assert.Len(t, ref.Key, 36)
+
+	// the same file gets the same key, and is only uploaded once
+	again := uploader.Upload("cat.png", ImagePNG, []byte("png bytes"))
+	assert.Equal(t, ref, again)
+	// the same content with another filename is uploaded with its own filename
+	renamed := uploader.Upload("", ImagePNG, []byte("png bytes"))
+	assert.NotEqual(t, ref.Key, renamed.Key)
+	assert.Equal(t, "image.png", renamed.Filename)
+	other := uploader.Upload("cat.png", ImagePNG, []byte("other bytes"))
+	assert.NotEqual(t, ref.Key, other.Key)
+
+	require.NoError(t, uploader.Flush(context.Background()))
+	assert.Equal(t, attachmenttest.Upload{Filename: "cat.png", ContentType: ImagePNG, Data: []byte("png bytes"), Status: "done", APIKey: auth.TestAPIKey}, server.Uploads()[ref.Key])
+	assert.Equal(t, "image.png", server.Uploads()[renamed.Key].Filename)
+	assert.Len(t, server.Uploads(), 3)
+	assert.Len(t, server.Requests(), 9)
+}
+
+func TestUploader_Retries(t *testing.T) {
+	uploader, server := newTestUploader(t)
+
+	server.Fail(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	ref := uploader.Upload("a.txt", TextPlain, []byte("a"))
+	require.NoError(t, uploader.Flush(context.Background()))
+	assert.Equal(t, []byte("a"), server.Uploads()[ref.Key].Data)
+	assert.Equal(t, []string{
+		"POST /attachment", "POST /attachment", "POST /attachment",
+		"PUT /upload/" + ref.Key, "POST /attachment/status",
+	}, server.Requests())
+}
+
+func TestUploader_Error(t *testing.T) {
+	uploader, server := newTestUploader(t)
+
+	// client errors aren't retried
+	server.Fail(http.StatusForbidden)
+	ref := uploader.Upload("a.txt", TextPlain, []byte("a"))
+	assert.ErrorContains(t, uploader.Flush(context.Background()), "[403]")
+	assert.Empty(t, server.Uploads())
+	// errors are only returned once
+	assert.NoError(t, uploader.Flush(context.Background()))
+
+	// a failed upload is tried again the next time it's logged
+	uploader.Upload("a.txt", TextPlain, []byte("a"))
+	require.NoError(t, uploader.Flush(context.Background()))
+	assert.Contains(t, server.Uploads(), ref.Key)
+}
+
+func TestUploader_ForgetsOldKeys(t *testing.T) {
+	defer func(n int) { maxUploadKeys = n }(maxUploadKeys)
+	maxUploadKeys = 2
+	uploader, server := newTestUploader(t)
+
+	for _, data := range []string{"a", "b", "a", "c"} {
+		uploader.Upload("f.txt", TextPlain, []byte(data))
+	}
+	require.NoError(t, uploader.Flush(context.Background()))
+	assert.Len(t, server.Requests(), 9)
+
+	// "b" was used least recently, so only it is uploaded again
+	uploader.Upload("f.txt", TextPlain, []byte("a"))
+	uploader.Upload("f.txt", TextPlain, []byte("b"))
+	require.NoError(t, uploader.Flush(context.Background()))
+	assert.Len(t, server.Requests(), 12)
+}
+
+func TestUploadAttachment_Reader(t *testing.T) {
+	uploader, server := newTestUploader(t)
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	data := strings.Repeat("streamed ", 10000)
+	ref, err := uploader.UploadAttachment(FromReader(TextPlain, strings.NewReader(data)).WithFilename("big.txt"))
+	require.NoError(t, err)
+	// it's stored under the same key as the same bytes in memory
+	assert.Equal(t, uploader.Upload("big.txt", TextPlain, []byte(data)), ref)
+	require.NoError(t, uploader.Flush(context.Background()))
+	assert.Equal(t, []byte(data), server.Uploads()[ref.Key].Data)
+
+	// the temporary file is removed
+	entries, err := os.ReadDir(tmp)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestUploadAttachment_RoundTrip(t *testing.T) {
+	uploader, _ := newTestUploader(t)
+
+	path := filepath.Join(t.TempDir(), "doc.pdf")
+	require.NoError(t, os.WriteFile(path, []byte("%PDF-1.4"), 0644))
+	att, err := FromFile(PDF, path)
+	require.NoError(t, err)
+
+	ref, err := uploader.UploadAttachment(att)
+	require.NoError(t, err)
+	assert.Equal(t, "doc.pdf", ref.Filename)
+	_, err = uploader.UploadAttachment(att)
+	assert.ErrorContains(t, err, "already consumed")
+	require.NoError(t, uploader.Flush(context.Background()))
+
+	// read it back from a logged row
+	var row struct {
+		Input map[string]any `json:"input"`
+	}
+	logged, err := json.Marshal(map[string]any{"input": map[string]any{"question": "summarize", "files": []any{ref}}})
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(logged, &row))
+
+	refs := References(row.Input)
+	require.Equal(t, []Reference{ref}, refs)
+	data, err := refs[0].ReadAll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("%PDF-1.4"), data)
+
+	_, err = Reference{Type: ReferenceType, Filename: "missing.txt", Key: "nope"}.ReadAll(context.Background())
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestReadExperimentRows(t *testing.T) {
+	uploader, server := newTestUploader(t)
+
+	ref := uploader.Upload("answer.png", ImagePNG, []byte("png bytes"))
+	require.NoError(t, uploader.Flush(context.Background()))
+	server.AddExperimentRows("exp-1",
+		map[string]any{"id": "row-1", "input": "draw a cat", "output": map[string]any{"image": ref}},
+		map[string]any{"id": "row-2", "input": "say hi", "output": "hi"},
+	)
+
+	rows := api.NewExperimentEvents("exp-1")
+	var refs []Reference
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		refs = append(refs, References(row.Output)...)
+	}
+	require.Equal(t, []Reference{ref}, refs)
+	data, err := refs[0].ReadAll(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("png bytes"), data)
+}
+
+func TestUpload_Default(t *testing.T) {
+	_, server := newTestUploader(t)
+
+	ref, err := Upload(FromBytes(TextPlain, []byte("hello")).WithFilename("hello.txt"))
+	require.NoError(t, err)
+	require.NoError(t, Flush(context.Background()))
+	assert.Equal(t, "hello.txt", server.Uploads()[ref.Key].Filename)
+}
+
+func TestSharedUploader(t *testing.T) {
+	_, server := newTestUploader(t)
+
+	// uploaders with the same options are shared, so they upload the same file once
+	u := SharedUploader(UploaderOpts{APIURL: server.URL})
+	assert.Same(t, u, SharedUploader(UploaderOpts{}))
+	assert.NotSame(t, u, SharedUploader(UploaderOpts{OrgName: "other-org"}))
+
+	ref := u.Upload("a.txt", TextPlain, []byte("a"))
+	again, err := Upload(FromBytes(TextPlain, []byte("a")).WithFilename("a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, ref, again)
+	require.NoError(t, Flush(context.Background()))
+	assert.Len(t, server.Uploads(), 1)
+}
+
+func TestAsReference(t *testing.T) {
+	ref := Reference{Type: ReferenceType, Filename: "a.png", ContentType: ImagePNG, Key: "k"}
+	for _, v := range []any{
+		ref,
+		&ref,
+		map[string]any{"type": ReferenceType, "filename": "a.png", "content_type": ImagePNG, "key": "k"},
+	} {
+		got, ok := AsReference(v)
+		assert.True(t, ok)
+		assert.Equal(t, ref, got)
+	}
+	for _, v := range []any{nil, "k", map[string]any{"type": "other", "key": "k"}, map[string]any{"type": ReferenceType}} {
+		_, ok := AsReference(v)
+		assert.False(t, ok)
+	}
+
+	raw := json.RawMessage(`[{"type": "braintrust_attachment", "key": "k", "filename": "a.png", "content_type": "image/png"}]`)
+	assert.Equal(t, []Reference{ref}, References(raw))
+
+	typed := struct {
+		Question string
+		Files    []*Reference
+	}{"q", []*Reference{&ref}}
+	assert.Equal(t, []Reference{ref}, References(typed))
+	assert.Empty(t, References("k"))
+}
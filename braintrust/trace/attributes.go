@@ -0,0 +1,129 @@
+package trace
+
+// this file has typed helpers for setting Braintrust fields on OpenTelemetry spans.
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/internal"
+)
+
+// SpanType is the type of a span in the Braintrust UI.
+type SpanType string
+
+const (
+	// SpanTypeLLM is a call to a model.
+	SpanTypeLLM SpanType = "llm"
+	// SpanTypeTask is a unit of work, e.g. the task of an eval.
+	SpanTypeTask SpanType = "task"
+	// SpanTypeTool is a tool called by a model.
+	SpanTypeTool SpanType = "tool"
+	// SpanTypeFunction is a function call.
+	SpanTypeFunction SpanType = "function"
+	// SpanTypeEval is the root span of an eval case.
+	SpanTypeEval SpanType = "eval"
+	// SpanTypeScore is a scorer run.
+	SpanTypeScore SpanType = "score"
+)
+
+// Attribute keys for the Braintrust fields of a span.
+const (
+	inputAttrKey     = "braintrust.input_json"
+	outputAttrKey    = "braintrust.output_json"
+	expectedAttrKey  = "braintrust.expected"
+	metadataAttrKey  = "braintrust.metadata"
+	metricsAttrKey   = "braintrust.metrics"
+	scoresAttrKey    = "braintrust.scores"
+	tagsAttrKey      = "braintrust.tags"
+	spanAttrsAttrKey = "braintrust.span_attributes"
+)
+
+// SetInput sets the input of a span. It returns an error if input can't be encoded as JSON.
+func SetInput(span oteltrace.Span, input any) error {
+	return internal.SetJSONAttr(span, inputAttrKey, input)
+}
+
+// SetOutput sets the output of a span. It returns an error if output can't be encoded as JSON.
+func SetOutput(span oteltrace.Span, output any) error {
+	return internal.SetJSONAttr(span, outputAttrKey, output)
+}
+
+// SetExpected sets the expected output of a span. It returns an error if expected
+// can't be encoded as JSON.
+func SetExpected(span oteltrace.Span, expected any) error {
+	return internal.SetJSONAttr(span, expectedAttrKey, expected)
+}
+
+// SetMetadata merges metadata into the metadata of a span, so keys set by previous
+// calls are kept unless they are overwritten.
+//
+// Merging reads the span's attributes, so it only works with spans from the
+// OpenTelemetry SDK; other spans have their metadata replaced. Concurrent calls on
+// the same span may lose updates.
+func SetMetadata(span oteltrace.Span, metadata map[string]any) error {
+	return mergeJSONAttr(span, metadataAttrKey, metadata)
+}
+
+// SetMetrics merges metrics, like token counts, into the metrics of a span. See
+// [SetMetadata] for how values are merged.
+func SetMetrics(span oteltrace.Span, metrics map[string]float64) error {
+	return mergeJSONAttr(span, metricsAttrKey, metrics)
+}
+
+// SetScores merges scores, which should be between 0 and 1, into the scores of a
+// span. See [SetMetadata] for how values are merged.
+func SetScores(span oteltrace.Span, scores map[string]float64) error {
+	return mergeJSONAttr(span, scoresAttrKey, scores)
+}
+
+// AddTags adds tags to a span. Tags the span already has are not duplicated.
+func AddTags(span oteltrace.Span, tags ...string) {
+	var all []string
+	if v, ok := spanAttr(span, tagsAttrKey); ok {
+		all = v.AsStringSlice()
+	}
+	for _, tag := range tags {
+		if !slices.Contains(all, tag) {
+			all = append(all, tag)
+		}
+	}
+	span.SetAttributes(attribute.StringSlice(tagsAttrKey, all))
+}
+
+// SetSpanType sets the type of a span, which is shown in the Braintrust UI.
+func SetSpanType(span oteltrace.Span, spanType SpanType) error {
+	return internal.SetJSONAttr(span, spanAttrsAttrKey, map[string]any{"type": spanType})
+}
+
+// mergeJSONAttr merges values into the JSON object stored in the span attribute key.
+func mergeJSONAttr[V any](span oteltrace.Span, key string, values map[string]V) error {
+	merged := make(map[string]V, len(values))
+	if v, ok := spanAttr(span, key); ok {
+		// if the existing value isn't an object of the right type, replace it
+		if err := json.Unmarshal([]byte(v.AsString()), &merged); err != nil {
+			merged = make(map[string]V, len(values))
+		}
+	}
+	maps.Copy(merged, values)
+	return internal.SetJSONAttr(span, key, merged)
+}
+
+// spanAttr returns the value of an attribute of a span, if the span can be read.
+func spanAttr(span oteltrace.Span, key string) (attribute.Value, bool) {
+	readSpan, ok := span.(sdktrace.ReadOnlySpan)
+	if !ok {
+		return attribute.Value{}, false
+	}
+	for _, a := range readSpan.Attributes() {
+		if string(a.Key) == key {
+			return a.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
@@ -0,0 +1,66 @@
+package trace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestSpanHelpers(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	_, span := tp.Tracer("test").Start(context.Background(), "op")
+	require.NoError(t, SetInput(span, []string{"a"}))
+	require.NoError(t, SetOutput(span, "b"))
+	require.NoError(t, SetExpected(span, "c"))
+	require.NoError(t, SetSpanType(span, SpanTypeTool))
+	require.NoError(t, SetMetadata(span, map[string]any{"model": "gpt-4o", "temperature": 0.5}))
+	require.NoError(t, SetMetadata(span, map[string]any{"temperature": 0.7, "user": "u1"}))
+	require.NoError(t, SetMetrics(span, map[string]float64{"prompt_tokens": 10}))
+	require.NoError(t, SetMetrics(span, map[string]float64{"completion_tokens": 3}))
+	require.NoError(t, SetScores(span, map[string]float64{"accuracy": 0.5}))
+	require.NoError(t, SetScores(span, map[string]float64{"accuracy": 1}))
+	AddTags(span, "a", "b")
+	AddTags(span, "b", "c")
+	span.End()
+
+	stub := flushOne(t, exporter)
+	assert.Equal(t, []any{"a"}, jsonAttr(t, stub, "braintrust.input_json"))
+	assert.Equal(t, "b", jsonAttr(t, stub, "braintrust.output_json"))
+	assert.Equal(t, "c", jsonAttr(t, stub, "braintrust.expected"))
+	assert.Equal(t, map[string]any{"type": "tool"}, jsonAttr(t, stub, "braintrust.span_attributes"))
+	assert.Equal(t, map[string]any{"model": "gpt-4o", "temperature": 0.7, "user": "u1"}, jsonAttr(t, stub, "braintrust.metadata"))
+	assert.Equal(t, map[string]any{"prompt_tokens": 10.0, "completion_tokens": 3.0}, jsonAttr(t, stub, "braintrust.metrics"))
+	assert.Equal(t, map[string]any{"accuracy": 1.0}, jsonAttr(t, stub, "braintrust.scores"))
+	tags, _ := attrValue(stub, "braintrust.tags")
+	assert.Equal(t, []string{"a", "b", "c"}, tags.AsStringSlice())
+}
+
+func TestSetMetadata_ReplacesInvalidValue(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	_, span := tp.Tracer("test").Start(context.Background(), "op")
+	span.SetAttributes(attribute.String("braintrust.metadata", `"not an object"`))
+	require.NoError(t, SetMetadata(span, map[string]any{"a": 1}))
+	span.End()
+
+	assert.Equal(t, map[string]any{"a": 1.0}, jsonAttr(t, flushOne(t, exporter), "braintrust.metadata"))
+}
+
+func TestSpanHelpers_NonSDKSpan(t *testing.T) {
+	_, span := noop.NewTracerProvider().Tracer("test").Start(context.Background(), "op")
+	assert.NoError(t, SetMetadata(span, map[string]any{"a": 1}))
+	assert.NoError(t, SetMetrics(span, map[string]float64{"a": 1}))
+	AddTags(span, "a")
+	assert.Error(t, SetOutput(span, make(chan int)))
+}
@@ -0,0 +1,210 @@
+package trace
+
+// this file scopes metadata and tags to a context, so they are added to every span started with it.
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/log"
+)
+
+var (
+	metadataContextKey contextKey = metadataAttrKey
+	tagsContextKey     contextKey = tagsAttrKey
+)
+
+// ContextWithMetadata returns a context with metadata that is merged into the
+// metadata of every span started with it, including spans from integrations like
+// traceopenai. It is merged with metadata already in the context, and metadata set
+// on a span takes precedence over it.
+//
+// Like the parent, the metadata is also stored in baggage, so it is propagated to
+// other processes if the baggage propagator is configured (see [Enable]).
+//
+// Example:
+//
+//	ctx = trace.ContextWithMetadata(ctx, map[string]any{"user_id": userID, "tenant": tenant})
+func ContextWithMetadata(ctx context.Context, metadata map[string]any) context.Context {
+	merged := maps.Clone(MetadataFromContext(ctx))
+	if merged == nil {
+		merged = make(map[string]any, len(metadata))
+	}
+	maps.Copy(merged, metadata)
+
+	ctx = context.WithValue(ctx, metadataContextKey, merged)
+	return withBaggageJSON(ctx, metadataAttrKey, merged)
+}
+
+// MetadataFromContext returns the metadata in the context, or nil if there is none.
+// It checks the context value first, then baggage.
+func MetadataFromContext(ctx context.Context) map[string]any {
+	if metadata, ok := ctx.Value(metadataContextKey).(map[string]any); ok {
+		return metadata
+	}
+	var metadata map[string]any
+	baggageJSON(ctx, metadataAttrKey, &metadata)
+	return metadata
+}
+
+// ContextWithTags returns a context with tags that are added to every span started
+// with it. They are added to tags already in the context, and propagated like
+// [ContextWithMetadata].
+func ContextWithTags(ctx context.Context, tags ...string) context.Context {
+	all := slices.Clone(TagsFromContext(ctx))
+	for _, tag := range tags {
+		if !slices.Contains(all, tag) {
+			all = append(all, tag)
+		}
+	}
+
+	ctx = context.WithValue(ctx, tagsContextKey, all)
+	return withBaggageJSON(ctx, tagsAttrKey, all)
+}
+
+// TagsFromContext returns the tags in the context, or nil if there are none. It
+// checks the context value first, then baggage.
+func TagsFromContext(ctx context.Context) []string {
+	if tags, ok := ctx.Value(tagsContextKey).([]string); ok {
+		return tags
+	}
+	var tags []string
+	baggageJSON(ctx, tagsAttrKey, &tags)
+	return tags
+}
+
+func withBaggageJSON(ctx context.Context, key string, value any) context.Context {
+	b, err := json.Marshal(value)
+	if err != nil {
+		log.Warnf("Failed to encode %s for baggage: %v", key, err)
+		return ctx
+	}
+	member, err := baggage.NewMemberRaw(key, string(b))
+	if err != nil {
+		log.Warnf("Failed to create baggage member for %s: %v", key, err)
+		return ctx
+	}
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		log.Warnf("Failed to set baggage member for %s: %v", key, err)
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+func baggageJSON(ctx context.Context, key string, into any) {
+	value := baggage.FromContext(ctx).Member(key).Value()
+	if value == "" {
+		return
+	}
+	if err := json.Unmarshal([]byte(value), into); err != nil {
+		log.Warnf("Failed to parse %s from baggage: %v", key, err)
+	}
+}
+
+// contextValues are the metadata and tags from the context a span was started with.
+type contextValues struct {
+	metadata map[string]any
+	tags     []string
+}
+
+// spanKey identifies a span while it is running.
+type spanKey struct {
+	traceID oteltrace.TraceID
+	spanID  oteltrace.SpanID
+}
+
+func newSpanKey(sc oteltrace.SpanContext) spanKey {
+	return spanKey{traceID: sc.TraceID(), spanID: sc.SpanID()}
+}
+
+// applyContextValues merges the context's metadata and tags into a starting span.
+// Integrations often replace a span's metadata after it starts, so the values are
+// also kept until the span ends and merged again by withContextValues.
+func (sp *spanProcessor) applyContextValues(ctx context.Context, span trace.ReadWriteSpan) {
+	values := contextValues{metadata: MetadataFromContext(ctx), tags: TagsFromContext(ctx)}
+	if len(values.metadata) == 0 && len(values.tags) == 0 {
+		return
+	}
+	span.SetAttributes(mergeContextValues(span.Attributes(), values)...)
+	sp.contextValues.Store(newSpanKey(span.SpanContext()), values)
+}
+
+// withContextValues returns the ended span with the metadata and tags of the context
+// it was started with merged in.
+func (sp *spanProcessor) withContextValues(span trace.ReadOnlySpan) trace.ReadOnlySpan {
+	v, ok := sp.contextValues.LoadAndDelete(newSpanKey(span.SpanContext()))
+	if !ok {
+		return span
+	}
+	merged := mergeContextValues(span.Attributes(), v.(contextValues))
+	attrs := make([]attribute.KeyValue, 0, len(span.Attributes())+len(merged))
+	for _, a := range span.Attributes() {
+		if a.Key != metadataAttrKey && a.Key != tagsAttrKey {
+			attrs = append(attrs, a)
+		}
+	}
+	return &attrsSpan{ReadOnlySpan: span, attrs: append(attrs, merged...)}
+}
+
+// mergeContextValues returns the metadata and tags attributes with the context
+// values merged in. Values already on the span take precedence.
+func mergeContextValues(attrs []attribute.KeyValue, values contextValues) []attribute.KeyValue {
+	var metadataAttr *attribute.KeyValue
+	var metadata map[string]any
+	var tags []string
+	for _, a := range attrs {
+		switch a.Key {
+		case metadataAttrKey:
+			metadataAttr = &a
+			if err := json.Unmarshal([]byte(a.Value.AsString()), &metadata); err != nil {
+				metadata = nil
+			}
+		case tagsAttrKey:
+			tags = a.Value.AsStringSlice()
+		}
+	}
+
+	var merged []attribute.KeyValue
+	switch {
+	case len(values.metadata) > 0 && (metadataAttr == nil || metadata != nil):
+		all := maps.Clone(values.metadata)
+		maps.Copy(all, metadata)
+		if b, err := json.Marshal(all); err == nil {
+			merged = append(merged, attribute.String(metadataAttrKey, string(b)))
+		} else if metadataAttr != nil {
+			merged = append(merged, *metadataAttr)
+		}
+	case metadataAttr != nil:
+		// metadata that isn't an object can't be merged, so leave it alone
+		merged = append(merged, *metadataAttr)
+	}
+
+	all := slices.Clone(values.tags)
+	for _, tag := range tags {
+		if !slices.Contains(all, tag) {
+			all = append(all, tag)
+		}
+	}
+	if len(all) > 0 {
+		merged = append(merged, attribute.StringSlice(tagsAttrKey, all))
+	}
+	return merged
+}
+
+// attrsSpan is an ended span with some of its attributes replaced.
+type attrsSpan struct {
+	trace.ReadOnlySpan
+	attrs []attribute.KeyValue
+}
+
+func (s *attrsSpan) Attributes() []attribute.KeyValue {
+	return s.attrs
+}
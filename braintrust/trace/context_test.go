@@ -0,0 +1,131 @@
+package trace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/internal"
+)
+
+func newContextTestTracer(t *testing.T) (oteltrace.Tracer, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider()
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	err := Enable(tp,
+		braintrust.WithAPIKey("test-key"),
+		braintrust.WithOrgName("test-org"),
+		withSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter)),
+	)
+	require.NoError(t, err)
+	return tp.Tracer("test"), exporter
+}
+
+func TestContextMetadataAndTags(t *testing.T) {
+	ctx := ContextWithMetadata(context.Background(), map[string]any{"user_id": "u1", "tenant": "acme"})
+	ctx = ContextWithMetadata(ctx, map[string]any{"tenant": "globex", "flag": true})
+	ctx = ContextWithTags(ctx, "beta")
+	ctx = ContextWithTags(ctx, "beta", "mobile")
+
+	assert.Equal(t, map[string]any{"user_id": "u1", "tenant": "globex", "flag": true}, MetadataFromContext(ctx))
+	assert.Equal(t, []string{"beta", "mobile"}, TagsFromContext(ctx))
+
+	assert.Nil(t, MetadataFromContext(context.Background()))
+	assert.Nil(t, TagsFromContext(context.Background()))
+}
+
+func TestSpanProcessor_ContextMetadataAndTags(t *testing.T) {
+	tracer, exporter := newContextTestTracer(t)
+
+	ctx := ContextWithMetadata(context.Background(), map[string]any{"user_id": "u1", "model": "default"})
+	ctx = ContextWithTags(ctx, "beta")
+
+	ctx, parent := tracer.Start(ctx, "parent", oteltrace.WithAttributes(attribute.String("braintrust.metadata", `{"step":1}`)))
+
+	// integrations replace the metadata after the span starts
+	_, child := tracer.Start(ctx, "child")
+	require.NoError(t, internal.SetJSONAttr(child, "braintrust.metadata", map[string]any{"model": "gpt-4o"}))
+	child.SetAttributes(attribute.StringSlice("braintrust.tags", []string{"llm"}))
+	child.End()
+	parent.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	childStub, parentStub := spans[0], spans[1]
+
+	assert.Equal(t, map[string]any{"user_id": "u1", "model": "default", "step": 1.0}, jsonAttr(t, parentStub, "braintrust.metadata"))
+	tags, _ := attrValue(parentStub, "braintrust.tags")
+	assert.Equal(t, []string{"beta"}, tags.AsStringSlice())
+
+	assert.Equal(t, map[string]any{"user_id": "u1", "model": "gpt-4o"}, jsonAttr(t, childStub, "braintrust.metadata"))
+	tags, _ = attrValue(childStub, "braintrust.tags")
+	assert.Equal(t, []string{"beta", "llm"}, tags.AsStringSlice())
+
+	// other attributes are kept, and each attribute appears once
+	_, ok := attrValue(childStub, ParentOtelAttrKey)
+	assert.True(t, ok)
+	var count int
+	for _, a := range childStub.Attributes {
+		if a.Key == "braintrust.metadata" {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count)
+}
+
+func TestSpanProcessor_NoContextValues(t *testing.T) {
+	tracer, exporter := newContextTestTracer(t)
+
+	_, span := tracer.Start(context.Background(), "plain")
+	span.End()
+
+	stub := flushOne(t, exporter)
+	_, ok := attrValue(stub, "braintrust.metadata")
+	assert.False(t, ok)
+	_, ok = attrValue(stub, "braintrust.tags")
+	assert.False(t, ok)
+}
+
+func TestContextMetadata_UnmergeableSpanMetadata(t *testing.T) {
+	tracer, exporter := newContextTestTracer(t)
+
+	ctx := ContextWithMetadata(context.Background(), map[string]any{"user_id": "u1"})
+	ctx = ContextWithTags(ctx, "beta")
+	_, span := tracer.Start(ctx, "op")
+	span.SetAttributes(attribute.String("braintrust.metadata", `"not an object"`))
+	span.End()
+
+	stub := flushOne(t, exporter)
+	assertAttrEquals(t, stub, "braintrust.metadata", `"not an object"`)
+	tags, _ := attrValue(stub, "braintrust.tags")
+	assert.Equal(t, []string{"beta"}, tags.AsStringSlice())
+}
+
+func TestContextMetadata_Propagation(t *testing.T) {
+	tracer, exporter := newContextTestTracer(t)
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+	ctx := ContextWithMetadata(context.Background(), map[string]any{"user_id": "u 1", "tenant": "acme,inc"})
+	ctx = ContextWithTags(ctx, "beta")
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+
+	// a different process
+	remote := propagator.Extract(context.Background(), carrier)
+	assert.Equal(t, map[string]any{"user_id": "u 1", "tenant": "acme,inc"}, MetadataFromContext(remote))
+	assert.Equal(t, []string{"beta"}, TagsFromContext(remote))
+
+	_, span := tracer.Start(remote, "remote")
+	span.End()
+	stub := flushOne(t, exporter)
+	assert.Equal(t, map[string]any{"user_id": "u 1", "tenant": "acme,inc"}, jsonAttr(t, stub, "braintrust.metadata"))
+}
@@ -0,0 +1,110 @@
+package trace
+
+// this file groups the traces of a multi-turn conversation.
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/log"
+)
+
+// conversationMetadataKey is the metadata key spans are grouped by.
+const conversationMetadataKey = "conversation_id"
+
+// ContextWithConversation returns a context whose spans are part of the given
+// conversation. Every span started with it has the conversation ID in its
+// "conversation_id" metadata, so all the turns of a conversation can be found in the
+// Braintrust UI. Like [ContextWithMetadata], it is propagated across processes.
+func ContextWithConversation(ctx context.Context, conversationID string) context.Context {
+	return ContextWithMetadata(ctx, map[string]any{conversationMetadataKey: conversationID})
+}
+
+// ConversationFromContext returns the ID of the conversation in the context, or "" if
+// there is none.
+func ConversationFromContext(ctx context.Context) string {
+	id, _ := MetadataFromContext(ctx)[conversationMetadataKey].(string)
+	return id
+}
+
+// Conversation tracks the turns of a conversation, like a chat with a user, where each
+// turn is handled separately and so is its own trace. It is not safe for concurrent
+// use, but its fields can be saved between requests to continue a conversation.
+//
+// Example:
+//
+//	conv := &trace.Conversation{ID: sessionID}
+//	for userMessage := range userMessages {
+//	    ctx, span := conv.StartTurn(ctx, "chat-turn", userMessage)
+//	    reply := respond(ctx, conv.Messages)
+//	    conv.AddMessages(reply)
+//	    _ = trace.SetOutput(span, reply)
+//	    span.End()
+//	}
+type Conversation struct {
+	ID string
+
+	// Turns is the number of turns started so far.
+	Turns int
+
+	// PreviousTurn is the span of the previous turn. If it is valid, the next turn's
+	// span links to it. StartTurn updates it.
+	PreviousTurn oteltrace.SpanContext
+
+	// Messages is the conversation's message history, which is logged as the input of
+	// each turn.
+	Messages []any
+
+	// TracerProvider defaults to the global tracer provider.
+	TracerProvider oteltrace.TracerProvider
+}
+
+// StartTurn starts the span of the next turn of the conversation. The messages, e.g.
+// the user's message, are added to the history, and the whole history is logged as
+// the span's input. The returned context carries the conversation ID, so every span
+// of the turn is part of the conversation. Callers must end the span. Messages that
+// can't be logged, e.g. because they aren't JSON, are logged as a warning.
+func (c *Conversation) StartTurn(ctx context.Context, name string, messages ...any) (context.Context, oteltrace.Span) {
+	c.Turns++
+	c.AddMessages(messages...)
+
+	ctx = ContextWithConversation(ctx, c.ID)
+
+	opts := []oteltrace.SpanStartOption{}
+	if c.PreviousTurn.IsValid() {
+		opts = append(opts, oteltrace.WithLinks(oteltrace.Link{
+			SpanContext: c.PreviousTurn,
+			Attributes:  []attribute.KeyValue{attribute.String("braintrust.link_type", "previous_turn")},
+		}))
+	}
+
+	tp := c.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	ctx, span := tp.Tracer("braintrust.conversation").Start(ctx, name, opts...)
+	c.PreviousTurn = span.SpanContext()
+
+	err := errors.Join(
+		SetSpanType(span, SpanTypeTask),
+		SetMetadata(span, map[string]any{"turn": c.Turns}),
+	)
+	if len(c.Messages) > 0 {
+		// a copy, so later messages don't change what was logged
+		err = errors.Join(err, SetInput(span, slices.Clone(c.Messages)))
+	}
+	if err != nil {
+		log.Warnf("conversation: failed to record turn %d of %q: %v", c.Turns, c.ID, err)
+	}
+	return ctx, span
+}
+
+// AddMessages adds messages, e.g. the assistant's reply, to the conversation's history.
+func (c *Conversation) AddMessages(messages ...any) {
+	c.Messages = append(c.Messages, messages...)
+}
@@ -0,0 +1,107 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/log"
+)
+
+func newConversationTestProvider(t *testing.T) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider()
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	err := Enable(tp,
+		braintrust.WithAPIKey("test-key"),
+		braintrust.WithOrgName("test-org"),
+		withSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter)),
+	)
+	require.NoError(t, err)
+	return tp, exporter
+}
+
+func TestConversation(t *testing.T) {
+	tp, exporter := newConversationTestProvider(t)
+	conv := &Conversation{ID: "conv-1", TracerProvider: tp}
+
+	// first turn, with a child span
+	ctx, turn1 := conv.StartTurn(context.Background(), "turn", "hi")
+	assert.Equal(t, "conv-1", ConversationFromContext(ctx))
+	_, llm := tp.Tracer("test").Start(ctx, "llm")
+	llm.End()
+	conv.AddMessages("hello!")
+	turn1.End()
+
+	// second turn
+	_, turn2 := conv.StartTurn(context.Background(), "turn", "how are you?")
+	turn2.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	llmStub, turn1Stub, turn2Stub := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, map[string]any{"conversation_id": "conv-1"}, jsonAttr(t, llmStub, "braintrust.metadata"))
+	assert.Equal(t, map[string]any{"conversation_id": "conv-1", "turn": 1.0}, jsonAttr(t, turn1Stub, "braintrust.metadata"))
+	assert.Equal(t, map[string]any{"conversation_id": "conv-1", "turn": 2.0}, jsonAttr(t, turn2Stub, "braintrust.metadata"))
+
+	assert.Equal(t, []any{"hi"}, jsonAttr(t, turn1Stub, "braintrust.input_json"))
+	assert.Equal(t, []any{"hi", "hello!", "how are you?"}, jsonAttr(t, turn2Stub, "braintrust.input_json"))
+	assert.Equal(t, map[string]any{"type": "task"}, jsonAttr(t, turn1Stub, "braintrust.span_attributes"))
+
+	// each turn is its own trace, linked to the previous turn
+	assert.NotEqual(t, turn1Stub.SpanContext.TraceID(), turn2Stub.SpanContext.TraceID())
+	assert.Empty(t, turn1Stub.Links)
+	require.Len(t, turn2Stub.Links, 1)
+	assert.Equal(t, turn1Stub.SpanContext.SpanID(), turn2Stub.Links[0].SpanContext.SpanID())
+	assert.Equal(t, turn2Stub.SpanContext, conv.PreviousTurn)
+	assert.Equal(t, 2, conv.Turns)
+}
+
+type warnRecorder struct {
+	warnings []string
+}
+
+func (r *warnRecorder) Debugf(format string, args ...any) {}
+func (r *warnRecorder) Infof(format string, args ...any)  {}
+func (r *warnRecorder) Warnf(format string, args ...any) {
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+}
+
+func TestConversation_InvalidMessage(t *testing.T) {
+	tp, exporter := newConversationTestProvider(t)
+	recorder := &warnRecorder{}
+	previous := log.Get()
+	log.Set(recorder)
+	t.Cleanup(func() { log.Set(previous) })
+
+	conv := &Conversation{ID: "conv-3", TracerProvider: tp}
+	_, turn := conv.StartTurn(context.Background(), "turn", func() {})
+	turn.End()
+
+	// the turn is still traced, without its input
+	stub := flushOne(t, exporter)
+	assert.Equal(t, map[string]any{"conversation_id": "conv-3", "turn": 1.0}, jsonAttr(t, stub, "braintrust.metadata"))
+	require.Len(t, recorder.warnings, 1)
+	assert.Contains(t, recorder.warnings[0], `failed to record turn 1 of "conv-3"`)
+}
+
+func TestConversation_Propagation(t *testing.T) {
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+	ctx := ContextWithConversation(context.Background(), "conv-2")
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+
+	remote := propagator.Extract(context.Background(), carrier)
+	assert.Equal(t, "conv-2", ConversationFromContext(remote))
+	assert.Equal(t, "", ConversationFromContext(context.Background()))
+}
@@ -0,0 +1,94 @@
+package trace
+
+// this file sums the estimated costs of the spans started with a context.
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// estimatedCostMetric is the metric with the estimated dollar cost of an LLM call, set
+// by the integrations with the prices of the pricing package.
+const estimatedCostMetric = "estimated_cost"
+
+type costTrackerKey struct{}
+
+// CostTracker sums the estimated_cost metrics of the spans started with its context,
+// like the LLM calls of an eval or a request. It requires Braintrust tracing to be
+// enabled (see [Enable]). It's safe for concurrent use.
+type CostTracker struct {
+	parent *CostTracker
+
+	mu    sync.Mutex
+	cost  float64
+	spans int
+}
+
+// ContextWithCostTracker returns a context with a new cost tracker. Trackers nest, so
+// the cost of a span is added to every tracker in its context.
+//
+// Example:
+//
+//	ctx, costs := trace.ContextWithCostTracker(ctx)
+//	handle(ctx, req)
+//	fmt.Printf("cost: $%.4f\n", costs.EstimatedCost())
+func ContextWithCostTracker(ctx context.Context) (context.Context, *CostTracker) {
+	parent, _ := ctx.Value(costTrackerKey{}).(*CostTracker)
+	tracker := &CostTracker{parent: parent}
+	return context.WithValue(ctx, costTrackerKey{}, tracker), tracker
+}
+
+// EstimatedCost returns the total estimated cost, in US dollars, of the spans that
+// have ended.
+func (t *CostTracker) EstimatedCost() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cost
+}
+
+// Spans returns the number of spans with an estimated cost that have ended.
+func (t *CostTracker) Spans() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.spans
+}
+
+func (t *CostTracker) add(cost float64) {
+	for ; t != nil; t = t.parent {
+		t.mu.Lock()
+		t.cost += cost
+		t.spans++
+		t.mu.Unlock()
+	}
+}
+
+// trackCost remembers the cost tracker of a starting span's context, if it has one.
+func (sp *spanProcessor) trackCost(ctx context.Context, span trace.ReadWriteSpan) {
+	if tracker, ok := ctx.Value(costTrackerKey{}).(*CostTracker); ok {
+		sp.costTrackers.Store(newSpanKey(span.SpanContext()), tracker)
+	}
+}
+
+// addCost adds the estimated cost of an ended span to the tracker of its context.
+func (sp *spanProcessor) addCost(span trace.ReadOnlySpan) {
+	v, ok := sp.costTrackers.LoadAndDelete(newSpanKey(span.SpanContext()))
+	if !ok {
+		return
+	}
+	for _, attr := range span.Attributes() {
+		if attr.Key != metricsAttrKey {
+			continue
+		}
+		var metrics map[string]any
+		if err := json.Unmarshal([]byte(attr.Value.AsString()), &metrics); err != nil {
+			return
+		}
+		if cost, ok := metrics[estimatedCostMetric].(float64); ok {
+			v.(*CostTracker).add(cost)
+		}
+		return
+	}
+}
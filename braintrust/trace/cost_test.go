@@ -0,0 +1,47 @@
+package trace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+)
+
+func TestCostTracker(t *testing.T) {
+	tp, exporter := newTestProvider(t, braintrust.WithSpanFilterFuncs(func(span sdktrace.ReadOnlySpan) int {
+		if span.Name() == "filtered" {
+			return -1
+		}
+		return 0
+	}))
+	tracer := tp.Tracer("test")
+
+	llm := func(ctx context.Context, name string, cost float64) {
+		_, span := tracer.Start(ctx, name)
+		require.NoError(t, SetMetrics(span, map[string]float64{"prompt_tokens": 100, "estimated_cost": cost}))
+		span.End()
+	}
+
+	ctx, root := tracer.Start(context.Background(), "request")
+	ctx, total := ContextWithCostTracker(ctx)
+	llm(ctx, "a", 0.25)
+	stepCtx, step := ContextWithCostTracker(ctx)
+	llm(stepCtx, "b", 0.5)
+	llm(stepCtx, "filtered", 1)
+
+	// spans without a cost, or outside the tracker's context, aren't counted
+	_, plain := tracer.Start(ctx, "plain")
+	plain.End()
+	llm(context.Background(), "untracked", 8)
+	root.End()
+
+	assert.Equal(t, 1.75, total.EstimatedCost())
+	assert.Equal(t, 3, total.Spans())
+	assert.Equal(t, 1.5, step.EstimatedCost())
+	assert.Equal(t, 2, step.Spans())
+	assert.Len(t, exporter.GetSpans(), 5)
+}
@@ -0,0 +1,379 @@
+package trace
+
+// this file sends feedback, like user ratings and delayed scores, for spans that were already logged.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/logobject"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/retry"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/log"
+)
+
+// FeedbackSource is where feedback came from.
+type FeedbackSource string
+
+const (
+	// FeedbackSourceExternal is feedback from your app's users. It is the default.
+	FeedbackSourceExternal FeedbackSource = "external"
+	// FeedbackSourceApp is feedback from the Braintrust app.
+	FeedbackSourceApp FeedbackSource = "app"
+	// FeedbackSourceAPI is feedback from an automated process.
+	FeedbackSourceAPI FeedbackSource = "api"
+)
+
+// Feedback is feedback on a span that was already logged. Scores, Expected and
+// Metadata are merged into the span's existing values, and Comment is added as a
+// comment on the span.
+type Feedback struct {
+	// Parent is the project or experiment the span was logged to.
+	Parent Parent
+	// SpanID is the hex-encoded OpenTelemetry span ID, which is also the span's row
+	// ID in Braintrust and the "s" parameter of its [Permalink].
+	SpanID string
+	// TraceID is the hex-encoded OpenTelemetry trace ID, to give feedback on a whole
+	// trace instead of a span. The feedback goes to the trace's root span, which is
+	// looked up when the feedback is sent, so the trace must be logged by then. Set
+	// either SpanID or TraceID.
+	TraceID string
+
+	Scores   map[string]float64
+	Expected any
+	Comment  string
+	Metadata map[string]any
+	Tags     []string
+	Source   FeedbackSource
+}
+
+// FeedbackFor returns feedback for a span, with its Parent and SpanID set. The span
+// can be ended. Its parent can only be read from spans of the OpenTelemetry SDK, so
+// other spans need their Parent set.
+//
+// Example:
+//
+//	fb := trace.FeedbackFor(span)
+//	fb.Scores = map[string]float64{"thumbs_up": 1}
+//	err := feedbackClient.Log(fb)
+func FeedbackFor(span oteltrace.Span) Feedback {
+	fb := Feedback{SpanID: span.SpanContext().SpanID().String()}
+	if v, ok := spanAttr(span, ParentOtelAttrKey); ok {
+		if parent, err := ParseParent(v.AsString()); err == nil {
+			fb.Parent = parent
+		}
+	}
+	return fb
+}
+
+func (fb Feedback) validate() error {
+	if fb.SpanID == "" && fb.TraceID == "" {
+		return fmt.Errorf("feedback SpanID or TraceID is required")
+	}
+	if fb.SpanID != "" && fb.TraceID != "" {
+		return fmt.Errorf("feedback can't have both a SpanID and a TraceID")
+	}
+	if !fb.Parent.Type.IsValid() || fb.Parent.ID == "" {
+		return fmt.Errorf("feedback Parent is required")
+	}
+	if fb.Scores == nil && fb.Expected == nil && fb.Comment == "" && fb.Metadata == nil && fb.Tags == nil {
+		return fmt.Errorf("feedback must have at least one of Scores, Expected, Comment, Metadata or Tags")
+	}
+	for name, score := range fb.Scores {
+		if score < 0 || score > 1 {
+			return fmt.Errorf("feedback score %q must be between 0 and 1, got %v", name, score)
+		}
+	}
+	return nil
+}
+
+// FeedbackOpts configures a [FeedbackClient].
+type FeedbackOpts struct {
+	BatchSize     int           // Feedback sent per request (default: 100)
+	FlushInterval time.Duration // How often queued feedback is sent (default: 1s)
+	MaxRetries    int           // Retries for failed requests (default: 3)
+	HTTPClient    *http.Client  // default: a client with a 30s timeout
+}
+
+// FeedbackClient sends feedback to Braintrust in the background. Feedback is queued
+// by [FeedbackClient.Log] and sent in batches, in the order it was logged. Call
+// [FeedbackClient.Close] before your program exits to send queued feedback. It is
+// safe for concurrent use.
+type FeedbackClient struct {
+	config braintrust.Config
+	opts   FeedbackOpts
+
+	mu      sync.Mutex
+	pending []Feedback
+	closed  bool
+
+	sendMu sync.Mutex // ensures batches are sent in order
+
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewFeedbackClient creates a feedback client using the global Braintrust config.
+func NewFeedbackClient(opts FeedbackOpts) *FeedbackClient {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	} else if opts.MaxRetries == 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	c := &FeedbackClient{
+		config: braintrust.GetConfig(),
+		opts:   opts,
+		kick:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// Log queues feedback to be sent. It returns an error if the feedback is invalid or
+// the client is closed.
+func (c *FeedbackClient) Log(fb Feedback) error {
+	if err := fb.validate(); err != nil {
+		return err
+	}
+	if fb.Source == "" {
+		fb.Source = FeedbackSourceExternal
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return fmt.Errorf("feedback client is closed")
+	}
+	c.pending = append(c.pending, fb)
+	if len(c.pending) >= c.opts.BatchSize {
+		select {
+		case c.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Flush sends all queued feedback and returns any errors sending it.
+func (c *FeedbackClient) Flush(ctx context.Context) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	var errs []error
+	for len(pending) > 0 {
+		n := min(len(pending), c.opts.BatchSize)
+		if err := c.send(ctx, pending[:n]); err != nil {
+			errs = append(errs, err)
+		}
+		pending = pending[n:]
+	}
+	return errors.Join(errs...)
+}
+
+// Close sends queued feedback and stops the client.
+func (c *FeedbackClient) Close(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	close(c.stop)
+	<-c.done
+	return c.Flush(ctx)
+}
+
+// run flushes queued feedback periodically, or sooner if a batch fills up.
+func (c *FeedbackClient) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		case <-c.kick:
+		}
+		if err := c.Flush(context.Background()); err != nil {
+			log.Warnf("failed to send feedback: %v", err)
+		}
+	}
+}
+
+// feedbackItem is a feedback event in the format of the Braintrust API.
+type feedbackItem struct {
+	ID       string             `json:"id"`
+	Scores   map[string]float64 `json:"scores,omitempty"`
+	Expected any                `json:"expected,omitempty"`
+	Comment  string             `json:"comment,omitempty"`
+	Metadata map[string]any     `json:"metadata,omitempty"`
+	Tags     []string           `json:"tags,omitempty"`
+	Source   FeedbackSource     `json:"source"`
+}
+
+// send sends a batch of feedback, grouped by the object it belongs to.
+func (c *FeedbackClient) send(ctx context.Context, batch []Feedback) error {
+	var paths []string
+	items := map[string][]feedbackItem{}
+	rootSpans := map[string]string{} // object path + trace ID => root span row ID
+	var errs []error
+	for _, fb := range batch {
+		path, err := c.objectPath(fb.Parent)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		id := fb.SpanID
+		if fb.TraceID != "" {
+			key := path + "/" + fb.TraceID
+			if id = rootSpans[key]; id == "" {
+				if id, err = c.rootSpanID(ctx, path, fb.TraceID); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				rootSpans[key] = id
+			}
+		}
+		if _, ok := items[path]; !ok {
+			paths = append(paths, path)
+		}
+		items[path] = append(items[path], feedbackItem{
+			ID:       id,
+			Scores:   fb.Scores,
+			Expected: fb.Expected,
+			Comment:  fb.Comment,
+			Metadata: fb.Metadata,
+			Tags:     fb.Tags,
+			Source:   fb.Source,
+		})
+	}
+
+	for _, path := range paths {
+		if err := c.post(ctx, path+"/feedback", map[string]any{"feedback": items[path]}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// objectPath returns the API path of the object spans logged to parent are in.
+func (c *FeedbackClient) objectPath(parent Parent) (string, error) {
+	objectType, objectID, err := logobject.Resolve(string(parent.Type), parent.ID)
+	if err != nil {
+		return "", err
+	}
+	return "/v1/" + objectType + "/" + objectID, nil
+}
+
+// rootSpanID returns the row ID of the root span of a trace in the object at path.
+// The root span is the trace's only row without span parents. A trace that isn't
+// found is retried, since it may not be ingested yet.
+func (c *FeedbackClient) rootSpanID(ctx context.Context, path, traceID string) (string, error) {
+	body, err := json.Marshal(map[string]any{
+		"filters": []map[string]any{{"type": "path_lookup", "path": []string{"root_span_id"}, "value": traceID}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode feedback: %w", err)
+	}
+
+	var id string
+	err = retry.Do(ctx, c.opts.MaxRetries, func() error {
+		var resp struct {
+			Events []struct {
+				ID          string   `json:"id"`
+				SpanParents []string `json:"span_parents"`
+			} `json:"events"`
+		}
+		if err := c.postOnce(ctx, path+"/fetch", body, &resp); err != nil {
+			return err
+		}
+		for _, event := range resp.Events {
+			if len(event.SpanParents) == 0 {
+				id = event.ID
+				return nil
+			}
+		}
+		return fmt.Errorf("failed to send feedback: no root span found for trace %s", traceID)
+	})
+	return id, err
+}
+
+// post sends a request, retrying network errors and server errors.
+func (c *FeedbackClient) post(ctx context.Context, path string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode feedback: %w", err)
+	}
+
+	return retry.Do(ctx, c.opts.MaxRetries, func() error {
+		return c.postOnce(ctx, path, body, nil)
+	})
+}
+
+// postOnce sends a request. If out isn't nil, the response is decoded into it.
+func (c *FeedbackClient) postOnce(ctx context.Context, path string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.APIURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create feedback request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send feedback: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &feedbackStatusError{statusCode: resp.StatusCode, body: string(respBody)}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode feedback response: %w", err)
+		}
+	}
+	return nil
+}
+
+type feedbackStatusError struct {
+	statusCode int
+	body       string
+}
+
+func (e *feedbackStatusError) StatusCode() int { return e.statusCode }
+
+func (e *feedbackStatusError) Error() string {
+	return fmt.Sprintf("failed to send feedback: [%d] %s", e.statusCode, e.body)
+}
@@ -0,0 +1,213 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+)
+
+type feedbackRequest struct {
+	path     string
+	feedback []map[string]any
+}
+
+// newFeedbackServer returns a fake API that records feedback requests. Requests fail
+// with the given statuses first.
+func newFeedbackServer(t *testing.T, failures ...int) func() []feedbackRequest {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []feedbackRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/v1/project" {
+			_, _ = w.Write([]byte(`{"id": "proj-from-name"}`))
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/fetch") {
+			// trace-1 has a root span and a child, logged in either order
+			var body struct {
+				Filters []struct {
+					Value string `json:"value"`
+				} `json:"filters"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			events := `[]`
+			if len(body.Filters) == 1 && body.Filters[0].Value == "trace-1" {
+				events = `[{"id": "child-span", "span_parents": ["root-span"]}, {"id": "root-span", "span_parents": null}]`
+			}
+			_, _ = w.Write([]byte(`{"events": ` + events + `}`))
+			return
+		}
+		if len(failures) > 0 {
+			status := failures[0]
+			failures = failures[1:]
+			http.Error(w, "failed", status)
+			return
+		}
+		var body struct {
+			Feedback []map[string]any `json:"feedback"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requests = append(requests, feedbackRequest{path: r.URL.Path, feedback: body.Feedback})
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("BRAINTRUST_API_KEY", "test-key")
+	t.Setenv("BRAINTRUST_API_URL", server.URL)
+
+	return func() []feedbackRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestFeedbackClient(t *testing.T) {
+	requests := newFeedbackServer(t)
+	client := NewFeedbackClient(FeedbackOpts{FlushInterval: time.Hour})
+
+	project := Parent{Type: ParentTypeProjectID, ID: "proj-1"}
+	require.NoError(t, client.Log(Feedback{Parent: project, SpanID: "span-1", Scores: map[string]float64{"thumbs_up": 1}}))
+	require.NoError(t, client.Log(Feedback{
+		Parent:   Parent{Type: ParentTypeExperimentID, ID: "my-project/exp-1"},
+		SpanID:   "span-2",
+		Expected: "Paris",
+		Source:   FeedbackSourceAPI,
+	}))
+	require.NoError(t, client.Log(Feedback{
+		Parent:   project,
+		SpanID:   "span-3",
+		Comment:  "too long",
+		Metadata: map[string]any{"user": "u1"},
+		Tags:     []string{"reviewed"},
+	}))
+	require.NoError(t, client.Log(Feedback{Parent: Parent{Type: ParentTypeProject, ID: "my-project"}, SpanID: "span-4", Comment: "ok"}))
+	require.NoError(t, client.Close(context.Background()))
+
+	assert.Equal(t, []feedbackRequest{
+		{path: "/v1/project_logs/proj-1/feedback", feedback: []map[string]any{
+			{"id": "span-1", "scores": map[string]any{"thumbs_up": 1.0}, "source": "external"},
+			{"id": "span-3", "comment": "too long", "metadata": map[string]any{"user": "u1"}, "tags": []any{"reviewed"}, "source": "external"},
+		}},
+		{path: "/v1/experiment/exp-1/feedback", feedback: []map[string]any{
+			{"id": "span-2", "expected": "Paris", "source": "api"},
+		}},
+		{path: "/v1/project_logs/proj-from-name/feedback", feedback: []map[string]any{
+			{"id": "span-4", "comment": "ok", "source": "external"},
+		}},
+	}, requests())
+
+	assert.Error(t, client.Log(Feedback{Parent: project, SpanID: "span-5", Comment: "late"}))
+}
+
+func TestFeedbackClient_TraceID(t *testing.T) {
+	requests := newFeedbackServer(t)
+	client := NewFeedbackClient(FeedbackOpts{FlushInterval: time.Hour, MaxRetries: -1})
+	defer func() { _ = client.Close(context.Background()) }()
+
+	// feedback on a trace goes to its root span
+	project := Parent{Type: ParentTypeProjectID, ID: "proj-1"}
+	require.NoError(t, client.Log(Feedback{Parent: project, TraceID: "trace-1", Scores: map[string]float64{"thumbs_up": 1}}))
+	require.NoError(t, client.Log(Feedback{Parent: project, TraceID: "trace-1", Comment: "great"}))
+	require.NoError(t, client.Flush(context.Background()))
+	assert.Equal(t, []feedbackRequest{
+		{path: "/v1/project_logs/proj-1/feedback", feedback: []map[string]any{
+			{"id": "root-span", "scores": map[string]any{"thumbs_up": 1.0}, "source": "external"},
+			{"id": "root-span", "comment": "great", "source": "external"},
+		}},
+	}, requests())
+
+	// unknown traces are errors
+	require.NoError(t, client.Log(Feedback{Parent: project, TraceID: "trace-2", Comment: "lost"}))
+	assert.ErrorContains(t, client.Flush(context.Background()), "no root span found for trace trace-2")
+	assert.Len(t, requests(), 1)
+}
+
+func TestFeedbackClient_Batching(t *testing.T) {
+	requests := newFeedbackServer(t)
+	client := NewFeedbackClient(FeedbackOpts{BatchSize: 2, FlushInterval: time.Hour})
+	defer func() { _ = client.Close(context.Background()) }()
+
+	project := Parent{Type: ParentTypeProjectID, ID: "proj-1"}
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, client.Log(Feedback{Parent: project, SpanID: id, Comment: id}))
+	}
+
+	// a full batch is sent in the background
+	require.Eventually(t, func() bool { return len(requests()) > 0 }, time.Second, time.Millisecond)
+	require.NoError(t, client.Flush(context.Background()))
+
+	var ids []string
+	for _, r := range requests() {
+		assert.LessOrEqual(t, len(r.feedback), 2)
+		for _, fb := range r.feedback {
+			ids = append(ids, fb["id"].(string))
+		}
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, ids)
+}
+
+func TestFeedbackClient_Retries(t *testing.T) {
+	requests := newFeedbackServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	client := NewFeedbackClient(FeedbackOpts{FlushInterval: time.Hour})
+	defer func() { _ = client.Close(context.Background()) }()
+
+	project := Parent{Type: ParentTypeProjectID, ID: "proj-1"}
+	require.NoError(t, client.Log(Feedback{Parent: project, SpanID: "a", Comment: "retried"}))
+	require.NoError(t, client.Flush(context.Background()))
+	assert.Len(t, requests(), 1)
+
+	// client errors aren't retried
+	requests = newFeedbackServer(t, http.StatusBadRequest)
+	client = NewFeedbackClient(FeedbackOpts{FlushInterval: time.Hour})
+	defer func() { _ = client.Close(context.Background()) }()
+	require.NoError(t, client.Log(Feedback{Parent: project, SpanID: "a", Comment: "rejected"}))
+	assert.ErrorContains(t, client.Flush(context.Background()), "[400]")
+	assert.Empty(t, requests())
+}
+
+func TestFeedback_Validation(t *testing.T) {
+	project := Parent{Type: ParentTypeProjectID, ID: "proj-1"}
+	tests := map[string]Feedback{
+		"SpanID or TraceID is required": {Parent: project, Comment: "x"},
+		"both a SpanID and a TraceID":   {Parent: project, SpanID: "a", TraceID: "t", Comment: "x"},
+		"Parent is required":            {SpanID: "a", Comment: "x"},
+		"at least one of":               {Parent: project, SpanID: "a"},
+		`score "bad" must be between`:   {Parent: project, SpanID: "a", Scores: map[string]float64{"bad": 2}},
+		`score "neg" must be between 0`: {Parent: project, SpanID: "a", Scores: map[string]float64{"neg": -1}},
+	}
+	for msg, fb := range tests {
+		assert.ErrorContains(t, fb.validate(), msg)
+	}
+}
+
+func TestFeedbackFor(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	err := Enable(tp,
+		braintrust.WithAPIKey("test-key"),
+		braintrust.WithOrgName("test-org"),
+		withSpanProcessor(sdktrace.NewSimpleSpanProcessor(tracetest.NewInMemoryExporter())),
+	)
+	require.NoError(t, err)
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	ctx := SetParent(context.Background(), Parent{Type: ParentTypeExperimentID, ID: "exp-1"})
+	_, span := tp.Tracer("test").Start(ctx, "op")
+	span.End()
+
+	fb := FeedbackFor(span)
+	assert.Equal(t, Parent{Type: ParentTypeExperimentID, ID: "exp-1"}, fb.Parent)
+	assert.Equal(t, span.SpanContext().SpanID().String(), fb.SpanID)
+}
@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// maxEventSize is the max size of a server-sent event of a streaming response. Events
+// with inline data like images or audio are large.
+const maxEventSize = 64 << 20
+
+// ReadEvents calls fn with every JSON event of a server-sent events body, until the
+// [DONE] event.
+func ReadEvents(body io.Reader, fn func(event map[string]any) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, maxEventSize)
+	for scanner.Scan() {
+		line, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if line == "[DONE]" {
+			break
+		}
+		var event map[string]any
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
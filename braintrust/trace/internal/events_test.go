@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadEvents(t *testing.T) {
+	body := "event: delta\ndata: {\"n\": 1}\n\n: comment\ndata: {\"n\": 2}\n\ndata: [DONE]\n\ndata: {\"n\": 3}\n"
+	var events []map[string]any
+	require.NoError(t, ReadEvents(strings.NewReader(body), func(event map[string]any) error {
+		events = append(events, event)
+		return nil
+	}))
+	assert.Equal(t, []map[string]any{{"n": float64(1)}, {"n": float64(2)}}, events)
+
+	assert.Error(t, ReadEvents(strings.NewReader("data: {\n"), func(map[string]any) error { return nil }))
+	stop := errors.New("stop")
+	assert.Equal(t, stop, ReadEvents(strings.NewReader(body), func(map[string]any) error { return stop }))
+
+	// large events, like ones with images, are read
+	large := "data: {\"image\": \"" + strings.Repeat("a", 1<<20) + "\"}\n"
+	require.NoError(t, ReadEvents(strings.NewReader(large), func(event map[string]any) error {
+		assert.Len(t, event["image"], 1<<20)
+		return nil
+	}))
+}
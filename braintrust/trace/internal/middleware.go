@@ -20,6 +20,12 @@ type MiddlewareTracer interface {
 	TagSpan(span trace.Span, response io.Reader) error
 }
 
+// RequestHeaderTracer is implemented by tracers that need the headers of the request,
+// like the boundary of a multipart form. The middleware sets them before StartSpan.
+type RequestHeaderTracer interface {
+	SetRequestHeader(header http.Header)
+}
+
 // NextMiddleware represents the next middleware to run in the client middleware chain.
 type NextMiddleware = func(req *http.Request) (*http.Response, error)
 
@@ -47,6 +53,9 @@ func Middleware(getMiddlewareTracer TracerRouter) func(*http.Request, NextMiddle
 		}
 
 		// Supported endpoint, let's set up tracing.
+		if ht, ok := mt.(RequestHeaderTracer); ok {
+			ht.SetRequestHeader(req.Header)
+		}
 		var buf bytes.Buffer
 		reqBody := req.Body
 		defer func() {
@@ -80,10 +89,19 @@ func Middleware(getMiddlewareTracer TracerRouter) func(*http.Request, NextMiddle
 		//
 		// It's critical that we don't try to parse the whole response body here because
 		// we don't want to block clients waiting for streaming responses.
+		var timer *chunkTimer
+		st, streams := mt.(StreamTracer)
+		if streams {
+			timer = newChunkTimer(resp.Body)
+			resp.Body = timer
+		}
 		onResponseDone := func(r io.Reader) {
 			// NOTE: this could be done in a goroutine so we don't add any extra
 			// latency to the response.
 			now := time.Now()
+			if streams {
+				st.SetChunkTimes(start, timer.times)
+			}
 			if err := mt.TagSpan(span, r); err != nil {
 				log.Warnf("Error tagging span: %v\n%s", err)
 			}
@@ -0,0 +1,148 @@
+package internal
+
+// this file measures the latency of the output of streaming responses, which are
+// parsed after they're fully read.
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+var streamingEvents atomic.Bool
+
+// SetStreamingEvents sets whether the spans of streaming responses get a "first_token"
+// event when their first output chunk is received.
+func SetStreamingEvents(enabled bool) {
+	streamingEvents.Store(enabled)
+}
+
+// StreamTracer is implemented by tracers of streaming responses. The middleware sets the
+// start of the request and the times the data lines of the response's server-sent
+// events were received, before TagSpan.
+type StreamTracer interface {
+	SetChunkTimes(start time.Time, chunks []time.Time)
+}
+
+// chunkTimer records the times the data lines of server-sent events are read.
+type chunkTimer struct {
+	src io.ReadCloser
+	// line is the start of the line being read, enough to tell if it's a data line.
+	line  []byte
+	times []time.Time
+}
+
+var dataPrefix = []byte("data: ")
+
+func newChunkTimer(src io.ReadCloser) *chunkTimer {
+	return &chunkTimer{src: src, line: make([]byte, 0, len(dataPrefix))}
+}
+
+func (ct *chunkTimer) Read(p []byte) (int, error) {
+	n, err := ct.src.Read(p)
+	now := time.Now()
+	for data := p[:n]; len(data) > 0; {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			ct.appendLine(data)
+			break
+		}
+		ct.appendLine(data[:i])
+		ct.endLine(now)
+		data = data[i+1:]
+	}
+	if err == io.EOF {
+		ct.endLine(now)
+	}
+	return n, err
+}
+
+func (ct *chunkTimer) Close() error {
+	return ct.src.Close()
+}
+
+func (ct *chunkTimer) appendLine(b []byte) {
+	if room := cap(ct.line) - len(ct.line); room > 0 {
+		ct.line = append(ct.line, b[:min(room, len(b))]...)
+	}
+}
+
+func (ct *chunkTimer) endLine(t time.Time) {
+	if bytes.Equal(ct.line, dataPrefix) {
+		ct.times = append(ct.times, t)
+	}
+	ct.line = ct.line[:0]
+}
+
+// StreamTiming measures the latency of the output of a streaming response. Tracers embed
+// it to implement StreamTracer, and mark the chunks that have output while they parse
+// the response.
+type StreamTiming struct {
+	start  time.Time
+	chunks []time.Time
+	output []time.Time
+	// last is the index of the last output chunk.
+	last int
+}
+
+// SetChunkTimes sets the start of the request and the times the response's chunks were
+// received.
+func (st *StreamTiming) SetChunkTimes(start time.Time, chunks []time.Time) {
+	st.start = start
+	st.chunks = chunks
+}
+
+// Output marks the chunk with index i, the i-th data line of the response, as having
+// output like text or tool call arguments. Chunks are marked in order, and marking a
+// chunk again is a no-op.
+func (st *StreamTiming) Output(i int) {
+	if i >= len(st.chunks) || i <= st.last && len(st.output) > 0 {
+		return
+	}
+	st.output = append(st.output, st.chunks[i])
+	st.last = i
+}
+
+// SetUsageMetrics sets the token metrics of a streaming LLM span like SetUsageMetrics,
+// with the latency of its output in seconds:
+//   - time_to_first_token: from the start of the request to the first output chunk
+//   - inter_chunk_latency_mean, inter_chunk_latency_p95, inter_chunk_latency_max:
+//     between output chunks
+//   - tokens_per_second: completion_tokens over the time between the first and last
+//     output chunks
+//
+// With streaming events enabled, the span gets a "first_token" event too. Spans of
+// responses without output chunks, like non-streaming ones, get the token metrics only.
+func (st *StreamTiming) SetUsageMetrics(span trace.Span, model string, metrics map[string]int64) error {
+	values := usageMetrics(model, metrics)
+	if len(st.output) > 0 {
+		first, last := st.output[0], st.output[len(st.output)-1]
+		values["time_to_first_token"] = first.Sub(st.start).Seconds()
+		if len(st.output) > 1 {
+			latencies := make([]float64, len(st.output)-1)
+			var total float64
+			for i := range latencies {
+				latencies[i] = st.output[i+1].Sub(st.output[i]).Seconds()
+				total += latencies[i]
+			}
+			sort.Float64s(latencies)
+			values["inter_chunk_latency_mean"] = total / float64(len(latencies))
+			values["inter_chunk_latency_p95"] = latencies[(len(latencies)*95+99)/100-1]
+			values["inter_chunk_latency_max"] = latencies[len(latencies)-1]
+			if tokens := metrics["completion_tokens"]; tokens > 0 && last.After(first) {
+				values["tokens_per_second"] = float64(tokens) / last.Sub(first).Seconds()
+			}
+		}
+		if streamingEvents.Load() {
+			span.AddEvent("first_token", trace.WithTimestamp(first))
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return SetJSONAttr(span, "braintrust.metrics", values)
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestChunkTimer(t *testing.T) {
+	body := "event: message_start\ndata: {\"a\":1}\n\n: comment\ndata: {\"b\":2}\r\n\ndata: [DONE]"
+	// read a byte at a time, so lines are split across reads
+	timer := newChunkTimer(io.NopCloser(iotest.OneByteReader(strings.NewReader(body))))
+	b, err := io.ReadAll(timer)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(b))
+	assert.Len(t, timer.times, 3)
+	assert.False(t, timer.times[2].Before(timer.times[0]))
+}
+
+func TestStreamTiming(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	SetStreamingEvents(true)
+	t.Cleanup(func() { SetStreamingEvents(false) })
+
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	var st StreamTiming
+	st.SetChunkTimes(start, []time.Time{at(100), at(500), at(600), at(800), at(1000), at(1000)})
+	// the first chunk has no output, and the second one has output of two choices
+	st.Output(1)
+	st.Output(1)
+	st.Output(2)
+	st.Output(4)
+	st.Output(5)
+
+	_, span := tp.Tracer(t.Name()).Start(context.Background(), "llm")
+	require.NoError(t, st.SetUsageMetrics(span, "", map[string]int64{"completion_tokens": 50}))
+	span.End()
+
+	stub := exporter.GetSpans()[0]
+	var metrics map[string]float64
+	for _, attr := range stub.Attributes {
+		if attr.Key == attribute.Key("braintrust.metrics") {
+			require.NoError(t, json.Unmarshal([]byte(attr.Value.AsString()), &metrics))
+		}
+	}
+	assert.Equal(t, float64(50), metrics["completion_tokens"])
+	assert.InDelta(t, 0.5, metrics["time_to_first_token"], 1e-9)
+	assert.InDelta(t, 0.5/3, metrics["inter_chunk_latency_mean"], 1e-9)
+	assert.InDelta(t, 0.4, metrics["inter_chunk_latency_p95"], 1e-9)
+	assert.InDelta(t, 0.4, metrics["inter_chunk_latency_max"], 1e-9)
+	assert.InDelta(t, 100, metrics["tokens_per_second"], 1e-9)
+
+	require.Len(t, stub.Events, 1)
+	assert.Equal(t, "first_token", stub.Events[0].Name)
+	assert.Equal(t, at(500), stub.Events[0].Time)
+}
+
+func TestStreamTiming_NoOutput(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	// like non-streaming responses, and the requests of batches
+	var st StreamTiming
+	_, span := tp.Tracer(t.Name()).Start(context.Background(), "llm")
+	require.NoError(t, st.SetUsageMetrics(span, "", nil))
+	span.End()
+
+	stub := exporter.GetSpans()[0]
+	assert.Empty(t, stub.Attributes)
+	assert.Empty(t, stub.Events)
+}
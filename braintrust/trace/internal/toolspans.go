@@ -0,0 +1,205 @@
+package internal
+
+// this file traces the tool calls of LLM responses as tool spans, which end when the
+// tool results are sent back to the LLM.
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ToolCall is a tool call of an LLM response.
+type ToolCall struct {
+	// ID is the call's ID, like OpenAI's tool_call_id or Anthropic's tool_use_id.
+	ID   string
+	Name string
+	// Arguments are the call's arguments, as a JSON string or a decoded value.
+	Arguments any
+}
+
+// ToolResult is the result of a tool call, sent to the LLM in a follow-up request.
+type ToolResult struct {
+	// ID is the ID of the tool call.
+	ID      string
+	Output  any
+	IsError bool
+}
+
+// toolSpanTTL is how long a tool span waits for its result. Spans whose result isn't
+// sent in time end without an output.
+var toolSpanTTL = 10 * time.Minute
+
+// maxToolSpans is the max number of tool spans of a TracerProvider waiting for their
+// results. Tool calls past it end right away.
+const maxToolSpans = 10000
+
+// toolSpan is a tool span waiting for its result.
+type toolSpan struct {
+	span  trace.Span
+	start time.Time
+	timer *time.Timer
+}
+
+// toolSpans are the tool spans waiting for their results, by TracerProvider and ID, so
+// the spans of a provider are matched with the results sent through the same provider,
+// and end when it shuts down.
+var (
+	toolSpansMu sync.Mutex
+	toolSpans   = map[trace.TracerProvider]map[string]*toolSpan{}
+)
+
+// StartToolSpans starts a tool span for each tool call of an LLM response, with the
+// call's name, arguments and ID. ctx is the context the LLM span was started with, so
+// tool spans are its siblings, and they're linked to it. Tool spans end when their
+// results are sent with EndToolSpans through the same TracerProvider, so they last as
+// long as the tools run.
+func StartToolSpans(ctx context.Context, tracer trace.Tracer, llmSpan trace.Span, start time.Time, calls []ToolCall) error {
+	for _, call := range calls {
+		if call.ID == "" {
+			continue
+		}
+		span, err := startToolSpan(ctx, tracer, llmSpan, start, call)
+		if err != nil {
+			return err
+		}
+		waitForResult(span.TracerProvider(), call.ID, &toolSpan{span: span, start: start})
+	}
+	return nil
+}
+
+// TraceToolCalls creates a tool span for each tool call of an LLM response whose
+// results won't be sent through this process, like the responses of batch jobs. The
+// spans start and end at t, without an output.
+func TraceToolCalls(ctx context.Context, tracer trace.Tracer, llmSpan trace.Span, t time.Time, calls []ToolCall) error {
+	for _, call := range calls {
+		if call.ID == "" {
+			continue
+		}
+		span, err := startToolSpan(ctx, tracer, llmSpan, t, call)
+		if err != nil {
+			return err
+		}
+		span.End(trace.WithTimestamp(t))
+	}
+	return nil
+}
+
+// startToolSpan starts the span of a tool call, with its input and metadata.
+func startToolSpan(ctx context.Context, tracer trace.Tracer, llmSpan trace.Span, start time.Time, call ToolCall) (trace.Span, error) {
+	_, span := tracer.Start(ctx, call.Name,
+		trace.WithTimestamp(start),
+		trace.WithLinks(trace.Link{SpanContext: llmSpan.SpanContext()}),
+	)
+
+	arguments := call.Arguments
+	if s, ok := arguments.(string); ok {
+		var decoded any
+		if err := json.Unmarshal([]byte(s), &decoded); err == nil {
+			arguments = decoded
+		}
+	}
+	if err := SetJSONAttr(span, "braintrust.span_attributes", map[string]string{"type": "tool"}); err != nil {
+		span.End(trace.WithTimestamp(start))
+		return nil, err
+	}
+	if err := SetJSONAttr(span, "braintrust.input_json", arguments); err != nil {
+		span.End(trace.WithTimestamp(start))
+		return nil, err
+	}
+	metadata := map[string]any{"tool_call_id": call.ID, "name": call.Name}
+	if err := SetJSONAttr(span, "braintrust.metadata", metadata); err != nil {
+		span.End(trace.WithTimestamp(start))
+		return nil, err
+	}
+	return span, nil
+}
+
+// waitForResult keeps a tool span until its result is sent, or it expires.
+func waitForResult(tp trace.TracerProvider, id string, ts *toolSpan) {
+	toolSpansMu.Lock()
+	defer toolSpansMu.Unlock()
+	pending := toolSpans[tp]
+	if pending == nil {
+		pending = map[string]*toolSpan{}
+		toolSpans[tp] = pending
+	}
+	if previous, ok := pending[id]; ok {
+		previous.timer.Stop()
+		previous.span.End(trace.WithTimestamp(previous.start))
+	} else if len(pending) >= maxToolSpans {
+		ts.span.End(trace.WithTimestamp(ts.start))
+		return
+	}
+	pending[id] = ts
+	ts.timer = time.AfterFunc(toolSpanTTL, func() {
+		if takeToolSpan(tp, id, ts) {
+			ts.span.End(trace.WithTimestamp(ts.start))
+		}
+	})
+}
+
+// takeToolSpan removes a tool span from the spans waiting for their result, and
+// returns whether it was still waiting.
+func takeToolSpan(tp trace.TracerProvider, id string, ts *toolSpan) bool {
+	toolSpansMu.Lock()
+	defer toolSpansMu.Unlock()
+	pending := toolSpans[tp]
+	if pending[id] != ts {
+		return false
+	}
+	delete(pending, id)
+	if len(pending) == 0 {
+		delete(toolSpans, tp)
+	}
+	return true
+}
+
+// EndToolSpans ends the tool spans of the tool results sent in a follow-up request to
+// an LLM, at the start of the request, with the results as their output. The span of
+// the request is linked to them. Results of unknown or ended tool spans, like the ones
+// of earlier turns of a conversation, are skipped.
+func EndToolSpans(span trace.Span, end time.Time, results []ToolResult) error {
+	tp := span.TracerProvider()
+	for _, result := range results {
+		toolSpansMu.Lock()
+		ts, ok := toolSpans[tp][result.ID]
+		toolSpansMu.Unlock()
+		if !ok || !takeToolSpan(tp, result.ID, ts) {
+			continue
+		}
+		ts.timer.Stop()
+
+		span.AddLink(trace.Link{
+			SpanContext: ts.span.SpanContext(),
+			Attributes:  []attribute.KeyValue{attribute.String("tool_call_id", result.ID)},
+		})
+		err := SetJSONAttr(ts.span, "braintrust.output_json", result.Output)
+		if result.IsError {
+			ts.span.SetStatus(codes.Error, "tool call failed")
+		}
+		ts.span.End(trace.WithTimestamp(end))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EndAllToolSpans ends the tool spans of a TracerProvider waiting for their results,
+// without an output. It's called when the provider shuts down.
+func EndAllToolSpans(tp trace.TracerProvider) {
+	toolSpansMu.Lock()
+	pending := toolSpans[tp]
+	delete(toolSpans, tp)
+	toolSpansMu.Unlock()
+	for _, ts := range pending {
+		ts.timer.Stop()
+		ts.span.End(trace.WithTimestamp(ts.start))
+	}
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestToolSpans_EndAll(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := tp.Tracer(t.Name())
+
+	start := time.Now()
+	_, llm := tracer.Start(context.Background(), "llm")
+	calls := []ToolCall{
+		{ID: "call_end_all", Name: "search", Arguments: `{"query":"otel"}`},
+		{Name: "no_id"},
+	}
+	require.NoError(t, StartToolSpans(context.Background(), tracer, llm, start, calls))
+	llm.End()
+
+	// results of unknown tool calls are skipped
+	_, followUp := tracer.Start(context.Background(), "follow-up")
+	require.NoError(t, EndToolSpans(followUp, time.Now(), []ToolResult{{ID: "call_unknown", Output: "x"}}))
+	followUp.End()
+	assert.Empty(t, followUp.(sdktrace.ReadOnlySpan).Links())
+
+	// calls without an ID have no span, and pending spans end without an output
+	EndAllToolSpans(tp)
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	tool := spans[2]
+	assert.Equal(t, "search", tool.Name)
+	assert.Equal(t, start.UnixNano(), tool.EndTime.UnixNano())
+	for _, attr := range tool.Attributes {
+		assert.NotEqual(t, "braintrust.output_json", string(attr.Key))
+	}
+}
+
+func TestToolSpans_NoFollowUp(t *testing.T) {
+	original := toolSpanTTL
+	t.Cleanup(func() { toolSpanTTL = original })
+	toolSpanTTL = 10 * time.Millisecond
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := tp.Tracer(t.Name())
+
+	start := time.Now()
+	_, llm := tracer.Start(context.Background(), "llm")
+	calls := []ToolCall{{ID: "call_no_follow_up", Name: "search"}}
+	require.NoError(t, StartToolSpans(context.Background(), tracer, llm, start, calls))
+	llm.End()
+
+	// without a follow-up request, the tool span ends at its start, without an output
+	require.Eventually(t, func() bool { return len(exporter.GetSpans()) == 2 }, time.Second, time.Millisecond)
+	tool := exporter.GetSpans()[1]
+	assert.Equal(t, "search", tool.Name)
+	assert.Equal(t, start.UnixNano(), tool.EndTime.UnixNano())
+	for _, attr := range tool.Attributes {
+		assert.NotEqual(t, "braintrust.output_json", string(attr.Key))
+	}
+
+	// a late result is skipped
+	_, followUp := tracer.Start(context.Background(), "follow-up")
+	require.NoError(t, EndToolSpans(followUp, time.Now(), []ToolResult{{ID: "call_no_follow_up", Output: "x"}}))
+	followUp.End()
+	assert.Empty(t, followUp.(sdktrace.ReadOnlySpan).Links())
+	assert.Len(t, exporter.GetSpans(), 3)
+}
+
+func TestToolSpans_ByTracerProvider(t *testing.T) {
+	exporter1 := tracetest.NewInMemoryExporter()
+	tp1 := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter1))
+	exporter2 := tracetest.NewInMemoryExporter()
+	tp2 := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter2))
+	t.Cleanup(func() { EndAllToolSpans(tp2) })
+
+	for _, tp := range []*sdktrace.TracerProvider{tp1, tp2} {
+		tracer := tp.Tracer(t.Name())
+		_, llm := tracer.Start(context.Background(), "llm")
+		calls := []ToolCall{{ID: "call_shared", Name: "search"}}
+		require.NoError(t, StartToolSpans(context.Background(), tracer, llm, time.Now(), calls))
+		llm.End()
+	}
+
+	// results only end the tool spans of their provider
+	_, followUp := tp1.Tracer(t.Name()).Start(context.Background(), "follow-up")
+	require.NoError(t, EndToolSpans(followUp, time.Now(), []ToolResult{{ID: "call_shared", Output: "x"}}))
+	followUp.End()
+	assert.Len(t, exporter1.GetSpans(), 3)
+	assert.Len(t, exporter2.GetSpans(), 1)
+
+	// ending the tool spans of a provider doesn't end the others'
+	EndAllToolSpans(tp1)
+	assert.Len(t, exporter2.GetSpans(), 1)
+	EndAllToolSpans(tp2)
+	assert.Len(t, exporter2.GetSpans(), 2)
+}
@@ -10,6 +10,8 @@ import (
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/pricing"
 )
 
 // BufferedReader saves data read from the readCloser and triggers an action
@@ -89,3 +91,30 @@ func SetJSONAttr(span trace.Span, key string, value any) error {
 	span.SetAttributes(attribute.String(key, string(jsonStr)))
 	return nil
 }
+
+// SetUsageMetrics sets the token metrics of an LLM span, and their estimated_cost if
+// the model has a price.
+func SetUsageMetrics(span trace.Span, model string, metrics map[string]int64) error {
+	return SetJSONAttr(span, "braintrust.metrics", usageMetrics(model, metrics))
+}
+
+// usageMetrics returns token metrics as span metrics, with their estimated_cost.
+func usageMetrics(model string, metrics map[string]int64) map[string]float64 {
+	values := make(map[string]float64, len(metrics)+1)
+	if len(metrics) == 0 {
+		return values
+	}
+	for k, v := range metrics {
+		values[k] = float64(v)
+	}
+	if cost, ok := pricing.Cost(model, metrics); ok {
+		values["estimated_cost"] = cost
+	}
+	return values
+}
+
+// ModelName returns the "model" of a span's metadata, or "" if it has none.
+func ModelName(metadata map[string]any) string {
+	model, _ := metadata["model"].(string)
+	return model
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -57,6 +59,27 @@ func TestSetJSONAttr(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestSetUsageMetrics(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := tp.Tracer("test")
+	metrics := map[string]int64{"prompt_tokens": 1000, "completion_tokens": 100, "tokens": 1100}
+
+	_, span := tracer.Start(context.Background(), "priced")
+	require.NoError(t, SetUsageMetrics(span, "gpt-4o-mini-2024-07-18", metrics))
+	span.End()
+	_, span = tracer.Start(context.Background(), "unpriced")
+	require.NoError(t, SetUsageMetrics(span, "my-model", metrics))
+	span.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.JSONEq(t, `{"prompt_tokens": 1000, "completion_tokens": 100, "tokens": 1100, "estimated_cost": 0.00021}`,
+		spans[0].Attributes[0].Value.AsString())
+	assert.JSONEq(t, `{"prompt_tokens": 1000, "completion_tokens": 100, "tokens": 1100}`,
+		spans[1].Attributes[0].Value.AsString())
+}
+
 // Mock tracer for testing
 type mockTracer struct {
 	startSpanCalled bool
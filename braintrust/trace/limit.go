@@ -0,0 +1,176 @@
+package trace
+
+// this file keeps large payloads from making spans too big to export.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/attachment"
+)
+
+// limitedAttrKeys are the attributes whose size is limited. The _json attributes and
+// expected are JSON, the others are plain strings. Metadata isn't limited, because it
+// must stay an object to be searchable.
+var limitedAttrKeys = map[attribute.Key]bool{
+	inputAttrKey:        true,
+	outputAttrKey:       true,
+	expectedAttrKey:     true,
+	"braintrust.input":  false,
+	"braintrust.output": false,
+}
+
+// payloadLimiter truncates large attributes of spans, or offloads them to attachments.
+type payloadLimiter struct {
+	maxSize int
+	// uploader offloads payloads to attachments. It is nil in truncate mode.
+	uploader *attachment.Uploader
+}
+
+// newPayloadLimiter returns a limiter for the config, or nil if there is nothing to limit.
+func newPayloadLimiter(config braintrust.Config) (*payloadLimiter, error) {
+	p := &payloadLimiter{maxSize: config.MaxAttributeSize}
+	switch config.LargeAttributeMode {
+	case "", braintrust.LargeAttributeTruncate:
+		if p.maxSize <= 0 {
+			return nil, nil
+		}
+	case braintrust.LargeAttributeAttachment:
+		p.uploader = attachment.SharedUploader(attachment.UploaderOpts{
+			APIKey:  config.APIKey,
+			APIURL:  config.APIURL,
+			AppURL:  config.AppURL,
+			OrgName: config.OrgName,
+		})
+	default:
+		return nil, fmt.Errorf("invalid large attribute mode: %q", config.LargeAttributeMode)
+	}
+	return p, nil
+}
+
+// limitSpan returns the ended span with its large attributes truncated or offloaded.
+func (p *payloadLimiter) limitSpan(span trace.ReadOnlySpan) trace.ReadOnlySpan {
+	var attrs []attribute.KeyValue
+	for i, a := range span.Attributes() {
+		isJSON, ok := limitedAttrKeys[a.Key]
+		if !ok || a.Value.Type() != attribute.STRING {
+			continue
+		}
+		value := a.Value.AsString()
+		limited := p.limit(string(a.Key), value, isJSON)
+		if limited == value {
+			continue
+		}
+		if attrs == nil {
+			attrs = append(attrs, span.Attributes()...)
+		}
+		attrs[i] = attribute.String(string(a.Key), limited)
+	}
+	if attrs == nil {
+		return span
+	}
+	return &attrsSpan{ReadOnlySpan: span, attrs: attrs}
+}
+
+// limit returns the value of an attribute with inline data URLs offloaded, and
+// truncated or offloaded if it is still too large.
+func (p *payloadLimiter) limit(key, value string, isJSON bool) string {
+	tooLarge := func(s string) bool { return p.maxSize > 0 && len(s) > p.maxSize }
+
+	if isJSON && strings.Contains(value, "data:") && (p.uploader != nil || tooLarge(value)) {
+		if replaced, ok := p.replaceDataURLs(value); ok {
+			value = replaced
+		}
+	}
+	if !tooLarge(value) {
+		return value
+	}
+
+	if p.uploader != nil && isJSON {
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "braintrust."), "_json") + ".json"
+		ref := p.uploader.Upload(name, "application/json", []byte(value))
+		if b, err := json.Marshal(ref); err == nil {
+			return string(b)
+		}
+	}
+	return truncate(value, p.maxSize, isJSON)
+}
+
+// replaceDataURLs replaces the data URLs in a JSON value with attachment references,
+// or with a marker in truncate mode. It returns false if the value isn't JSON or has
+// no data URLs.
+func (p *payloadLimiter) replaceDataURLs(value string) (string, bool) {
+	var v any
+	dec := json.NewDecoder(strings.NewReader(value))
+	dec.UseNumber() // keep large numbers exact
+	if err := dec.Decode(&v); err != nil {
+		return "", false
+	}
+
+	var replaced bool
+	var walk func(v any) any
+	walk = func(v any) any {
+		switch t := v.(type) {
+		case string:
+			contentType, data, ok := attachment.ParseDataURL(t)
+			if !ok {
+				return t
+			}
+			replaced = true
+			if p.uploader == nil {
+				return fmt.Sprintf("[data URL removed: %s, %d bytes]", contentType, len(data))
+			}
+			return p.uploader.Upload("", contentType, data)
+		case map[string]any:
+			for k, child := range t {
+				t[k] = walk(child)
+			}
+		case []any:
+			for i, child := range t {
+				t[i] = walk(child)
+			}
+		}
+		return v
+	}
+	v = walk(v)
+	if !replaced {
+		return "", false
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+// truncate cuts a value to at most maxSize bytes, including a marker saying how much
+// was cut. JSON values are truncated to a JSON string.
+func truncate(value string, maxSize int, isJSON bool) string {
+	cut := maxSize
+	for {
+		cut = max(min(cut, len(value)), 0)
+		for cut > 0 && cut < len(value) && !utf8.RuneStart(value[cut]) {
+			cut--
+		}
+		prefix := value[:cut]
+		s := fmt.Sprintf("%s... [truncated %d bytes]", prefix, len(value)-len(prefix))
+		if isJSON {
+			b, _ := json.Marshal(s)
+			s = string(b)
+		}
+		if len(s) <= maxSize || cut == 0 {
+			return s
+		}
+		cut -= len(s) - maxSize
+	}
+}
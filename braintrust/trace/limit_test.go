@@ -0,0 +1,113 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/attachmenttest"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/auth"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/attachment"
+)
+
+func TestPayloadLimit_Truncate(t *testing.T) {
+	tracer, exporter := newRedactTestTracer(t, braintrust.WithMaxAttributeSize(100))
+
+	image, err := attachment.FromBytes(attachment.ImagePNG, []byte(strings.Repeat("x", 200))).Base64URL()
+	require.NoError(t, err)
+
+	_, span := tracer.Start(context.Background(), "op")
+	require.NoError(t, SetInput(span, []any{map[string]any{"type": "image_url", "url": image}}))
+	require.NoError(t, SetOutput(span, strings.Repeat("é", 200)))
+	require.NoError(t, SetExpected(span, "small"))
+	span.SetAttributes(attribute.String("braintrust.input", strings.Repeat("a", 150)))
+	span.End()
+
+	stub := flushOne(t, exporter)
+
+	// data URLs are replaced first, which can be enough
+	assert.Equal(t, []any{map[string]any{"type": "image_url", "url": "[data URL removed: image/png, 200 bytes]"}}, jsonAttr(t, stub, "braintrust.input_json"))
+
+	output := attrString(t, stub, "braintrust.output_json")
+	assert.LessOrEqual(t, len(output), 100)
+	var s string
+	require.NoError(t, json.Unmarshal([]byte(output), &s))
+	assert.True(t, strings.HasPrefix(s, `"ééé`))
+	assert.Regexp(t, `\.\.\. \[truncated \d+ bytes\]$`, s)
+
+	assertAttrEquals(t, stub, "braintrust.expected", `"small"`)
+
+	input := attrString(t, stub, "braintrust.input")
+	assert.Len(t, input, 100)
+	assert.True(t, strings.HasSuffix(input, "... [truncated 74 bytes]"))
+}
+
+func TestPayloadLimit_Attachment(t *testing.T) {
+	server := attachmenttest.NewServer(t)
+	tp, exporter := newTestProvider(t,
+		braintrust.WithAPIKey(auth.TestAPIKey),
+		braintrust.WithAPIURL(server.URL),
+		braintrust.WithMaxAttributeSize(400),
+		braintrust.WithLargeAttributeMode(braintrust.LargeAttributeAttachment),
+	)
+
+	image, err := attachment.FromBytes(attachment.ImagePNG, []byte("png bytes")).Base64URL()
+	require.NoError(t, err)
+	long := strings.Repeat("a", 500)
+
+	_, span := tp.Tracer("test").Start(context.Background(), "op")
+	// small data URLs are offloaded too
+	require.NoError(t, SetInput(span, map[string]any{"image": image}))
+	require.NoError(t, SetOutput(span, long))
+	span.End()
+
+	// the same image in a later turn isn't uploaded again
+	_, span2 := tp.Tracer("test").Start(context.Background(), "op2")
+	require.NoError(t, SetInput(span2, []any{image, image}))
+	span2.End()
+
+	require.NoError(t, tp.ForceFlush(context.Background()))
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	stub := spans[0]
+	assert.Equal(t, jsonAttr(t, stub, "braintrust.input_json").(map[string]any)["image"], jsonAttr(t, spans[1], "braintrust.input_json").([]any)[1])
+
+	input := jsonAttr(t, stub, "braintrust.input_json").(map[string]any)
+	imageRef := input["image"].(map[string]any)
+	assert.Equal(t, "braintrust_attachment", imageRef["type"])
+	assert.Equal(t, "image.png", imageRef["filename"])
+	assert.Equal(t, "image/png", imageRef["content_type"])
+
+	outputRef := jsonAttr(t, stub, "braintrust.output_json").(map[string]any)
+	assert.Equal(t, "braintrust_attachment", outputRef["type"])
+	assert.Equal(t, "output.json", outputRef["filename"])
+	assert.Equal(t, "application/json", outputRef["content_type"])
+
+	uploads := server.Uploads()
+	assert.Len(t, uploads, 2)
+	assert.Equal(t, attachmenttest.Upload{Filename: "image.png", ContentType: "image/png", Data: []byte("png bytes"), Status: "done", APIKey: auth.TestAPIKey}, uploads[imageRef["key"].(string)])
+	assert.Equal(t, `"`+long+`"`, string(uploads[outputRef["key"].(string)].Data))
+}
+
+func TestPayloadLimit_InvalidMode(t *testing.T) {
+	_, err := newPayloadLimiter(braintrust.Config{LargeAttributeMode: "drop"})
+	assert.ErrorContains(t, err, "invalid large attribute mode")
+
+	limiter, err := newPayloadLimiter(braintrust.Config{LargeAttributeMode: braintrust.LargeAttributeTruncate})
+	require.NoError(t, err)
+	assert.Nil(t, limiter)
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "... [truncated 30 bytes]", truncate(strings.Repeat("x", 30), 5, false))
+
+	quoted := truncate(strings.Repeat(`"`, 100), 60, true)
+	assert.LessOrEqual(t, len(quoted), 60)
+	assert.True(t, json.Valid([]byte(quoted)))
+}
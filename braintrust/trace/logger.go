@@ -0,0 +1,195 @@
+package trace
+
+// this file is a high level logging API for apps that don't want to use OpenTelemetry directly.
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Logger logs spans to Braintrust without needing to know OpenTelemetry or
+// Braintrust's attribute conventions. Spans go through the tracer provider set up
+// with [Quickstart] or [Enable], so they are exported like any other span.
+//
+// Example:
+//
+//	logger := trace.NewLogger(trace.LoggerOpts{Project: "my-app"})
+//	err := logger.Traced(ctx, "answer-question", func(ctx context.Context, span *trace.Span) error {
+//	    span.Log(trace.LogEvent{Input: question})
+//	    answer, err := answer(ctx, question)
+//	    span.Log(trace.LogEvent{Output: answer, Metrics: map[string]float64{"tokens": 42}})
+//	    return err
+//	})
+type Logger struct {
+	tracer oteltrace.Tracer
+	parent *Parent
+}
+
+// LoggerOpts configures a [Logger].
+type LoggerOpts struct {
+	// Provide either Project name or Project ID to log to a specific project. By
+	// default, spans are logged to the parent in the context or the default project.
+	Project   string
+	ProjectID string
+
+	// TracerProvider defaults to the global tracer provider.
+	TracerProvider oteltrace.TracerProvider
+}
+
+// NewLogger creates a logger.
+func NewLogger(opts LoggerOpts) *Logger {
+	tp := opts.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	l := &Logger{tracer: tp.Tracer("braintrust.logger")}
+	switch {
+	case opts.ProjectID != "":
+		l.parent = &Parent{Type: ParentTypeProjectID, ID: opts.ProjectID}
+	case opts.Project != "":
+		l.parent = &Parent{Type: ParentTypeProject, ID: opts.Project}
+	}
+	return l
+}
+
+// SpanOpts are the options for starting a span.
+type SpanOpts struct {
+	// Type is shown in the UI. It defaults to "task" for root spans.
+	Type     SpanType
+	Input    any
+	Metadata map[string]any
+	Tags     []string
+}
+
+// StartSpan starts a span, which is a child of the span in ctx, if any. The returned
+// context contains the span, so spans started with it are its children. Callers
+// must call [Span.End].
+func (l *Logger) StartSpan(ctx context.Context, name string, opts SpanOpts) (context.Context, *Span) {
+	if l.parent != nil {
+		if ok, _ := GetParent(ctx); !ok {
+			ctx = SetParent(ctx, *l.parent)
+		}
+	}
+
+	spanType := opts.Type
+	if spanType == "" && !oteltrace.SpanContextFromContext(ctx).IsValid() {
+		spanType = SpanTypeTask
+	}
+
+	ctx, otelSpan := l.tracer.Start(ctx, name)
+	span := &Span{span: otelSpan}
+	if spanType != "" {
+		span.recordErr(SetSpanType(otelSpan, spanType))
+	}
+	span.Log(LogEvent{Input: opts.Input, Metadata: opts.Metadata, Tags: opts.Tags})
+	return ctx, span
+}
+
+// Traced runs fn in a new span and ends the span when fn returns. If fn returns an
+// error or panics, it is recorded on the span.
+func (l *Logger) Traced(ctx context.Context, name string, fn func(ctx context.Context, span *Span) error) (err error) {
+	ctx, span := l.StartSpan(ctx, name, SpanOpts{})
+	defer span.End()
+	defer func() {
+		if r := recover(); r != nil {
+			span.RecordError(fmt.Errorf("panic: %v", r))
+			panic(r)
+		}
+	}()
+
+	err = fn(ctx, span)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// Traced runs fn in a new span using a logger with the default options. See [Logger.Traced].
+func Traced(ctx context.Context, name string, fn func(ctx context.Context, span *Span) error) error {
+	return NewLogger(LoggerOpts{}).Traced(ctx, name, fn)
+}
+
+// LogEvent is the data logged on a span. Zero fields are ignored.
+type LogEvent struct {
+	Input    any
+	Output   any
+	Expected any
+	// Metadata, Metrics and Scores are merged with previously logged values.
+	Metadata map[string]any
+	Metrics  map[string]float64
+	Scores   map[string]float64
+	// Tags are added to previously logged tags.
+	Tags []string
+}
+
+// Span is a span created by a [Logger]. It is safe for concurrent use.
+type Span struct {
+	span oteltrace.Span
+	mu   sync.Mutex // serializes merges of metadata, metrics, scores and tags
+}
+
+// Log logs data on the span. Input, Output and Expected replace previously logged
+// values, while Metadata, Metrics, Scores and Tags are merged into them.
+func (s *Span) Log(e LogEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e.Input != nil {
+		s.recordErr(SetInput(s.span, e.Input))
+	}
+	if e.Output != nil {
+		s.recordErr(SetOutput(s.span, e.Output))
+	}
+	if e.Expected != nil {
+		s.recordErr(SetExpected(s.span, e.Expected))
+	}
+	if len(e.Metadata) > 0 {
+		s.recordErr(SetMetadata(s.span, e.Metadata))
+	}
+	if len(e.Metrics) > 0 {
+		s.recordErr(SetMetrics(s.span, e.Metrics))
+	}
+	if len(e.Scores) > 0 {
+		s.recordErr(SetScores(s.span, e.Scores))
+	}
+	if len(e.Tags) > 0 {
+		AddTags(s.span, e.Tags...)
+	}
+}
+
+// RecordError marks the span as failed.
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End ends the span. Calls after the first are ignored.
+func (s *Span) End() {
+	s.span.End()
+}
+
+// OtelSpan returns the underlying OpenTelemetry span.
+func (s *Span) OtelSpan() oteltrace.Span {
+	return s.span
+}
+
+// Permalink returns a URL to the span in the Braintrust UI.
+func (s *Span) Permalink() (string, error) {
+	return Permalink(s.span)
+}
+
+// recordErr records errors encoding logged data, which don't fail the traced operation.
+func (s *Span) recordErr(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+	}
+}
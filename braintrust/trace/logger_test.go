@@ -0,0 +1,157 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+)
+
+func newTestLogger(t *testing.T, opts LoggerOpts) (*Logger, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider()
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	err := Enable(tp,
+		braintrust.WithAPIKey("test-key"),
+		braintrust.WithOrgName("test-org"),
+		braintrust.WithDefaultProjectID("default-project"),
+		withSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter)),
+	)
+	require.NoError(t, err)
+
+	opts.TracerProvider = tp
+	return NewLogger(opts), exporter
+}
+
+func attrValue(span tracetest.SpanStub, key string) (attribute.Value, bool) {
+	for _, a := range span.Attributes {
+		if string(a.Key) == key {
+			return a.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func jsonAttr(t *testing.T, span tracetest.SpanStub, key string) any {
+	t.Helper()
+	v, ok := attrValue(span, key)
+	require.True(t, ok, "missing attribute %s", key)
+	var out any
+	require.NoError(t, json.Unmarshal([]byte(v.AsString()), &out))
+	return out
+}
+
+func TestLogger_StartSpan(t *testing.T) {
+	logger, exporter := newTestLogger(t, LoggerOpts{Project: "my-app"})
+
+	ctx, span := logger.StartSpan(context.Background(), "answer", SpanOpts{
+		Input:    map[string]any{"question": "why?"},
+		Metadata: map[string]any{"user": "u1"},
+		Tags:     []string{"prod"},
+	})
+	span.Log(LogEvent{
+		Output:   "because",
+		Expected: "because",
+		Metadata: map[string]any{"model": "gpt-4o"},
+		Metrics:  map[string]float64{"prompt_tokens": 10},
+		Scores:   map[string]float64{"accuracy": 1},
+		Tags:     []string{"v2"},
+	})
+	span.Log(LogEvent{Metrics: map[string]float64{"completion_tokens": 5}})
+
+	_, child := logger.StartSpan(ctx, "llm", SpanOpts{Type: SpanTypeLLM})
+	child.End()
+	span.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	childStub, root := spans[0], spans[1]
+
+	assert.Equal(t, "answer", root.Name)
+	assertAttrEquals(t, root, ParentOtelAttrKey, "project_name:my-app")
+	assert.Equal(t, map[string]any{"type": "task"}, jsonAttr(t, root, "braintrust.span_attributes"))
+	assert.Equal(t, map[string]any{"question": "why?"}, jsonAttr(t, root, "braintrust.input_json"))
+	assert.Equal(t, "because", jsonAttr(t, root, "braintrust.output_json"))
+	assert.Equal(t, "because", jsonAttr(t, root, "braintrust.expected"))
+	assert.Equal(t, map[string]any{"user": "u1", "model": "gpt-4o"}, jsonAttr(t, root, "braintrust.metadata"))
+	assert.Equal(t, map[string]any{"prompt_tokens": 10.0, "completion_tokens": 5.0}, jsonAttr(t, root, "braintrust.metrics"))
+	assert.Equal(t, map[string]any{"accuracy": 1.0}, jsonAttr(t, root, "braintrust.scores"))
+	tags, _ := attrValue(root, "braintrust.tags")
+	assert.Equal(t, []string{"prod", "v2"}, tags.AsStringSlice())
+
+	assert.Equal(t, root.SpanContext.SpanID(), childStub.Parent.SpanID())
+	assertAttrEquals(t, childStub, ParentOtelAttrKey, "project_name:my-app")
+	assert.Equal(t, map[string]any{"type": "llm"}, jsonAttr(t, childStub, "braintrust.span_attributes"))
+}
+
+func TestLogger_DefaultParent(t *testing.T) {
+	logger, exporter := newTestLogger(t, LoggerOpts{})
+
+	_, span := logger.StartSpan(context.Background(), "op", SpanOpts{})
+	span.End()
+	assertAttrEquals(t, flushOne(t, exporter), ParentOtelAttrKey, "project_id:default-project")
+
+	// the parent in the context takes precedence over the logger's project
+	logger, exporter = newTestLogger(t, LoggerOpts{ProjectID: "logger-project"})
+	ctx := SetParent(context.Background(), Parent{Type: ParentTypeExperimentID, ID: "exp-1"})
+	_, span = logger.StartSpan(ctx, "op", SpanOpts{})
+	span.End()
+	assertAttrEquals(t, flushOne(t, exporter), ParentOtelAttrKey, "experiment_id:exp-1")
+}
+
+func TestLogger_Traced(t *testing.T) {
+	logger, exporter := newTestLogger(t, LoggerOpts{})
+
+	err := logger.Traced(context.Background(), "ok", func(ctx context.Context, span *Span) error {
+		span.Log(LogEvent{Input: 1, Output: 2})
+		return nil
+	})
+	require.NoError(t, err)
+	span := flushOne(t, exporter)
+	assert.Equal(t, "ok", span.Name)
+	assert.Equal(t, 2.0, jsonAttr(t, span, "braintrust.output_json"))
+	assert.Equal(t, codes.Unset, span.Status.Code)
+
+	boom := errors.New("boom")
+	err = logger.Traced(context.Background(), "fails", func(ctx context.Context, span *Span) error {
+		return boom
+	})
+	assert.ErrorIs(t, err, boom)
+	span = flushOne(t, exporter)
+	assert.Equal(t, codes.Error, span.Status.Code)
+	assert.Equal(t, "boom", span.Status.Description)
+
+	assert.PanicsWithValue(t, "oops", func() {
+		_ = logger.Traced(context.Background(), "panics", func(ctx context.Context, span *Span) error {
+			panic("oops")
+		})
+	})
+	span = flushOne(t, exporter)
+	assert.Equal(t, codes.Error, span.Status.Code)
+	assert.Equal(t, "panic: oops", span.Status.Description)
+}
+
+func TestSpan_LogInvalidJSON(t *testing.T) {
+	logger, exporter := newTestLogger(t, LoggerOpts{})
+
+	_, span := logger.StartSpan(context.Background(), "op", SpanOpts{})
+	span.Log(LogEvent{Output: func() {}})
+	span.End()
+
+	stub := flushOne(t, exporter)
+	_, ok := attrValue(stub, "braintrust.output_json")
+	assert.False(t, ok)
+	require.Len(t, stub.Events, 1)
+	assert.Equal(t, "exception", stub.Events[0].Name)
+}
@@ -0,0 +1,155 @@
+// Package pricing estimates the dollar cost of LLM calls from their token counts.
+//
+// The tracers in traceopenai, traceanthropic and tracegenai use it to add an
+// "estimated_cost" metric to LLM spans, next to their token metrics. Prices come from
+// a built-in table of common models, which can be changed or extended:
+//
+//	pricing.Set("my-fine-tuned-model", pricing.Price{Input: 3, Output: 12})
+//
+// Or updated from a JSON file in the format of Load:
+//
+//	f, err := os.Open("prices.json")
+//	...
+//	err = pricing.Load(f)
+//
+// Costs are estimates: they don't account for batch or priority pricing, long-context
+// tiers, or discounts.
+package pricing
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/models"
+)
+
+// Price is the price of a model's tokens, in US dollars per million tokens.
+type Price struct {
+	// Input is the price of prompt tokens.
+	Input float64 `json:"input"`
+	// Output is the price of completion tokens.
+	Output float64 `json:"output"`
+	// CachedInput is the price of prompt tokens read from a cache. Zero means Input.
+	CachedInput float64 `json:"cached_input,omitempty"`
+	// CacheWrite is the price of prompt tokens written to a cache. Zero means Input.
+	CacheWrite float64 `json:"cache_write,omitempty"`
+	// Reasoning is the price of reasoning tokens. Zero means Output.
+	Reasoning float64 `json:"reasoning,omitempty"`
+}
+
+// Cost returns the cost of a call from its token metrics, as recorded on spans:
+// prompt_tokens, completion_tokens, prompt_cached_tokens, prompt_cache_creation_tokens
+// and completion_reasoning_tokens. Cached and reasoning tokens are counted in
+// prompt_tokens and completion_tokens.
+func (p Price) Cost(metrics map[string]int64) float64 {
+	cachedInput := orDefault(p.CachedInput, p.Input)
+	cacheWrite := orDefault(p.CacheWrite, p.Input)
+	reasoning := orDefault(p.Reasoning, p.Output)
+
+	cached := metrics["prompt_cached_tokens"]
+	cacheCreation := metrics["prompt_cache_creation_tokens"]
+	uncached := max(metrics["prompt_tokens"]-cached-cacheCreation, 0)
+	reasoningTokens := metrics["completion_reasoning_tokens"]
+	completion := max(metrics["completion_tokens"]-reasoningTokens, 0)
+
+	cost := float64(uncached)*p.Input +
+		float64(cached)*cachedInput +
+		float64(cacheCreation)*cacheWrite +
+		float64(completion)*p.Output +
+		float64(reasoningTokens)*reasoning
+	return cost / 1e6
+}
+
+func orDefault(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// Table is a table of model prices. It's safe for concurrent use.
+type Table struct {
+	prices *models.Registry[Price]
+}
+
+// NewTable returns a table with the given prices.
+func NewTable(prices map[string]Price) *Table {
+	return &Table{prices: models.NewRegistry(prices)}
+}
+
+// Set sets the price of a model, replacing its previous price. It's also used for
+// dated versions and aliases of the model, like "-2024-08-06" or "-latest".
+func (t *Table) Set(model string, price Price) {
+	t.prices.Set(model, price)
+}
+
+// Load sets the prices of a JSON object of model names to prices, e.g.
+//
+//	{"gpt-4o": {"input": 2.5, "output": 10, "cached_input": 1.25}}
+//
+// Models that aren't in the object keep their prices.
+func (t *Table) Load(r io.Reader) error {
+	var prices map[string]Price
+	if err := json.NewDecoder(r).Decode(&prices); err != nil {
+		return fmt.Errorf("failed to decode prices: %w", err)
+	}
+	for model, price := range prices {
+		t.Set(model, price)
+	}
+	return nil
+}
+
+// Lookup returns the price of a model. Provider prefixes like "openai/" or "models/"
+// are ignored, and a model without a price of its own uses the price of its name
+// without a date or alias suffix, so "gpt-4o-2024-08-06" has the price of "gpt-4o".
+// Other variants, like "o3-pro" or "gpt-4o-transcribe", have no price unless they're
+// set, because no estimate is better than a wrong one.
+func (t *Table) Lookup(model string) (Price, bool) {
+	return t.prices.Lookup(model)
+}
+
+// Cost returns the estimated cost of a call to a model from its token metrics (see
+// [Price.Cost]), or false if the model has no price.
+func (t *Table) Cost(model string, metrics map[string]int64) (float64, bool) {
+	price, ok := t.Lookup(model)
+	if !ok {
+		return 0, false
+	}
+	return price.Cost(metrics), true
+}
+
+//go:embed prices.json
+var builtinPrices []byte
+
+// Default is the table used by the tracers. It starts with the built-in prices.
+var Default = newDefaultTable()
+
+func newDefaultTable() *Table {
+	var prices map[string]Price
+	if err := json.Unmarshal(builtinPrices, &prices); err != nil {
+		panic(fmt.Sprintf("pricing: invalid built-in prices: %v", err))
+	}
+	return NewTable(prices)
+}
+
+// Set sets the price of a model in the Default table.
+func Set(model string, price Price) {
+	Default.Set(model, price)
+}
+
+// Load sets prices in the Default table from JSON. See [Table.Load].
+func Load(r io.Reader) error {
+	return Default.Load(r)
+}
+
+// Lookup returns the price of a model in the Default table.
+func Lookup(model string) (Price, bool) {
+	return Default.Lookup(model)
+}
+
+// Cost returns the estimated cost of a call to a model with the Default table.
+func Cost(model string, metrics map[string]int64) (float64, bool) {
+	return Default.Cost(model, metrics)
+}
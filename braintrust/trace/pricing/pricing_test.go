@@ -0,0 +1,135 @@
+package pricing
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrice_Cost(t *testing.T) {
+	price := Price{Input: 2, Output: 8, CachedInput: 0.5, CacheWrite: 2.5, Reasoning: 10}
+
+	assert.InDelta(t, (1000*2+500*8)/1e6, price.Cost(map[string]int64{
+		"prompt_tokens":     1000,
+		"completion_tokens": 500,
+		"tokens":            1500,
+	}), 1e-12)
+
+	// cached, cache creation and reasoning tokens are part of the prompt and completion
+	assert.InDelta(t, (600*2+300*0.5+100*2.5+200*8+300*10)/1e6, price.Cost(map[string]int64{
+		"prompt_tokens":                1000,
+		"prompt_cached_tokens":         300,
+		"prompt_cache_creation_tokens": 100,
+		"completion_tokens":            500,
+		"completion_reasoning_tokens":  300,
+	}), 1e-12)
+
+	// zero prices default to the input and output prices
+	assert.InDelta(t, (1000*2+500*8)/1e6, Price{Input: 2, Output: 8}.Cost(map[string]int64{
+		"prompt_tokens":               1000,
+		"prompt_cached_tokens":        400,
+		"completion_tokens":           500,
+		"completion_reasoning_tokens": 100,
+	}), 1e-12)
+
+	assert.Zero(t, price.Cost(nil))
+}
+
+func TestTable_Lookup(t *testing.T) {
+	table := NewTable(map[string]Price{
+		"gpt-4":       {Input: 30, Output: 60},
+		"gpt-4o":      {Input: 2.5, Output: 10},
+		"gpt-4o-mini": {Input: 0.15, Output: 0.6},
+	})
+
+	for model, want := range map[string]float64{
+		"gpt-4o":                 2.5,
+		"GPT-4o":                 2.5,
+		"gpt-4o-2024-08-06":      2.5,
+		"gpt-4o-mini-2024-07-18": 0.15,
+		"openai/gpt-4o-mini":     0.15,
+		"gpt-4-0613":             30,
+		"gpt-4o-latest":          2.5,
+		"gpt-4-1106-preview":     30,
+	} {
+		price, ok := table.Lookup(model)
+		if assert.True(t, ok, model) {
+			assert.Equal(t, want, price.Input, model)
+		}
+	}
+
+	for _, model := range []string{"", "gpt-4o2", "gpt", "claude-3-haiku"} {
+		_, ok := table.Lookup(model)
+		assert.False(t, ok, model)
+	}
+}
+
+func TestTable_LookupVariants(t *testing.T) {
+	// variants of a model that aren't versions of it don't have its price
+	for _, model := range []string{
+		"o3-pro",
+		"o3-pro-2025-06-10",
+		"gpt-5-pro",
+		"gpt-4o-transcribe",
+		"gpt-4o-mini-transcribe",
+		"gpt-4o-mini-tts",
+		"gpt-4o-audio-preview",
+		"gpt-4o-realtime-preview-2024-12-17",
+		"gpt-4o-search-preview",
+	} {
+		_, ok := Lookup(model)
+		assert.False(t, ok, model)
+	}
+}
+
+func TestTable_SetAndLoad(t *testing.T) {
+	table := NewTable(map[string]Price{"gpt-4o": {Input: 2.5, Output: 10}})
+
+	table.Set("my-model", Price{Input: 1, Output: 2})
+	cost, ok := table.Cost("my-model-latest", map[string]int64{"prompt_tokens": 1e6, "completion_tokens": 1e6})
+	require.True(t, ok)
+	assert.Equal(t, 3.0, cost)
+
+	require.NoError(t, table.Load(strings.NewReader(`{"gpt-4o": {"input": 5, "output": 20}, "other": {"input": 1}}`)))
+	price, _ := table.Lookup("gpt-4o")
+	assert.Equal(t, Price{Input: 5, Output: 20}, price)
+	_, ok = table.Lookup("other")
+	assert.True(t, ok)
+	_, ok = table.Lookup("my-model")
+	assert.True(t, ok, "loading keeps other prices")
+
+	assert.Error(t, table.Load(strings.NewReader(`[]`)))
+
+	_, ok = table.Cost("unknown", map[string]int64{"prompt_tokens": 1})
+	assert.False(t, ok)
+}
+
+func TestDefault(t *testing.T) {
+	for _, model := range []string{
+		"gpt-4o-mini",
+		"gpt-5-2025-08-07",
+		"o3-mini",
+		"claude-3-haiku-20240307",
+		"claude-sonnet-4-5-20250929",
+		"models/gemini-2.5-flash",
+		"gemini-2.0-flash-001",
+	} {
+		_, ok := Lookup(model)
+		assert.True(t, ok, model)
+	}
+
+	sonnet45, _ := Lookup("claude-sonnet-4-5-20250929")
+	assert.Equal(t, 3.75, sonnet45.CacheWrite)
+	lite, _ := Lookup("gemini-2.5-flash-lite-preview")
+	assert.Equal(t, 0.1, lite.Input, "an alias has the price of its model")
+
+	original := Default
+	t.Cleanup(func() { Default = original })
+	Default = NewTable(nil)
+	Set("gpt-4o-mini", Price{Input: 1, Output: 1})
+	cost, ok := Cost("gpt-4o-mini", map[string]int64{"prompt_tokens": 1e6})
+	require.True(t, ok)
+	assert.Equal(t, 1.0, cost)
+}
@@ -0,0 +1,417 @@
+package trace
+
+// this file redacts sensitive data from spans before they are exported.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+)
+
+// redactedValue replaces values masked by a path and matches of rules without a replacement.
+const redactedValue = "[REDACTED]"
+
+// redactedAttrKeys are the attributes that are redacted. The _json attributes and
+// metadata are JSON, the others are plain strings.
+var redactedAttrKeys = map[attribute.Key]bool{
+	inputAttrKey:        true,
+	outputAttrKey:       true,
+	expectedAttrKey:     true,
+	metadataAttrKey:     true,
+	"braintrust.input":  false,
+	"braintrust.output": false,
+}
+
+// detectorRules are the rules of the built-in detectors.
+var detectorRules = map[braintrust.RedactDetector][]redactRule{
+	braintrust.RedactEmail: {{
+		pattern:     regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+		replacement: "[REDACTED_EMAIL]",
+	}},
+	braintrust.RedactPhone: {{
+		pattern:     regexp.MustCompile(`(?:\+\d{1,3}[\s.\-]?)?(?:\(\d{3}\)\s?|\b\d{3}[\s.\-])\d{3}[\s.\-]\d{4}\b`),
+		replacement: "[REDACTED_PHONE]",
+	}},
+	braintrust.RedactCreditCard: {{
+		pattern:     regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+		replacement: "[REDACTED_CREDIT_CARD]",
+		match:       luhnValid,
+	}},
+	braintrust.RedactBearerToken: {
+		{
+			pattern:     regexp.MustCompile(`(?i)\b(bearer)\s+[A-Za-z0-9\-._~+/]+=*`),
+			replacement: "$1 [REDACTED_TOKEN]",
+		},
+		{
+			pattern:     regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_\-]{16,}`),
+			replacement: "[REDACTED_TOKEN]",
+		},
+	},
+}
+
+type redactRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+	// match, if set, filters the pattern's matches, e.g. with a checksum
+	match func(s string) bool
+}
+
+func (r redactRule) apply(s string) string {
+	if r.match == nil {
+		return r.pattern.ReplaceAllString(s, r.replacement)
+	}
+	return r.pattern.ReplaceAllStringFunc(s, func(m string) string {
+		if !r.match(m) {
+			return m
+		}
+		return r.pattern.ReplaceAllString(m, r.replacement)
+	})
+}
+
+// redactor rewrites the Braintrust fields of spans to remove sensitive data. Paths
+// are masked first, then rules are applied to every string, then the custom function.
+type redactor struct {
+	paths [][]pathSegment
+	rules []redactRule
+	fn    braintrust.RedactFunc
+}
+
+// newRedactor returns a redactor for the config, or nil if redaction isn't configured.
+func newRedactor(config braintrust.Config) (*redactor, error) {
+	r := &redactor{fn: config.RedactFunc}
+	for _, path := range config.RedactPaths {
+		segments, err := parsePath(path)
+		if err != nil {
+			return nil, err
+		}
+		r.paths = append(r.paths, segments)
+	}
+	for _, detector := range config.RedactDetectors {
+		rules, ok := detectorRules[detector]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction detector: %q", detector)
+		}
+		r.rules = append(r.rules, rules...)
+	}
+	for _, rule := range config.RedactRules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", rule.Pattern, err)
+		}
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = redactedValue
+		}
+		r.rules = append(r.rules, redactRule{pattern: pattern, replacement: replacement})
+	}
+
+	if len(r.paths) == 0 && len(r.rules) == 0 && r.fn == nil {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// redactSpan returns the ended span with its Braintrust fields redacted.
+func (r *redactor) redactSpan(span trace.ReadOnlySpan) trace.ReadOnlySpan {
+	var attrs []attribute.KeyValue
+	for i, a := range span.Attributes() {
+		isJSON, ok := redactedAttrKeys[a.Key]
+		if !ok || a.Value.Type() != attribute.STRING {
+			continue
+		}
+		redacted, changed := r.redactAttr(string(a.Key), a.Value.AsString(), isJSON)
+		if !changed {
+			continue
+		}
+		if attrs == nil {
+			attrs = append(attrs, span.Attributes()...)
+		}
+		attrs[i] = attribute.String(string(a.Key), redacted)
+	}
+	redacted := span
+	if attrs != nil {
+		redacted = &attrsSpan{ReadOnlySpan: span, attrs: attrs}
+	}
+
+	// errors are recorded as events and the status, and often include the input
+	events, eventsChanged := r.redactEvents(span.Events())
+	status := span.Status()
+	var statusChanged bool
+	if status.Description != "" {
+		status.Description, statusChanged = r.redactAttr("status.description", status.Description, false)
+	}
+	if !eventsChanged && !statusChanged {
+		return redacted
+	}
+	return &eventsSpan{ReadOnlySpan: redacted, events: events, status: status}
+}
+
+// redactEvents returns the events with their string attributes redacted, like the
+// "exception.message" of RecordError, and whether any changed.
+func (r *redactor) redactEvents(events []trace.Event) ([]trace.Event, bool) {
+	var redacted []trace.Event
+	for i, event := range events {
+		var attrs []attribute.KeyValue
+		for j, a := range event.Attributes {
+			if a.Value.Type() != attribute.STRING {
+				continue
+			}
+			value, changed := r.redactAttr(string(a.Key), a.Value.AsString(), false)
+			if !changed {
+				continue
+			}
+			if attrs == nil {
+				attrs = append(attrs, event.Attributes...)
+			}
+			attrs[j] = attribute.String(string(a.Key), value)
+		}
+		if attrs == nil {
+			continue
+		}
+		if redacted == nil {
+			redacted = append(redacted, events...)
+		}
+		redacted[i].Attributes = attrs
+	}
+	if redacted == nil {
+		return events, false
+	}
+	return redacted, true
+}
+
+// eventsSpan is an ended span with its events and status redacted.
+type eventsSpan struct {
+	trace.ReadOnlySpan
+	events []trace.Event
+	status trace.Status
+}
+
+func (s *eventsSpan) Events() []trace.Event {
+	return s.events
+}
+
+func (s *eventsSpan) Status() trace.Status {
+	return s.status
+}
+
+// redactAttr returns the redacted value of an attribute, and whether it changed.
+func (r *redactor) redactAttr(key, value string, isJSON bool) (string, bool) {
+	var v any = value
+	if isJSON {
+		dec := json.NewDecoder(strings.NewReader(value))
+		dec.UseNumber() // keep large numbers exact
+		if err := dec.Decode(&v); err != nil {
+			// not JSON, so redact it as a string
+			v = value
+			isJSON = false
+		}
+	}
+
+	for _, path := range r.paths {
+		v = maskPath(v, path)
+	}
+	v = r.redactStrings(v)
+	if r.fn != nil {
+		v = r.fn(key, v)
+	}
+
+	var redacted string
+	if s, ok := v.(string); ok && !isJSON {
+		redacted = s
+	} else {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			// never export data that might not be redacted
+			return redactedValue, true
+		}
+		redacted = strings.TrimSuffix(buf.String(), "\n")
+	}
+
+	if redacted == value {
+		return value, false
+	}
+	if isJSON && jsonEqual(redacted, value) {
+		// re-encoding changed the formatting but not the data
+		return value, false
+	}
+	return redacted, true
+}
+
+// redactStrings applies the rules to every string in v. Object keys aren't redacted.
+func (r *redactor) redactStrings(v any) any {
+	switch t := v.(type) {
+	case string:
+		for _, rule := range r.rules {
+			t = rule.apply(t)
+		}
+		return t
+	case map[string]any:
+		for k, child := range t {
+			t[k] = r.redactStrings(child)
+		}
+	case []any:
+		for i, child := range t {
+			t[i] = r.redactStrings(child)
+		}
+	}
+	return v
+}
+
+func jsonEqual(a, b string) bool {
+	var va, vb any
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return false
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return bytes.Equal(ja, jb)
+}
+
+// luhnValid returns true if the digits of s pass the Luhn checksum of card numbers.
+func luhnValid(s string) bool {
+	var sum, n int
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// pathSegment is a step of a JSONPath.
+type pathSegment struct {
+	name      string
+	index     int
+	isIndex   bool
+	wildcard  bool
+	recursive bool // ".." matches at any depth
+}
+
+// parsePath parses the subset of JSONPath supported by masks: "$", ".name", "..name",
+// ".*", "[0]", "[*]" and "['name']".
+func parsePath(path string) ([]pathSegment, error) {
+	invalid := func(reason string) error {
+		return fmt.Errorf("invalid redaction path %q: %s", path, reason)
+	}
+
+	s := strings.TrimSpace(path)
+	if !strings.HasPrefix(s, "$") {
+		return nil, invalid(`must start with "$"`)
+	}
+	s = s[1:]
+
+	var segments []pathSegment
+	for s != "" {
+		var seg pathSegment
+		switch {
+		case strings.HasPrefix(s, ".."):
+			seg.recursive = true
+			s = s[2:]
+		case s[0] == '.':
+			s = s[1:]
+		case s[0] == '[':
+		default:
+			return nil, invalid(fmt.Sprintf("unexpected %q", s[0]))
+		}
+
+		switch {
+		case s == "":
+			return nil, invalid("missing name")
+		case s[0] == '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, invalid(`missing "]"`)
+			}
+			inner := s[1:end]
+			s = s[end+1:]
+			switch {
+			case inner == "*":
+				seg.wildcard = true
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				seg.name = inner[1 : len(inner)-1]
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil || i < 0 {
+					return nil, invalid(fmt.Sprintf("bad index %q", inner))
+				}
+				seg.index, seg.isIndex = i, true
+			}
+		case s[0] == '*':
+			seg.wildcard = true
+			s = s[1:]
+		default:
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			seg.name = s[:end]
+			s = s[end:]
+		}
+		segments = append(segments, seg)
+	}
+	if len(segments) == 0 {
+		return nil, invalid("masks the whole value")
+	}
+	return segments, nil
+}
+
+// maskPath replaces the values in v at the path with redactedValue.
+func maskPath(v any, path []pathSegment) any {
+	if len(path) == 0 {
+		return redactedValue
+	}
+	seg, rest := path[0], path[1:]
+
+	if seg.recursive {
+		here := seg
+		here.recursive = false
+		v = maskPath(v, append([]pathSegment{here}, rest...))
+		switch t := v.(type) {
+		case map[string]any:
+			for k, child := range t {
+				t[k] = maskPath(child, path)
+			}
+		case []any:
+			for i, child := range t {
+				t[i] = maskPath(child, path)
+			}
+		}
+		return v
+	}
+
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if seg.wildcard || (!seg.isIndex && k == seg.name) {
+				t[k] = maskPath(child, rest)
+			}
+		}
+	case []any:
+		for i, child := range t {
+			if seg.wildcard || (seg.isIndex && i == seg.index) {
+				t[i] = maskPath(child, rest)
+			}
+		}
+	}
+	return v
+}
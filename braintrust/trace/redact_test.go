@@ -0,0 +1,198 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+)
+
+// newTestProvider returns a tracer provider with Braintrust enabled, exporting to memory.
+func newTestProvider(t *testing.T, opts ...braintrust.Option) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider()
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	opts = append([]braintrust.Option{
+		braintrust.WithAPIKey("test-key"),
+		braintrust.WithOrgName("test-org"),
+		withSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter)),
+	}, opts...)
+	require.NoError(t, Enable(tp, opts...))
+	return tp, exporter
+}
+
+func newRedactTestTracer(t *testing.T, opts ...braintrust.Option) (oteltrace.Tracer, *tracetest.InMemoryExporter) {
+	t.Helper()
+	tp, exporter := newTestProvider(t, opts...)
+	return tp.Tracer("test"), exporter
+}
+
+func TestRedaction_Detectors(t *testing.T) {
+	tracer, exporter := newRedactTestTracer(t, braintrust.WithRedactDetectors(
+		braintrust.RedactEmail, braintrust.RedactPhone, braintrust.RedactCreditCard, braintrust.RedactBearerToken,
+	))
+
+	_, span := tracer.Start(context.Background(), "op")
+	require.NoError(t, SetInput(span, map[string]any{
+		"messages": []any{
+			map[string]any{"role": "user", "content": "I'm bob@example.com, call me at (555) 123-4567"},
+			map[string]any{"role": "user", "content": "card 4111 1111 1111 1111, order 1234 5678 9012 3456"},
+		},
+		"count": 12345678901234567,
+	}))
+	require.NoError(t, SetOutput(span, "use header Authorization: Bearer abc.def-123 and key sk-proj1234567890abcdef"))
+	require.NoError(t, SetMetadata(span, map[string]any{"user": "bob@example.com", "bob@example.com": "key"}))
+	span.SetAttributes(attribute.String("other", "bob@example.com"))
+	span.End()
+
+	stub := flushOne(t, exporter)
+	assert.Equal(t, map[string]any{
+		"messages": []any{
+			map[string]any{"role": "user", "content": "I'm [REDACTED_EMAIL], call me at [REDACTED_PHONE]"},
+			// the order number fails the card checksum
+			map[string]any{"role": "user", "content": "card [REDACTED_CREDIT_CARD], order 1234 5678 9012 3456"},
+		},
+		"count": 12345678901234567.0,
+	}, jsonAttr(t, stub, "braintrust.input_json"))
+	assert.Contains(t, attrString(t, stub, "braintrust.input_json"), `"count":12345678901234567`)
+	assert.Equal(t, "use header Authorization: Bearer [REDACTED_TOKEN] and key [REDACTED_TOKEN]", jsonAttr(t, stub, "braintrust.output_json"))
+	// keys aren't redacted
+	assert.Equal(t, map[string]any{"user": "[REDACTED_EMAIL]", "bob@example.com": "key"}, jsonAttr(t, stub, "braintrust.metadata"))
+	// other attributes aren't redacted
+	assertAttrEquals(t, stub, "other", "bob@example.com")
+}
+
+func TestRedaction_RulesPathsAndFunc(t *testing.T) {
+	var keys []string
+	tracer, exporter := newRedactTestTracer(t,
+		braintrust.WithRedactRules(
+			braintrust.RedactRule{Pattern: `secret-\d+`},
+			braintrust.RedactRule{Pattern: `(user)-\d+`, Replacement: "$1-***"},
+		),
+		braintrust.WithRedactPaths("$.password", "$.messages[*].content", "$..api_key", "$.list[1]"),
+		braintrust.WithRedactFunc(func(key string, value any) any {
+			keys = append(keys, key)
+			if key == expectedAttrKey {
+				return "custom"
+			}
+			return value
+		}),
+	)
+
+	_, span := tracer.Start(context.Background(), "op")
+	require.NoError(t, SetInput(span, map[string]any{
+		"password": map[string]any{"nested": "value"},
+		"messages": []any{
+			map[string]any{"role": "user", "content": "hi"},
+			map[string]any{"role": "assistant", "content": "hello"},
+		},
+		"config": map[string]any{"deep": map[string]any{"api_key": "k1"}},
+		"list":   []any{"a", "b", "c"},
+		"note":   "secret-42 from user-7",
+	}))
+	require.NoError(t, SetExpected(span, "anything"))
+	span.SetAttributes(attribute.String("braintrust.output", "plain secret-1"))
+	span.End()
+
+	stub := flushOne(t, exporter)
+	assert.Equal(t, map[string]any{
+		"password": "[REDACTED]",
+		"messages": []any{
+			map[string]any{"role": "user", "content": "[REDACTED]"},
+			map[string]any{"role": "assistant", "content": "[REDACTED]"},
+		},
+		"config": map[string]any{"deep": map[string]any{"api_key": "[REDACTED]"}},
+		"list":   []any{"a", "[REDACTED]", "c"},
+		"note":   "[REDACTED] from user-***",
+	}, jsonAttr(t, stub, "braintrust.input_json"))
+	assert.Equal(t, "custom", jsonAttr(t, stub, "braintrust.expected"))
+	assertAttrEquals(t, stub, "braintrust.output", "plain [REDACTED]")
+	assert.ElementsMatch(t, []string{inputAttrKey, expectedAttrKey, "braintrust.output"}, keys)
+}
+
+func TestRedaction_Unchanged(t *testing.T) {
+	tracer, exporter := newRedactTestTracer(t, braintrust.WithRedactDetectors(braintrust.RedactEmail))
+
+	_, span := tracer.Start(context.Background(), "op")
+	span.SetAttributes(attribute.String("braintrust.input_json", `{"b": 1, "a": "no secrets"}`))
+	span.End()
+
+	// the original formatting is kept when nothing is redacted
+	stub := flushOne(t, exporter)
+	assertAttrEquals(t, stub, "braintrust.input_json", `{"b": 1, "a": "no secrets"}`)
+}
+
+func TestRedaction_EventsAndStatus(t *testing.T) {
+	tracer, exporter := newRedactTestTracer(t, braintrust.WithRedactDetectors(braintrust.RedactEmail, braintrust.RedactBearerToken))
+
+	_, span := tracer.Start(context.Background(), "op")
+	err := errors.New("no account for bob@example.com")
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	span.AddEvent("request", oteltrace.WithAttributes(
+		attribute.String("header", "Bearer abc123"),
+		attribute.Int("attempt", 1),
+	))
+	span.End()
+
+	stub := flushOne(t, exporter)
+	assert.Equal(t, "no account for [REDACTED_EMAIL]", stub.Status.Description)
+	require.Len(t, stub.Events, 2)
+	assert.Contains(t, stub.Events[0].Attributes, attribute.String("exception.message", "no account for [REDACTED_EMAIL]"))
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("header", "Bearer [REDACTED_TOKEN]"),
+		attribute.Int("attempt", 1),
+	}, stub.Events[1].Attributes)
+}
+
+func TestRedaction_InvalidConfig(t *testing.T) {
+	tests := map[string]braintrust.Option{
+		"unknown redaction detector": braintrust.WithRedactDetectors("ssn"),
+		"invalid redaction pattern":  braintrust.WithRedactRules(braintrust.RedactRule{Pattern: "("}),
+		`must start with "$"`:        braintrust.WithRedactPaths("password"),
+		"bad index":                  braintrust.WithRedactPaths("$.list[x]"),
+		"masks the whole value":      braintrust.WithRedactPaths("$"),
+	}
+	for msg, opt := range tests {
+		err := Enable(sdktrace.NewTracerProvider(), braintrust.WithAPIKey("test-key"), braintrust.WithOrgName("test-org"), opt)
+		assert.ErrorContains(t, err, msg)
+	}
+}
+
+func TestRedaction_Env(t *testing.T) {
+	t.Setenv("BRAINTRUST_REDACT_DETECTORS", "email")
+	t.Setenv("BRAINTRUST_REDACT_PATTERNS", `["secret-\\d+", "token"]`)
+	t.Setenv("BRAINTRUST_REDACT_PATHS", "$.password")
+	tracer, exporter := newRedactTestTracer(t)
+
+	_, span := tracer.Start(context.Background(), "op")
+	require.NoError(t, SetInput(span, map[string]any{"text": "bob@example.com secret-1 token", "password": "hunter2"}))
+	span.End()
+
+	stub := flushOne(t, exporter)
+	assert.Equal(t, map[string]any{"text": "[REDACTED_EMAIL] [REDACTED] [REDACTED]", "password": "[REDACTED]"}, jsonAttr(t, stub, "braintrust.input_json"))
+}
+
+func TestLuhnValid(t *testing.T) {
+	assert.True(t, luhnValid("4111111111111111"))
+	assert.True(t, luhnValid("5500-0000-0000-0004"))
+	assert.False(t, luhnValid("4111111111111112"))
+	assert.False(t, luhnValid("0000"))
+}
+
+func attrString(t *testing.T, span tracetest.SpanStub, key string) string {
+	t.Helper()
+	v, ok := attrValue(span, key)
+	require.True(t, ok, "attribute %s not found", key)
+	return v.AsString()
+}
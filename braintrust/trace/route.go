@@ -0,0 +1,181 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+)
+
+// route is a braintrust.SpanRoute that is ready to use.
+type route struct {
+	braintrust.SpanRoute
+	parent Parent
+
+	// processor and otelAttrs send spans somewhere other than the default exporter.
+	// They are nil if the route only changes the parent.
+	processor trace.SpanProcessor
+	otelAttrs *otelAttrs
+	// limiter offloads large payloads with the route's credentials. It is nil if the
+	// route uses the default ones.
+	limiter *payloadLimiter
+}
+
+// newRoutes validates the routes in the config and creates their exporters.
+func newRoutes(config braintrust.Config) ([]*route, error) {
+	routes := make([]*route, 0, len(config.SpanRoutes))
+	for i, r := range config.SpanRoutes {
+		rt := &route{SpanRoute: r}
+		var parents []Parent
+		if r.ProjectName != "" {
+			parents = append(parents, Parent{Type: ParentTypeProject, ID: r.ProjectName})
+		}
+		if r.ProjectID != "" {
+			parents = append(parents, Parent{Type: ParentTypeProjectID, ID: r.ProjectID})
+		}
+		if r.ExperimentID != "" {
+			parents = append(parents, Parent{Type: ParentTypeExperimentID, ID: r.ExperimentID})
+		}
+		if len(parents) != 1 {
+			return nil, fmt.Errorf("span route %d: exactly one of ProjectName, ProjectID or ExperimentID is required", i)
+		}
+		rt.parent = parents[0]
+
+		for _, pattern := range []string{r.SpanName, r.Scope} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("span route %d: invalid pattern %q: %w", i, pattern, err)
+			}
+		}
+
+		apiURL := r.APIURL
+		if apiURL == "" {
+			apiURL = config.APIURL
+		}
+		exporter := r.Exporter
+		if exporter == nil && r.APIKey != "" {
+			otelOpts, err := getHTTPOtelOpts(apiURL, r.APIKey)
+			if err != nil {
+				return nil, fmt.Errorf("span route %d: %w", i, err)
+			}
+			exporter, err = otlptrace.New(context.Background(), otlptracehttp.NewClient(otelOpts...))
+			if err != nil {
+				return nil, fmt.Errorf("span route %d: failed to create OTLP exporter: %w", i, err)
+			}
+		}
+		if exporter != nil {
+			rt.processor = trace.NewBatchSpanProcessor(exporter)
+		}
+		if r.APIKey != "" || r.OrgName != "" {
+			rt.otelAttrs = newOtelAttrs(rt.parent, r.OrgName, config.AppURL)
+			if r.OrgName == "" {
+				go login(config.AppURL, r.APIKey, rt.otelAttrs)
+			}
+		}
+		if config.LargeAttributeMode == braintrust.LargeAttributeAttachment && (r.APIKey != "" || r.OrgName != "") {
+			// attachments must be uploaded to the org the spans are sent to
+			routeConfig := config
+			if r.APIKey != "" {
+				routeConfig.APIKey = r.APIKey
+				routeConfig.APIURL = apiURL
+			}
+			routeConfig.OrgName = r.OrgName
+			limiter, err := newPayloadLimiter(routeConfig)
+			if err != nil {
+				return nil, fmt.Errorf("span route %d: %w", i, err)
+			}
+			rt.limiter = limiter
+		}
+		routes = append(routes, rt)
+	}
+	return routes, nil
+}
+
+// matches returns true if the starting span matches all of the route's conditions.
+func (r *route) matches(ctx context.Context, span trace.ReadWriteSpan) bool {
+	if r.SpanName != "" {
+		if ok, _ := path.Match(r.SpanName, span.Name()); !ok {
+			return false
+		}
+	}
+	if r.Scope != "" {
+		if ok, _ := path.Match(r.Scope, span.InstrumentationScope().Name); !ok {
+			return false
+		}
+	}
+	for key, want := range r.Attributes {
+		found := false
+		for _, a := range span.Attributes() {
+			if string(a.Key) == key {
+				found = a.Value.Emit() == want
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.ContextKey != nil {
+		v := ctx.Value(r.ContextKey)
+		if v == nil || (r.ContextValue != nil && !reflect.DeepEqual(v, r.ContextValue)) {
+			return false
+		}
+	}
+	if r.Match != nil && !r.Match(ctx, span) {
+		return false
+	}
+	return true
+}
+
+// routeSpan returns the route of a starting span: its parent span's route, or the
+// first one that matches it. It returns nil if the span isn't routed.
+func (sp *spanProcessor) routeSpan(ctx context.Context, span trace.ReadWriteSpan) *route {
+	if len(sp.routes) == 0 {
+		return nil
+	}
+	if parent := span.Parent(); parent.IsValid() {
+		if r, ok := sp.routed.Load(newSpanKey(parent)); ok {
+			return r.(*route)
+		}
+	}
+	for _, r := range sp.routes {
+		if r.matches(ctx, span) {
+			return r
+		}
+	}
+	return nil
+}
+
+// processorFor returns the processor that the span's route sends it to.
+func (sp *spanProcessor) processorFor(r *route) trace.SpanProcessor {
+	if r != nil && r.processor != nil {
+		return r.processor
+	}
+	return sp.wrapped
+}
+
+// limiterFor returns the limiter of the span's route, which is nil if payloads
+// aren't limited.
+func (sp *spanProcessor) limiterFor(r *route) *payloadLimiter {
+	if r != nil && r.limiter != nil {
+		return r.limiter
+	}
+	return sp.limiter
+}
+
+// routeProcessors calls fn with each processor of a route, and joins the errors.
+func (sp *spanProcessor) routeProcessors(fn func(trace.SpanProcessor) error) error {
+	var errs []error
+	for _, r := range sp.routes {
+		if r.processor != nil {
+			errs = append(errs, fn(r.processor))
+		}
+	}
+	return errors.Join(errs...)
+}
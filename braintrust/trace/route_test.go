@@ -0,0 +1,199 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/attachmenttest"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/auth"
+)
+
+type routeTestKey struct{}
+
+func spanParents(spans tracetest.SpanStubs) map[string]string {
+	parents := map[string]string{}
+	for _, s := range spans {
+		for _, a := range s.Attributes {
+			if a.Key == ParentOtelAttrKey {
+				parents[s.Name] = a.Value.AsString()
+			}
+		}
+	}
+	return parents
+}
+
+func TestRoutes_Match(t *testing.T) {
+	tp, exporter := newTestProvider(t, braintrust.WithDefaultProject("default"), braintrust.WithSpanRoutes(
+		braintrust.SpanRoute{SpanName: "openai.*", ProjectName: "llm"},
+		braintrust.SpanRoute{Scope: "billing/*", ProjectID: "billing-id"},
+		braintrust.SpanRoute{Attributes: map[string]string{"team": "search", "shard": "2"}, ProjectName: "search"},
+		braintrust.SpanRoute{ContextKey: routeTestKey{}, ContextValue: "exp", ExperimentID: "proj/exp-1"},
+		braintrust.SpanRoute{ContextKey: routeTestKey{}, ProjectName: "any-context"},
+		braintrust.SpanRoute{Match: func(_ context.Context, span sdktrace.ReadOnlySpan) bool {
+			return span.SpanKind() == oteltrace.SpanKindServer
+		}, ProjectName: "servers"},
+	))
+
+	ctx := context.Background()
+	tracer := tp.Tracer("app")
+	start := func(tracer oteltrace.Tracer, ctx context.Context, name string, opts ...oteltrace.SpanStartOption) {
+		_, span := tracer.Start(ctx, name, opts...)
+		span.End()
+	}
+	start(tracer, ctx, "openai.chat")
+	start(tp.Tracer("billing/invoices"), ctx, "charge")
+	start(tracer, ctx, "query", oteltrace.WithAttributes(attribute.String("team", "search"), attribute.Int("shard", 2)))
+	start(tracer, ctx, "wrong-shard", oteltrace.WithAttributes(attribute.String("team", "search"), attribute.Int("shard", 3)))
+	start(tracer, context.WithValue(ctx, routeTestKey{}, "exp"), "experiment")
+	start(tracer, context.WithValue(ctx, routeTestKey{}, "other"), "other-context")
+	start(tracer, ctx, "handler", oteltrace.WithSpanKind(oteltrace.SpanKindServer))
+	start(tracer, ctx, "unmatched")
+	// an explicit parent isn't routed
+	start(tracer, SetParent(ctx, Parent{Type: ParentTypeProject, ID: "explicit"}), "openai.explicit")
+
+	assert.Equal(t, map[string]string{
+		"openai.chat":     "project_name:llm",
+		"charge":          "project_id:billing-id",
+		"query":           "project_name:search",
+		"wrong-shard":     "project_name:default",
+		"experiment":      "experiment_id:proj/exp-1",
+		"other-context":   "project_name:any-context",
+		"handler":         "project_name:servers",
+		"unmatched":       "project_name:default",
+		"openai.explicit": "project_name:explicit",
+	}, spanParents(exporter.GetSpans()))
+}
+
+func TestRoutes_ChildrenInheritRoute(t *testing.T) {
+	tp, exporter := newTestProvider(t, braintrust.WithDefaultProject("default"), braintrust.WithSpanRoutes(
+		braintrust.SpanRoute{SpanName: "checkout", ProjectName: "payments"},
+		braintrust.SpanRoute{SpanName: "openai.chat", ProjectName: "llm"},
+	))
+	tracer := tp.Tracer("app")
+
+	ctx, root := tracer.Start(context.Background(), "checkout")
+	_, child := tracer.Start(ctx, "openai.chat")
+	child.End()
+	root.End()
+
+	_, other := tracer.Start(context.Background(), "openai.chat")
+	other.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "project_name:payments", attrString(t, spans[0], ParentOtelAttrKey))
+	assert.Equal(t, "project_name:payments", attrString(t, spans[1], ParentOtelAttrKey))
+	assert.Equal(t, "project_name:llm", attrString(t, spans[2], ParentOtelAttrKey))
+}
+
+func TestRoutes_Exporter(t *testing.T) {
+	routed := tracetest.NewInMemoryExporter()
+	tp, exporter := newTestProvider(t, braintrust.WithSpanRoutes(
+		braintrust.SpanRoute{SpanName: "team-b.*", ProjectName: "b", OrgName: "org-b", Exporter: routed},
+	))
+	tracer := tp.Tracer("app")
+
+	ctx, span := tracer.Start(context.Background(), "team-b.handler")
+	_, child := tracer.Start(ctx, "db.query")
+	child.End()
+	span.End()
+	_, other := tracer.Start(context.Background(), "team-a.handler")
+	other.End()
+	require.NoError(t, tp.ForceFlush(context.Background()))
+
+	spans := routed.GetSpans()
+	require.Len(t, spans, 2)
+	for _, s := range spans {
+		assert.Equal(t, "project_name:b", attrString(t, s, ParentOtelAttrKey))
+		assert.Equal(t, "org-b", attrString(t, s, orgAttrKey))
+	}
+	require.Len(t, exporter.GetSpans(), 1)
+	assert.Equal(t, "team-a.handler", exporter.GetSpans()[0].Name)
+	assert.Equal(t, "test-org", attrString(t, exporter.GetSpans()[0], orgAttrKey))
+
+	require.NoError(t, tp.Shutdown(context.Background()))
+	assert.Empty(t, routed.GetSpans(), "route exporters are shut down with the provider")
+}
+
+func TestRoutes_APIKey(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	tp, exporter := newTestProvider(t, braintrust.WithSpanRoutes(
+		braintrust.SpanRoute{SpanName: "team-b.*", ProjectName: "b", APIKey: "key-b", APIURL: server.URL, OrgName: "org-b"},
+	))
+	_, span := tp.Tracer("app").Start(context.Background(), "team-b.handler")
+	span.End()
+	require.NoError(t, tp.ForceFlush(context.Background()))
+
+	assert.Empty(t, exporter.GetSpans())
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"Bearer key-b"}, keys)
+}
+
+func TestRoutes_Attachments(t *testing.T) {
+	server := attachmenttest.NewServer(t)
+	routed := tracetest.NewInMemoryExporter()
+	tp, exporter := newTestProvider(t,
+		braintrust.WithAPIKey(auth.TestAPIKey),
+		braintrust.WithAPIURL(server.URL),
+		braintrust.WithAppURL(server.URL),
+		braintrust.WithMaxAttributeSize(100),
+		braintrust.WithLargeAttributeMode(braintrust.LargeAttributeAttachment),
+		braintrust.WithSpanRoutes(
+			braintrust.SpanRoute{SpanName: "team-b.*", ProjectName: "b", APIKey: "key-b", OrgName: "test-org", Exporter: routed},
+		),
+	)
+	for _, name := range []string{"team-a.handler", "team-b.handler"} {
+		_, span := tp.Tracer("app").Start(context.Background(), name)
+		require.NoError(t, SetOutput(span, strings.Repeat(name, 20)))
+		span.End()
+	}
+	require.NoError(t, tp.ForceFlush(context.Background()))
+
+	// each span's payload is uploaded to the org it's sent to
+	keys := map[string]string{}
+	for _, spans := range []tracetest.SpanStubs{exporter.GetSpans(), routed.GetSpans()} {
+		require.Len(t, spans, 1)
+		ref := jsonAttr(t, spans[0], "braintrust.output_json").(map[string]any)
+		keys[spans[0].Name] = server.Uploads()[ref["key"].(string)].APIKey
+	}
+	assert.Equal(t, map[string]string{"team-a.handler": auth.TestAPIKey, "team-b.handler": "key-b"}, keys)
+}
+
+func TestRoutes_Errors(t *testing.T) {
+	for _, routes := range [][]braintrust.SpanRoute{
+		{{SpanName: "a"}},
+		{{SpanName: "a", ProjectName: "p", ProjectID: "id"}},
+		{{SpanName: "[", ProjectName: "p"}},
+		{{ProjectName: "p", APIKey: "key", APIURL: "invalid-url"}},
+	} {
+		tp := sdktrace.NewTracerProvider()
+		err := Enable(tp,
+			braintrust.WithAPIKey("test-key"),
+			braintrust.WithOrgName("test-org"),
+			withSpanProcessor(sdktrace.NewSimpleSpanProcessor(tracetest.NewInMemoryExporter())),
+			braintrust.WithSpanRoutes(routes...),
+		)
+		assert.Error(t, err, "%+v", routes)
+	}
+}
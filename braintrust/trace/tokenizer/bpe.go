@@ -0,0 +1,134 @@
+package tokenizer
+
+// this file implements byte pair encoding, the tokenization of OpenAI's models.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/dlclark/regexp2"
+)
+
+// BPE is a byte pair encoder in the format of OpenAI's tiktoken: text is split into
+// pieces with a regular expression, then the bytes of each piece are merged into
+// tokens, lowest rank first. Special tokens like <|endoftext|> are encoded as text.
+type BPE struct {
+	ranks   map[string]int
+	pattern *regexp2.Regexp
+}
+
+// NewBPE returns a byte pair encoder with the given token ranks, as loaded by LoadRanks,
+// and the regular expression that splits text into pieces.
+func NewBPE(ranks map[string]int, pattern string) (*BPE, error) {
+	re, err := regexp2.Compile(pattern, regexp2.None)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	return &BPE{ranks: ranks, pattern: re}, nil
+}
+
+// LoadRanks reads token ranks in the .tiktoken format: a line per token, with its
+// base64-encoded bytes and its rank.
+func LoadRanks(r io.Reader) (map[string]int, error) {
+	ranks := map[string]int{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		token, rank, ok := bytes.Cut(text, []byte(" "))
+		if !ok {
+			return nil, fmt.Errorf("invalid rank on line %d", line)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(token))
+		if err != nil {
+			return nil, fmt.Errorf("invalid token on line %d: %w", line, err)
+		}
+		n, err := strconv.Atoi(string(rank))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank on line %d: %w", line, err)
+		}
+		ranks[string(decoded)] = n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ranks: %w", err)
+	}
+	return ranks, nil
+}
+
+// Encode returns the tokens of text.
+func (b *BPE) Encode(text string) []int {
+	var tokens []int
+	m, _ := b.pattern.FindStringMatch(text)
+	for m != nil {
+		piece := []byte(m.String())
+		if rank, ok := b.ranks[string(piece)]; ok {
+			tokens = append(tokens, rank)
+		} else {
+			tokens = b.merge(piece, tokens)
+		}
+		m, _ = b.pattern.FindNextMatch(m)
+	}
+	return tokens
+}
+
+// CountTokens returns the number of tokens of text.
+func (b *BPE) CountTokens(text string) int {
+	return len(b.Encode(text))
+}
+
+// part is a part of a piece being merged: its start, and the rank of the token it
+// makes with the next part, if any.
+type part struct {
+	start int
+	rank  int
+}
+
+// merge appends the tokens of a piece that isn't a token itself, by merging its adjacent
+// parts into tokens until no merge is left, lowest rank first.
+func (b *BPE) merge(piece []byte, tokens []int) []int {
+	// parts ends with a part at len(piece), to mark the end of the last one.
+	parts := make([]part, len(piece)+1)
+	rank := func(i int) int {
+		if i+2 < len(parts) {
+			if r, ok := b.ranks[string(piece[parts[i].start:parts[i+2].start])]; ok {
+				return r
+			}
+		}
+		return math.MaxInt
+	}
+	for i := range parts {
+		parts[i] = part{start: i, rank: math.MaxInt}
+	}
+	for i := range parts {
+		parts[i].rank = rank(i)
+	}
+
+	for {
+		lowest := -1
+		for i := 0; i+1 < len(parts); i++ {
+			if parts[i].rank != math.MaxInt && (lowest < 0 || parts[i].rank < parts[lowest].rank) {
+				lowest = i
+			}
+		}
+		if lowest < 0 {
+			break
+		}
+		parts = append(parts[:lowest+1], parts[lowest+2:]...)
+		parts[lowest].rank = rank(lowest)
+		if lowest > 0 {
+			parts[lowest-1].rank = rank(lowest - 1)
+		}
+	}
+
+	for i := 0; i+1 < len(parts); i++ {
+		tokens = append(tokens, b.ranks[string(piece[parts[i].start:parts[i+1].start])])
+	}
+	return tokens
+}
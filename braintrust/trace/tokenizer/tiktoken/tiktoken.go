@@ -0,0 +1,86 @@
+// Package tiktoken registers byte pair encoders of OpenAI's cl100k_base and o200k_base
+// encodings for OpenAI's models, to count their tokens exactly. Import it for its side
+// effect:
+//
+//	import _ "github.com/braintrustdata/braintrust-x-go/braintrust/trace/tokenizer/tiktoken"
+//
+// The encodings are embedded in the binary, and loaded the first time they're used.
+package tiktoken
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go-loader/assets"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/tokenizer"
+)
+
+// The patterns that split text into pieces, from OpenAI's tiktoken.
+var (
+	cl100kPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+	o200kPattern  = strings.Join([]string{
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+		`\p{N}{1,3}`,
+		` ?[^\s\p{L}\p{N}]+[\r\n/]*`,
+		`\s*[\r\n]+`,
+		`\s+(?!\S)`,
+		`\s+`,
+	}, "|")
+)
+
+// CL100KBase returns the encoder of the cl100k_base encoding, used by gpt-4,
+// gpt-3.5-turbo and OpenAI's embedding models.
+var CL100KBase = sync.OnceValue(func() *tokenizer.BPE {
+	return load("cl100k_base", cl100kPattern)
+})
+
+// O200KBase returns the encoder of the o200k_base encoding, used by gpt-4o, gpt-4.1,
+// gpt-5 and the o-series models.
+var O200KBase = sync.OnceValue(func() *tokenizer.BPE {
+	return load("o200k_base", o200kPattern)
+})
+
+func load(encoding, pattern string) *tokenizer.BPE {
+	f, err := assets.Assets.Open(encoding + ".tiktoken")
+	if err != nil {
+		panic(fmt.Sprintf("tiktoken: missing built-in encoding %s: %v", encoding, err))
+	}
+	defer func() { _ = f.Close() }()
+	ranks, err := tokenizer.LoadRanks(f)
+	if err != nil {
+		panic(fmt.Sprintf("tiktoken: invalid built-in encoding %s: %v", encoding, err))
+	}
+	bpe, err := tokenizer.NewBPE(ranks, pattern)
+	if err != nil {
+		panic(fmt.Sprintf("tiktoken: invalid built-in encoding %s: %v", encoding, err))
+	}
+	return bpe
+}
+
+// lazy is a tokenizer that loads its encoder the first time it counts tokens.
+type lazy func() *tokenizer.BPE
+
+func (l lazy) CountTokens(text string) int {
+	return l().CountTokens(text)
+}
+
+func init() {
+	for _, model := range []string{
+		"gpt-4o", "gpt-4o-mini", "chatgpt-4o",
+		"gpt-4.1", "gpt-4.1-mini", "gpt-4.1-nano", "gpt-4.5",
+		"gpt-5", "gpt-5-mini", "gpt-5-nano", "gpt-5-chat", "gpt-5-pro",
+		"o1", "o1-mini", "o1-pro", "o3", "o3-mini", "o3-pro", "o4-mini",
+	} {
+		tokenizer.Register(model, lazy(O200KBase))
+	}
+	for _, model := range []string{
+		"gpt-4", "gpt-4-32k", "gpt-4-turbo",
+		"gpt-3.5-turbo", "gpt-3.5-turbo-16k", "gpt-35-turbo", "gpt-35-turbo-16k",
+		"text-embedding-ada-002", "text-embedding-3-small", "text-embedding-3-large",
+	} {
+		tokenizer.Register(model, lazy(CL100KBase))
+	}
+}
@@ -0,0 +1,34 @@
+package tiktoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/tokenizer"
+)
+
+func TestEncodings(t *testing.T) {
+	assert.Equal(t, []int{15339, 1917}, CL100KBase().Encode("hello world"))
+	assert.Equal(t, []int{83, 1609, 5963, 374, 2294, 0}, CL100KBase().Encode("tiktoken is great!"))
+	assert.Equal(t, []int{24912, 2375}, O200KBase().Encode("hello world"))
+	assert.Equal(t, []int{83, 8251, 2488, 382, 2212, 0}, O200KBase().Encode("tiktoken is great!"))
+}
+
+func TestModels(t *testing.T) {
+	text := "Héllo, 世界! I'm here\n\n\t12345678"
+	for model, encoder := range map[string]*tokenizer.BPE{
+		"gpt-4o-mini-2024-07-18": O200KBase(),
+		"openai/gpt-4.1-nano":    O200KBase(),
+		"gpt-5":                  O200KBase(),
+		"o3-mini":                O200KBase(),
+		"gpt-4-0613":             CL100KBase(),
+		"gpt-4-1106-preview":     CL100KBase(),
+		"chatgpt-4o-latest":      O200KBase(),
+		"gpt-3.5-turbo":          CL100KBase(),
+		"text-embedding-3-small": CL100KBase(),
+	} {
+		assert.Equal(t, encoder.CountTokens(text), tokenizer.For(model).CountTokens(text), model)
+	}
+	assert.NotEqual(t, O200KBase().CountTokens(text), CL100KBase().CountTokens(text))
+}
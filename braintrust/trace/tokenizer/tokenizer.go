@@ -0,0 +1,71 @@
+// Package tokenizer counts the tokens of text, to estimate the token usage of LLM calls
+// whose responses don't report it, like OpenAI streaming chat completions without
+// stream_options.include_usage, or some OpenAI-compatible servers.
+//
+// Tokenizers are looked up by model name. Models without a tokenizer of their own use
+// [Approximate], which estimates about four characters per token. Exact byte pair
+// encoders for OpenAI's cl100k_base and o200k_base encodings are registered for their
+// models by importing the tiktoken package:
+//
+//	import _ "github.com/braintrustdata/braintrust-x-go/braintrust/trace/tokenizer/tiktoken"
+//
+// The encodings are embedded in the binary, which makes it a few megabytes larger, so
+// they're opt-in. Tokenizers of other models can be registered with Register:
+//
+//	tokenizer.Register("my-model", myTokenizer)
+package tokenizer
+
+import (
+	"unicode/utf8"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/models"
+)
+
+// Tokenizer counts the tokens of text for a model. Implementations must be safe for
+// concurrent use.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// Approximate is a tokenizer that estimates one token per four ASCII characters, and one
+// per other character, which is close for English text and code with OpenAI, Anthropic
+// and Gemini models.
+var Approximate Tokenizer = approximate{}
+
+type approximate struct{}
+
+func (approximate) CountTokens(text string) int {
+	var ascii, other int
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+var tokenizers = models.NewRegistry[Tokenizer](nil)
+
+// Register sets the tokenizer of a model, replacing its previous tokenizer. It's also
+// used for dated versions and aliases of the model, like "-2024-08-06" or "-latest".
+func Register(model string, t Tokenizer) {
+	tokenizers.Set(model, t)
+}
+
+// Lookup returns the tokenizer of a model, or false if it has none. Provider prefixes
+// like "openai/" are ignored, and a model without a tokenizer of its own uses the
+// tokenizer of its name without a date or alias suffix, so "gpt-4o-2024-08-06" has the
+// tokenizer of "gpt-4o".
+func Lookup(model string) (Tokenizer, bool) {
+	return tokenizers.Lookup(model)
+}
+
+// For returns the tokenizer of a model, or Approximate if it has none.
+func For(model string) Tokenizer {
+	if t, ok := Lookup(model); ok {
+		return t
+	}
+	return Approximate
+}
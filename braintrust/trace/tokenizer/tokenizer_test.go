@@ -0,0 +1,72 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApproximate(t *testing.T) {
+	assert.Equal(t, 0, Approximate.CountTokens(""))
+	assert.Equal(t, 1, Approximate.CountTokens("hi"))
+	assert.Equal(t, 3, Approximate.CountTokens("hello world!"))
+	assert.Equal(t, 2+2, Approximate.CountTokens("hello 世界"))
+}
+
+type fixed int
+
+func (f fixed) CountTokens(string) int { return int(f) }
+
+func TestRegister(t *testing.T) {
+	t.Cleanup(func() {
+		tokenizers.Delete("my-model")
+		tokenizers.Delete("my-model-large")
+	})
+	Register("My-Model", fixed(1))
+	Register("my-model-large", fixed(2))
+
+	for model, want := range map[string]int{
+		"my-model":              1,
+		"my-model-2024-01-01":   1,
+		"local/my-model":        1,
+		"my-model-large-latest": 2,
+	} {
+		tok, ok := Lookup(model)
+		if assert.True(t, ok, model) {
+			assert.Equal(t, want, tok.CountTokens(""), model)
+		}
+	}
+
+	for _, model := range []string{"my-modelx", "my-model-small"} {
+		_, ok := Lookup(model)
+		assert.False(t, ok, model)
+	}
+	assert.Equal(t, Approximate, For("other-model"))
+	assert.Equal(t, fixed(1), For("my-model"))
+}
+
+func TestBPE(t *testing.T) {
+	// a toy vocabulary: every byte, and the merges "ab", "abc" and "bc" (less likely)
+	ranks, err := LoadRanks(strings.NewReader("YQ== 0\nYg== 1\nYw== 2\nIA== 3\nYWI= 4\nYWJj 5\nYmM= 6\n"))
+	require.NoError(t, err)
+	bpe, err := NewBPE(ranks, `\S+|\s+`)
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{5}, bpe.Encode("abc"))
+	assert.Equal(t, []int{4, 6, 3, 2}, bpe.Encode("abbc c"))
+	assert.Equal(t, []int{1, 4}, bpe.Encode("bab"))
+	assert.Empty(t, bpe.Encode(""))
+	assert.Equal(t, 4, bpe.CountTokens("abbc c"))
+}
+
+func TestNewBPE_Errors(t *testing.T) {
+	_, err := NewBPE(nil, `(`)
+	assert.Error(t, err)
+
+	for _, ranks := range []string{"YQ==", "!!! 1", "YQ== one"} {
+		_, err := LoadRanks(strings.NewReader(ranks))
+		assert.Error(t, err, ranks)
+	}
+}
@@ -25,12 +25,38 @@
 //	span.SetAttributes(attribute.String("user.id", "123"))
 //	span.End()
 //
+// If you'd rather not use OpenTelemetry directly, a [Logger] creates spans and logs
+// typed data on them:
+//
+//	err := trace.Traced(ctx, "my-operation", func(ctx context.Context, span *trace.Span) error {
+//		span.Log(trace.LogEvent{Input: input, Output: output})
+//		return nil
+//	})
+//
+// Metadata and tags that apply to a whole request, like a user ID, can be set once on
+// the context with [ContextWithMetadata] and [ContextWithTags], and are added to every
+// span started with it.
+//
+// The turns of a multi-turn conversation are grouped with a [Conversation], which tags
+// every span with the conversation ID and links each turn to the previous one.
+//
+// Sensitive data like emails and API keys can be redacted from spans before they are
+// exported, with [braintrust.WithRedactDetectors], [braintrust.WithRedactRules],
+// [braintrust.WithRedactPaths] and [braintrust.WithRedactFunc]. Payloads that are too
+// large to export, like long conversations and inline images, can be truncated or
+// uploaded as attachments with [braintrust.WithMaxAttributeSize] and
+// [braintrust.WithLargeAttributeMode].
+//
+// To attach user feedback or delayed scores to a span that was already logged, use a
+// [FeedbackClient] with [FeedbackFor].
+//
 // For automatic instrumentation of external libraries like OpenAI, see the
 // traceopenai subpackage for ready-to-use middleware.
 package trace
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"strings"
@@ -48,6 +74,9 @@ import (
 	"github.com/braintrustdata/braintrust-x-go/braintrust"
 	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/auth"
 	"github.com/braintrustdata/braintrust-x-go/braintrust/log"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/attachment"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/internal"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/wal"
 )
 
 // Enable adds Braintrust tracing to an existing OpenTelemetry tracer provider.
@@ -61,7 +90,8 @@ import (
 //		propagation.Baggage{},
 //	))
 //
-// See examples/temporal for a complete distributed tracing example.
+// For HTTP services, the tracehttp package does this for you. See examples/temporal for
+// a complete distributed tracing example.
 //
 // Example:
 //
@@ -73,7 +103,7 @@ import (
 //	if err != nil {
 //		log.Fatal(err)
 //	}
-func Enable(tp *trace.TracerProvider, opts ...braintrust.Option) error {
+func Enable(tp *trace.TracerProvider, opts ...braintrust.Option) (err error) {
 	config := braintrust.GetConfig(opts...)
 	url := config.APIURL
 	apiKey := config.APIKey
@@ -97,6 +127,13 @@ func Enable(tp *trace.TracerProvider, opts ...braintrust.Option) error {
 	}
 	// If still no orgName, background login will be triggered later by spanProcessor
 
+	var queue *wal.Exporter
+	defer func() {
+		if err != nil && queue != nil {
+			// unlock the queue's directory, so Enable can be called again
+			_ = queue.Shutdown(context.Background())
+		}
+	}()
 	processor := config.SpanProcessor
 	if processor == nil {
 		otelOpts, err := getHTTPOtelOpts(url, apiKey)
@@ -112,7 +149,19 @@ func Enable(tp *trace.TracerProvider, opts ...braintrust.Option) error {
 		if err != nil {
 			return fmt.Errorf("failed to create OTLP exporter: %w", err)
 		}
-		processor = trace.NewBatchSpanProcessor(exporter)
+		var spanExporter trace.SpanExporter = exporter
+		if config.ExportQueueDir != "" {
+			// Queue spans on disk, so they aren't lost when Braintrust can't be reached.
+			queue, err = wal.New(exporter, wal.Opts{
+				Dir:      config.ExportQueueDir,
+				MaxBytes: config.ExportQueueMaxBytes,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to open export queue: %w", err)
+			}
+			spanExporter = queue
+		}
+		processor = trace.NewBatchSpanProcessor(spanExporter)
 	}
 
 	// Figure out our default parent from the config.
@@ -125,13 +174,36 @@ func Enable(tp *trace.TracerProvider, opts ...braintrust.Option) error {
 		filters = append(filters, aiSpanFilterFunc)
 	}
 
+	// Mark the first chunk of streaming LLM responses with span events, if enabled.
+	internal.SetStreamingEvents(config.StreamingEvents)
+
+	redactor, err := newRedactor(config)
+	if err != nil {
+		return err
+	}
+	limiter, err := newPayloadLimiter(config)
+	if err != nil {
+		return err
+	}
+	routes, err := newRoutes(config)
+	if err != nil {
+		return err
+	}
+
 	// Wrap the raw OTEL span processor with the bt span processor (which labels the parents,
 	// filters data, etc)
 	sp, err := newSpanProcessor(processor, parent, filters, orgName, config.AppURL, apiKey)
 	if err != nil {
 		return err
 	}
+	sp.redactor = redactor
+	sp.limiter = limiter
+	sp.routes = routes
+	sp.tp = tp
 	tp.RegisterSpanProcessor(sp)
+	if queue != nil {
+		exportQueues.Store(tp, queue)
+	}
 
 	// Add console debug exporter if BRAINTRUST_ENABLE_TRACE_DEBUG_LOG is set
 	if config.EnableTraceConsoleLog {
@@ -147,6 +219,21 @@ func Enable(tp *trace.TracerProvider, opts ...braintrust.Option) error {
 	return nil
 }
 
+// exportQueues are the export queues of tracer providers, by provider.
+var exportQueues sync.Map
+
+// ExportQueueStats returns the counters of the export queue of a tracer provider that
+// Braintrust tracing was enabled on with braintrust.WithExportQueueDir, like the spans
+// waiting to be sent and the ones dropped because the queue was full. It returns false
+// if the provider has no export queue, or it has shut down.
+func ExportQueueStats(tp *trace.TracerProvider) (wal.Stats, bool) {
+	queue, ok := exportQueues.Load(tp)
+	if !ok {
+		return wal.Stats{}, false
+	}
+	return queue.(*wal.Exporter).Stats(), true
+}
+
 // Quickstart configures OpenTelemetry tracing and returns a teardown function that should
 // be called before your program exits.
 //
@@ -163,7 +250,8 @@ func Enable(tp *trace.TracerProvider, opts ...braintrust.Option) error {
 //		propagation.Baggage{},
 //	))
 //
-// See examples/temporal for a complete distributed tracing example.
+// For HTTP services, the tracehttp package does this for you. See examples/temporal for
+// a complete distributed tracing example.
 //
 // Example:
 //
@@ -255,7 +343,7 @@ func GetParent(ctx context.Context) (bool, Parent) {
 	// Fall back to baggage (for distributed tracing)
 	bag := baggage.FromContext(ctx)
 	if parentStr := bag.Member(ParentOtelAttrKey).Value(); parentStr != "" {
-		parent, err := parseParent(parentStr)
+		parent, err := ParseParent(parentStr)
 		if err != nil {
 			log.Warnf("Failed to parse parent from baggage: %v", err)
 			return false, Parent{}
@@ -299,7 +387,9 @@ func (p Parent) String() string {
 	return fmt.Sprintf("%s:%s", p.Type, p.ID)
 }
 
-func parseParent(s string) (Parent, error) {
+// ParseParent parses a parent in the format of [Parent.String], like
+// "project_name:my-project".
+func ParseParent(s string) (Parent, error) {
 	parts := strings.SplitN(s, ":", 2)
 	if len(parts) != 2 {
 		return Parent{}, fmt.Errorf("invalid parent format: %s", s)
@@ -366,10 +456,28 @@ func (o *otelAttrs) makeAttrs() {
 
 type spanProcessor struct {
 	wrapped   trace.SpanProcessor
+	tp        *trace.TracerProvider
 	filters   []braintrust.SpanFilterFunc
 	apiKey    string
 	appURL    string
 	otelAttrs *otelAttrs
+
+	// metadata and tags from the context of running spans, by spanKey.
+	contextValues sync.Map
+
+	// redactor removes sensitive data from spans. It is nil if redaction isn't configured.
+	redactor *redactor
+
+	// limiter truncates or offloads large attributes. It is nil if they aren't limited.
+	limiter *payloadLimiter
+
+	// routes send spans to other parents and exporters, and routed holds the route of
+	// running spans, by spanKey.
+	routes []*route
+	routed sync.Map
+
+	// costTrackers holds the CostTracker of the context of running spans, by spanKey.
+	costTrackers sync.Map
 }
 
 // newSpanProcessor creates a new span processor that wraps another processor and adds parent labeling.
@@ -393,18 +501,18 @@ func newSpanProcessor(proc trace.SpanProcessor, defaultParent Parent, filters []
 	// to create links on spans in advance so that we don't rely on looking up global state
 	// later.
 	if orgName == "" {
-		go sp.login()
+		go login(appURL, apiKey, attrs)
 	}
 
 	return sp, nil
 }
 
 // login will attempt to login until it succeeds so that we can look up the active org name.
-func (sp *spanProcessor) login() {
+func login(appURL, apiKey string, attrs *otelAttrs) {
 	log.Debugf("spanProcessor: no orgName configured, calling LoginUntilSuccess")
 	state, err := auth.LoginUntilSuccess(auth.Options{
-		AppURL: sp.appURL,
-		APIKey: sp.apiKey,
+		AppURL: appURL,
+		APIKey: apiKey,
 	})
 	if err != nil {
 		log.Warnf("spanProcessor: LoginUntilSuccess failed: %v", err)
@@ -412,23 +520,29 @@ func (sp *spanProcessor) login() {
 	}
 	log.Debugf("spanProcessor: LoginUntilSuccess succeeded, setting orgName to %q", state.OrgName)
 	if state.OrgName != "" {
-		sp.otelAttrs.SetOrgName(state.OrgName)
+		attrs.SetOrgName(state.OrgName)
 	}
 }
 
 // OnStart is called when a span is started and assigns parent attributes.
-// It assigns spans to projects or experiments based on context or default parent.
+// It assigns spans to projects or experiments based on context, routes or default parent.
 func (sp *spanProcessor) OnStart(ctx context.Context, span trace.ReadWriteSpan) {
 	defaultParent, attrs := sp.otelAttrs.Get()
 
 	// All otel spans need to have a parent attached (e.g. project-id:12345). If the span
-	// doesn't have one already attached, use the one from the context or our default.
+	// doesn't have one already attached, use the one from the context, a route or our default.
+	var rt *route
 	if !hasParent(span) {
 		// if the context has a parent, use it.
 		ok, parent := GetParent(ctx)
 		if ok {
 			setParentOnSpan(span, parent)
 			log.Debugf("SpanProcessor.OnStart: setting parent from context: %s", parent)
+		} else if rt = sp.routeSpan(ctx, span); rt != nil {
+			// then a route's parent
+			setParentOnSpan(span, rt.parent)
+			sp.routed.Store(newSpanKey(span.SpanContext()), rt)
+			log.Debugf("SpanProcessor.OnStart: setting parent from route: %s", rt.parent)
 		} else {
 			// otherwise use the default parent
 			span.SetAttributes(defaultParent)
@@ -438,17 +552,45 @@ func (sp *spanProcessor) OnStart(ctx context.Context, span trace.ReadWriteSpan)
 
 	// Set any other additional attributes (org name, app URL, etc.)
 	span.SetAttributes(attrs...)
+	if rt != nil && rt.otelAttrs != nil {
+		_, routeAttrs := rt.otelAttrs.Get()
+		span.SetAttributes(routeAttrs...)
+	}
+
+	// Add the metadata and tags from the context
+	sp.applyContextValues(ctx, span)
+	sp.trackCost(ctx, span)
 
 	// Delegate to wrapped processor
-	sp.wrapped.OnStart(ctx, span)
+	sp.processorFor(rt).OnStart(ctx, span)
 }
 
 // OnEnd is called when a span ends.
 func (sp *spanProcessor) OnEnd(span trace.ReadOnlySpan) {
+	var rt *route
+	if r, ok := sp.routed.LoadAndDelete(newSpanKey(span.SpanContext())); ok {
+		rt = r.(*route)
+	}
+	span = sp.withContextValues(span)
+
+	// Costs are incurred whether or not the span is exported
+	sp.addCost(span)
+
 	// Apply filters to determine if we should forward this span
-	if sp.shouldForwardSpan(span) {
-		sp.wrapped.OnEnd(span)
+	if !sp.shouldForwardSpan(span) {
+		return
+	}
+
+	// Redact sensitive data before it leaves the process
+	if sp.redactor != nil {
+		span = sp.redactor.redactSpan(span)
+	}
+
+	// Keep large payloads from making the span too big to export
+	if limiter := sp.limiterFor(rt); limiter != nil {
+		span = limiter.limitSpan(span)
 	}
+	sp.processorFor(rt).OnEnd(span)
 }
 
 // shouldForwardSpan applies filter functions to determine if a span should be forwarded.
@@ -484,12 +626,31 @@ func (sp *spanProcessor) shouldForwardSpan(span trace.ReadOnlySpan) bool {
 
 // Shutdown shuts down the span processor.
 func (sp *spanProcessor) Shutdown(ctx context.Context) error {
-	return sp.wrapped.Shutdown(ctx)
+	// tool spans still waiting for their results would never be exported
+	if sp.tp != nil {
+		internal.EndAllToolSpans(sp.tp)
+		defer exportQueues.Delete(sp.tp)
+	}
+	return errors.Join(
+		sp.flushAttachments(ctx),
+		sp.wrapped.Shutdown(ctx),
+		sp.routeProcessors(func(p trace.SpanProcessor) error { return p.Shutdown(ctx) }),
+	)
 }
 
 // ForceFlush forces a flush of the span processor.
 func (sp *spanProcessor) ForceFlush(ctx context.Context) error {
-	return sp.wrapped.ForceFlush(ctx)
+	return errors.Join(
+		sp.flushAttachments(ctx),
+		sp.wrapped.ForceFlush(ctx),
+		sp.routeProcessors(func(p trace.SpanProcessor) error { return p.ForceFlush(ctx) }),
+	)
+}
+
+// flushAttachments waits for the attachments of exported spans to be uploaded,
+// including the ones uploaded with attachment.Upload and offloaded payloads.
+func (sp *spanProcessor) flushAttachments(ctx context.Context) error {
+	return attachment.Flush(ctx)
 }
 
 var _ trace.SpanProcessor = &spanProcessor{}
@@ -649,7 +810,7 @@ func getSpanURLData(span oteltrace.Span) (url, org string, parent Parent, err er
 		}
 	}
 
-	parent, err = parseParent(attrs[ParentOtelAttrKey])
+	parent, err = ParseParent(attrs[ParentOtelAttrKey])
 	if err != nil {
 		return
 	}
@@ -2,9 +2,15 @@ package trace
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/propagation"
@@ -179,6 +185,52 @@ func TestEnableOptions(t *testing.T) {
 	}
 }
 
+func TestEnableWithExportQueue(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/otel/v1/traces" {
+			requests++
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	tp := sdktrace.NewTracerProvider()
+	err := Enable(tp,
+		braintrust.WithAPIURL(server.URL),
+		braintrust.WithAPIKey("test-key"),
+		braintrust.WithOrgName("test-org"),
+		braintrust.WithExportQueueDir(dir),
+	)
+	require.NoError(t, err)
+
+	_, ok := ExportQueueStats(sdktrace.NewTracerProvider())
+	assert.False(t, ok)
+
+	_, span := tp.Tracer("test").Start(context.Background(), "queued")
+	span.End()
+	require.NoError(t, tp.ForceFlush(context.Background()))
+	require.Eventually(t, func() bool {
+		stats, ok := ExportQueueStats(tp)
+		return ok && stats.ExportedSpans == 1
+	}, 5*time.Second, time.Millisecond)
+	stats, _ := ExportQueueStats(tp)
+	assert.Zero(t, stats.DroppedSpans)
+	require.NoError(t, tp.Shutdown(context.Background()))
+	_, ok = ExportQueueStats(tp)
+	assert.False(t, ok)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, requests)
+	files, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, files)
+}
+
 func TestEnableWithExistingProcessors(t *testing.T) {
 	assert := assert.New(t)
 
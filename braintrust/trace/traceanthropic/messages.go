@@ -20,6 +20,10 @@ import (
 type messagesTracer struct {
 	streaming bool
 	metadata  map[string]any
+	// parent is the context the span was started with, to start the spans of the
+	// response's tool calls.
+	parent context.Context
+	internal.StreamTiming
 }
 
 func newMessagesTracer() *messagesTracer {
@@ -33,6 +37,7 @@ func newMessagesTracer() *messagesTracer {
 }
 
 func (mt *messagesTracer) StartSpan(ctx context.Context, t time.Time, request io.Reader) (context.Context, trace.Span, error) {
+	mt.parent = ctx
 	ctx, span := tracer().Start(
 		ctx,
 		"anthropic.messages.create",
@@ -88,6 +93,9 @@ func (mt *messagesTracer) StartSpan(ctx context.Context, t time.Time, request io
 	// Add user/assistant messages
 	if messages, ok := raw["messages"].([]any); ok {
 		msgs = append(msgs, messages...)
+		if err := internal.EndToolSpans(span, t, toolResults(messages)); err != nil {
+			return ctx, span, err
+		}
 	}
 
 	if len(msgs) > 0 {
@@ -115,12 +123,15 @@ func (mt *messagesTracer) parseStreamingResponse(span trace.Span, body io.Reader
 	var allResults []map[string]any
 	usage := make(map[string]any)
 
+	var chunks int
 	for scanner.Scan() {
 		line := scanner.Text()
 
 		if !strings.HasPrefix(line, "data: ") {
 			continue
 		}
+		i := chunks
+		chunks++
 
 		line = strings.TrimPrefix(line, "data: ")
 		if line == "[DONE]" {
@@ -140,6 +151,10 @@ func (mt *messagesTracer) parseStreamingResponse(span trace.Span, body io.Reader
 		if ok {
 			switch eventType {
 
+			// Contains the output: text, tool call arguments or thinking
+			case "content_block_delta":
+				mt.Output(i)
+
 			// Contains input and cache tokens
 			case "message_start":
 				// Usage is nested in message object for message_start events
@@ -175,12 +190,21 @@ func (mt *messagesTracer) parseStreamingResponse(span trace.Span, body io.Reader
 		}
 	}
 
-	// Handle usage metrics
+	// Handle usage and latency metrics
+	var metrics map[string]int64
 	if len(usage) > 0 {
-		metrics := parseUsageTokens(usage)
-		if err := internal.SetJSONAttr(span, "braintrust.metrics", metrics); err != nil {
-			return err
-		}
+		metrics = parseUsageTokens(usage)
+	}
+	if err := mt.StreamTiming.SetUsageMetrics(span, internal.ModelName(mt.metadata), metrics); err != nil {
+		return err
+	}
+
+	var calls []internal.ToolCall
+	for _, msg := range output {
+		calls = append(calls, toolCalls(msg["content"])...)
+	}
+	if err := internal.StartToolSpans(mt.parent, tracer(), span, time.Now(), calls); err != nil {
+		return err
 	}
 
 	return scanner.Err()
@@ -344,7 +368,7 @@ func (mt *messagesTracer) handleMessageResponse(span trace.Span, rawMsg map[stri
 
 	if usage, ok := rawMsg["usage"].(map[string]any); ok {
 		metrics := parseUsageTokens(usage)
-		if err := internal.SetJSONAttr(span, "braintrust.metrics", metrics); err != nil {
+		if err := internal.SetUsageMetrics(span, internal.ModelName(mt.metadata), metrics); err != nil {
 			return err
 		}
 	}
@@ -361,7 +385,61 @@ func (mt *messagesTracer) handleMessageResponse(span trace.Span, rawMsg map[stri
 		if err := internal.SetJSONAttr(span, "braintrust.output_json", output); err != nil {
 			return err
 		}
+		if err := internal.StartToolSpans(mt.parent, tracer(), span, time.Now(), toolCalls(content)); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+// contentBlocks returns the blocks of a message's content that are objects.
+func contentBlocks(content any) []map[string]any {
+	switch content := content.(type) {
+	case []map[string]any:
+		return content
+	case []any:
+		blocks := make([]map[string]any, 0, len(content))
+		for _, block := range content {
+			if block, ok := block.(map[string]any); ok {
+				blocks = append(blocks, block)
+			}
+		}
+		return blocks
+	}
+	return nil
+}
+
+// toolCalls returns the tool_use blocks of a response's content.
+func toolCalls(content any) []internal.ToolCall {
+	var calls []internal.ToolCall
+	for _, block := range contentBlocks(content) {
+		if block["type"] != "tool_use" {
+			continue
+		}
+		id, _ := block["id"].(string)
+		name, _ := block["name"].(string)
+		calls = append(calls, internal.ToolCall{ID: id, Name: name, Arguments: block["input"]})
+	}
+	return calls
+}
+
+// toolResults returns the tool_result blocks of a request's user messages.
+func toolResults(messages []any) []internal.ToolResult {
+	var results []internal.ToolResult
+	for _, m := range messages {
+		msg, _ := m.(map[string]any)
+		if msg["role"] != "user" {
+			continue
+		}
+		for _, block := range contentBlocks(msg["content"]) {
+			if block["type"] != "tool_result" {
+				continue
+			}
+			id, _ := block["tool_use_id"].(string)
+			isError, _ := block["is_error"].(bool)
+			results = append(results, internal.ToolResult{ID: id, Output: block["content"], IsError: isError})
+		}
+	}
+	return results
+}
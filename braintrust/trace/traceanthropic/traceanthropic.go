@@ -23,6 +23,12 @@
 //		},
 //		MaxTokens: 1024,
 //	})
+//
+// Tool calls of messages are traced as "tool" spans, siblings of the message's span,
+// which end when a follow-up request sends their results.
+//
+// Spans of streaming responses have the time_to_first_token, inter-chunk latency and
+// tokens_per_second of their output as metrics.
 package traceanthropic
 
 import (
@@ -100,5 +106,6 @@ func parseUsageTokens(usage map[string]interface{}) map[string]int64 {
 	return metrics
 }
 
-// Ensure our tracers implement the shared interface
+// Ensure our tracers implement the shared interfaces
 var _ internal.MiddlewareTracer = &messagesTracer{}
+var _ internal.StreamTracer = &messagesTracer{}
@@ -85,6 +85,154 @@ func TestMiddleware(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestMiddleware_EstimatedCost(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"model": "claude-3-haiku-20240307", "max_tokens": 1024, "messages": []}`))
+	next := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Header:     make(http.Header),
+			Body: io.NopCloser(strings.NewReader(`{
+				"type": "message",
+				"model": "claude-3-haiku-20240307",
+				"content": [],
+				"usage": {"input_tokens": 12, "cache_read_input_tokens": 100, "output_tokens": 9}
+			}`)),
+		}, nil
+	}
+	resp, err := Middleware(req, next)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	span := exporter.FlushOne()
+	metrics := span.Metrics()
+	assert.Equal(t, float64(112), metrics["prompt_tokens"])
+	assert.InDelta(t, (12*0.25+100*0.03+9*1.25)/1e6, metrics["estimated_cost"], 1e-12)
+}
+
+func TestMiddleware_ToolSpans(t *testing.T) {
+	tracer, exporter := oteltest.Setup(t)
+	ctx, agent := tracer.Start(context.Background(), "agent")
+
+	send := func(request, response string) {
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(request)).WithContext(ctx)
+		next := func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"text/event-stream"}},
+				Body:       io.NopCloser(strings.NewReader(response)),
+			}, nil
+		}
+		resp, err := Middleware(req, next)
+		require.NoError(t, err)
+		_, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+
+	send(`{"model": "claude-3-haiku-20240307", "max_tokens": 1024, "stream": true, "messages": [{"role": "user", "content": "What's the weather in Paris?"}]}`,
+		`data: {"type":"message_start","message":{"usage":{"input_tokens":10}}}
+
+data: {"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_spans","name":"get_weather","input":{}}}
+
+data: {"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}
+
+data: {"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}
+
+data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":5}}
+
+`)
+	send(`{"model": "claude-3-haiku-20240307", "max_tokens": 1024, "stream": true, "messages": [
+		{"role": "user", "content": "What's the weather in Paris?"},
+		{"role": "assistant", "content": [{"type": "tool_use", "id": "toolu_spans", "name": "get_weather", "input": {"city": "Paris"}}]},
+		{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "toolu_spans", "content": "service unavailable", "is_error": true}]}
+	]}`,
+		`data: {"type":"message_start","message":{"usage":{"input_tokens":20}}}
+
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Sorry."}}
+
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":2}}
+
+`)
+	agent.End()
+
+	spans := exporter.Flush()
+	require.Len(t, spans, 4)
+	var llm, tool, followUp oteltest.Span
+	for _, span := range spans {
+		switch {
+		case span.Name() == "get_weather":
+			tool = span
+		case span.Name() == "anthropic.messages.create" && len(span.Stub.Links) == 0:
+			llm = span
+		case span.Name() == "anthropic.messages.create":
+			followUp = span
+		}
+	}
+
+	tool.AssertJSONAttrEquals("braintrust.span_attributes", map[string]any{"type": "tool"})
+	assert.Equal(t, map[string]any{"city": "Paris"}, tool.Input())
+	assert.Equal(t, "service unavailable", tool.Output())
+	assert.Equal(t, map[string]any{"tool_call_id": "toolu_spans", "name": "get_weather"}, tool.Metadata())
+	assert.Equal(t, codes.Error, tool.Status().Code)
+
+	assert.Equal(t, agent.SpanContext().SpanID(), tool.Stub.Parent.SpanID())
+	require.Len(t, tool.Stub.Links, 1)
+	assert.Equal(t, llm.Stub.SpanContext.SpanID(), tool.Stub.Links[0].SpanContext.SpanID())
+	assert.Equal(t, followUp.Stub.StartTime, tool.Stub.EndTime)
+	require.Len(t, followUp.Stub.Links, 1)
+	assert.Equal(t, tool.Stub.SpanContext.SpanID(), followUp.Stub.Links[0].SpanContext.SpanID())
+}
+
+func TestMiddleware_StreamingLatency(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	delay := 20 * time.Millisecond
+	events := []string{
+		`{"type":"message_start","message":{"model":"claude-3-haiku-20240307","usage":{"input_tokens":10}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":" there!"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":4}}`,
+	}
+	req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"model": "claude-3-haiku-20240307", "max_tokens": 1024, "stream": true, "messages": []}`))
+	next := func(req *http.Request) (*http.Response, error) {
+		r, w := io.Pipe()
+		go func() {
+			for _, event := range events {
+				time.Sleep(delay)
+				_, _ = io.WriteString(w, "event: message\ndata: "+event+"\n\n")
+			}
+			_ = w.Close()
+		}()
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {"text/event-stream"}},
+			Body:       r,
+		}, nil
+	}
+	resp, err := Middleware(req, next)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	span := exporter.FlushOne()
+	metrics := span.Metrics()
+	assert.Equal(t, float64(4), metrics["completion_tokens"])
+	// the first delta is the third event
+	assert.GreaterOrEqual(t, metrics["time_to_first_token"], 3*delay.Seconds())
+	assert.GreaterOrEqual(t, metrics["inter_chunk_latency_mean"], delay.Seconds())
+	assert.Greater(t, metrics["tokens_per_second"], 0.0)
+	// streaming events are disabled by default
+	assert.Empty(t, span.Events())
+}
+
 func TestMessagesTracer(t *testing.T) {
 	tracer := newMessagesTracer()
 	assert.NotNil(t, tracer)
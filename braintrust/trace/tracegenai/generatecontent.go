@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"sort"
 	"strings"
 	"time"
 
@@ -14,11 +15,13 @@ import (
 	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/internal"
 )
 
-// generateContentTracer is a tracer for the Gemini generateContent endpoint.
+// generateContentTracer is a tracer for the Gemini generateContent and
+// streamGenerateContent endpoints.
 type generateContentTracer struct {
 	streaming bool
 	metadata  map[string]any
 	model     string
+	internal.StreamTiming
 }
 
 func newGenerateContentTracer(model string) *generateContentTracer {
@@ -31,10 +34,20 @@ func newGenerateContentTracer(model string) *generateContentTracer {
 	}
 }
 
+func newStreamGenerateContentTracer(model string) *generateContentTracer {
+	gt := newGenerateContentTracer(model)
+	gt.streaming = true
+	return gt
+}
+
 func (gt *generateContentTracer) StartSpan(ctx context.Context, t time.Time, request io.Reader) (context.Context, trace.Span, error) {
+	name := "genai.models.generateContent"
+	if gt.streaming {
+		name = "genai.models.generateContentStream"
+	}
 	ctx, span := tracer().Start(
 		ctx,
-		"genai.models.generateContent",
+		name,
 		trace.WithTimestamp(t),
 	)
 
@@ -120,11 +133,118 @@ func (gt *generateContentTracer) StartSpan(ctx context.Context, t time.Time, req
 }
 
 func (gt *generateContentTracer) TagSpan(span trace.Span, body io.Reader) error {
-	// For now, handle non-streaming responses
-	// Streaming will be handled separately
+	if gt.streaming {
+		return gt.parseStreamingResponse(span, body)
+	}
 	return gt.parseResponse(span, body)
 }
 
+// parseStreamingResponse merges the chunks of a streaming response, which are responses
+// with a part of the candidates' content, into one response.
+func (gt *generateContentTracer) parseStreamingResponse(span trace.Span, body io.Reader) error {
+	merged := map[string]any{}
+	candidates := map[int64]map[string]any{}
+
+	var chunks int
+	err := internal.ReadEvents(body, func(chunk map[string]any) error {
+		i := chunks
+		chunks++
+
+		// the last chunk has the final usage
+		for k, v := range chunk {
+			if k != "candidates" {
+				merged[k] = v
+			}
+		}
+		list, _ := chunk["candidates"].([]any)
+		for _, c := range list {
+			c, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			_, index := internal.ToInt64(c["index"])
+			candidate, ok := candidates[index]
+			if !ok {
+				candidate = map[string]any{}
+				candidates[index] = candidate
+			}
+			if mergeCandidate(candidate, c) {
+				gt.Output(i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(candidates) > 0 {
+		list := make([]any, 0, len(candidates))
+		for _, candidate := range candidates {
+			list = append(list, candidate)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			_, a := internal.ToInt64(list[i].(map[string]any)["index"])
+			_, b := internal.ToInt64(list[j].(map[string]any)["index"])
+			return a < b
+		})
+		merged["candidates"] = list
+	}
+
+	return gt.handleResponse(span, merged)
+}
+
+// mergeCandidate merges a chunk of a candidate into it, and returns whether the chunk
+// has content. Consecutive text parts are joined, other fields are replaced.
+func mergeCandidate(candidate, chunk map[string]any) bool {
+	var hasContent bool
+	for k, v := range chunk {
+		if k != "content" {
+			candidate[k] = v
+			continue
+		}
+		content, _ := v.(map[string]any)
+		merged, _ := candidate["content"].(map[string]any)
+		if merged == nil {
+			merged = map[string]any{}
+			candidate["content"] = merged
+		}
+		if role, ok := content["role"]; ok {
+			merged["role"] = role
+		}
+		parts, _ := merged["parts"].([]any)
+		newParts, _ := content["parts"].([]any)
+		for _, part := range newParts {
+			hasContent = true
+			if len(parts) > 0 && joinText(parts[len(parts)-1], part) {
+				continue
+			}
+			parts = append(parts, part)
+		}
+		merged["parts"] = parts
+	}
+	return hasContent
+}
+
+// joinText appends the text of part to the text of last, if both are only text of the
+// same kind (thoughts or not), and returns whether it did.
+func joinText(last, part any) bool {
+	l, _ := last.(map[string]any)
+	p, _ := part.(map[string]any)
+	lt, lok := l["text"].(string)
+	pt, pok := p["text"].(string)
+	if !lok || !pok || l["thought"] != p["thought"] {
+		return false
+	}
+	for k := range p {
+		if k != "text" && k != "thought" {
+			return false
+		}
+	}
+	l["text"] = lt + pt
+	return true
+}
+
 func (gt *generateContentTracer) parseResponse(span trace.Span, body io.Reader) error {
 	var raw map[string]interface{}
 	err := json.NewDecoder(body).Decode(&raw)
@@ -151,12 +271,17 @@ func (gt *generateContentTracer) handleResponse(span trace.Span, raw map[string]
 		return err
 	}
 
-	// Parse usage metadata (token counts)
+	// Parse usage metadata (token counts), and the latency of streaming responses
+	var metrics map[string]int64
 	if usageMetadata, ok := raw["usageMetadata"].(map[string]any); ok {
-		metrics := parseUsageTokens(usageMetadata)
-		if err := internal.SetJSONAttr(span, "braintrust.metrics", metrics); err != nil {
-			return err
-		}
+		metrics = parseUsageTokens(usageMetadata)
+	}
+	model := internal.ModelName(gt.metadata)
+	if model == "" {
+		model = gt.model
+	}
+	if err := gt.StreamTiming.SetUsageMetrics(span, model, metrics); err != nil {
+		return err
 	}
 
 	return nil
@@ -205,5 +330,6 @@ func camelToSnake(s string) string {
 	return strings.ToLower(result.String())
 }
 
-// Ensure our tracer implements the shared interface
+// Ensure our tracer implements the shared interfaces
 var _ internal.MiddlewareTracer = &generateContentTracer{}
+var _ internal.StreamTracer = &generateContentTracer{}
@@ -20,6 +20,10 @@
 //	// Your Gemini calls will now be automatically traced
 //	resp, err := client.Models.GenerateContent(ctx, "gemini-2.0-flash-exp",
 //		genai.Text("Hello!"), nil)
+//
+// Streaming calls made with GenerateContentStream are traced too, with the chunks of
+// their response merged into one, and the time_to_first_token, inter-chunk latency and
+// tokens_per_second of their output as metrics.
 package tracegenai
 
 import (
@@ -89,6 +93,10 @@ func genaiRouter(path string) internal.MiddlewareTracer {
 	// Match both Gemini API and Vertex AI paths
 	// Gemini API: /v1beta/models/{model}/generateContent
 	// Vertex AI: /v1/projects/{project}/locations/{location}/publishers/google/models/{model}:generateContent
+	if containsStreamGenerateContent(path) {
+		model := extractModelFromPath(path)
+		return newStreamGenerateContentTracer(model)
+	}
 	if containsGenerateContent(path) {
 		model := extractModelFromPath(path)
 		return newGenerateContentTracer(model)
@@ -102,6 +110,12 @@ func containsGenerateContent(path string) bool {
 		strings.Contains(path, ":generateContent")
 }
 
+// containsStreamGenerateContent checks if the path is for a streamGenerateContent endpoint
+func containsStreamGenerateContent(path string) bool {
+	return strings.Contains(path, "/streamGenerateContent") ||
+		strings.Contains(path, ":streamGenerateContent")
+}
+
 // extractModelFromPath extracts the model name from the URL path
 // Gemini API: /v1beta/models/{model}/generateContent or /v1beta/models/{model}:generateContent
 // Vertex AI: /v1/projects/{project}/locations/{location}/publishers/google/models/{model}:generateContent
@@ -115,9 +129,11 @@ func extractModelFromPath(path string) string {
 	// Get the model part (after /models/)
 	modelPart := parts[1]
 
-	// Remove :generateContent or /generateContent suffix
-	modelPart = strings.TrimSuffix(modelPart, ":generateContent")
-	modelPart = strings.TrimSuffix(modelPart, "/generateContent")
+	// Remove :generateContent or /generateContent suffix, or the streaming one
+	for _, suffix := range []string{"generateContent", "streamGenerateContent"} {
+		modelPart = strings.TrimSuffix(modelPart, ":"+suffix)
+		modelPart = strings.TrimSuffix(modelPart, "/"+suffix)
+	}
 
 	return modelPart
 }
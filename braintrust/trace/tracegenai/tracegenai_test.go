@@ -2,14 +2,18 @@ package tracegenai
 
 import (
 	"context"
+	"io"
+	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel/codes"
 	"google.golang.org/genai"
 
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
 	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/oteltest"
 )
 
@@ -155,3 +159,77 @@ func TestCamelToSnake(t *testing.T) {
 		})
 	}
 }
+
+// roundTripperFunc is a fake transport.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestGenerateContentStream(t *testing.T) {
+	_, exporter := oteltest.Setup(t, braintrust.WithStreamingEvents(true))
+
+	delay := 20 * time.Millisecond
+	chunks := []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"1, "}]},"index":0}],"modelVersion":"gemini-2.0-flash"}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"2, "}]},"index":0}],"modelVersion":"gemini-2.0-flash"}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"3"}]},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":8,"candidatesTokenCount":6,"totalTokenCount":14},"modelVersion":"gemini-2.0-flash"}`,
+	}
+	var path string
+	fake := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		path = req.URL.Path
+		r, w := io.Pipe()
+		go func() {
+			for _, chunk := range chunks {
+				time.Sleep(delay)
+				_, _ = io.WriteString(w, "data: "+chunk+"\r\n\r\n")
+			}
+			_ = w.Close()
+		}()
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {"text/event-stream"}},
+			Body:       r,
+			Request:    req,
+		}, nil
+	})
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		HTTPClient: WrapClient(&http.Client{Transport: fake}),
+		APIKey:     "fake",
+		Backend:    genai.BackendGeminiAPI,
+	})
+	require.NoError(t, err)
+
+	var text string
+	for resp, err := range client.Models.GenerateContentStream(context.Background(), "gemini-2.0-flash", genai.Text("Count from 1 to 3"), nil) {
+		require.NoError(t, err)
+		text += resp.Text()
+	}
+	assert.Equal(t, "1, 2, 3", text)
+	assert.Contains(t, path, ":streamGenerateContent")
+
+	span := exporter.FlushOne()
+	span.AssertNameIs("genai.models.generateContentStream")
+	assert.Equal(t, "gemini-2.0-flash", span.Metadata()["model"])
+	output := span.Output().(map[string]any)
+	assert.Equal(t, []any{map[string]any{
+		"content":      map[string]any{"role": "model", "parts": []any{map[string]any{"text": "1, 2, 3"}}},
+		"finishReason": "STOP",
+		"index":        float64(0),
+	}}, output["candidates"])
+
+	metrics := span.Metrics()
+	assert.Equal(t, float64(6), metrics["completion_tokens"])
+	assert.GreaterOrEqual(t, metrics["time_to_first_token"], delay.Seconds())
+	assert.GreaterOrEqual(t, metrics["inter_chunk_latency_mean"], delay.Seconds())
+	assert.Greater(t, metrics["tokens_per_second"], 0.0)
+	require.Len(t, span.Events(), 1)
+	assert.Equal(t, "first_token", span.Events()[0].Name)
+}
+
+func TestExtractModelFromPath(t *testing.T) {
+	assert.Equal(t, "gemini-2.0-flash", extractModelFromPath("/v1beta/models/gemini-2.0-flash:generateContent"))
+	assert.Equal(t, "gemini-2.0-flash", extractModelFromPath("/v1beta/models/gemini-2.0-flash:streamGenerateContent"))
+	assert.Nil(t, genaiRouter("/v1beta/models/gemini-2.0-flash:countTokens"))
+}
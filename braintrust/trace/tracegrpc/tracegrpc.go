@@ -0,0 +1,439 @@
+// Package tracegrpc propagates Braintrust traces between services over gRPC, so calls
+// through gRPC services land in the same Braintrust trace and project.
+//
+// The interceptors send the W3C trace context, the baggage and the Braintrust parent
+// in gRPC metadata, and record a span for each call. Add them to your servers:
+//
+//	server := grpc.NewServer(
+//		grpc.ChainUnaryInterceptor(tracegrpc.UnaryServerInterceptor()),
+//		grpc.ChainStreamInterceptor(tracegrpc.StreamServerInterceptor()),
+//	)
+//
+// And your clients:
+//
+//	conn, err := grpc.NewClient(target,
+//		grpc.WithChainUnaryInterceptor(tracegrpc.UnaryClientInterceptor()),
+//		grpc.WithChainStreamInterceptor(tracegrpc.StreamClientInterceptor()),
+//	)
+//
+// With WithMessages, request and response messages are recorded as the input and
+// output of spans. Use WithRedact to remove sensitive fields from them.
+package tracegrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/log"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace"
+)
+
+// ParentMetadataKey is the metadata key that carries the Braintrust parent, e.g.
+// "project_name:my-project".
+const ParentMetadataKey = "x-bt-parent"
+
+// Propagator reads and writes the W3C trace context and baggage.
+var Propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// RedactFunc returns the version of a request or response message of a method that
+// is recorded on spans. It can return a modified copy of the message, or nil to not
+// record it. It must not modify msg.
+type RedactFunc func(method string, msg any) any
+
+// Option configures the interceptors.
+type Option func(*config)
+
+type config struct {
+	tracerProvider oteltrace.TracerProvider
+	filter         func(method string) bool
+	messages       bool
+	redact         RedactFunc
+}
+
+// WithTracerProvider sets the tracer provider of the spans (default: the global one).
+func WithTracerProvider(tp oteltrace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithFilter sets which methods are traced, by full method name like
+// "/grpc.health.v1.Health/Check". Calls to other methods still have their context
+// propagated, but no span is started for them.
+func WithFilter(fn func(method string) bool) Option {
+	return func(c *config) {
+		c.filter = fn
+	}
+}
+
+// WithMessages records request messages as the input of spans, and response messages
+// as their output. Streamed messages are recorded as lists.
+func WithMessages() Option {
+	return func(c *config) {
+		c.messages = true
+	}
+}
+
+// WithRedact records messages like WithMessages, passing them through fn first.
+func WithRedact(fn RedactFunc) Option {
+	return func(c *config) {
+		c.messages = true
+		c.redact = fn
+	}
+}
+
+func newConfig(opts []Option) config {
+	c := config{filter: func(string) bool { return true }}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+func (c config) tracer() oteltrace.Tracer {
+	tp := c.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer("braintrust.grpc")
+}
+
+// message returns the version of msg to record, or nil.
+func (c config) message(method string, msg any) any {
+	if c.redact != nil {
+		msg = c.redact(method, msg)
+	}
+	if m, ok := msg.(proto.Message); ok {
+		b, err := protojson.Marshal(m)
+		if err != nil {
+			log.Warnf("tracegrpc: failed to encode message of %s: %v", method, err)
+			return nil
+		}
+		return json.RawMessage(b)
+	}
+	return msg
+}
+
+// UnaryClientInterceptor returns an interceptor that adds the trace context, baggage
+// and Braintrust parent to the metadata of unary calls, and records a client span.
+func UnaryClientInterceptor(opts ...Option) grpc.UnaryClientInterceptor {
+	c := newConfig(opts)
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		if !c.filter(method) {
+			return invoker(inject(ctx), method, req, reply, cc, callOpts...)
+		}
+		ctx, span := c.tracer().Start(ctx, spanName(method),
+			oteltrace.WithSpanKind(oteltrace.SpanKindClient),
+			oteltrace.WithAttributes(methodAttrs(method)...),
+		)
+		defer span.End()
+
+		err := invoker(inject(ctx), method, req, reply, cc, callOpts...)
+		if c.messages {
+			setMessage(span, trace.SetInput, c.message(method, req))
+			if err == nil {
+				setMessage(span, trace.SetOutput, c.message(method, reply))
+			}
+		}
+		setStatus(span, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns an interceptor that adds the trace context, baggage
+// and Braintrust parent to the metadata of streaming calls, and records a client span
+// that ends with the stream.
+func StreamClientInterceptor(opts ...Option) grpc.StreamClientInterceptor {
+	c := newConfig(opts)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if !c.filter(method) {
+			return streamer(inject(ctx), desc, cc, method, callOpts...)
+		}
+		ctx, span := c.tracer().Start(ctx, spanName(method),
+			oteltrace.WithSpanKind(oteltrace.SpanKindClient),
+			oteltrace.WithAttributes(methodAttrs(method)...),
+		)
+
+		stream, err := streamer(inject(ctx), desc, cc, method, callOpts...)
+		if err != nil {
+			setStatus(span, err)
+			span.End()
+			return nil, err
+		}
+		return &clientStream{
+			ClientStream: stream,
+			recorder:     newRecorder(c, method, span),
+			unaryReply:   !desc.ServerStreams,
+		}, nil
+	}
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	*recorder
+	unaryReply bool
+}
+
+func (s *clientStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.addInput(m)
+	} else if !errors.Is(err, io.EOF) {
+		// io.EOF means the stream failed, and RecvMsg returns the error
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case errors.Is(err, io.EOF):
+		s.finish(nil)
+	case err != nil:
+		s.finish(err)
+	default:
+		s.addOutput(m)
+		if s.unaryReply {
+			s.finish(nil)
+		}
+	}
+	return err
+}
+
+// UnaryServerInterceptor returns an interceptor that continues the trace of unary
+// calls, and records a server span.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	c := newConfig(opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx = extract(ctx)
+		if !c.filter(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		ctx, span := c.tracer().Start(ctx, spanName(info.FullMethod),
+			oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+			oteltrace.WithAttributes(methodAttrs(info.FullMethod)...),
+		)
+		defer span.End()
+
+		resp, err := handler(ctx, req)
+		if c.messages {
+			setMessage(span, trace.SetInput, c.message(info.FullMethod, req))
+			if err == nil {
+				setMessage(span, trace.SetOutput, c.message(info.FullMethod, resp))
+			}
+		}
+		setStatus(span, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that continues the trace of
+// streaming calls, and records a server span.
+func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	c := newConfig(opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := extract(ss.Context())
+		if !c.filter(info.FullMethod) {
+			return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		}
+		ctx, span := c.tracer().Start(ctx, spanName(info.FullMethod),
+			oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+			oteltrace.WithAttributes(methodAttrs(info.FullMethod)...),
+		)
+
+		stream := &serverStream{ServerStream: ss, ctx: ctx, recorder: newRecorder(c, info.FullMethod, span)}
+		err := handler(srv, stream)
+		stream.finish(err)
+		return err
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	*recorder
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil && s.recorder != nil {
+		s.addOutput(m)
+	}
+	return err
+}
+
+func (s *serverStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil && s.recorder != nil {
+		s.addInput(m)
+	}
+	return err
+}
+
+// recorder collects the messages of a stream, and ends its span once.
+type recorder struct {
+	config config
+	method string
+	span   oteltrace.Span
+
+	mu      sync.Mutex
+	inputs  []any
+	outputs []any
+	done    bool
+}
+
+func newRecorder(c config, method string, span oteltrace.Span) *recorder {
+	return &recorder{config: c, method: method, span: span}
+}
+
+func (r *recorder) addInput(m any) {
+	if !r.config.messages {
+		return
+	}
+	msg := r.config.message(r.method, m)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inputs = append(r.inputs, msg)
+}
+
+func (r *recorder) addOutput(m any) {
+	if !r.config.messages {
+		return
+	}
+	msg := r.config.message(r.method, m)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outputs = append(r.outputs, msg)
+}
+
+func (r *recorder) finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.done = true
+	if r.config.messages {
+		if len(r.inputs) > 0 {
+			setMessage(r.span, trace.SetInput, r.inputs)
+		}
+		if len(r.outputs) > 0 {
+			setMessage(r.span, trace.SetOutput, r.outputs)
+		}
+	}
+	setStatus(r.span, err)
+	r.span.End()
+}
+
+// inject adds the trace context, baggage and Braintrust parent of ctx to its outgoing
+// metadata.
+func inject(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	Propagator.Inject(ctx, metadataCarrier(md))
+	if ok, parent := trace.GetParent(ctx); ok {
+		md.Set(ParentMetadataKey, parent.String())
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// extract returns ctx with the trace context, baggage and Braintrust parent of its
+// incoming metadata.
+func extract(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	ctx = Propagator.Extract(ctx, metadataCarrier(md))
+	if values := md.Get(ParentMetadataKey); len(values) > 0 {
+		parent, err := trace.ParseParent(values[0])
+		if err != nil {
+			log.Warnf("tracegrpc: ignoring invalid %s metadata: %v", ParentMetadataKey, err)
+		} else {
+			return trace.SetParent(ctx, parent)
+		}
+	}
+	if ok, parent := trace.GetParent(ctx); ok {
+		ctx = trace.SetParent(ctx, parent)
+	}
+	return ctx
+}
+
+// metadataCarrier adapts gRPC metadata to a propagation.TextMapCarrier.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// spanName returns the name of a method's spans, like "grpc.health.v1.Health/Check".
+func spanName(method string) string {
+	return strings.TrimPrefix(method, "/")
+}
+
+func methodAttrs(method string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String("rpc.system", "grpc")}
+	service, name, ok := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	if ok {
+		attrs = append(attrs, attribute.String("rpc.service", service), attribute.String("rpc.method", name))
+	}
+	return attrs
+}
+
+func setMessage(span oteltrace.Span, set func(oteltrace.Span, any) error, msg any) {
+	if msg == nil {
+		return
+	}
+	if err := set(span, msg); err != nil {
+		log.Warnf("tracegrpc: failed to record message: %v", err)
+	}
+}
+
+func setStatus(span oteltrace.Span, err error) {
+	st, _ := status.FromError(err)
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(st.Code())))
+	if st.Code() != grpccodes.OK {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, st.Message())
+	}
+}
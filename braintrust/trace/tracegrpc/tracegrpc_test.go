@@ -0,0 +1,187 @@
+package tracegrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/oteltest"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace"
+)
+
+// healthServer records the Braintrust parent of calls.
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+	parents chan trace.Parent
+}
+
+func (s *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	_, parent := trace.GetParent(ctx)
+	s.parents <- parent
+	if req.Service == "missing" {
+		return nil, status.Error(grpccodes.NotFound, "unknown service")
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func (s *healthServer) Watch(req *healthpb.HealthCheckRequest, stream grpc.ServerStreamingServer[healthpb.HealthCheckResponse]) error {
+	_, parent := trace.GetParent(stream.Context())
+	s.parents <- parent
+	for _, st := range []healthpb.HealthCheckResponse_ServingStatus{healthpb.HealthCheckResponse_NOT_SERVING, healthpb.HealthCheckResponse_SERVING} {
+		if err := stream.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newTestClient starts an in-process server with the server interceptors, and returns
+// a client with the client interceptors.
+func newTestClient(t *testing.T, opts ...Option) (healthpb.HealthClient, *healthServer) {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(UnaryServerInterceptor(opts...)),
+		grpc.ChainStreamInterceptor(StreamServerInterceptor(opts...)),
+	)
+	health := &healthServer{parents: make(chan trace.Parent, 1)}
+	healthpb.RegisterHealthServer(server, health)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptor(opts...)),
+		grpc.WithChainStreamInterceptor(StreamClientInterceptor(opts...)),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return healthpb.NewHealthClient(conn), health
+}
+
+func spanOfKind(t *testing.T, spans []oteltest.Span, kind oteltrace.SpanKind) oteltest.Span {
+	t.Helper()
+	for _, span := range spans {
+		if span.Stub.SpanKind == kind {
+			return span
+		}
+	}
+	t.Fatalf("no span of kind %s", kind)
+	return oteltest.Span{}
+}
+
+func TestUnary(t *testing.T) {
+	tracer, exporter := oteltest.Setup(t)
+	client, health := newTestClient(t, WithMessages())
+
+	ctx := trace.SetParent(context.Background(), trace.Parent{Type: trace.ParentTypeProject, ID: "gateway"})
+	ctx, root := tracer.Start(ctx, "root")
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "chat"})
+	require.NoError(t, err)
+	root.End()
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	assert.Equal(t, trace.Parent{Type: trace.ParentTypeProject, ID: "gateway"}, <-health.parents)
+
+	spans := exporter.Flush()
+	require.Len(t, spans, 3)
+	serverSpan := spanOfKind(t, spans, oteltrace.SpanKindServer)
+	clientSpan := spanOfKind(t, spans, oteltrace.SpanKindClient)
+
+	// the server span is in the same trace, under the client span
+	assert.Equal(t, root.SpanContext().TraceID(), serverSpan.Stub.SpanContext.TraceID())
+	assert.Equal(t, clientSpan.Stub.SpanContext.SpanID(), serverSpan.Stub.Parent.SpanID())
+	for _, span := range spans {
+		span.AssertAttrEquals(trace.ParentOtelAttrKey, "project_name:gateway")
+	}
+
+	for _, span := range []oteltest.Span{serverSpan, clientSpan} {
+		span.AssertNameIs("grpc.health.v1.Health/Check")
+		span.AssertAttrEquals("rpc.system", "grpc")
+		span.AssertAttrEquals("rpc.service", "grpc.health.v1.Health")
+		span.AssertAttrEquals("rpc.method", "Check")
+		span.AssertAttrEquals("rpc.grpc.status_code", int64(0))
+		assert.Equal(t, map[string]any{"service": "chat"}, span.Input())
+		assert.Equal(t, map[string]any{"status": "SERVING"}, span.Output())
+	}
+}
+
+func TestUnary_Error(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+	client, health := newTestClient(t)
+
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "missing"})
+	assert.Equal(t, grpccodes.NotFound, status.Code(err))
+	<-health.parents
+
+	spans := exporter.Flush()
+	require.Len(t, spans, 2)
+	for _, span := range spans {
+		assert.Equal(t, codes.Error, span.Status().Code)
+		assert.Equal(t, "unknown service", span.Status().Description)
+		span.AssertAttrEquals("rpc.grpc.status_code", int64(grpccodes.NotFound))
+		assert.False(t, span.HasAttr("braintrust.input_json"), "messages aren't recorded by default")
+	}
+}
+
+func TestStream(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+	client, health := newTestClient(t, WithRedact(func(method string, msg any) any {
+		if _, ok := msg.(*healthpb.HealthCheckRequest); ok {
+			return &healthpb.HealthCheckRequest{Service: "[redacted from " + method + "]"}
+		}
+		return msg
+	}))
+
+	ctx := trace.SetParent(context.Background(), trace.Parent{Type: trace.ParentTypeProjectID, ID: "p1"})
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "secret"})
+	require.NoError(t, err)
+	var statuses []healthpb.HealthCheckResponse_ServingStatus
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		statuses = append(statuses, resp.Status)
+	}
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, "p1", (<-health.parents).ID)
+
+	spans := exporter.Flush()
+	require.Len(t, spans, 2)
+	for _, span := range spans {
+		span.AssertNameIs("grpc.health.v1.Health/Watch")
+		span.AssertAttrEquals(trace.ParentOtelAttrKey, "project_id:p1")
+		assert.Equal(t, codes.Unset, span.Status().Code)
+		assert.Equal(t, []any{map[string]any{"service": "[redacted from /grpc.health.v1.Health/Watch]"}}, span.Input())
+		assert.Equal(t, []any{map[string]any{"status": "NOT_SERVING"}, map[string]any{"status": "SERVING"}}, span.Output())
+	}
+	assert.Equal(t,
+		spanOfKind(t, spans, oteltrace.SpanKindClient).Stub.SpanContext.SpanID(),
+		spanOfKind(t, spans, oteltrace.SpanKindServer).Stub.Parent.SpanID())
+}
+
+func TestFilter(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+	client, health := newTestClient(t, WithFilter(func(method string) bool { return method != healthpb.Health_Check_FullMethodName }))
+
+	ctx := trace.SetParent(context.Background(), trace.Parent{Type: trace.ParentTypeProject, ID: "filtered"})
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "filtered", (<-health.parents).ID, "filtered calls still get the parent")
+	assert.Empty(t, exporter.Flush())
+}
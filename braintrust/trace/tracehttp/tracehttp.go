@@ -0,0 +1,245 @@
+// Package tracehttp propagates Braintrust traces between services over HTTP, so calls
+// between microservices land in the same Braintrust trace and project.
+//
+// Wrap your server's handler with Middleware. It reads the W3C trace context, the
+// baggage and the Braintrust parent from inbound requests, and starts a server span:
+//
+//	http.ListenAndServe(":8080", tracehttp.Middleware(mux))
+//
+// And send requests to other services with a client that uses Transport, which adds
+// them to outbound requests:
+//
+//	client := &http.Client{Transport: tracehttp.Transport(http.DefaultTransport)}
+//
+// The parent is sent in the baggage header, and in the x-bt-parent header for services
+// that don't read baggage. The metadata and tags of trace.ContextWithMetadata and
+// trace.ContextWithTags are sent in the baggage too.
+package tracehttp
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/log"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace"
+)
+
+// ParentHeader is the header that carries the Braintrust parent, e.g.
+// "project_name:my-project".
+const ParentHeader = "x-bt-parent"
+
+// Propagator reads and writes the W3C trace context and baggage headers.
+var Propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// Option configures Middleware and Transport.
+type Option func(*config)
+
+type config struct {
+	tracerProvider oteltrace.TracerProvider
+	spanName       func(r *http.Request) string
+	filter         func(r *http.Request) bool
+}
+
+// WithTracerProvider sets the tracer provider of the spans (default: the global one).
+func WithTracerProvider(tp oteltrace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithSpanName sets how spans are named (default: the method and path, like "GET /users").
+func WithSpanName(fn func(r *http.Request) string) Option {
+	return func(c *config) {
+		c.spanName = fn
+	}
+}
+
+// WithFilter sets which requests are traced. Other requests still have their context
+// propagated, but no span is started for them.
+func WithFilter(fn func(r *http.Request) bool) Option {
+	return func(c *config) {
+		c.filter = fn
+	}
+}
+
+func newConfig(opts []Option) config {
+	c := config{
+		spanName: func(r *http.Request) string { return r.Method + " " + r.URL.Path },
+		filter:   func(*http.Request) bool { return true },
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+func (c config) tracer() oteltrace.Tracer {
+	tp := c.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer("braintrust.http")
+}
+
+// Middleware returns a handler that continues the trace of inbound requests, and
+// records a server span for each one.
+func Middleware(next http.Handler, opts ...Option) http.Handler {
+	c := newConfig(opts)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := Extract(r)
+		if !c.filter(r) {
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		ctx, span := c.tracer().Start(ctx, c.spanName(r),
+			oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+			oteltrace.WithAttributes(requestAttrs(r)...),
+		)
+		defer span.End()
+
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			if v := recover(); v != nil {
+				span.SetStatus(codes.Error, "panic")
+				span.SetAttributes(attribute.Int("http.response.status_code", http.StatusInternalServerError))
+				panic(v)
+			}
+			span.SetAttributes(attribute.Int("http.response.status_code", rw.status))
+			if rw.status >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(rw.status))
+			}
+		}()
+		next.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+// Extract returns the request's context with the trace context, baggage and
+// Braintrust parent of its headers. Middleware calls it, so it's only needed by
+// servers that start their own spans.
+func Extract(r *http.Request) context.Context {
+	ctx := Propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	if value := r.Header.Get(ParentHeader); value != "" {
+		parent, err := trace.ParseParent(value)
+		if err != nil {
+			log.Warnf("tracehttp: ignoring invalid %s header: %v", ParentHeader, err)
+		} else {
+			return trace.SetParent(ctx, parent)
+		}
+	}
+	if ok, parent := trace.GetParent(ctx); ok {
+		// keep it as a context value, so it doesn't depend on the baggage from here on
+		ctx = trace.SetParent(ctx, parent)
+	}
+	return ctx
+}
+
+// Inject adds the trace context, baggage and Braintrust parent of ctx to the headers
+// of an outbound request. Transport calls it, so it's only needed by clients that
+// don't use it.
+func Inject(ctx context.Context, header http.Header) {
+	Propagator.Inject(ctx, propagation.HeaderCarrier(header))
+	if ok, parent := trace.GetParent(ctx); ok {
+		header.Set(ParentHeader, parent.String())
+	}
+}
+
+// Transport returns a round tripper that adds the trace context, baggage and
+// Braintrust parent of requests' contexts to their headers, and records a client span
+// for each request. If base is nil, http.DefaultTransport is used.
+func Transport(base http.RoundTripper, opts ...Option) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, config: newConfig(opts)}
+}
+
+type transport struct {
+	base   http.RoundTripper
+	config config
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+	var span oteltrace.Span
+	if t.config.filter(r) {
+		ctx, span = t.config.tracer().Start(ctx, t.config.spanName(r),
+			oteltrace.WithSpanKind(oteltrace.SpanKindClient),
+			oteltrace.WithAttributes(requestAttrs(r)...),
+		)
+		defer span.End()
+	}
+
+	// a round tripper must not modify the request
+	r = r.Clone(ctx)
+	Inject(ctx, r.Header)
+
+	resp, err := t.base.RoundTrip(r)
+	if span == nil {
+		return resp, err
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return resp, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
+
+func requestAttrs(r *http.Request) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("http.request.method", r.Method),
+		attribute.String("url.path", r.URL.Path),
+	}
+	if host := r.Host; host != "" {
+		attrs = append(attrs, attribute.String("server.address", host))
+	} else if r.URL.Host != "" {
+		attrs = append(attrs, attribute.String("server.address", r.URL.Host))
+	}
+	return attrs
+}
+
+// responseWriter records the status code of a response.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush supports streaming responses.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap supports http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
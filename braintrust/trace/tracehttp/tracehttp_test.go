@@ -0,0 +1,126 @@
+package tracehttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/oteltest"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace"
+)
+
+func TestPropagation(t *testing.T) {
+	tracer, exporter := oteltest.Setup(t)
+
+	var serverParent trace.Parent
+	var serverMetadata map[string]any
+	server := httptest.NewServer(Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, serverParent = trace.GetParent(r.Context())
+		serverMetadata = trace.MetadataFromContext(r.Context())
+		_, _ = io.WriteString(w, "ok")
+	})))
+	defer server.Close()
+
+	ctx := trace.SetParent(context.Background(), trace.Parent{Type: trace.ParentTypeProject, ID: "checkout"})
+	ctx = trace.ContextWithMetadata(ctx, map[string]any{"tenant": "acme"})
+	ctx, root := tracer.Start(ctx, "root")
+
+	client := &http.Client{Transport: Transport(nil)}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/users", nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	root.End()
+
+	assert.Equal(t, trace.Parent{Type: trace.ParentTypeProject, ID: "checkout"}, serverParent)
+	assert.Equal(t, map[string]any{"tenant": "acme"}, serverMetadata)
+
+	spans := exporter.Flush()
+	require.Len(t, spans, 3)
+	serverSpan, clientSpan, rootSpan := spans[0], spans[1], spans[2]
+
+	serverSpan.AssertNameIs("GET /users")
+	assert.Equal(t, oteltrace.SpanKindServer, serverSpan.Stub.SpanKind)
+	serverSpan.AssertAttrEquals("http.response.status_code", int64(200))
+	clientSpan.AssertNameIs("GET /users")
+	assert.Equal(t, oteltrace.SpanKindClient, clientSpan.Stub.SpanKind)
+
+	// the server span is in the same trace, under the client span
+	traceID := rootSpan.Stub.SpanContext.TraceID()
+	assert.Equal(t, traceID, clientSpan.Stub.SpanContext.TraceID())
+	assert.Equal(t, traceID, serverSpan.Stub.SpanContext.TraceID())
+	assert.Equal(t, clientSpan.Stub.SpanContext.SpanID(), serverSpan.Stub.Parent.SpanID())
+	assert.True(t, serverSpan.Stub.Parent.IsRemote())
+	for _, span := range spans {
+		span.AssertAttrEquals(trace.ParentOtelAttrKey, "project_name:checkout")
+	}
+}
+
+func TestMiddleware_ParentHeader(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/jobs", nil)
+	req.Header.Set(ParentHeader, "experiment_id:proj/exp-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	span := exporter.FlushOne()
+	span.AssertAttrEquals(trace.ParentOtelAttrKey, "experiment_id:proj/exp-1")
+	span.AssertAttrEquals("http.request.method", "POST")
+	span.AssertAttrEquals("http.response.status_code", int64(503))
+	assert.Equal(t, codes.Error, span.Status().Code)
+}
+
+func TestOptions(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	var parent trace.Parent
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, parent = trace.GetParent(r.Context())
+	}),
+		WithFilter(func(r *http.Request) bool { return r.URL.Path != "/healthz" }),
+		WithSpanName(func(r *http.Request) string { return "handle " + r.Method }),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set(ParentHeader, "project_name:p")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Empty(t, exporter.Flush())
+	assert.Equal(t, "p", parent.ID, "filtered requests still get the parent")
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+	span := exporter.FlushOne()
+	span.AssertNameIs("handle GET")
+}
+
+func TestTransport_Error(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	client := &http.Client{Transport: Transport(http.DefaultTransport)}
+	_, err := client.Get(server.URL)
+	require.Error(t, err)
+
+	span := exporter.FlushOne()
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.NotEmpty(t, span.Events())
+}
+
+func TestInject(t *testing.T) {
+	oteltest.Setup(t)
+	header := http.Header{}
+	Inject(trace.SetParent(context.Background(), trace.Parent{Type: trace.ParentTypeProjectID, ID: "123"}), header)
+	assert.Equal(t, "project_id:123", header.Get(ParentHeader))
+	assert.Contains(t, header.Get("baggage"), "braintrust.parent=project_id:123")
+}
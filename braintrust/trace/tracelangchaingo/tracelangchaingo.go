@@ -278,7 +278,7 @@ func (h *Handler) HandleLLMGenerateContentEnd(ctx context.Context, res *llms.Con
 			// Extract metadata and metrics from the first choice
 			if i == 0 && choice.GenerationInfo != nil {
 				metadata = h.extractMetadata(span, choice.GenerationInfo, choice.StopReason)
-				h.extractMetrics(span, choice.GenerationInfo)
+				h.extractMetrics(span, choice.GenerationInfo, internal.ModelName(metadata))
 			}
 		}
 
@@ -382,8 +382,9 @@ func (h *Handler) extractMetadata(span trace.Span, genInfo map[string]any, stopR
 	return metadata
 }
 
-// extractMetrics attempts to extract token usage metrics from generation info with multiple fallback strategies
-func (h *Handler) extractMetrics(span trace.Span, genInfo map[string]any) {
+// extractMetrics attempts to extract token usage metrics from generation info with multiple fallback strategies,
+// and estimates their cost if the model has a price
+func (h *Handler) extractMetrics(span trace.Span, genInfo map[string]any, model string) {
 	metrics := make(map[string]int64)
 
 	// Strategy 1: Look for nested "usage" object (most common)
@@ -417,7 +418,7 @@ func (h *Handler) extractMetrics(span trace.Span, genInfo map[string]any) {
 
 	// Only set metrics if we found any
 	if len(metrics) > 0 {
-		if err := internal.SetJSONAttr(span, "braintrust.metrics", metrics); err != nil {
+		if err := internal.SetUsageMetrics(span, model, metrics); err != nil {
 			span.RecordError(err)
 		}
 	}
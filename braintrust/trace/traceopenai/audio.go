@@ -0,0 +1,276 @@
+package traceopenai
+
+// this file parses the audio API.
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/internal"
+)
+
+// speechTracer is a tracer for the openai v1/audio/speech POST endpoint. The generated
+// audio is logged as an attachment.
+// See docs here: https://platform.openai.com/docs/api-reference/audio/createSpeech
+type speechTracer struct {
+	streaming bool
+	metadata  map[string]any
+}
+
+func newSpeechTracer() *speechTracer {
+	return &speechTracer{
+		metadata: map[string]any{
+			"provider": "openai",
+			"endpoint": "/v1/audio/speech",
+		},
+	}
+}
+
+func (st *speechTracer) StartSpan(ctx context.Context, t time.Time, request io.Reader) (context.Context, trace.Span, error) {
+	ctx, span := tracer().Start(
+		ctx,
+		"openai.audio.speech.create",
+		trace.WithTimestamp(t),
+	)
+
+	var raw map[string]any
+	if err := json.NewDecoder(request).Decode(&raw); err != nil {
+		return ctx, span, err
+	}
+
+	for _, field := range []string{"model", "voice", "instructions", "response_format", "speed", "stream_format"} {
+		if value, exists := raw[field]; exists {
+			st.metadata[field] = value
+		}
+	}
+	st.streaming = raw["stream_format"] == "sse"
+
+	if input, ok := raw["input"]; ok {
+		if err := internal.SetJSONAttr(span, "braintrust.input_json", input); err != nil {
+			return ctx, span, err
+		}
+	}
+
+	if err := internal.SetJSONAttr(span, "braintrust.metadata", st.metadata); err != nil {
+		return ctx, span, err
+	}
+
+	return ctx, span, nil
+}
+
+func (st *speechTracer) TagSpan(span trace.Span, body io.Reader) error {
+	var audio []byte
+	if st.streaming {
+		err := internal.ReadEvents(body, func(event map[string]any) error {
+			switch event["type"] {
+			case "speech.audio.delta":
+				delta, _ := event["audio"].(string)
+				data, err := base64.StdEncoding.DecodeString(delta)
+				if err != nil {
+					return err
+				}
+				audio = append(audio, data...)
+			case "speech.audio.done":
+				if usage, ok := event["usage"].(map[string]any); ok {
+					metrics := parseUsageTokens(usage)
+					return internal.SetUsageMetrics(span, internal.ModelName(st.metadata), metrics)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if audio, err = io.ReadAll(body); err != nil {
+			return err
+		}
+		// errors are JSON, not audio
+		if bytes.HasPrefix(audio, []byte("{")) && json.Valid(audio) {
+			return nil
+		}
+	}
+
+	att, err := newAttachment(speechContentType(st.metadata["response_format"]), audio)
+	if err != nil {
+		return err
+	}
+	return internal.SetJSONAttr(span, "braintrust.output_json", att)
+}
+
+// speechContentType returns the content type of a speech response format. The default
+// is mp3.
+func speechContentType(format any) string {
+	switch format {
+	case "opus":
+		return "audio/opus"
+	case "aac":
+		return "audio/aac"
+	case "flac":
+		return "audio/flac"
+	case "wav":
+		return "audio/wav"
+	case "pcm":
+		return "audio/pcm"
+	default:
+		return "audio/mpeg"
+	}
+}
+
+// transcriptionsTracer is a tracer for the openai v1/audio/transcriptions and
+// v1/audio/translations POST endpoints, which take multipart forms. The audio file is
+// logged as an attachment.
+// See docs here: https://platform.openai.com/docs/api-reference/audio/createTranscription
+type transcriptionsTracer struct {
+	name      string
+	header    http.Header
+	streaming bool
+	metadata  map[string]any
+}
+
+func newTranscriptionsTracer(name, endpoint string) *transcriptionsTracer {
+	return &transcriptionsTracer{
+		name: name,
+		metadata: map[string]any{
+			"provider": "openai",
+			"endpoint": endpoint,
+		},
+	}
+}
+
+func (tt *transcriptionsTracer) SetRequestHeader(header http.Header) {
+	tt.header = header
+}
+
+func (tt *transcriptionsTracer) StartSpan(ctx context.Context, t time.Time, request io.Reader) (context.Context, trace.Span, error) {
+	ctx, span := tracer().Start(
+		ctx,
+		tt.name,
+		trace.WithTimestamp(t),
+	)
+
+	form, err := parseForm(tt.header, request)
+	if err != nil {
+		return ctx, span, err
+	}
+
+	metadataFields := []string{
+		"model",
+		"language",
+		"response_format",
+		"temperature",
+		"timestamp_granularities",
+		"include",
+		"chunking_strategy",
+		"stream",
+	}
+	for _, field := range metadataFields {
+		if value, exists := form.values[field]; exists {
+			tt.metadata[field] = value
+		}
+	}
+	tt.streaming = form.values["stream"] == "true"
+
+	input := map[string]any{}
+	if files := form.files["file"]; len(files) > 0 {
+		file, err := files[0].attachment()
+		if err != nil {
+			return ctx, span, err
+		}
+		input["file"] = file
+	}
+	if prompt, ok := form.values["prompt"]; ok {
+		input["prompt"] = prompt
+	}
+	if err := internal.SetJSONAttr(span, "braintrust.input_json", input); err != nil {
+		return ctx, span, err
+	}
+
+	if err := internal.SetJSONAttr(span, "braintrust.metadata", tt.metadata); err != nil {
+		return ctx, span, err
+	}
+
+	return ctx, span, nil
+}
+
+func (tt *transcriptionsTracer) TagSpan(span trace.Span, body io.Reader) error {
+	var text string
+	var usage map[string]any
+	var duration float64
+
+	switch {
+	case tt.streaming:
+		err := internal.ReadEvents(body, func(event map[string]any) error {
+			switch event["type"] {
+			case "transcript.text.delta":
+				delta, _ := event["delta"].(string)
+				text += delta
+			case "transcript.text.done":
+				text, _ = event["text"].(string)
+				usage, _ = event["usage"].(map[string]any)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	case tt.metadata["response_format"] == "text" || tt.metadata["response_format"] == "srt" || tt.metadata["response_format"] == "vtt":
+		b, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		text = string(b)
+	default:
+		var raw struct {
+			Text     string         `json:"text"`
+			Language string         `json:"language"`
+			Duration float64        `json:"duration"`
+			Usage    map[string]any `json:"usage"`
+		}
+		if err := json.NewDecoder(body).Decode(&raw); err != nil {
+			return err
+		}
+		text, usage, duration = raw.Text, raw.Usage, raw.Duration
+		if raw.Language != "" {
+			tt.metadata["language"] = raw.Language
+			if err := internal.SetJSONAttr(span, "braintrust.metadata", tt.metadata); err != nil {
+				return err
+			}
+		}
+	}
+
+	if metrics := audioUsageMetrics(usage, duration); len(metrics) > 0 {
+		if err := internal.SetUsageMetrics(span, internal.ModelName(tt.metadata), metrics); err != nil {
+			return err
+		}
+	}
+
+	return internal.SetJSONAttr(span, "braintrust.output_json", text)
+}
+
+// audioUsageMetrics returns the metrics of a transcription: its tokens, for models
+// billed by tokens, and the duration of its audio in audio_seconds, rounded up to whole
+// seconds like OpenAI bills them, for models billed by duration.
+func audioUsageMetrics(usage map[string]any, duration float64) map[string]int64 {
+	metrics := map[string]int64{}
+	if usage["type"] == "duration" {
+		if seconds, ok := usage["seconds"].(float64); ok {
+			duration = seconds
+		}
+	} else if usage != nil {
+		metrics = parseUsageTokens(usage)
+	}
+	if duration > 0 {
+		metrics["audio_seconds"] = int64(math.Ceil(duration))
+	}
+	return metrics
+}
@@ -0,0 +1,151 @@
+package traceopenai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/oteltest"
+)
+
+var fakeWAV = []byte("RIFF\x00\x00\x00\x00WAVEfake audio")
+
+func TestAudioTranscriptions(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	client := newFakeClient("application/json", `{"task": "transcribe", "language": "english", "duration": 2.3, "text": "Hello there."}`)
+	resp, err := client.Audio.Transcriptions.New(context.Background(), openai.AudioTranscriptionNewParams{
+		File:           openai.File(bytes.NewReader(fakeWAV), "hello.wav", ""),
+		Model:          openai.AudioModelWhisper1,
+		Prompt:         openai.String("A greeting."),
+		ResponseFormat: openai.AudioResponseFormatVerboseJSON,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello there.", resp.Text)
+
+	span := exporter.FlushOne()
+	span.AssertNameIs("openai.audio.transcriptions.create")
+	assert.Equal(t, map[string]any{
+		"file":   base64Attachment("audio/wav", fakeWAV),
+		"prompt": "A greeting.",
+	}, span.Input())
+	assert.Equal(t, "Hello there.", span.Output())
+	metadata := span.Metadata()
+	assert.Equal(t, "whisper-1", metadata["model"])
+	assert.Equal(t, "verbose_json", metadata["response_format"])
+	assert.Equal(t, "english", metadata["language"])
+	assert.Equal(t, float64(3), span.Metrics()["audio_seconds"])
+}
+
+func TestAudioTranscriptions_Streaming(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	client := newFakeClient("text/event-stream", `data: {"type": "transcript.text.delta", "delta": "Hello"}
+
+data: {"type": "transcript.text.delta", "delta": " there."}
+
+data: {"type": "transcript.text.done", "text": "Hello there.", "usage": {"type": "tokens", "input_tokens": 14, "input_token_details": {"text_tokens": 0, "audio_tokens": 14}, "output_tokens": 4, "total_tokens": 18}}
+
+`)
+	stream := client.Audio.Transcriptions.NewStreaming(context.Background(), openai.AudioTranscriptionNewParams{
+		File:  openai.File(bytes.NewReader(fakeWAV), "hello.wav", "audio/wav"),
+		Model: openai.AudioModelGPT4oTranscribe,
+	})
+	for stream.Next() {
+	}
+	require.NoError(t, stream.Err())
+	require.NoError(t, stream.Close())
+
+	span := exporter.FlushOne()
+	assert.Equal(t, "Hello there.", span.Output())
+	assert.Equal(t, "true", span.Metadata()["stream"])
+	metrics := span.Metrics()
+	assert.Equal(t, float64(14), metrics["prompt_tokens"])
+	assert.Equal(t, float64(14), metrics["prompt_audio_tokens"])
+	assert.Equal(t, float64(4), metrics["completion_tokens"])
+	assert.NotContains(t, metrics, "audio_seconds")
+}
+
+func TestAudioTranslations(t *testing.T) {
+	tracer, exporter := oteltest.Setup(t)
+
+	client := newFakeClient("application/json", `{"text": "Hello there."}`)
+	_, err := client.Audio.Translations.New(context.Background(), openai.AudioTranslationNewParams{
+		File:  openai.File(bytes.NewReader(fakeWAV), "hola.wav", ""),
+		Model: openai.AudioModelWhisper1,
+	})
+	require.NoError(t, err)
+
+	span := exporter.FlushOne()
+	span.AssertNameIs("openai.audio.translations.create")
+	assert.Equal(t, "Hello there.", span.Output())
+	assert.False(t, span.HasAttr("braintrust.metrics"))
+
+	// text formats are recorded as they are
+	tt := newTranscriptionsTracer("translations", "/v1/audio/translations")
+	tt.metadata["response_format"] = "srt"
+	_, textSpan := tracer.Start(context.Background(), "translations")
+	require.NoError(t, tt.TagSpan(textSpan, strings.NewReader("1\n00:00:00,000 --> 00:00:01,000\nHello there.\n")))
+	textSpan.End()
+	span = exporter.FlushOne()
+	assert.Equal(t, "1\n00:00:00,000 --> 00:00:01,000\nHello there.\n", span.Output())
+}
+
+func TestAudioSpeech(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	client := newFakeClient("audio/wav", string(fakeWAV))
+	resp, err := client.Audio.Speech.New(context.Background(), openai.AudioSpeechNewParams{
+		Input:          "Hello there.",
+		Model:          openai.SpeechModelTTS1,
+		Voice:          openai.AudioSpeechNewParamsVoiceAlloy,
+		ResponseFormat: openai.AudioSpeechNewParamsResponseFormatWAV,
+	})
+	require.NoError(t, err)
+	audio, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, fakeWAV, audio)
+
+	span := exporter.FlushOne()
+	span.AssertNameIs("openai.audio.speech.create")
+	assert.Equal(t, "Hello there.", span.Input())
+	assert.Equal(t, base64Attachment("audio/wav", fakeWAV), span.Output())
+	metadata := span.Metadata()
+	assert.Equal(t, "tts-1", metadata["model"])
+	assert.Equal(t, "alloy", metadata["voice"])
+}
+
+func TestAudioSpeech_Streaming(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	client := newFakeClient("text/event-stream", `data: {"type": "speech.audio.delta", "audio": "`+base64.StdEncoding.EncodeToString(fakeWAV[:4])+`"}
+
+data: {"type": "speech.audio.delta", "audio": "`+base64.StdEncoding.EncodeToString(fakeWAV[4:])+`"}
+
+data: {"type": "speech.audio.done", "usage": {"input_tokens": 5, "output_tokens": 80, "total_tokens": 85}}
+
+`)
+	resp, err := client.Audio.Speech.New(context.Background(), openai.AudioSpeechNewParams{
+		Input:          "Hello there.",
+		Model:          openai.SpeechModelGPT4oMiniTTS,
+		Voice:          openai.AudioSpeechNewParamsVoiceAlloy,
+		ResponseFormat: openai.AudioSpeechNewParamsResponseFormatWAV,
+		StreamFormat:   openai.AudioSpeechNewParamsStreamFormatSSE,
+	})
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	span := exporter.FlushOne()
+	assert.Equal(t, base64Attachment("audio/wav", fakeWAV), span.Output())
+	assert.Equal(t, float64(85), span.Metrics()["tokens"])
+}
@@ -0,0 +1,217 @@
+package traceopenai
+
+// this file traces the requests of jobs of the Batch API, which aren't sent through
+// the client, from the job's files.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/log"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/internal"
+)
+
+// Batch is a finished job of the OpenAI Batch API, with the contents of its files.
+// See docs here: https://platform.openai.com/docs/api-reference/batch
+type Batch struct {
+	// ID is the batch's ID, like "batch_abc123".
+	ID string
+	// Input is the batch's input file, with a request per line. It's required.
+	Input io.Reader
+	// Output is the batch's output file, with a result per line.
+	Output io.Reader
+	// Errors is the batch's error file, if it has one.
+	Errors io.Reader
+	// CreatedAt and CompletedAt are the start and end of the batch's spans. Zero means
+	// the time TraceBatch is called.
+	CreatedAt   time.Time
+	CompletedAt time.Time
+}
+
+// batchRequest is a line of a batch's input file.
+type batchRequest struct {
+	CustomID string          `json:"custom_id"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// batchResult is a line of a batch's output or error file.
+type batchResult struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// batchTracer is a tracer of an endpoint supported by the Batch API.
+type batchTracer interface {
+	internal.MiddlewareTracer
+	// setMetadata adds metadata to the span, before it's started.
+	setMetadata(key string, value any)
+}
+
+// batchToolTracer is a batchTracer whose responses can have tool calls. The results of
+// tool calls of batches aren't sent through this process, so their tool spans start
+// and end at the batch's end instead of waiting for them.
+type batchToolTracer interface {
+	setBatchEnd(end time.Time)
+}
+
+func (ct *chatCompletionsTracer) setBatchEnd(end time.Time) { ct.batchEnd = end }
+
+func (ct *chatCompletionsTracer) setMetadata(key string, value any) { ct.metadata[key] = value }
+func (ct *completionsTracer) setMetadata(key string, value any)     { ct.metadata[key] = value }
+func (rt *responsesTracer) setMetadata(key string, value any)       { rt.metadata[key] = value }
+func (et *embeddingsTracer) setMetadata(key string, value any)      { et.metadata[key] = value }
+func (mt *moderationsTracer) setMetadata(key string, value any)     { mt.metadata[key] = value }
+
+// TraceBatch creates a span for every request of a finished batch, like the ones of
+// requests sent through the Middleware, from the batch's input and results. They're
+// children of an "openai.batch" span, and have the batch_id and the custom_id of their
+// request in their metadata. Requests that failed, or have no result because the
+// batch expired or was cancelled, have an error status.
+//
+// Example:
+//
+//	batch, err := client.Batches.Get(ctx, batchID)
+//	...
+//	input, err := client.Files.Content(ctx, batch.InputFileID)
+//	...
+//	output, err := client.Files.Content(ctx, batch.OutputFileID)
+//	...
+//	err = traceopenai.TraceBatch(ctx, traceopenai.Batch{
+//		ID:          batch.ID,
+//		Input:       input.Body,
+//		Output:      output.Body,
+//		CreatedAt:   time.Unix(batch.CreatedAt, 0),
+//		CompletedAt: time.Unix(batch.CompletedAt, 0),
+//	})
+func TraceBatch(ctx context.Context, batch Batch) error {
+	if batch.Input == nil {
+		return fmt.Errorf("invalid batch input: no input file")
+	}
+
+	now := time.Now()
+	start, end := batch.CreatedAt, batch.CompletedAt
+	if start.IsZero() {
+		start = now
+	}
+	if end.IsZero() {
+		end = now
+	}
+
+	results := map[string]batchResult{}
+	for _, file := range []io.Reader{batch.Output, batch.Errors} {
+		if file == nil {
+			continue
+		}
+		err := decodeLines(file, func(result batchResult) {
+			results[result.CustomID] = result
+		})
+		if err != nil {
+			return fmt.Errorf("invalid batch results: %w", err)
+		}
+	}
+
+	ctx, span := tracer().Start(ctx, "openai.batch", trace.WithTimestamp(start))
+	var requests, failed int
+	err := decodeLines(batch.Input, func(req batchRequest) {
+		requests++
+		result, ok := results[req.CustomID]
+		if !traceBatchRequest(ctx, batch.ID, req, result, ok, start, end) {
+			failed++
+		}
+	})
+	if err != nil {
+		err = fmt.Errorf("invalid batch input: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	metadata := map[string]any{
+		"provider":        "openai",
+		"batch_id":        batch.ID,
+		"requests":        requests,
+		"failed_requests": failed,
+	}
+	if merr := internal.SetJSONAttr(span, "braintrust.metadata", metadata); merr != nil {
+		log.Warnf("traceopenai: %v", merr)
+	}
+	span.End(trace.WithTimestamp(end))
+	return err
+}
+
+// traceBatchRequest creates the span of a request of a batch, and returns whether the
+// request succeeded.
+func traceBatchRequest(ctx context.Context, batchID string, req batchRequest, result batchResult, ok bool, start, end time.Time) bool {
+	mt, supported := openaiRouter(req.URL).(batchTracer)
+	if !supported {
+		log.Warnf("traceopenai: batch %s: unsupported endpoint %s", batchID, req.URL)
+		return false
+	}
+	mt.setMetadata("batch_id", batchID)
+	mt.setMetadata("custom_id", req.CustomID)
+	if tt, ok := mt.(batchToolTracer); ok {
+		tt.setBatchEnd(end)
+	}
+	_, span, err := mt.StartSpan(ctx, start, bytes.NewReader(req.Body))
+	if err != nil {
+		log.Warnf("traceopenai: error starting span of batch request %s: %v", req.CustomID, err)
+	}
+	defer span.End(trace.WithTimestamp(end))
+
+	var failure string
+	switch {
+	case !ok || (result.Response == nil && result.Error == nil):
+		failure = "the request has no result"
+	case result.Error != nil:
+		failure = result.Error.Message
+	case result.Response.StatusCode >= 400:
+		var body struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		failure = fmt.Sprintf("status %d", result.Response.StatusCode)
+		if json.Unmarshal(result.Response.Body, &body) == nil && body.Error.Message != "" {
+			failure = body.Error.Message
+		}
+	default:
+		if err := mt.TagSpan(span, bytes.NewReader(result.Response.Body)); err != nil {
+			log.Warnf("traceopenai: error tagging span of batch request %s: %v", req.CustomID, err)
+		}
+		return true
+	}
+
+	err = errors.New(failure)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, failure)
+	return false
+}
+
+// decodeLines calls fn with every JSON value of a JSON lines file.
+func decodeLines[T any](r io.Reader, fn func(T)) error {
+	dec := json.NewDecoder(r)
+	for {
+		var v T
+		err := dec.Decode(&v)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(v)
+	}
+}
@@ -0,0 +1,142 @@
+package traceopenai
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/oteltest"
+)
+
+func TestTraceBatch(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	input := `{"custom_id": "req-1", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "gpt-4o-mini", "messages": [{"role": "user", "content": "Hello"}]}}
+{"custom_id": "req-2", "method": "POST", "url": "/v1/embeddings", "body": {"model": "text-embedding-3-small", "input": "Hello"}}
+{"custom_id": "req-3", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "gpt-4o-mini", "messages": [{"role": "user", "content": "Bad"}]}}
+{"custom_id": "req-4", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "gpt-4o-mini", "messages": [{"role": "user", "content": "Late"}]}}
+`
+	// results are in any order
+	output := `{"id": "r2", "custom_id": "req-2", "response": {"status_code": 200, "request_id": "a", "body": {"data": [{"embedding": [0.1, 0.2]}], "usage": {"prompt_tokens": 1, "total_tokens": 1}}}, "error": null}
+{"id": "r1", "custom_id": "req-1", "response": {"status_code": 200, "request_id": "b", "body": {"id": "chatcmpl-1", "choices": [{"index": 0, "message": {"role": "assistant", "content": "Hi!"}, "finish_reason": "stop"}], "usage": {"prompt_tokens": 8, "completion_tokens": 2, "total_tokens": 10}}}, "error": null}
+`
+	errors := `{"id": "r3", "custom_id": "req-3", "response": {"status_code": 400, "request_id": "c", "body": {"error": {"message": "Invalid request"}}}, "error": null}
+`
+	created := time.Unix(1711471533, 0)
+	completed := created.Add(time.Hour)
+	err := TraceBatch(context.Background(), Batch{
+		ID:          "batch_1",
+		Input:       strings.NewReader(input),
+		Output:      strings.NewReader(output),
+		Errors:      strings.NewReader(errors),
+		CreatedAt:   created,
+		CompletedAt: completed,
+	})
+	require.NoError(t, err)
+
+	spans := exporter.Flush()
+	require.Len(t, spans, 5)
+	byID := map[string]oteltest.Span{}
+	var batchSpan oteltest.Span
+	for _, span := range spans {
+		if span.Stub.Name == "openai.batch" {
+			batchSpan = span
+			continue
+		}
+		byID[span.Metadata()["custom_id"].(string)] = span
+	}
+
+	batchSpan.AssertNameIs("openai.batch")
+	assert.Equal(t, map[string]any{
+		"provider":        "openai",
+		"batch_id":        "batch_1",
+		"requests":        float64(4),
+		"failed_requests": float64(2),
+	}, batchSpan.Metadata())
+	assert.Equal(t, created, batchSpan.Stub.StartTime)
+	assert.Equal(t, completed, batchSpan.Stub.EndTime)
+
+	for id, span := range byID {
+		assert.Equal(t, batchSpan.Stub.SpanContext.SpanID(), span.Stub.Parent.SpanID(), id)
+		assert.Equal(t, "batch_1", span.Metadata()["batch_id"], id)
+		assert.Equal(t, created, span.Stub.StartTime, id)
+	}
+
+	chat := byID["req-1"]
+	chat.AssertNameIs("openai.chat.completions.create")
+	assert.Equal(t, codes.Unset, chat.Status().Code)
+	assert.Equal(t, "chatcmpl-1", chat.Metadata()["id"])
+	assert.Equal(t, float64(10), chat.Metrics()["tokens"])
+	assert.Contains(t, chat.Metrics(), "estimated_cost")
+
+	embedding := byID["req-2"]
+	embedding.AssertNameIs("openai.embeddings.create")
+	assert.Equal(t, map[string]any{"embeddings": float64(1), "dimensions": float64(2)}, embedding.Output())
+
+	failed := byID["req-3"]
+	assert.Equal(t, codes.Error, failed.Status().Code)
+	assert.Equal(t, "Invalid request", failed.Status().Description)
+
+	missing := byID["req-4"]
+	assert.Equal(t, codes.Error, missing.Status().Code)
+	assert.Equal(t, "the request has no result", missing.Status().Description)
+}
+
+func TestTraceBatch_ToolCalls(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	input := `{"custom_id": "req-1", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "gpt-4o-mini", "messages": [{"role": "user", "content": "Weather?"}]}}
+`
+	output := `{"id": "r1", "custom_id": "req-1", "response": {"status_code": 200, "request_id": "a", "body": {"id": "chatcmpl-1", "choices": [{"index": 0, "message": {"role": "assistant", "tool_calls": [{"id": "call_batch", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]}, "finish_reason": "tool_calls"}]}}, "error": null}
+`
+	created := time.Unix(1711471533, 0)
+	completed := created.Add(time.Hour)
+	err := TraceBatch(context.Background(), Batch{
+		ID:          "batch_1",
+		Input:       strings.NewReader(input),
+		Output:      strings.NewReader(output),
+		CreatedAt:   created,
+		CompletedAt: completed,
+	})
+	require.NoError(t, err)
+
+	// the results of batch tool calls aren't sent through this process, so their spans
+	// end at the batch's end without an output, instead of waiting for them
+	spans := exporter.Flush()
+	require.Len(t, spans, 3)
+	var tool oteltest.Span
+	for _, span := range spans {
+		if span.Stub.Name == "get_weather" {
+			tool = span
+		}
+	}
+	require.Equal(t, "get_weather", tool.Stub.Name)
+	assert.Equal(t, completed, tool.Stub.StartTime)
+	assert.Equal(t, completed, tool.Stub.EndTime)
+	assert.Equal(t, map[string]any{"city": "Paris"}, tool.Input())
+	for _, attr := range tool.Stub.Attributes {
+		assert.NotEqual(t, "braintrust.output_json", string(attr.Key))
+	}
+}
+
+func TestTraceBatch_InvalidFiles(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	err := TraceBatch(context.Background(), Batch{ID: "batch_1", Output: strings.NewReader("{}")})
+	assert.ErrorContains(t, err, "no input file")
+	assert.Empty(t, exporter.Flush())
+
+	err = TraceBatch(context.Background(), Batch{ID: "batch_2", Input: strings.NewReader("{}"), Output: strings.NewReader("not json")})
+	assert.ErrorContains(t, err, "invalid batch results")
+	assert.Empty(t, exporter.Flush())
+
+	err = TraceBatch(context.Background(), Batch{ID: "batch_3", Input: strings.NewReader("not json")})
+	assert.ErrorContains(t, err, "invalid batch input")
+	span := exporter.FlushOne()
+	assert.Equal(t, codes.Error, span.Status().Code)
+}
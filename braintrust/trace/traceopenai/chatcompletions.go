@@ -13,6 +13,7 @@ import (
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/internal"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/tokenizer"
 )
 
 // chatCompletionsTracer is a tracer for the openai v1/chat/completions POST endpoint.
@@ -20,6 +21,15 @@ import (
 type chatCompletionsTracer struct {
 	streaming bool
 	metadata  map[string]any
+	// messages are the request's messages, to estimate its prompt tokens if the
+	// response has no usage.
+	messages []any
+	// parent is the context the span was started with, to start the spans of the
+	// response's tool calls.
+	parent context.Context
+	// batchEnd is the end of the batch of the request, if it's part of one.
+	batchEnd time.Time
+	internal.StreamTiming
 }
 
 func newChatCompletionsTracer() *chatCompletionsTracer {
@@ -33,6 +43,7 @@ func newChatCompletionsTracer() *chatCompletionsTracer {
 }
 
 func (ct *chatCompletionsTracer) StartSpan(ctx context.Context, t time.Time, request io.Reader) (context.Context, trace.Span, error) {
+	ct.parent = ctx
 	ctx, span := tracer().Start(
 		ctx,
 		"openai.chat.completions.create",
@@ -83,9 +94,15 @@ func (ct *chatCompletionsTracer) StartSpan(ctx context.Context, t time.Time, req
 	}
 
 	if messages, ok := raw["messages"]; ok {
+		ct.messages, _ = messages.([]any)
 		if err := internal.SetJSONAttr(span, "braintrust.input_json", messages); err != nil {
 			return ctx, span, err
 		}
+		if ct.batchEnd.IsZero() {
+			if err := internal.EndToolSpans(span, t, toolResults(ct.messages)); err != nil {
+				return ctx, span, err
+			}
+		}
 	}
 
 	if err := internal.SetJSONAttr(span, "braintrust.metadata", ct.metadata); err != nil {
@@ -106,12 +123,15 @@ func (ct *chatCompletionsTracer) parseStreamingResponse(span trace.Span, body io
 	scanner := bufio.NewScanner(body)
 	var allResults []map[string]any
 
+	var chunks int
 	for scanner.Scan() {
 		line := scanner.Text()
 
 		if !strings.HasPrefix(line, "data: ") {
 			continue
 		}
+		i := chunks
+		chunks++
 
 		line = strings.TrimPrefix(line, "data: ")
 		if line == "[DONE]" {
@@ -125,6 +145,9 @@ func (ct *chatCompletionsTracer) parseStreamingResponse(span trace.Span, body io
 		}
 
 		allResults = append(allResults, chunk)
+		if hasDeltaOutput(chunk) {
+			ct.Output(i)
+		}
 
 		// Handle usage in streaming response (if stream_options.include_usage is true)
 		if usage, ok := chunk["usage"]; ok {
@@ -143,11 +166,19 @@ func (ct *chatCompletionsTracer) parseStreamingResponse(span trace.Span, body io
 	// Handle usage metrics
 	if usage, ok := ct.metadata["usage"].(map[string]any); ok {
 		metrics := parseUsageTokens(usage)
-		if err := internal.SetJSONAttr(span, "braintrust.metrics", metrics); err != nil {
+		if err := ct.StreamTiming.SetUsageMetrics(span, internal.ModelName(ct.metadata), metrics); err != nil {
+			return err
+		}
+	} else if len(allResults) > 0 {
+		if err := ct.setEstimatedUsage(span, output); err != nil {
 			return err
 		}
 	}
 
+	if err := ct.startToolSpans(span, toolCalls(output)); err != nil {
+		return err
+	}
+
 	return scanner.Err()
 }
 
@@ -283,22 +314,183 @@ func (ct *chatCompletionsTracer) handleChatCompletionResponse(span trace.Span, r
 		}
 	}
 
-	if err := internal.SetJSONAttr(span, "braintrust.metadata", ct.metadata); err != nil {
-		return err
-	}
-
 	if usage, ok := rawMsg["usage"].(map[string]any); ok {
 		metrics := parseUsageTokens(usage)
-		if err := internal.SetJSONAttr(span, "braintrust.metrics", metrics); err != nil {
+		if err := internal.SetUsageMetrics(span, internal.ModelName(ct.metadata), metrics); err != nil {
+			return err
+		}
+	} else if choices, ok := rawMsg["choices"]; ok {
+		if err := ct.setEstimatedUsage(span, choiceMaps(choices)); err != nil {
 			return err
 		}
 	}
 
+	if err := internal.SetJSONAttr(span, "braintrust.metadata", ct.metadata); err != nil {
+		return err
+	}
+
 	if choices, ok := rawMsg["choices"]; ok {
 		if err := internal.SetJSONAttr(span, "braintrust.output_json", choices); err != nil {
 			return err
 		}
+		if err := ct.startToolSpans(span, toolCalls(choiceMaps(choices))); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+// startToolSpans starts the spans of the response's tool calls, which end when their
+// results are sent. The tool spans of batch requests start and end at the batch's end.
+func (ct *chatCompletionsTracer) startToolSpans(span trace.Span, calls []internal.ToolCall) error {
+	if !ct.batchEnd.IsZero() {
+		return internal.TraceToolCalls(ct.parent, tracer(), span, ct.batchEnd, calls)
+	}
+	return internal.StartToolSpans(ct.parent, tracer(), span, time.Now(), calls)
+}
+
+// setEstimatedUsage sets the token metrics of a completion whose response has no usage,
+// counted with the tokenizer of its model from its messages and choices, and flags them
+// as estimated in its metadata.
+func (ct *chatCompletionsTracer) setEstimatedUsage(span trace.Span, choices []map[string]any) error {
+	model := internal.ModelName(ct.metadata)
+	tok := tokenizer.For(model)
+
+	// like OpenAI's own estimates, every message has 3 tokens of its own, a name 1
+	// more, and the reply is primed with 3 more.
+	prompt := 3
+	for _, m := range ct.messages {
+		msg, ok := m.(map[string]any)
+		if !ok {
+			continue
+		}
+		prompt += 3
+		if role, ok := msg["role"].(string); ok {
+			prompt += tok.CountTokens(role)
+		}
+		if _, ok := msg["name"]; ok {
+			prompt++
+		}
+		for _, text := range messageTexts(msg) {
+			prompt += tok.CountTokens(text)
+		}
+	}
+
+	var completion int
+	for _, choice := range choices {
+		if msg, ok := choice["message"].(map[string]any); ok {
+			for _, text := range messageTexts(msg) {
+				completion += tok.CountTokens(text)
+			}
+		}
+	}
+
+	ct.metadata["tokens_estimated"] = true
+	if err := internal.SetJSONAttr(span, "braintrust.metadata", ct.metadata); err != nil {
+		return err
+	}
+	return ct.StreamTiming.SetUsageMetrics(span, model, map[string]int64{
+		"prompt_tokens":     int64(prompt),
+		"completion_tokens": int64(completion),
+		"tokens":            int64(prompt + completion),
+	})
+}
+
+// messageTexts returns the texts of a chat message that are tokenized: its name, its
+// content or the text of its content parts, its refusal, and its tool calls.
+func messageTexts(msg map[string]any) []string {
+	var texts []string
+	for _, field := range []string{"name", "content", "refusal"} {
+		if text, ok := msg[field].(string); ok && text != "" {
+			texts = append(texts, text)
+		}
+	}
+	if parts, ok := msg["content"].([]any); ok {
+		for _, part := range parts {
+			if part, ok := part.(map[string]any); ok {
+				if text, ok := part["text"].(string); ok {
+					texts = append(texts, text)
+				}
+			}
+		}
+	}
+	if toolCalls, ok := msg["tool_calls"].([]any); ok {
+		for _, toolCall := range toolCalls {
+			toolCall, _ := toolCall.(map[string]any)
+			if function, ok := toolCall["function"].(map[string]any); ok {
+				for _, field := range []string{"name", "arguments"} {
+					if text, ok := function[field].(string); ok {
+						texts = append(texts, text)
+					}
+				}
+			}
+		}
+	}
+	return texts
+}
+
+// choiceMaps returns the choices of a response that are objects.
+func choiceMaps(choices any) []map[string]any {
+	list, _ := choices.([]any)
+	maps := make([]map[string]any, 0, len(list))
+	for _, choice := range list {
+		if choice, ok := choice.(map[string]any); ok {
+			maps = append(maps, choice)
+		}
+	}
+	return maps
+}
+
+// toolCalls returns the function tool calls of the messages of a response's choices.
+func toolCalls(choices []map[string]any) []internal.ToolCall {
+	var calls []internal.ToolCall
+	for _, choice := range choices {
+		msg, _ := choice["message"].(map[string]any)
+		toolCalls, _ := msg["tool_calls"].([]any)
+		for _, toolCall := range toolCalls {
+			toolCall, _ := toolCall.(map[string]any)
+			function, ok := toolCall["function"].(map[string]any)
+			if !ok {
+				continue
+			}
+			id, _ := toolCall["id"].(string)
+			name, _ := function["name"].(string)
+			calls = append(calls, internal.ToolCall{ID: id, Name: name, Arguments: function["arguments"]})
+		}
+	}
+	return calls
+}
+
+// toolResults returns the tool results of a request's tool messages.
+func toolResults(messages []any) []internal.ToolResult {
+	var results []internal.ToolResult
+	for _, m := range messages {
+		msg, _ := m.(map[string]any)
+		if msg["role"] != "tool" {
+			continue
+		}
+		id, _ := msg["tool_call_id"].(string)
+		results = append(results, internal.ToolResult{ID: id, Output: msg["content"]})
+	}
+	return results
+}
+
+// hasDeltaOutput returns whether a chunk of a chat completion stream has output, like
+// content or the arguments of a tool call.
+func hasDeltaOutput(chunk map[string]any) bool {
+	choices, _ := chunk["choices"].([]any)
+	for _, choice := range choices {
+		choice, _ := choice.(map[string]any)
+		delta, _ := choice["delta"].(map[string]any)
+		for _, field := range []string{"content", "refusal", "reasoning_content"} {
+			if s, _ := delta[field].(string); s != "" {
+				return true
+			}
+		}
+		if toolCalls, _ := delta["tool_calls"].([]any); len(toolCalls) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -4,16 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel/codes"
 
+	"github.com/braintrustdata/braintrust-x-go/braintrust"
 	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/oteltest"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/tokenizer"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/tokenizer/tiktoken"
 )
 
 func TestOpenAIChatCompletions(t *testing.T) {
@@ -1164,3 +1171,260 @@ func TestMultipleMessagesIssue33(t *testing.T) {
 	assert.Equal("user", messages[3]["role"])
 	assert.Equal("What is the population?", messages[3]["content"])
 }
+
+// newFakeClient returns a client with the middleware whose requests are answered with
+// the given response body, instead of calling OpenAI.
+func newFakeClient(contentType, body string) openai.Client {
+	fake := func(req *http.Request, _ NextMiddleware) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {contentType}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	}
+	return openai.NewClient(
+		option.WithAPIKey("fake"),
+		option.WithMiddleware(Middleware),
+		option.WithMiddleware(fake),
+	)
+}
+
+func TestChatCompletionsStreaming_EstimatedUsage(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	// without stream_options.include_usage, the stream has no usage
+	client := newFakeClient("text/event-stream", `data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4o-mini","choices":[{"index":0,"delta":{"role":"assistant","content":"1, 2"}}]}
+
+data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4o-mini","choices":[{"index":0,"delta":{"content":", 3"},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`)
+	stream := client.Chat.Completions.NewStreaming(context.Background(), openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage("You count."),
+			openai.UserMessage("Count from 1 to 3"),
+		},
+		Model: "gpt-4o-mini",
+	})
+	for stream.Next() {
+	}
+	require.NoError(t, stream.Err())
+	require.NoError(t, stream.Close())
+
+	span := exporter.FlushOne()
+	o200k := tiktoken.O200KBase()
+	prompt := 3 +
+		3 + o200k.CountTokens("system") + o200k.CountTokens("You count.") +
+		3 + o200k.CountTokens("user") + o200k.CountTokens("Count from 1 to 3")
+	completion := o200k.CountTokens("1, 2, 3")
+
+	metrics := span.Metrics()
+	assert.Equal(t, float64(prompt), metrics["prompt_tokens"])
+	assert.Equal(t, float64(completion), metrics["completion_tokens"])
+	assert.Equal(t, float64(prompt+completion), metrics["tokens"])
+	assert.Greater(t, metrics["estimated_cost"], 0.0)
+	assert.Equal(t, true, span.Metadata()["tokens_estimated"])
+}
+
+func TestChatCompletions_EstimatedUsage(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	// an OpenAI-compatible server without usage, for a model without a tokenizer
+	client := newFakeClient("application/json", `{
+		"id": "c2",
+		"object": "chat.completion",
+		"model": "my-local-model",
+		"choices": [{
+			"index": 0,
+			"message": {
+				"role": "assistant",
+				"content": null,
+				"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]
+			},
+			"finish_reason": "tool_calls"
+		}]
+	}`)
+	_, err := client.Chat.Completions.New(context.Background(), openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.UserMessage("What's the weather in Paris?"),
+		},
+		Model: "my-local-model",
+	})
+	require.NoError(t, err)
+
+	span := exporter.FlushOne()
+	approx := tokenizer.Approximate
+	prompt := 3 + 3 + approx.CountTokens("user") + approx.CountTokens("What's the weather in Paris?")
+	completion := approx.CountTokens("get_weather") + approx.CountTokens(`{"city":"Paris"}`)
+
+	metrics := span.Metrics()
+	assert.Equal(t, float64(prompt), metrics["prompt_tokens"])
+	assert.Equal(t, float64(completion), metrics["completion_tokens"])
+	assert.NotContains(t, metrics, "estimated_cost")
+	metadata := span.Metadata()
+	assert.Equal(t, true, metadata["tokens_estimated"])
+	assert.Equal(t, "c2", metadata["id"])
+}
+
+func TestChatCompletions_UsageNotEstimated(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	client := newFakeClient("application/json", `{
+		"id": "c3",
+		"object": "chat.completion",
+		"model": "gpt-4o-mini",
+		"choices": [{"index": 0, "message": {"role": "assistant", "content": "4"}, "finish_reason": "stop"}],
+		"usage": {"prompt_tokens": 14, "completion_tokens": 1, "total_tokens": 15}
+	}`)
+	_, err := client.Chat.Completions.New(context.Background(), openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("What is 2+2?")},
+		Model:    "gpt-4o-mini",
+	})
+	require.NoError(t, err)
+
+	span := exporter.FlushOne()
+	assert.Equal(t, float64(14), span.Metrics()["prompt_tokens"])
+	assert.NotContains(t, span.Metadata(), "tokens_estimated")
+}
+
+func TestChatCompletions_ToolSpans(t *testing.T) {
+	tracer, exporter := oteltest.Setup(t)
+	ctx, agent := tracer.Start(context.Background(), "agent")
+
+	client := newFakeClient("application/json", `{
+		"id": "c4",
+		"object": "chat.completion",
+		"model": "gpt-4o-mini",
+		"choices": [{
+			"index": 0,
+			"message": {
+				"role": "assistant",
+				"content": null,
+				"tool_calls": [{"id": "call_tool_spans", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]
+			},
+			"finish_reason": "tool_calls"
+		}],
+		"usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}
+	}`)
+	params := openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("What's the weather in Paris?")},
+		Model:    "gpt-4o-mini",
+	}
+	resp, err := client.Chat.Completions.New(ctx, params)
+	require.NoError(t, err)
+
+	// the follow-up request sends the tool result
+	client = newFakeClient("application/json", `{
+		"id": "c5",
+		"object": "chat.completion",
+		"model": "gpt-4o-mini",
+		"choices": [{"index": 0, "message": {"role": "assistant", "content": "It's sunny."}, "finish_reason": "stop"}],
+		"usage": {"prompt_tokens": 20, "completion_tokens": 3, "total_tokens": 23}
+	}`)
+	params.Messages = append(params.Messages,
+		resp.Choices[0].Message.ToParam(),
+		openai.ToolMessage("sunny, 22C", "call_tool_spans"),
+	)
+	_, err = client.Chat.Completions.New(ctx, params)
+	require.NoError(t, err)
+	agent.End()
+
+	spans := exporter.Flush()
+	require.Len(t, spans, 4)
+	var llm, tool, followUp oteltest.Span
+	for _, span := range spans {
+		switch {
+		case span.Name() == "get_weather":
+			tool = span
+		case span.Name() == "openai.chat.completions.create" && len(span.Stub.Links) == 0:
+			llm = span
+		case span.Name() == "openai.chat.completions.create":
+			followUp = span
+		}
+	}
+
+	tool.AssertJSONAttrEquals("braintrust.span_attributes", map[string]any{"type": "tool"})
+	assert.Equal(t, map[string]any{"city": "Paris"}, tool.Input())
+	assert.Equal(t, "sunny, 22C", tool.Output())
+	assert.Equal(t, map[string]any{"tool_call_id": "call_tool_spans", "name": "get_weather"}, tool.Metadata())
+
+	// the tool span is a sibling of the LLM span, linked to it
+	assert.Equal(t, agent.SpanContext().SpanID(), tool.Stub.Parent.SpanID())
+	assert.Equal(t, agent.SpanContext().SpanID(), llm.Stub.Parent.SpanID())
+	require.Len(t, tool.Stub.Links, 1)
+	assert.Equal(t, llm.Stub.SpanContext.SpanID(), tool.Stub.Links[0].SpanContext.SpanID())
+
+	// it lasts until the tool result is sent, and the follow-up span is linked to it
+	assert.False(t, tool.Stub.EndTime.Before(llm.Stub.EndTime))
+	assert.Equal(t, followUp.Stub.StartTime, tool.Stub.EndTime)
+	require.Len(t, followUp.Stub.Links, 1)
+	assert.Equal(t, tool.Stub.SpanContext.SpanID(), followUp.Stub.Links[0].SpanContext.SpanID())
+}
+
+// newSlowFakeClient returns a client with a fake server that streams events with a delay
+// before each one.
+func newSlowFakeClient(delay time.Duration, events ...string) openai.Client {
+	fake := func(req *http.Request, _ NextMiddleware) (*http.Response, error) {
+		r, w := io.Pipe()
+		go func() {
+			for _, event := range events {
+				time.Sleep(delay)
+				_, _ = io.WriteString(w, "data: "+event+"\n\n")
+			}
+			_ = w.Close()
+		}()
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {"text/event-stream"}},
+			Body:       r,
+			Request:    req,
+		}, nil
+	}
+	return openai.NewClient(
+		option.WithAPIKey("fake"),
+		option.WithMiddleware(Middleware),
+		option.WithMiddleware(fake),
+	)
+}
+
+func TestChatCompletionsStreaming_Latency(t *testing.T) {
+	_, exporter := oteltest.Setup(t, braintrust.WithStreamingEvents(true))
+
+	delay := 20 * time.Millisecond
+	client := newSlowFakeClient(delay,
+		`{"id":"c6","object":"chat.completion.chunk","model":"gpt-4o-mini","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+		`{"id":"c6","object":"chat.completion.chunk","model":"gpt-4o-mini","choices":[{"index":0,"delta":{"content":"1"}}]}`,
+		`{"id":"c6","object":"chat.completion.chunk","model":"gpt-4o-mini","choices":[{"index":0,"delta":{"content":", 2"}}]}`,
+		`{"id":"c6","object":"chat.completion.chunk","model":"gpt-4o-mini","choices":[{"index":0,"delta":{"content":", 3"},"finish_reason":"stop"}]}`,
+		`{"id":"c6","object":"chat.completion.chunk","model":"gpt-4o-mini","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":5,"total_tokens":17}}`,
+		`[DONE]`,
+	)
+	stream := client.Chat.Completions.NewStreaming(context.Background(), openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("Count from 1 to 3")},
+		Model:    "gpt-4o-mini",
+	})
+	for stream.Next() {
+	}
+	require.NoError(t, stream.Err())
+	require.NoError(t, stream.Close())
+
+	span := exporter.FlushOne()
+	metrics := span.Metrics()
+	assert.Equal(t, float64(5), metrics["completion_tokens"])
+
+	// the first chunk with content is the second one
+	ttft := metrics["time_to_first_token"]
+	assert.GreaterOrEqual(t, ttft, 2*delay.Seconds())
+	assert.Less(t, ttft, span.Stub.EndTime.Sub(span.Stub.StartTime).Seconds())
+	assert.GreaterOrEqual(t, metrics["inter_chunk_latency_mean"], delay.Seconds())
+	assert.GreaterOrEqual(t, metrics["inter_chunk_latency_max"], metrics["inter_chunk_latency_p95"])
+	assert.Greater(t, metrics["tokens_per_second"], 0.0)
+	assert.LessOrEqual(t, metrics["tokens_per_second"], 5/(2*delay.Seconds()))
+
+	events := span.Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, "first_token", events[0].Name)
+	assert.InDelta(t, ttft, events[0].Time.Sub(span.Stub.StartTime).Seconds(), 1e-6)
+}
@@ -0,0 +1,225 @@
+package traceopenai
+
+// this file parses the legacy completions API.
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/internal"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/tokenizer"
+)
+
+// completionsTracer is a tracer for the legacy openai v1/completions POST endpoint.
+// See docs here: https://platform.openai.com/docs/api-reference/completions/create
+type completionsTracer struct {
+	streaming bool
+	metadata  map[string]any
+	// prompt is the request's prompt, to estimate its tokens if the response has no
+	// usage.
+	prompt any
+	internal.StreamTiming
+}
+
+func newCompletionsTracer() *completionsTracer {
+	return &completionsTracer{
+		metadata: map[string]any{
+			"provider": "openai",
+			"endpoint": "/v1/completions",
+		},
+	}
+}
+
+func (ct *completionsTracer) StartSpan(ctx context.Context, t time.Time, request io.Reader) (context.Context, trace.Span, error) {
+	ctx, span := tracer().Start(
+		ctx,
+		"openai.completions.create",
+		trace.WithTimestamp(t),
+	)
+
+	var raw map[string]any
+	if err := json.NewDecoder(request).Decode(&raw); err != nil {
+		return ctx, span, err
+	}
+
+	metadataFields := []string{
+		"model",
+		"suffix",
+		"max_tokens",
+		"temperature",
+		"top_p",
+		"n",
+		"best_of",
+		"echo",
+		"logprobs",
+		"logit_bias",
+		"stop",
+		"presence_penalty",
+		"frequency_penalty",
+		"seed",
+		"stream",
+		"stream_options",
+		"user",
+	}
+	for _, field := range metadataFields {
+		if value, exists := raw[field]; exists {
+			ct.metadata[field] = value
+		}
+	}
+	ct.streaming = raw["stream"] == true
+
+	if prompt, ok := raw["prompt"]; ok {
+		ct.prompt = prompt
+		if err := internal.SetJSONAttr(span, "braintrust.input_json", prompt); err != nil {
+			return ctx, span, err
+		}
+	}
+
+	if err := internal.SetJSONAttr(span, "braintrust.metadata", ct.metadata); err != nil {
+		return ctx, span, err
+	}
+
+	return ctx, span, nil
+}
+
+func (ct *completionsTracer) TagSpan(span trace.Span, body io.Reader) error {
+	if ct.streaming {
+		return ct.parseStreamingResponse(span, body)
+	}
+
+	var raw map[string]any
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return err
+	}
+	var choices []map[string]any
+	if list, ok := raw["choices"].([]any); ok {
+		for _, choice := range list {
+			if choice, ok := choice.(map[string]any); ok {
+				choices = append(choices, choice)
+			}
+		}
+	}
+	return ct.handleResponse(span, raw, choices)
+}
+
+func (ct *completionsTracer) parseStreamingResponse(span trace.Span, body io.Reader) error {
+	// chunks have the text of one choice, by index
+	texts := map[int]string{}
+	finishReasons := map[int]any{}
+	last := map[string]any{}
+	var chunks int
+	err := internal.ReadEvents(body, func(chunk map[string]any) error {
+		i := chunks
+		chunks++
+		for _, field := range []string{"id", "object", "created", "system_fingerprint", "usage"} {
+			if v, ok := chunk[field]; ok && v != nil {
+				last[field] = v
+			}
+		}
+		choices, _ := chunk["choices"].([]any)
+		for _, choice := range choices {
+			choice, ok := choice.(map[string]any)
+			if !ok {
+				continue
+			}
+			_, index := internal.ToInt64(choice["index"])
+			text, _ := choice["text"].(string)
+			texts[int(index)] += text
+			if text != "" {
+				ct.Output(i)
+			}
+			if fr, ok := choice["finish_reason"]; ok && fr != nil {
+				finishReasons[int(index)] = fr
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	choices := make([]map[string]any, 0, len(texts))
+	for index, text := range texts {
+		choices = append(choices, map[string]any{
+			"index":         index,
+			"text":          text,
+			"finish_reason": finishReasons[index],
+		})
+	}
+	sort.Slice(choices, func(i, j int) bool {
+		return choices[i]["index"].(int) < choices[j]["index"].(int)
+	})
+	return ct.handleResponse(span, last, choices)
+}
+
+func (ct *completionsTracer) handleResponse(span trace.Span, raw map[string]any, choices []map[string]any) error {
+	for _, field := range []string{"id", "object", "created", "system_fingerprint"} {
+		if v, ok := raw[field]; ok {
+			ct.metadata[field] = v
+		}
+	}
+
+	model := internal.ModelName(ct.metadata)
+	if usage, ok := raw["usage"].(map[string]any); ok {
+		if err := ct.StreamTiming.SetUsageMetrics(span, model, parseUsageTokens(usage)); err != nil {
+			return err
+		}
+	} else if len(choices) > 0 {
+		// estimate the usage of servers that don't report it, like chat completions
+		tok := tokenizer.For(model)
+		prompt := countPromptTokens(tok, ct.prompt)
+		var completion int
+		for _, choice := range choices {
+			text, _ := choice["text"].(string)
+			completion += tok.CountTokens(text)
+		}
+		ct.metadata["tokens_estimated"] = true
+		err := ct.StreamTiming.SetUsageMetrics(span, model, map[string]int64{
+			"prompt_tokens":     int64(prompt),
+			"completion_tokens": int64(completion),
+			"tokens":            int64(prompt + completion),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := internal.SetJSONAttr(span, "braintrust.metadata", ct.metadata); err != nil {
+		return err
+	}
+
+	if choices != nil {
+		if err := internal.SetJSONAttr(span, "braintrust.output_json", choices); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countPromptTokens returns the number of tokens of a completions prompt: a string, a
+// list of strings, a list of token IDs, or a list of lists of token IDs.
+func countPromptTokens(tok tokenizer.Tokenizer, prompt any) int {
+	switch p := prompt.(type) {
+	case string:
+		return tok.CountTokens(p)
+	case []any:
+		var n int
+		for _, item := range p {
+			switch item := item.(type) {
+			case string:
+				n += tok.CountTokens(item)
+			case []any:
+				n += len(item)
+			default:
+				n++
+			}
+		}
+		return n
+	}
+	return 0
+}
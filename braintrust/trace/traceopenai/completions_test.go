@@ -0,0 +1,95 @@
+package traceopenai
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/oteltest"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/tokenizer"
+)
+
+func TestCompletions(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	client := newFakeClient("application/json", `{
+		"id": "cmpl-1",
+		"object": "text_completion",
+		"created": 1589478378,
+		"model": "gpt-3.5-turbo-instruct",
+		"choices": [{"text": " sunny.", "index": 0, "logprobs": null, "finish_reason": "stop"}],
+		"usage": {"prompt_tokens": 5, "completion_tokens": 2, "total_tokens": 7}
+	}`)
+	_, err := client.Completions.New(context.Background(), openai.CompletionNewParams{
+		Prompt:    openai.CompletionNewParamsPromptUnion{OfString: openai.String("The weather today is")},
+		Model:     openai.CompletionNewParamsModelGPT3_5TurboInstruct,
+		MaxTokens: openai.Int(16),
+	})
+	require.NoError(t, err)
+
+	span := exporter.FlushOne()
+	span.AssertNameIs("openai.completions.create")
+	assert.Equal(t, "The weather today is", span.Input())
+	assert.Equal(t, []any{map[string]any{
+		"text": " sunny.", "index": float64(0), "logprobs": nil, "finish_reason": "stop",
+	}}, span.Output())
+	metadata := span.Metadata()
+	assert.Equal(t, "gpt-3.5-turbo-instruct", metadata["model"])
+	assert.Equal(t, float64(16), metadata["max_tokens"])
+	assert.Equal(t, "cmpl-1", metadata["id"])
+	assert.NotContains(t, metadata, "tokens_estimated")
+	metrics := span.Metrics()
+	assert.Equal(t, float64(5), metrics["prompt_tokens"])
+	assert.Equal(t, float64(7), metrics["tokens"])
+}
+
+func TestCompletions_Streaming(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	client := newFakeClient("text/event-stream", `data: {"id": "cmpl-2", "object": "text_completion", "choices": [{"text": " sun", "index": 0, "finish_reason": null}, {"text": " rain", "index": 1, "finish_reason": null}], "usage": null}
+
+data: {"id": "cmpl-2", "object": "text_completion", "choices": [{"text": "ny.", "index": 0, "finish_reason": "stop"}], "usage": null}
+
+data: {"id": "cmpl-2", "object": "text_completion", "choices": [{"text": "y.", "index": 1, "finish_reason": "stop"}], "usage": null}
+
+data: [DONE]
+
+`)
+	stream := client.Completions.NewStreaming(context.Background(), openai.CompletionNewParams{
+		Prompt: openai.CompletionNewParamsPromptUnion{OfString: openai.String("The weather today is")},
+		Model:  "my-fine-tuned-model",
+		N:      openai.Int(2),
+	})
+	for stream.Next() {
+	}
+	require.NoError(t, stream.Err())
+	require.NoError(t, stream.Close())
+
+	span := exporter.FlushOne()
+	assert.Equal(t, []any{
+		map[string]any{"index": float64(0), "text": " sunny.", "finish_reason": "stop"},
+		map[string]any{"index": float64(1), "text": " rainy.", "finish_reason": "stop"},
+	}, span.Output())
+	metadata := span.Metadata()
+	assert.Equal(t, "cmpl-2", metadata["id"])
+	assert.Equal(t, true, metadata["stream"])
+
+	// without stream_options.include_usage, the usage is estimated
+	assert.Equal(t, true, metadata["tokens_estimated"])
+	approx := tokenizer.Approximate
+	metrics := span.Metrics()
+	assert.Equal(t, float64(approx.CountTokens("The weather today is")), metrics["prompt_tokens"])
+	assert.Equal(t, float64(approx.CountTokens(" sunny.")+approx.CountTokens(" rainy.")), metrics["completion_tokens"])
+}
+
+func TestCountPromptTokens(t *testing.T) {
+	approx := tokenizer.Approximate
+	assert.Equal(t, 2, countPromptTokens(approx, "hi there"))
+	assert.Equal(t, 4, countPromptTokens(approx, []any{"hi there", "hi there"}))
+	assert.Equal(t, 3, countPromptTokens(approx, []any{float64(1), float64(2), float64(3)}))
+	assert.Equal(t, 5, countPromptTokens(approx, []any{[]any{float64(1), float64(2)}, []any{float64(1), float64(2), float64(3)}}))
+	assert.Equal(t, 0, countPromptTokens(approx, nil))
+}
@@ -0,0 +1,160 @@
+package traceopenai
+
+// this file parses the embeddings and moderations APIs.
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/internal"
+)
+
+// embeddingsTracer is a tracer for the openai v1/embeddings POST endpoint. It records
+// the input and the number and dimensions of the embeddings, but not the embeddings,
+// which are large and unreadable.
+// See docs here: https://platform.openai.com/docs/api-reference/embeddings/create
+type embeddingsTracer struct {
+	metadata map[string]any
+}
+
+func newEmbeddingsTracer() *embeddingsTracer {
+	return &embeddingsTracer{
+		metadata: map[string]any{
+			"provider": "openai",
+			"endpoint": "/v1/embeddings",
+		},
+	}
+}
+
+func (et *embeddingsTracer) StartSpan(ctx context.Context, t time.Time, request io.Reader) (context.Context, trace.Span, error) {
+	ctx, span := tracer().Start(
+		ctx,
+		"openai.embeddings.create",
+		trace.WithTimestamp(t),
+	)
+
+	var raw map[string]any
+	if err := json.NewDecoder(request).Decode(&raw); err != nil {
+		return ctx, span, err
+	}
+
+	for _, field := range []string{"model", "dimensions", "encoding_format", "user"} {
+		if value, exists := raw[field]; exists {
+			et.metadata[field] = value
+		}
+	}
+
+	if input, ok := raw["input"]; ok {
+		if err := internal.SetJSONAttr(span, "braintrust.input_json", input); err != nil {
+			return ctx, span, err
+		}
+	}
+
+	if err := internal.SetJSONAttr(span, "braintrust.metadata", et.metadata); err != nil {
+		return ctx, span, err
+	}
+
+	return ctx, span, nil
+}
+
+func (et *embeddingsTracer) TagSpan(span trace.Span, body io.Reader) error {
+	var raw struct {
+		Data []struct {
+			// Embedding is a list of floats, or a base64 string of little-endian
+			// float32s if the encoding_format is base64.
+			Embedding any `json:"embedding"`
+		} `json:"data"`
+		Usage map[string]any `json:"usage"`
+	}
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return err
+	}
+
+	if raw.Usage != nil {
+		metrics := parseUsageTokens(raw.Usage)
+		if err := internal.SetUsageMetrics(span, internal.ModelName(et.metadata), metrics); err != nil {
+			return err
+		}
+	}
+
+	output := map[string]any{"embeddings": len(raw.Data)}
+	if len(raw.Data) > 0 {
+		switch embedding := raw.Data[0].Embedding.(type) {
+		case []any:
+			output["dimensions"] = len(embedding)
+		case string:
+			output["dimensions"] = base64.StdEncoding.DecodedLen(len(embedding)) / 4
+		}
+	}
+	return internal.SetJSONAttr(span, "braintrust.output_json", output)
+}
+
+// moderationsTracer is a tracer for the openai v1/moderations POST endpoint.
+// See docs here: https://platform.openai.com/docs/api-reference/moderations/create
+type moderationsTracer struct {
+	metadata map[string]any
+}
+
+func newModerationsTracer() *moderationsTracer {
+	return &moderationsTracer{
+		metadata: map[string]any{
+			"provider": "openai",
+			"endpoint": "/v1/moderations",
+		},
+	}
+}
+
+func (mt *moderationsTracer) StartSpan(ctx context.Context, t time.Time, request io.Reader) (context.Context, trace.Span, error) {
+	ctx, span := tracer().Start(
+		ctx,
+		"openai.moderations.create",
+		trace.WithTimestamp(t),
+	)
+
+	var raw map[string]any
+	if err := json.NewDecoder(request).Decode(&raw); err != nil {
+		return ctx, span, err
+	}
+
+	if model, ok := raw["model"]; ok {
+		mt.metadata["model"] = model
+	}
+
+	if input, ok := raw["input"]; ok {
+		if err := internal.SetJSONAttr(span, "braintrust.input_json", input); err != nil {
+			return ctx, span, err
+		}
+	}
+
+	if err := internal.SetJSONAttr(span, "braintrust.metadata", mt.metadata); err != nil {
+		return ctx, span, err
+	}
+
+	return ctx, span, nil
+}
+
+func (mt *moderationsTracer) TagSpan(span trace.Span, body io.Reader) error {
+	var raw map[string]any
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return err
+	}
+
+	if id, ok := raw["id"]; ok {
+		mt.metadata["id"] = id
+	}
+	if err := internal.SetJSONAttr(span, "braintrust.metadata", mt.metadata); err != nil {
+		return err
+	}
+
+	if results, ok := raw["results"]; ok {
+		if err := internal.SetJSONAttr(span, "braintrust.output_json", results); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package traceopenai
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/oteltest"
+)
+
+func TestEmbeddings(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	client := newFakeClient("application/json", `{
+		"object": "list",
+		"data": [
+			{"object": "embedding", "index": 0, "embedding": [0.1, 0.2, 0.3]},
+			{"object": "embedding", "index": 1, "embedding": [0.4, 0.5, 0.6]}
+		],
+		"model": "text-embedding-3-small",
+		"usage": {"prompt_tokens": 2, "total_tokens": 2}
+	}`)
+	resp, err := client.Embeddings.New(context.Background(), openai.EmbeddingNewParams{
+		Input:      openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: []string{"hello", "world"}},
+		Model:      openai.EmbeddingModelTextEmbedding3Small,
+		Dimensions: openai.Int(3),
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Data, 2)
+
+	span := exporter.FlushOne()
+	span.AssertNameIs("openai.embeddings.create")
+	assert.Equal(t, []any{"hello", "world"}, span.Input())
+	assert.Equal(t, map[string]any{"embeddings": float64(2), "dimensions": float64(3)}, span.Output())
+	metadata := span.Metadata()
+	assert.Equal(t, "text-embedding-3-small", metadata["model"])
+	assert.Equal(t, float64(3), metadata["dimensions"])
+	metrics := span.Metrics()
+	assert.Equal(t, float64(2), metrics["prompt_tokens"])
+	assert.Equal(t, float64(2), metrics["tokens"])
+	assert.Contains(t, metrics, "estimated_cost")
+}
+
+func TestEmbeddings_Base64(t *testing.T) {
+	tracer, exporter := oteltest.Setup(t)
+
+	et := newEmbeddingsTracer()
+	_, span := tracer.Start(context.Background(), "embeddings")
+	// three little-endian float32s: 1, 2 and 3
+	err := et.TagSpan(span, strings.NewReader(`{"data": [{"embedding": "AACAPwAAAEAAAEBA"}], "usage": {"prompt_tokens": 1}}`))
+	require.NoError(t, err)
+	span.End()
+
+	ts := exporter.FlushOne()
+	assert.Equal(t, map[string]any{"embeddings": float64(1), "dimensions": float64(3)}, ts.Output())
+}
+
+func TestModerations(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	client := newFakeClient("application/json", `{
+		"id": "modr-1",
+		"model": "omni-moderation-latest",
+		"results": [{"flagged": false, "categories": {"violence": false}, "category_scores": {"violence": 0.01}}]
+	}`)
+	_, err := client.Moderations.New(context.Background(), openai.ModerationNewParams{
+		Input: openai.ModerationNewParamsInputUnion{OfString: openai.String("I love puppies")},
+		Model: openai.ModerationModelOmniModerationLatest,
+	})
+	require.NoError(t, err)
+
+	span := exporter.FlushOne()
+	span.AssertNameIs("openai.moderations.create")
+	assert.Equal(t, "I love puppies", span.Input())
+	output, ok := span.Output().([]any)
+	require.True(t, ok)
+	require.Len(t, output, 1)
+	assert.Equal(t, false, output[0].(map[string]any)["flagged"])
+	metadata := span.Metadata()
+	assert.Equal(t, "modr-1", metadata["id"])
+	assert.Equal(t, "omni-moderation-latest", metadata["model"])
+}
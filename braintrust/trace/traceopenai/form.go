@@ -0,0 +1,122 @@
+package traceopenai
+
+// this file parses the multipart form requests of the images and audio APIs, and
+// logs their files as attachments.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/attachment"
+)
+
+// formFile is a file of a multipart form request.
+type formFile struct {
+	filename    string
+	contentType string
+	data        []byte
+}
+
+// attachment returns the file in the attachment format of span inputs and outputs.
+func (f formFile) attachment() (map[string]string, error) {
+	return newAttachment(f.contentType, f.data)
+}
+
+// form is a parsed multipart form request.
+type form struct {
+	// values are the form's values. Fields sent more than once, like "include[]",
+	// have a list of values, without the brackets in their name.
+	values map[string]any
+	files  map[string][]formFile
+}
+
+// parseForm parses a multipart form request body, with the boundary of its header's
+// content type.
+func parseForm(header http.Header, body io.Reader) (*form, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type: %w", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return nil, fmt.Errorf("not a multipart form: %s", mediaType)
+	}
+
+	f := &form{values: map[string]any{}, files: map[string][]formFile{}}
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return f, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid multipart form: %w", err)
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multipart form: %w", err)
+		}
+
+		name, isList := strings.CutSuffix(part.FormName(), "[]")
+		if filename := part.FileName(); filename != "" {
+			f.files[name] = append(f.files[name], formFile{
+				filename:    filename,
+				contentType: fileContentType(filename, part.Header.Get("Content-Type")),
+				data:        data,
+			})
+			continue
+		}
+		if isList {
+			values, _ := f.values[name].([]any)
+			f.values[name] = append(values, string(data))
+		} else {
+			f.values[name] = string(data)
+		}
+	}
+}
+
+// fileTypes are the content types of the audio and image files of the API, which
+// aren't all known to the mime package.
+var fileTypes = map[string]string{
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".mp3":  "audio/mpeg",
+	".mp4":  "audio/mp4",
+	".mpeg": "audio/mpeg",
+	".mpga": "audio/mpeg",
+	".oga":  "audio/ogg",
+	".ogg":  "audio/ogg",
+	".wav":  "audio/wav",
+	".webm": "audio/webm",
+	".png":  attachment.ImagePNG,
+	".jpg":  attachment.ImageJPEG,
+	".jpeg": attachment.ImageJPEG,
+	".webp": attachment.ImageWEBP,
+}
+
+// fileContentType returns the content type of an uploaded file: the one it was sent
+// with if it's specific, or else the one of its extension.
+func fileContentType(filename, contentType string) string {
+	if contentType != "" && contentType != "application/octet-stream" {
+		return contentType
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if t, ok := fileTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// newAttachment returns data in the attachment format of span inputs and outputs (see
+// [attachment.Attachment.Base64Message]).
+func newAttachment(contentType string, data []byte) (map[string]string, error) {
+	return attachment.FromBytes(contentType, data).Base64Message()
+}
@@ -0,0 +1,204 @@
+package traceopenai
+
+// this file parses the images API.
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/internal"
+)
+
+// imagesTracer is a tracer for the openai v1/images POST endpoints: generations, which
+// take JSON, and edits and variations, which take multipart forms. Input and output
+// images are logged as attachments.
+// See docs here: https://platform.openai.com/docs/api-reference/images
+type imagesTracer struct {
+	name      string
+	header    http.Header
+	streaming bool
+	metadata  map[string]any
+}
+
+func newImagesTracer(name, endpoint string) *imagesTracer {
+	return &imagesTracer{
+		name: name,
+		metadata: map[string]any{
+			"provider": "openai",
+			"endpoint": endpoint,
+		},
+	}
+}
+
+func (it *imagesTracer) SetRequestHeader(header http.Header) {
+	it.header = header
+}
+
+func (it *imagesTracer) StartSpan(ctx context.Context, t time.Time, request io.Reader) (context.Context, trace.Span, error) {
+	ctx, span := tracer().Start(
+		ctx,
+		it.name,
+		trace.WithTimestamp(t),
+	)
+
+	raw := map[string]any{}
+	input := map[string]any{}
+	if isMultipart(it.header) {
+		form, err := parseForm(it.header, request)
+		if err != nil {
+			return ctx, span, err
+		}
+		raw = form.values
+		for name, files := range form.files {
+			var images []any
+			for _, file := range files {
+				image, err := file.attachment()
+				if err != nil {
+					return ctx, span, err
+				}
+				images = append(images, image)
+			}
+			if len(images) == 1 {
+				input[name] = images[0]
+			} else {
+				input[name] = images
+			}
+		}
+	} else if err := json.NewDecoder(request).Decode(&raw); err != nil {
+		return ctx, span, err
+	}
+
+	metadataFields := []string{
+		"model",
+		"n",
+		"size",
+		"quality",
+		"response_format",
+		"style",
+		"background",
+		"output_format",
+		"output_compression",
+		"moderation",
+		"input_fidelity",
+		"partial_images",
+		"stream",
+		"user",
+	}
+	for _, field := range metadataFields {
+		if value, exists := raw[field]; exists {
+			it.metadata[field] = value
+		}
+	}
+	// form values are strings
+	it.streaming = raw["stream"] == true || raw["stream"] == "true"
+
+	if prompt, ok := raw["prompt"]; ok {
+		input["prompt"] = prompt
+	}
+	if len(input) > 0 {
+		if err := internal.SetJSONAttr(span, "braintrust.input_json", input); err != nil {
+			return ctx, span, err
+		}
+	}
+
+	if err := internal.SetJSONAttr(span, "braintrust.metadata", it.metadata); err != nil {
+		return ctx, span, err
+	}
+
+	return ctx, span, nil
+}
+
+func (it *imagesTracer) TagSpan(span trace.Span, body io.Reader) error {
+	var images []map[string]any
+	var usage map[string]any
+	if it.streaming {
+		// partial images are skipped, the completed events have the final images.
+		err := internal.ReadEvents(body, func(event map[string]any) error {
+			if eventType, _ := event["type"].(string); strings.HasSuffix(eventType, ".completed") {
+				images = append(images, event)
+				if u, ok := event["usage"].(map[string]any); ok {
+					usage = u
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		var raw struct {
+			Data         []map[string]any `json:"data"`
+			OutputFormat string           `json:"output_format"`
+			Usage        map[string]any   `json:"usage"`
+		}
+		if err := json.NewDecoder(body).Decode(&raw); err != nil {
+			return err
+		}
+		for _, image := range raw.Data {
+			if _, ok := image["output_format"]; !ok && raw.OutputFormat != "" {
+				image["output_format"] = raw.OutputFormat
+			}
+			images = append(images, image)
+		}
+		usage = raw.Usage
+	}
+
+	if usage != nil {
+		metrics := parseUsageTokens(usage)
+		if err := internal.SetUsageMetrics(span, internal.ModelName(it.metadata), metrics); err != nil {
+			return err
+		}
+	}
+
+	output := make([]map[string]any, 0, len(images))
+	for _, image := range images {
+		out := map[string]any{}
+		if b64, ok := image["b64_json"].(string); ok {
+			data, err := base64.StdEncoding.DecodeString(b64)
+			if err != nil {
+				return err
+			}
+			att, err := newAttachment(it.contentType(image), data)
+			if err != nil {
+				return err
+			}
+			out["image"] = att
+		}
+		for _, field := range []string{"url", "revised_prompt"} {
+			if value, ok := image[field]; ok {
+				out[field] = value
+			}
+		}
+		output = append(output, out)
+	}
+	return internal.SetJSONAttr(span, "braintrust.output_json", output)
+}
+
+// contentType returns the content type of a generated image, from its output format or
+// the requested one. The default is png.
+func (it *imagesTracer) contentType(image map[string]any) string {
+	format, _ := image["output_format"].(string)
+	if format == "" {
+		format, _ = it.metadata["output_format"].(string)
+	}
+	switch format {
+	case "jpeg", "webp":
+		return "image/" + format
+	default:
+		return "image/png"
+	}
+}
+
+// isMultipart returns whether a request's header has a multipart content type.
+func isMultipart(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && strings.HasPrefix(mediaType, "multipart/")
+}
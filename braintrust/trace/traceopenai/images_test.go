@@ -0,0 +1,123 @@
+package traceopenai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/oteltest"
+)
+
+var fakePNG = []byte("\x89PNG\r\n\x1a\nfake image")
+
+func base64Attachment(contentType string, data []byte) map[string]any {
+	return map[string]any{
+		"type":    "base64_attachment",
+		"content": "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data),
+	}
+}
+
+func TestImagesGenerate(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	client := newFakeClient("application/json", `{
+		"created": 1713833628,
+		"data": [{"b64_json": "`+base64.StdEncoding.EncodeToString(fakePNG)+`", "revised_prompt": "a cute otter"}],
+		"usage": {"input_tokens": 50, "output_tokens": 272, "total_tokens": 322, "input_tokens_details": {"text_tokens": 50, "image_tokens": 0}}
+	}`)
+	_, err := client.Images.Generate(context.Background(), openai.ImageGenerateParams{
+		Prompt: "an otter",
+		Model:  openai.ImageModelGPTImage1,
+		Size:   openai.ImageGenerateParamsSize1024x1024,
+	})
+	require.NoError(t, err)
+
+	span := exporter.FlushOne()
+	span.AssertNameIs("openai.images.generate")
+	assert.Equal(t, map[string]any{"prompt": "an otter"}, span.Input())
+	assert.Equal(t, []any{map[string]any{
+		"image":          base64Attachment("image/png", fakePNG),
+		"revised_prompt": "a cute otter",
+	}}, span.Output())
+	metadata := span.Metadata()
+	assert.Equal(t, "gpt-image-1", metadata["model"])
+	assert.Equal(t, "1024x1024", metadata["size"])
+	metrics := span.Metrics()
+	assert.Equal(t, float64(50), metrics["prompt_tokens"])
+	assert.Equal(t, float64(272), metrics["completion_tokens"])
+	assert.Equal(t, float64(50), metrics["prompt_text_tokens"])
+}
+
+func TestImagesGenerate_URL(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	client := newFakeClient("application/json", `{"created": 1, "data": [{"url": "https://example.com/otter.png"}]}`)
+	_, err := client.Images.Generate(context.Background(), openai.ImageGenerateParams{
+		Prompt: "an otter",
+		Model:  openai.ImageModelDallE3,
+	})
+	require.NoError(t, err)
+
+	span := exporter.FlushOne()
+	assert.Equal(t, []any{map[string]any{"url": "https://example.com/otter.png"}}, span.Output())
+	assert.False(t, span.HasAttr("braintrust.metrics"))
+}
+
+func TestImagesEdit(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	fakeJPEG := []byte("\xff\xd8\xfffake jpeg")
+	client := newFakeClient("application/json", `{
+		"created": 1,
+		"output_format": "jpeg",
+		"data": [{"b64_json": "`+base64.StdEncoding.EncodeToString(fakeJPEG)+`"}]
+	}`)
+	_, err := client.Images.Edit(context.Background(), openai.ImageEditParams{
+		Image:        openai.ImageEditParamsImageUnion{OfFile: openai.File(bytes.NewReader(fakePNG), "otter.png", "")},
+		Prompt:       "add a hat",
+		Model:        openai.ImageModelGPTImage1,
+		OutputFormat: openai.ImageEditParamsOutputFormatJPEG,
+	})
+	require.NoError(t, err)
+
+	span := exporter.FlushOne()
+	span.AssertNameIs("openai.images.edit")
+	assert.Equal(t, map[string]any{
+		"prompt": "add a hat",
+		"image":  base64Attachment("image/png", fakePNG),
+	}, span.Input())
+	assert.Equal(t, []any{map[string]any{"image": base64Attachment("image/jpeg", fakeJPEG)}}, span.Output())
+	metadata := span.Metadata()
+	assert.Equal(t, "gpt-image-1", metadata["model"])
+	assert.Equal(t, "/v1/images/edits", metadata["endpoint"])
+}
+
+func TestImagesGenerate_Streaming(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	image := base64.StdEncoding.EncodeToString(fakePNG)
+	client := newFakeClient("text/event-stream", `data: {"type": "image_generation.partial_image", "b64_json": "`+image+`", "partial_image_index": 0}
+
+data: {"type": "image_generation.completed", "b64_json": "`+image+`", "output_format": "webp", "usage": {"input_tokens": 10, "output_tokens": 100, "total_tokens": 110}}
+
+`)
+	stream := client.Images.GenerateStreaming(context.Background(), openai.ImageGenerateParams{
+		Prompt:        "an otter",
+		Model:         openai.ImageModelGPTImage1,
+		PartialImages: openai.Int(1),
+	})
+	for stream.Next() {
+	}
+	require.NoError(t, stream.Err())
+	require.NoError(t, stream.Close())
+
+	span := exporter.FlushOne()
+	assert.Equal(t, []any{map[string]any{"image": base64Attachment("image/webp", fakePNG)}}, span.Output())
+	assert.Equal(t, true, span.Metadata()["stream"])
+	assert.Equal(t, float64(110), span.Metrics()["tokens"])
+}
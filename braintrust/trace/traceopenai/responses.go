@@ -21,6 +21,7 @@ import (
 type responsesTracer struct {
 	streaming bool
 	metadata  map[string]any
+	internal.StreamTiming
 }
 
 func newResponsesTracer() *responsesTracer {
@@ -103,11 +104,14 @@ func (rt *responsesTracer) TagSpan(span trace.Span, body io.Reader) error {
 
 func (rt *responsesTracer) parseStreamingResponse(span trace.Span, body io.Reader) error {
 	scanner := bufio.NewScanner(body)
+	var chunks int
 	for scanner.Scan() {
 		line := scanner.Text()
 		if !strings.HasPrefix(line, "data: ") {
 			continue
 		}
+		i := chunks
+		chunks++
 
 		line = strings.TrimPrefix(line, "data: ")
 		var envelope map[string]any
@@ -117,6 +121,10 @@ func (rt *responsesTracer) parseStreamingResponse(span trace.Span, body io.Reade
 		}
 
 		if msgType, ok := envelope["type"].(string); ok {
+			// deltas of text, tool call arguments, reasoning, etc. are output
+			if strings.HasSuffix(msgType, ".delta") {
+				rt.Output(i)
+			}
 			// the response.completed message has everything, so just parse that. Should we
 			// parse the other messages too?
 			if msgType == "response.completed" {
@@ -182,7 +190,7 @@ func (rt *responsesTracer) handleResponseCompletedMessage(span trace.Span, rawMs
 
 	if usage, ok := rawMsg["usage"].(map[string]any); ok {
 		metrics := parseUsageTokens(usage)
-		if err := internal.SetJSONAttr(span, "braintrust.metrics", metrics); err != nil {
+		if err := rt.StreamTiming.SetUsageMetrics(span, internal.ModelName(rt.metadata), metrics); err != nil {
 			return err
 		}
 	}
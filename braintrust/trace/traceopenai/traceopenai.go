@@ -22,6 +22,16 @@
 //			openai.UserMessage("Hello!"),
 //		}),
 //	})
+//
+// Chat completions, legacy completions, responses, embeddings, moderations, images and
+// audio are traced. Images and audio are logged as attachments, and embeddings are
+// logged without their vectors. Requests of batch jobs are traced with TraceBatch.
+//
+// Tool calls of chat completions are traced as "tool" spans, siblings of the completion's
+// span, which end when a follow-up request sends their results.
+//
+// Spans of streaming responses have the time_to_first_token, inter-chunk latency and
+// tokens_per_second of their output as metrics.
 package traceopenai
 
 import (
@@ -60,6 +70,42 @@ func openaiRouter(path string) internal.MiddlewareTracer {
 		return newResponsesTracer()
 	}
 
+	if strings.HasSuffix(path, "/v1/completions") {
+		return newCompletionsTracer()
+	}
+
+	if strings.HasSuffix(path, "/v1/embeddings") {
+		return newEmbeddingsTracer()
+	}
+
+	if strings.HasSuffix(path, "/v1/moderations") {
+		return newModerationsTracer()
+	}
+
+	if strings.HasSuffix(path, "/v1/images/generations") {
+		return newImagesTracer("openai.images.generate", "/v1/images/generations")
+	}
+
+	if strings.HasSuffix(path, "/v1/images/edits") {
+		return newImagesTracer("openai.images.edit", "/v1/images/edits")
+	}
+
+	if strings.HasSuffix(path, "/v1/images/variations") {
+		return newImagesTracer("openai.images.create_variation", "/v1/images/variations")
+	}
+
+	if strings.HasSuffix(path, "/v1/audio/transcriptions") {
+		return newTranscriptionsTracer("openai.audio.transcriptions.create", "/v1/audio/transcriptions")
+	}
+
+	if strings.HasSuffix(path, "/v1/audio/translations") {
+		return newTranscriptionsTracer("openai.audio.translations.create", "/v1/audio/translations")
+	}
+
+	if strings.HasSuffix(path, "/v1/audio/speech") {
+		return newSpeechTracer()
+	}
+
 	return nil
 }
 
@@ -74,8 +120,9 @@ func parseUsageTokens(usage map[string]interface{}) map[string]int64 {
 
 	// Parse token metrics and translate names to be consistent
 	for k, v := range usage {
-		if strings.HasSuffix(k, "_tokens_details") {
-			prefix := translateMetricPrefix(strings.TrimSuffix(k, "_tokens_details"))
+		// the audio APIs have input_token_details instead of input_tokens_details
+		if strings.HasSuffix(k, "_tokens_details") || strings.HasSuffix(k, "_token_details") {
+			prefix := translateMetricPrefix(strings.TrimSuffix(strings.TrimSuffix(k, "_tokens_details"), "_token_details"))
 			if details, ok := v.(map[string]interface{}); ok {
 				for kd, vd := range details {
 					if ok, i := internal.ToInt64(vd); ok {
@@ -118,3 +165,16 @@ func translateMetricPrefix(prefix string) string {
 // Ensure our tracers implement the shared interface
 var _ internal.MiddlewareTracer = &responsesTracer{}
 var _ internal.MiddlewareTracer = &chatCompletionsTracer{}
+var _ internal.MiddlewareTracer = &completionsTracer{}
+var _ internal.MiddlewareTracer = &embeddingsTracer{}
+var _ internal.MiddlewareTracer = &moderationsTracer{}
+var _ internal.MiddlewareTracer = &imagesTracer{}
+var _ internal.MiddlewareTracer = &speechTracer{}
+var _ internal.MiddlewareTracer = &transcriptionsTracer{}
+var _ internal.RequestHeaderTracer = &imagesTracer{}
+var _ internal.RequestHeaderTracer = &transcriptionsTracer{}
+var _ batchTracer = &chatCompletionsTracer{}
+var _ batchTracer = &completionsTracer{}
+var _ batchTracer = &responsesTracer{}
+var _ batchTracer = &embeddingsTracer{}
+var _ batchTracer = &moderationsTracer{}
@@ -0,0 +1,266 @@
+// Package tracetemporal traces Temporal workflows and activities to Braintrust, so an
+// eval or request that starts a workflow, the workflow, and its activities land in the
+// same Braintrust trace and project.
+//
+// The interceptor is both a client and a worker interceptor. Add it to your clients,
+// and the workers created from them use it too:
+//
+//	c, err := client.Dial(client.Options{
+//		Interceptors: []interceptor.ClientInterceptor{tracetemporal.NewInterceptor()},
+//	})
+//
+// It sends the W3C trace context, the baggage and the Braintrust parent in Temporal
+// headers, and records a span for each workflow and activity run. Workflow runs are
+// "task" spans, and activity runs are "function" spans with the activity's arguments
+// and result as their input and output. The context of activities carries the trace
+// and the parent, so spans started in activities (e.g. by traceopenai) are children of
+// the activity's span.
+//
+// It's a module of its own, so only programs that use it depend on the Temporal SDK:
+//
+//	go get github.com/braintrustdata/braintrust-x-go/braintrust/trace/tracetemporal
+package tracetemporal
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.temporal.io/sdk/interceptor"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/log"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace"
+)
+
+// HeaderKey is the Temporal header that carries the trace. It's the one used by the
+// Temporal SDKs' own tracing interceptors, so traces continue across workers that use
+// them.
+const HeaderKey = "_tracer-data"
+
+// ParentKey is the key of the Braintrust parent in the header, e.g.
+// "project_name:my-project".
+const ParentKey = "x-bt-parent"
+
+// Propagator reads and writes the W3C trace context and baggage.
+var Propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// Option configures the interceptor.
+type Option func(*config)
+
+type config struct {
+	tracerProvider oteltrace.TracerProvider
+	activityIO     bool
+}
+
+// WithTracerProvider sets the tracer provider of the spans (default: the global one).
+func WithTracerProvider(tp oteltrace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithActivityIO sets whether the arguments and results of activities are recorded as
+// the input and output of their spans (default: true).
+func WithActivityIO(enabled bool) Option {
+	return func(c *config) {
+		c.activityIO = enabled
+	}
+}
+
+func newConfig(opts []Option) config {
+	c := config{activityIO: true}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// NewInterceptor returns a Temporal client and worker interceptor that traces
+// workflows and activities.
+func NewInterceptor(opts ...Option) interceptor.Interceptor {
+	c := newConfig(opts)
+	return &tracingInterceptor{
+		Interceptor: interceptor.NewTracingInterceptor(newTracer(c)),
+		activityIO:  c.activityIO,
+	}
+}
+
+// tracingInterceptor adds the recording of activity inputs and outputs to Temporal's
+// tracing interceptor.
+type tracingInterceptor struct {
+	interceptor.Interceptor
+	activityIO bool
+}
+
+func (i *tracingInterceptor) InterceptActivity(ctx context.Context, next interceptor.ActivityInboundInterceptor) interceptor.ActivityInboundInterceptor {
+	if i.activityIO {
+		next = &activityIOInterceptor{ActivityInboundInterceptorBase: interceptor.ActivityInboundInterceptorBase{Next: next}}
+	}
+	// the tracing interceptor runs first, so the activity's span is in the context
+	// of ours
+	return i.Interceptor.InterceptActivity(ctx, next)
+}
+
+type activityIOInterceptor struct {
+	interceptor.ActivityInboundInterceptorBase
+}
+
+func (i *activityIOInterceptor) ExecuteActivity(ctx context.Context, in *interceptor.ExecuteActivityInput) (any, error) {
+	span := oteltrace.SpanFromContext(ctx)
+	if len(in.Args) == 1 {
+		setIO(span, trace.SetInput, in.Args[0])
+	} else {
+		setIO(span, trace.SetInput, in.Args)
+	}
+	result, err := i.Next.ExecuteActivity(ctx, in)
+	if err == nil && result != nil {
+		setIO(span, trace.SetOutput, result)
+	}
+	return result, err
+}
+
+func setIO(span oteltrace.Span, set func(oteltrace.Span, any) error, value any) {
+	if err := set(span, value); err != nil {
+		log.Warnf("tracetemporal: failed to record activity input or output: %v", err)
+	}
+}
+
+// NewTracer returns the interceptor.Tracer of NewInterceptor, for use with
+// interceptor.NewTracingInterceptor. Most callers use NewInterceptor instead. The
+// activity inputs and outputs are recorded by NewInterceptor, not the tracer.
+func NewTracer(opts ...Option) interceptor.Tracer {
+	return newTracer(newConfig(opts))
+}
+
+func newTracer(c config) *tracer {
+	tp := c.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &tracer{tracer: tp.Tracer("braintrust.temporal")}
+}
+
+type tracer struct {
+	interceptor.BaseTracer
+	tracer oteltrace.Tracer
+}
+
+type spanContextKey struct{}
+
+// spanRef is a span read from a header. Its context has the remote span context, the
+// baggage and the Braintrust parent of the header.
+type spanRef struct {
+	ctx context.Context
+}
+
+// span is a span started by the tracer, or found in a context. Its context has the
+// span, the baggage and the Braintrust parent.
+type span struct {
+	oteltrace.Span
+	ctx context.Context
+}
+
+func (s *span) Finish(opts *interceptor.TracerFinishSpanOptions) {
+	if opts.Error != nil {
+		s.RecordError(opts.Error)
+		s.SetStatus(codes.Error, opts.Error.Error())
+	}
+	s.End()
+}
+
+func (t *tracer) Options() interceptor.TracerOptions {
+	return interceptor.TracerOptions{
+		SpanContextKey: spanContextKey{},
+		HeaderKey:      HeaderKey,
+	}
+}
+
+func (t *tracer) UnmarshalSpan(m map[string]string) (interceptor.TracerSpanRef, error) {
+	carrier := propagation.MapCarrier(m)
+	ctx := Propagator.Extract(context.Background(), carrier)
+	if value := carrier.Get(ParentKey); value != "" {
+		parent, err := trace.ParseParent(value)
+		if err != nil {
+			log.Warnf("tracetemporal: ignoring invalid %s in header: %v", ParentKey, err)
+		} else {
+			ctx = trace.SetParent(ctx, parent)
+		}
+	}
+	if !oteltrace.SpanContextFromContext(ctx).IsValid() {
+		if ok, _ := trace.GetParent(ctx); !ok {
+			return nil, fmt.Errorf("tracetemporal: no trace context or parent in header")
+		}
+	}
+	return &spanRef{ctx: ctx}, nil
+}
+
+func (t *tracer) MarshalSpan(s interceptor.TracerSpan) (map[string]string, error) {
+	carrier := propagation.MapCarrier{}
+	ctx := s.(*span).ctx
+	Propagator.Inject(ctx, carrier)
+	if ok, parent := trace.GetParent(ctx); ok {
+		carrier.Set(ParentKey, parent.String())
+	}
+	return carrier, nil
+}
+
+func (t *tracer) SpanFromContext(ctx context.Context) interceptor.TracerSpan {
+	// a context with only a Braintrust parent counts too, so it isn't lost
+	ok, _ := trace.GetParent(ctx)
+	s := oteltrace.SpanFromContext(ctx)
+	if !ok && !s.SpanContext().IsValid() {
+		return nil
+	}
+	return &span{Span: s, ctx: ctx}
+}
+
+func (t *tracer) ContextWithSpan(ctx context.Context, s interceptor.TracerSpan) context.Context {
+	return contextWith(ctx, s.(*span).ctx)
+}
+
+func (t *tracer) StartSpan(opts *interceptor.TracerStartSpanOptions) (interceptor.TracerSpan, error) {
+	ctx := context.Background()
+	switch parent := opts.Parent.(type) {
+	case nil:
+	case *span:
+		ctx = parent.ctx
+	case *spanRef:
+		ctx = parent.ctx
+	default:
+		return nil, fmt.Errorf("tracetemporal: unrecognized parent type %T", parent)
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(opts.Tags))
+	for k, v := range opts.Tags {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	ctx, s := t.tracer.Start(ctx, t.SpanName(opts),
+		oteltrace.WithTimestamp(opts.Time),
+		oteltrace.WithAttributes(attrs...),
+	)
+	switch opts.Operation {
+	case "RunWorkflow":
+		_ = trace.SetSpanType(s, trace.SpanTypeTask)
+	case "RunActivity":
+		_ = trace.SetSpanType(s, trace.SpanTypeFunction)
+	}
+	return &span{Span: s, ctx: ctx}, nil
+}
+
+// contextWith returns ctx with the span, baggage and Braintrust parent of from.
+func contextWith(ctx, from context.Context) context.Context {
+	ctx = oteltrace.ContextWithSpan(ctx, oteltrace.SpanFromContext(from))
+	ctx = baggage.ContextWithBaggage(ctx, baggage.FromContext(from))
+	if ok, parent := trace.GetParent(from); ok {
+		ctx = trace.SetParent(ctx, parent)
+	}
+	return ctx
+}
@@ -0,0 +1,189 @@
+package tracetemporal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	commonpb "go.temporal.io/api/common/v1"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/internal/oteltest"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace"
+)
+
+type Order struct {
+	ID    string `json:"id"`
+	Items int    `json:"items"`
+}
+
+// Charge starts a span of its own, and records the Braintrust parent of its context.
+func Charge(ctx context.Context, order Order, cents int) (string, error) {
+	_, span := otel.Tracer("app").Start(ctx, "charge-card")
+	defer span.End()
+	if order.ID == "declined" {
+		return "", temporal.NewNonRetryableApplicationError("card declined", "declined", nil)
+	}
+	_, parent := trace.GetParent(ctx)
+	return "charged " + order.ID + " to " + parent.String(), nil
+}
+
+func OrderWorkflow(ctx workflow.Context, order Order) (string, error) {
+	ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{StartToCloseTimeout: time.Minute})
+	var receipt string
+	err := workflow.ExecuteActivity(ctx, Charge, order, 1299).Get(ctx, &receipt)
+	return receipt, err
+}
+
+// newTestEnv returns a test workflow environment with the interceptor, started with the
+// header a client with the interceptor sends for ctx.
+func newTestEnv(t *testing.T, ctx context.Context, opts ...Option) *testsuite.TestWorkflowEnvironment {
+	t.Helper()
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestWorkflowEnvironment()
+	env.SetWorkerOptions(worker.Options{Interceptors: []interceptor.WorkerInterceptor{NewInterceptor(opts...)}})
+	env.RegisterWorkflow(OrderWorkflow)
+	env.RegisterActivity(Charge)
+
+	tracer := NewTracer()
+	if span := tracer.SpanFromContext(ctx); span != nil {
+		data, err := tracer.MarshalSpan(span)
+		require.NoError(t, err)
+		payload, err := converter.GetDefaultDataConverter().ToPayload(data)
+		require.NoError(t, err)
+		env.SetHeader(&commonpb.Header{Fields: map[string]*commonpb.Payload{HeaderKey: payload}})
+	}
+	return env
+}
+
+func spansByName(spans []oteltest.Span) map[string]oteltest.Span {
+	byName := map[string]oteltest.Span{}
+	for _, span := range spans {
+		byName[span.Stub.Name] = span
+	}
+	return byName
+}
+
+func TestWorkflow(t *testing.T) {
+	tracer, exporter := oteltest.Setup(t)
+
+	ctx := trace.SetParent(context.Background(), trace.Parent{Type: trace.ParentTypeExperimentID, ID: "exp-1"})
+	ctx, root := tracer.Start(ctx, "eval-case")
+	env := newTestEnv(t, ctx)
+	env.ExecuteWorkflow(OrderWorkflow, Order{ID: "o-1", Items: 2})
+	root.End()
+
+	require.True(t, env.IsWorkflowCompleted())
+	require.NoError(t, env.GetWorkflowError())
+	var receipt string
+	require.NoError(t, env.GetWorkflowResult(&receipt))
+	assert.Equal(t, "charged o-1 to experiment_id:exp-1", receipt)
+
+	spans := spansByName(exporter.Flush())
+	require.Len(t, spans, 5)
+	rootSpan := spans["eval-case"]
+	workflowSpan := spans["RunWorkflow:OrderWorkflow"]
+	startSpan := spans["StartActivity:Charge"]
+	activitySpan := spans["RunActivity:Charge"]
+	chargeSpan := spans["charge-card"]
+
+	// one trace: eval-case > workflow > start activity > activity > charge-card
+	traceID := rootSpan.Stub.SpanContext.TraceID()
+	for _, span := range spans {
+		assert.Equal(t, traceID, span.Stub.SpanContext.TraceID(), span.Stub.Name)
+		span.AssertAttrEquals(trace.ParentOtelAttrKey, "experiment_id:exp-1")
+	}
+	assert.Equal(t, rootSpan.Stub.SpanContext.SpanID(), workflowSpan.Stub.Parent.SpanID())
+	assert.Equal(t, workflowSpan.Stub.SpanContext.SpanID(), startSpan.Stub.Parent.SpanID())
+	assert.Equal(t, startSpan.Stub.SpanContext.SpanID(), activitySpan.Stub.Parent.SpanID())
+	assert.Equal(t, activitySpan.Stub.SpanContext.SpanID(), chargeSpan.Stub.Parent.SpanID())
+
+	workflowSpan.AssertAttrEquals("braintrust.span_attributes", `{"type":"task"}`)
+	activitySpan.AssertAttrEquals("braintrust.span_attributes", `{"type":"function"}`)
+	assert.Equal(t, []any{map[string]any{"id": "o-1", "items": float64(2)}, float64(1299)}, activitySpan.Input())
+	assert.Equal(t, "charged o-1 to experiment_id:exp-1", activitySpan.Output())
+}
+
+func TestWorkflow_ActivityError(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	ctx := trace.SetParent(context.Background(), trace.Parent{Type: trace.ParentTypeProject, ID: "orders"})
+	env := newTestEnv(t, ctx, WithActivityIO(false))
+	env.ExecuteWorkflow(OrderWorkflow, Order{ID: "declined"})
+	var appErr *temporal.ApplicationError
+	require.True(t, errors.As(env.GetWorkflowError(), &appErr))
+
+	spans := spansByName(exporter.Flush())
+	for _, span := range spans {
+		span.AssertAttrEquals(trace.ParentOtelAttrKey, "project_name:orders")
+	}
+	activitySpan := spans["RunActivity:Charge"]
+	assert.Equal(t, codes.Error, activitySpan.Status().Code)
+	assert.Contains(t, activitySpan.Status().Description, "card declined")
+	assert.False(t, activitySpan.HasAttr("braintrust.input_json"))
+	workflowSpan := spans["RunWorkflow:OrderWorkflow"]
+	assert.Equal(t, codes.Error, workflowSpan.Status().Code)
+}
+
+func TestWorkflow_NoParent(t *testing.T) {
+	_, exporter := oteltest.Setup(t)
+
+	env := newTestEnv(t, context.Background())
+	env.ExecuteWorkflow(OrderWorkflow, Order{ID: "o-2"})
+	require.NoError(t, env.GetWorkflowError())
+
+	spans := spansByName(exporter.Flush())
+	require.Len(t, spans, 4)
+	workflowSpan := spans["RunWorkflow:OrderWorkflow"]
+	assert.False(t, workflowSpan.Stub.Parent.IsValid())
+	assert.Equal(t, workflowSpan.Stub.SpanContext.TraceID(), spans["charge-card"].Stub.SpanContext.TraceID())
+}
+
+func TestTracer_MarshalSpan(t *testing.T) {
+	tracer, exporter := oteltest.Setup(t)
+	tt := NewTracer()
+
+	// a parent without a span is still sent
+	ctx := trace.SetParent(context.Background(), trace.Parent{Type: trace.ParentTypeProjectID, ID: "p1"})
+	data, err := tt.MarshalSpan(tt.SpanFromContext(ctx))
+	require.NoError(t, err)
+	assert.Equal(t, "project_id:p1", data[ParentKey])
+	assert.NotContains(t, data, "traceparent")
+
+	ctx, root := tracer.Start(ctx, "root")
+	root.End()
+	data, err = tt.MarshalSpan(tt.SpanFromContext(ctx))
+	require.NoError(t, err)
+	assert.Contains(t, data, "traceparent")
+
+	// a span started from the header continues the trace, with the parent
+	ref, err := tt.UnmarshalSpan(data)
+	require.NoError(t, err)
+	child, err := tt.StartSpan(&interceptor.TracerStartSpanOptions{Parent: ref, Operation: "RunWorkflow", Name: "wf"})
+	require.NoError(t, err)
+	childCtx := tt.ContextWithSpan(context.Background(), child)
+	child.Finish(&interceptor.TracerFinishSpanOptions{})
+	_, parent := trace.GetParent(childCtx)
+	assert.Equal(t, "p1", parent.ID)
+
+	spans := exporter.Flush()
+	require.Len(t, spans, 2)
+	assert.Equal(t, spans[0].Stub.SpanContext.TraceID(), spans[1].Stub.SpanContext.TraceID())
+	assert.Equal(t, spans[0].Stub.SpanContext.SpanID(), spans[1].Stub.Parent.SpanID())
+	spans[1].AssertNameIs("RunWorkflow:wf")
+	spans[1].AssertAttrEquals(trace.ParentOtelAttrKey, "project_id:p1")
+
+	_, err = tt.UnmarshalSpan(map[string]string{})
+	assert.Error(t, err)
+	assert.Nil(t, tt.SpanFromContext(context.Background()))
+}
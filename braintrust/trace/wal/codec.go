@@ -0,0 +1,300 @@
+package wal
+
+// this file encodes spans to JSON, so they can be stored on disk and exported later.
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type spanRecord struct {
+	Name              string        `json:"name"`
+	SpanContext       spanContext   `json:"span_context"`
+	Parent            spanContext   `json:"parent"`
+	Kind              int           `json:"kind"`
+	StartTime         time.Time     `json:"start_time"`
+	EndTime           time.Time     `json:"end_time"`
+	Attributes        []attr        `json:"attributes,omitempty"`
+	Events            []eventRecord `json:"events,omitempty"`
+	Links             []linkRecord  `json:"links,omitempty"`
+	StatusCode        uint32        `json:"status_code"`
+	StatusDescription string        `json:"status_description,omitempty"`
+	DroppedAttributes int           `json:"dropped_attributes,omitempty"`
+	DroppedEvents     int           `json:"dropped_events,omitempty"`
+	DroppedLinks      int           `json:"dropped_links,omitempty"`
+	ChildSpanCount    int           `json:"child_span_count,omitempty"`
+	Resource          []attr        `json:"resource,omitempty"`
+	ResourceSchemaURL string        `json:"resource_schema_url,omitempty"`
+	Scope             scopeRecord   `json:"scope"`
+}
+
+type spanContext struct {
+	TraceID    string `json:"trace_id,omitempty"`
+	SpanID     string `json:"span_id,omitempty"`
+	TraceFlags byte   `json:"trace_flags,omitempty"`
+	TraceState string `json:"trace_state,omitempty"`
+	Remote     bool   `json:"remote,omitempty"`
+}
+
+type eventRecord struct {
+	Name       string    `json:"name"`
+	Time       time.Time `json:"time"`
+	Attributes []attr    `json:"attributes,omitempty"`
+}
+
+type linkRecord struct {
+	SpanContext spanContext `json:"span_context"`
+	Attributes  []attr      `json:"attributes,omitempty"`
+}
+
+type scopeRecord struct {
+	Name       string `json:"name,omitempty"`
+	Version    string `json:"version,omitempty"`
+	SchemaURL  string `json:"schema_url,omitempty"`
+	Attributes []attr `json:"attributes,omitempty"`
+}
+
+// attr is an attribute with its type, so it can be decoded exactly.
+type attr struct {
+	Key   string          `json:"k"`
+	Type  string          `json:"t"`
+	Value json.RawMessage `json:"v"`
+}
+
+func encodeSpans(spans []sdktrace.ReadOnlySpan) ([]byte, error) {
+	records := make([]spanRecord, len(spans))
+	for i, s := range spans {
+		scope := s.InstrumentationScope()
+		r := spanRecord{
+			Name:              s.Name(),
+			SpanContext:       encodeSpanContext(s.SpanContext()),
+			Parent:            encodeSpanContext(s.Parent()),
+			Kind:              int(s.SpanKind()),
+			StartTime:         s.StartTime(),
+			EndTime:           s.EndTime(),
+			Attributes:        encodeAttrs(s.Attributes()),
+			StatusCode:        uint32(s.Status().Code),
+			StatusDescription: s.Status().Description,
+			DroppedAttributes: s.DroppedAttributes(),
+			DroppedEvents:     s.DroppedEvents(),
+			DroppedLinks:      s.DroppedLinks(),
+			ChildSpanCount:    s.ChildSpanCount(),
+			Scope: scopeRecord{
+				Name:       scope.Name,
+				Version:    scope.Version,
+				SchemaURL:  scope.SchemaURL,
+				Attributes: encodeAttrs(scope.Attributes.ToSlice()),
+			},
+		}
+		for _, e := range s.Events() {
+			r.Events = append(r.Events, eventRecord{Name: e.Name, Time: e.Time, Attributes: encodeAttrs(e.Attributes)})
+		}
+		for _, l := range s.Links() {
+			r.Links = append(r.Links, linkRecord{SpanContext: encodeSpanContext(l.SpanContext), Attributes: encodeAttrs(l.Attributes)})
+		}
+		if res := s.Resource(); res != nil {
+			r.Resource = encodeAttrs(res.Attributes())
+			r.ResourceSchemaURL = res.SchemaURL()
+		}
+		records[i] = r
+	}
+	return json.Marshal(records)
+}
+
+func decodeSpans(data []byte) ([]sdktrace.ReadOnlySpan, error) {
+	var records []spanRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+
+	spans := make([]sdktrace.ReadOnlySpan, len(records))
+	for i, r := range records {
+		stub := tracetest.SpanStub{
+			Name:              r.Name,
+			SpanKind:          trace.SpanKind(r.Kind),
+			StartTime:         r.StartTime,
+			EndTime:           r.EndTime,
+			Status:            sdktrace.Status{Code: codes.Code(r.StatusCode), Description: r.StatusDescription},
+			DroppedAttributes: r.DroppedAttributes,
+			DroppedEvents:     r.DroppedEvents,
+			DroppedLinks:      r.DroppedLinks,
+			ChildSpanCount:    r.ChildSpanCount,
+		}
+		var err error
+		if stub.SpanContext, err = decodeSpanContext(r.SpanContext); err != nil {
+			return nil, err
+		}
+		if stub.Parent, err = decodeSpanContext(r.Parent); err != nil {
+			return nil, err
+		}
+		if stub.Attributes, err = decodeAttrs(r.Attributes); err != nil {
+			return nil, err
+		}
+		for _, e := range r.Events {
+			attrs, err := decodeAttrs(e.Attributes)
+			if err != nil {
+				return nil, err
+			}
+			stub.Events = append(stub.Events, sdktrace.Event{Name: e.Name, Time: e.Time, Attributes: attrs})
+		}
+		for _, l := range r.Links {
+			sc, err := decodeSpanContext(l.SpanContext)
+			if err != nil {
+				return nil, err
+			}
+			attrs, err := decodeAttrs(l.Attributes)
+			if err != nil {
+				return nil, err
+			}
+			stub.Links = append(stub.Links, sdktrace.Link{SpanContext: sc, Attributes: attrs})
+		}
+		resAttrs, err := decodeAttrs(r.Resource)
+		if err != nil {
+			return nil, err
+		}
+		stub.Resource = resource.NewWithAttributes(r.ResourceSchemaURL, resAttrs...)
+		scopeAttrs, err := decodeAttrs(r.Scope.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		stub.InstrumentationScope = instrumentation.Scope{
+			Name:       r.Scope.Name,
+			Version:    r.Scope.Version,
+			SchemaURL:  r.Scope.SchemaURL,
+			Attributes: attribute.NewSet(scopeAttrs...),
+		}
+		spans[i] = stub.Snapshot()
+	}
+	return spans, nil
+}
+
+func encodeSpanContext(sc trace.SpanContext) spanContext {
+	if !sc.IsValid() {
+		return spanContext{}
+	}
+	return spanContext{
+		TraceID:    sc.TraceID().String(),
+		SpanID:     sc.SpanID().String(),
+		TraceFlags: byte(sc.TraceFlags()),
+		TraceState: sc.TraceState().String(),
+		Remote:     sc.IsRemote(),
+	}
+}
+
+func decodeSpanContext(r spanContext) (trace.SpanContext, error) {
+	if r.TraceID == "" {
+		return trace.SpanContext{}, nil
+	}
+	var cfg trace.SpanContextConfig
+	if _, err := hex.Decode(cfg.TraceID[:], []byte(r.TraceID)); err != nil {
+		return trace.SpanContext{}, fmt.Errorf("invalid trace ID %q: %w", r.TraceID, err)
+	}
+	if _, err := hex.Decode(cfg.SpanID[:], []byte(r.SpanID)); err != nil {
+		return trace.SpanContext{}, fmt.Errorf("invalid span ID %q: %w", r.SpanID, err)
+	}
+	state, err := trace.ParseTraceState(r.TraceState)
+	if err != nil {
+		return trace.SpanContext{}, err
+	}
+	cfg.TraceFlags = trace.TraceFlags(r.TraceFlags)
+	cfg.TraceState = state
+	cfg.Remote = r.Remote
+	return trace.NewSpanContext(cfg), nil
+}
+
+func encodeAttrs(attrs []attribute.KeyValue) []attr {
+	if len(attrs) == 0 {
+		return nil
+	}
+	out := make([]attr, 0, len(attrs))
+	for _, a := range attrs {
+		v := a.Value.AsInterface()
+		if f, ok := v.(float64); ok && !isFinite(f) {
+			// JSON has no NaN or infinity
+			v = fmt.Sprint(f)
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			b, _ = json.Marshal(a.Value.Emit())
+		}
+		out = append(out, attr{Key: string(a.Key), Type: a.Value.Type().String(), Value: b})
+	}
+	return out
+}
+
+func decodeAttrs(attrs []attr) ([]attribute.KeyValue, error) {
+	if len(attrs) == 0 {
+		return nil, nil
+	}
+	out := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		kv, err := decodeAttr(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attribute %q: %w", a.Key, err)
+		}
+		out = append(out, kv)
+	}
+	return out, nil
+}
+
+func decodeAttr(a attr) (attribute.KeyValue, error) {
+	switch a.Type {
+	case attribute.BOOL.String():
+		var v bool
+		err := json.Unmarshal(a.Value, &v)
+		return attribute.Bool(a.Key, v), err
+	case attribute.INT64.String():
+		var v int64
+		err := json.Unmarshal(a.Value, &v)
+		return attribute.Int64(a.Key, v), err
+	case attribute.FLOAT64.String():
+		var v float64
+		if err := json.Unmarshal(a.Value, &v); err != nil {
+			// NaN and infinity are stored as strings
+			var s string
+			if json.Unmarshal(a.Value, &s) != nil {
+				return attribute.KeyValue{}, err
+			}
+			if _, scanErr := fmt.Sscan(s, &v); scanErr != nil {
+				return attribute.KeyValue{}, err
+			}
+		}
+		return attribute.Float64(a.Key, v), nil
+	case attribute.STRING.String():
+		var v string
+		err := json.Unmarshal(a.Value, &v)
+		return attribute.String(a.Key, v), err
+	case attribute.BOOLSLICE.String():
+		var v []bool
+		err := json.Unmarshal(a.Value, &v)
+		return attribute.BoolSlice(a.Key, v), err
+	case attribute.INT64SLICE.String():
+		var v []int64
+		err := json.Unmarshal(a.Value, &v)
+		return attribute.Int64Slice(a.Key, v), err
+	case attribute.FLOAT64SLICE.String():
+		var v []float64
+		err := json.Unmarshal(a.Value, &v)
+		return attribute.Float64Slice(a.Key, v), err
+	case attribute.STRINGSLICE.String():
+		var v []string
+		err := json.Unmarshal(a.Value, &v)
+		return attribute.StringSlice(a.Key, v), err
+	default:
+		return attribute.KeyValue{}, fmt.Errorf("unknown type %q", a.Type)
+	}
+}
+
+func isFinite(f float64) bool {
+	return f == f && f-f == 0
+}
@@ -0,0 +1,680 @@
+// Package wal provides a span exporter that writes spans to a write-ahead log on local
+// disk before exporting them, so spans survive network outages and restarts.
+//
+// Spans are appended to the log when they are exported, and a background goroutine
+// sends them to the wrapped exporter in the order they were written. When an export
+// fails, it is retried with backoff until it succeeds, and spans that are logged in
+// the meantime wait behind it. When the process restarts with the same directory,
+// spans that weren't sent are replayed.
+//
+// The log is bounded by a disk budget. When it is full, the oldest spans are dropped
+// to make room for new ones, and counted in [Stats].
+//
+// The directory is locked while the log is open, so only one exporter, in one process,
+// uses it at a time.
+//
+// Most users enable it with braintrust.WithExportQueueDir, which wraps the default
+// Braintrust exporter, and get its Stats with trace.ExportQueueStats. To wrap another
+// exporter:
+//
+//	exporter, err := wal.New(otlpExporter, wal.Opts{Dir: "/var/lib/myapp/spans"})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+package wal
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/braintrustdata/braintrust-x-go/braintrust/log"
+)
+
+const (
+	segmentExt = ".wal"
+	cursorFile = "cursor"
+	lockName   = "lock"
+	headerSize = 8 // 4 bytes of length, 4 bytes of CRC-32 of the payload
+
+	defaultMaxBytes     = 256 << 20
+	defaultSegmentBytes = 8 << 20
+	defaultMinBackoff   = time.Second
+	defaultMaxBackoff   = time.Minute
+)
+
+// errLocked is returned by New when another exporter has the log open.
+var errLocked = errors.New("the log is open in another exporter")
+
+// Opts configures an [Exporter].
+type Opts struct {
+	Dir          string        // Directory of the log. It is created if it doesn't exist. Required.
+	MaxBytes     int64         // Disk budget of the log (default: 256MB)
+	SegmentBytes int64         // Size at which a new log file is started (default: 8MB)
+	Sync         bool          // Fsync every write, so spans survive power loss and not just crashes
+	MinBackoff   time.Duration // First delay before retrying a failed export (default: 1s)
+	MaxBackoff   time.Duration // Max delay between retries (default: 1m)
+}
+
+// Stats are counters of an [Exporter].
+type Stats struct {
+	QueuedSpans   int64 // spans in the log that haven't been sent
+	QueuedBytes   int64 // size of the log on disk
+	ExportedSpans int64 // spans sent to the wrapped exporter
+	DroppedSpans  int64 // spans that were dropped because the log was full or corrupt
+	ExportErrors  int64 // failed exports, including ones that were retried
+}
+
+// Exporter is a [sdktrace.SpanExporter] that writes spans to a write-ahead log on disk,
+// and sends them to another exporter in the background. Create it with [New].
+type Exporter struct {
+	next sdktrace.SpanExporter
+	opts Opts
+	lock *os.File // held while the log is open, so only one exporter writes to it
+
+	mu       sync.Mutex
+	segments []*segment // oldest first. The last one is being written.
+	active   *os.File
+	inflight *record // the record being exported, if any
+	stats    Stats
+	closed   bool
+	changed  chan struct{} // closed and replaced when spans are sent or dropped
+
+	wake    chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+type segment struct {
+	id      uint64
+	size    int64
+	records []*record
+	next    int // index of the first record that hasn't been sent
+}
+
+type record struct {
+	segment *segment
+	offset  int64
+	size    int64 // including the header
+	spans   int
+}
+
+// cursor is the position of the first record that hasn't been sent.
+type cursor struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+// New opens the log in opts.Dir, creating it if needed, and starts sending the spans
+// in it to next. Call Shutdown to stop it.
+func New(next sdktrace.SpanExporter, opts Opts) (*Exporter, error) {
+	if next == nil {
+		return nil, errors.New("wal: exporter is required")
+	}
+	if opts.Dir == "" {
+		return nil, errors.New("wal: directory is required")
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultMaxBytes
+	}
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = defaultSegmentBytes
+	}
+	opts.SegmentBytes = min(opts.SegmentBytes, opts.MaxBytes)
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("wal: failed to create directory: %w", err)
+	}
+
+	lock, err := os.OpenFile(filepath.Join(opts.Dir, lockName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("wal: failed to create lock file: %w", err)
+	}
+	if err := lockFile(lock); err != nil {
+		_ = lock.Close()
+		return nil, fmt.Errorf("wal: failed to lock %s: %w", opts.Dir, err)
+	}
+
+	e := &Exporter{
+		next:    next,
+		lock:    lock,
+		opts:    opts,
+		changed: make(chan struct{}),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if err := e.open(); err != nil {
+		if e.active != nil {
+			_ = e.active.Close()
+		}
+		_ = lock.Close()
+		return nil, err
+	}
+	go e.run()
+	return e, nil
+}
+
+// open loads the segments on disk, and starts a new one to write to.
+func (e *Exporter) open() error {
+	cur, err := e.readCursor()
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(e.opts.Dir)
+	if err != nil {
+		return fmt.Errorf("wal: failed to read directory: %w", err)
+	}
+	var ids []uint64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentExt)
+		if !ok {
+			continue
+		}
+		id, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	lastID := cur.Segment
+	for _, id := range ids {
+		lastID = max(lastID, id)
+		if id < cur.Segment {
+			// already sent
+			_ = os.Remove(e.segmentPath(id))
+			continue
+		}
+		seg, err := e.scanSegment(id)
+		if err != nil {
+			return err
+		}
+		if id == cur.Segment {
+			for seg.next < len(seg.records) && seg.records[seg.next].offset < cur.Offset {
+				seg.next++
+			}
+		}
+		e.segments = append(e.segments, seg)
+	}
+	return e.startSegment(lastID + 1)
+}
+
+// scanSegment indexes the records of a segment. A torn or corrupt record at the end,
+// from a crash in the middle of a write, is cut off.
+func (e *Exporter) scanSegment(id uint64) (*segment, error) {
+	path := e.segmentPath(id)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("wal: failed to open %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	seg := &segment{id: id}
+	var header [headerSize]byte
+	for {
+		n, err := f.ReadAt(header[:], seg.size)
+		if n == 0 && err == io.EOF {
+			break
+		}
+		var spans int
+		if err == nil {
+			spans, err = e.readPayload(f, seg.size, header)
+		}
+		if err != nil {
+			info, statErr := f.Stat()
+			if statErr == nil && info.Size() > seg.size {
+				log.Warnf("wal: truncating corrupt data at the end of %s: %v", path, err)
+				if err := f.Truncate(seg.size); err != nil {
+					return nil, fmt.Errorf("wal: failed to truncate %s: %w", path, err)
+				}
+			}
+			break
+		}
+		size := headerSize + int64(binary.BigEndian.Uint32(header[:4]))
+		seg.records = append(seg.records, &record{segment: seg, offset: seg.size, size: size, spans: spans})
+		seg.size += size
+	}
+	return seg, nil
+}
+
+// readPayload checks the payload of the record at offset and returns how many spans it has.
+func (e *Exporter) readPayload(f *os.File, offset int64, header [headerSize]byte) (int, error) {
+	payload, err := readRecord(f, offset, header, e.opts.MaxBytes)
+	if err != nil {
+		return 0, err
+	}
+	var spans []json.RawMessage
+	if err := json.Unmarshal(payload, &spans); err != nil {
+		return 0, err
+	}
+	return len(spans), nil
+}
+
+func readRecord(f *os.File, offset int64, header [headerSize]byte, maxSize int64) ([]byte, error) {
+	length := int64(binary.BigEndian.Uint32(header[:4]))
+	if length > maxSize {
+		return nil, fmt.Errorf("record of %d bytes is larger than the log", length)
+	}
+	payload := make([]byte, length)
+	if _, err := f.ReadAt(payload, offset+headerSize); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return payload, nil
+}
+
+func (e *Exporter) startSegment(id uint64) error {
+	path := e.segmentPath(id)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("wal: failed to create %s: %w", path, err)
+	}
+	if e.active != nil {
+		_ = e.active.Close()
+	}
+	e.active = f
+	e.segments = append(e.segments, &segment{id: id})
+	return nil
+}
+
+// ExportSpans appends spans to the log. They are sent to the wrapped exporter in the
+// background.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	payload, err := encodeSpans(spans)
+	if err != nil {
+		return fmt.Errorf("wal: failed to encode spans: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return errors.New("wal: exporter is shut down")
+	}
+
+	size := headerSize + int64(len(payload))
+	if size > e.opts.MaxBytes {
+		e.stats.DroppedSpans += int64(len(spans))
+		log.Warnf("wal: dropped %d spans because they are larger than the log (%d bytes)", len(spans), size)
+		return nil
+	}
+	if err := e.makeRoom(size); err != nil {
+		return err
+	}
+
+	var buf []byte
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(payload))
+	buf = append(buf, payload...)
+	seg := e.segments[len(e.segments)-1]
+	if _, err := e.active.Write(buf); err != nil {
+		// cut off a partial write, so later records can be read
+		_ = e.active.Truncate(seg.size)
+		return fmt.Errorf("wal: failed to write spans: %w", err)
+	}
+	if e.opts.Sync {
+		if err := e.active.Sync(); err != nil {
+			return fmt.Errorf("wal: failed to sync: %w", err)
+		}
+	}
+	seg.records = append(seg.records, &record{segment: seg, offset: seg.size, size: size, spans: len(spans)})
+	seg.size += size
+
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// makeRoom starts a new segment if the active one is full, and drops the oldest
+// segments until size more bytes fit in the disk budget. It must be called with mu held.
+func (e *Exporter) makeRoom(size int64) error {
+	if active := e.segments[len(e.segments)-1]; active.size > 0 && active.size+size > e.opts.SegmentBytes {
+		if err := e.startSegment(active.id + 1); err != nil {
+			return err
+		}
+	}
+
+	dropped := 0
+	for e.diskSize()+size > e.opts.MaxBytes {
+		if len(e.segments) == 1 {
+			if err := e.startSegment(e.segments[0].id + 1); err != nil {
+				return err
+			}
+		}
+		oldest := e.segments[0]
+		for _, r := range oldest.records[oldest.next:] {
+			if r != e.inflight {
+				dropped += r.spans
+			}
+		}
+		e.removeHead()
+	}
+	if dropped > 0 {
+		e.stats.DroppedSpans += int64(dropped)
+		log.Warnf("wal: dropped the %d oldest spans because the log is full (%d bytes)", dropped, e.opts.MaxBytes)
+		e.notify()
+	}
+	return nil
+}
+
+func (e *Exporter) diskSize() int64 {
+	var size int64
+	for _, seg := range e.segments {
+		size += seg.size
+	}
+	return size
+}
+
+// removeHead deletes the oldest segment, which must not be the active one. It must be
+// called with mu held.
+func (e *Exporter) removeHead() {
+	head := e.segments[0]
+	e.segments = e.segments[1:]
+	if err := os.Remove(e.segmentPath(head.id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warnf("wal: failed to remove %s: %v", e.segmentPath(head.id), err)
+	}
+	e.writeCursor()
+}
+
+// run sends the log to the wrapped exporter until Shutdown is called.
+func (e *Exporter) run() {
+	defer close(e.stopped)
+
+	backoff := time.Duration(0)
+	for {
+		select {
+		case <-e.stop:
+			return
+		default:
+		}
+
+		r, spans, ok := e.head()
+		if !ok {
+			select {
+			case <-e.wake:
+			case <-e.stop:
+				return
+			}
+			continue
+		}
+
+		if err := e.send(context.Background(), r, spans); err != nil {
+			backoff = min(max(2*backoff, e.opts.MinBackoff), e.opts.MaxBackoff)
+			log.Warnf("wal: failed to export %d spans, retrying in %s: %v", len(spans), backoff, err)
+			select {
+			case <-time.After(backoff):
+			case <-e.stop:
+				return
+			}
+			continue
+		}
+		backoff = 0
+	}
+}
+
+// head returns the oldest record that hasn't been sent, and marks it in flight.
+func (e *Exporter) head() (*record, []sdktrace.ReadOnlySpan, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for len(e.segments) > 0 {
+		seg := e.segments[0]
+		if seg.next == len(seg.records) {
+			if len(e.segments) == 1 {
+				return nil, nil, false
+			}
+			e.removeHead()
+			continue
+		}
+
+		r := seg.records[seg.next]
+		spans, err := e.read(r)
+		if err != nil {
+			log.Warnf("wal: dropped %d unreadable spans: %v", r.spans, err)
+			e.stats.DroppedSpans += int64(r.spans)
+			e.advance(r)
+			continue
+		}
+		e.inflight = r
+		return r, spans, true
+	}
+	return nil, nil, false
+}
+
+func (e *Exporter) read(r *record) ([]sdktrace.ReadOnlySpan, error) {
+	f, err := os.Open(e.segmentPath(r.segment.id))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var header [headerSize]byte
+	if _, err := f.ReadAt(header[:], r.offset); err != nil {
+		return nil, err
+	}
+	payload, err := readRecord(f, r.offset, header, e.opts.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSpans(payload)
+}
+
+// send exports an in flight record, and moves past it if that succeeds.
+func (e *Exporter) send(ctx context.Context, r *record, spans []sdktrace.ReadOnlySpan) error {
+	err := e.next.ExportSpans(ctx, spans)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.inflight = nil
+	if err != nil {
+		e.stats.ExportErrors++
+		if !slices.Contains(e.segments, r.segment) {
+			// the log filled up and the record was dropped while it was in flight
+			e.stats.DroppedSpans += int64(r.spans)
+			e.notify()
+		}
+		return err
+	}
+	e.stats.ExportedSpans += int64(r.spans)
+	if slices.Contains(e.segments, r.segment) {
+		e.advance(r)
+	} else {
+		e.notify()
+	}
+	return nil
+}
+
+// advance moves the cursor past r, which must be the oldest record that hasn't been
+// sent. It must be called with mu held.
+func (e *Exporter) advance(r *record) {
+	r.segment.next++
+	e.writeCursor()
+	e.notify()
+}
+
+func (e *Exporter) notify() {
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// writeCursor saves the position of the oldest record that hasn't been sent. It must
+// be called with mu held.
+func (e *Exporter) writeCursor() {
+	if len(e.segments) == 0 {
+		return
+	}
+	seg := e.segments[0]
+	cur := cursor{Segment: seg.id, Offset: seg.size}
+	if seg.next < len(seg.records) {
+		cur.Offset = seg.records[seg.next].offset
+	}
+	if err := e.saveCursor(cur); err != nil {
+		// at worst, spans are sent twice after a restart
+		log.Warnf("wal: failed to save cursor: %v", err)
+	}
+}
+
+func (e *Exporter) saveCursor(cur cursor) error {
+	data, err := json.Marshal(cur)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(e.opts.Dir, cursorFile)
+	tmp, err := os.CreateTemp(e.opts.Dir, cursorFile+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if e.opts.Sync {
+		if err := tmp.Sync(); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (e *Exporter) readCursor() (cursor, error) {
+	var cur cursor
+	data, err := os.ReadFile(filepath.Join(e.opts.Dir, cursorFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return cur, nil
+	}
+	if err != nil {
+		return cur, fmt.Errorf("wal: failed to read cursor: %w", err)
+	}
+	if err := json.Unmarshal(data, &cur); err != nil {
+		// resend everything rather than lose spans
+		log.Warnf("wal: ignoring corrupt cursor: %v", err)
+		return cursor{}, nil
+	}
+	return cur, nil
+}
+
+func (e *Exporter) segmentPath(id uint64) string {
+	return filepath.Join(e.opts.Dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+// ForceFlush waits until every span in the log has been sent, or ctx is done.
+func (e *Exporter) ForceFlush(ctx context.Context) error {
+	for {
+		e.mu.Lock()
+		empty := e.queuedSpans() == 0
+		changed := e.changed
+		e.mu.Unlock()
+		if empty {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Shutdown stops the background sender, tries once more to send the spans in the log,
+// and shuts down the wrapped exporter. Spans that can't be sent before ctx is done
+// stay in the log, and are sent the next time it is opened.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+	e.mu.Unlock()
+
+	close(e.stop)
+	select {
+	case <-e.stopped:
+	case <-ctx.Done():
+		// the sender is blocked in an export. The log is unlocked and the wrapped
+		// exporter shut down once it returns, so the record isn't sent twice.
+		err := e.closeActive()
+		go func() {
+			<-e.stopped
+			_ = e.lock.Close()
+			_ = e.next.Shutdown(context.WithoutCancel(ctx))
+		}()
+		return errors.Join(ctx.Err(), err)
+	}
+
+	var err error
+	for ctx.Err() == nil {
+		r, spans, ok := e.head()
+		if !ok {
+			break
+		}
+		if err = e.send(ctx, r, spans); err != nil {
+			err = fmt.Errorf("wal: failed to export spans, they will be sent when the log is reopened: %w", err)
+			break
+		}
+	}
+
+	err = errors.Join(err, e.closeActive())
+	_ = e.lock.Close()
+	return errors.Join(err, e.next.Shutdown(ctx))
+}
+
+// closeActive syncs and closes the segment being written.
+func (e *Exporter) closeActive() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return errors.Join(e.active.Sync(), e.active.Close())
+}
+
+// Stats returns the exporter's counters.
+func (e *Exporter) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	stats := e.stats
+	stats.QueuedSpans = e.queuedSpans()
+	stats.QueuedBytes = e.diskSize()
+	return stats
+}
+
+func (e *Exporter) queuedSpans() int64 {
+	var n int64
+	for _, seg := range e.segments {
+		for _, r := range seg.records[seg.next:] {
+			n += int64(r.spans)
+		}
+	}
+	return n
+}
@@ -0,0 +1,362 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeExporter records exported spans, and fails while failing is set.
+type fakeExporter struct {
+	mu        sync.Mutex
+	names     []string
+	failing   bool
+	calls     int
+	shutdowns int
+}
+
+func (f *fakeExporter) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.failing {
+		return errors.New("connection refused")
+	}
+	for _, s := range spans {
+		f.names = append(f.names, s.Name())
+	}
+	return nil
+}
+
+func (f *fakeExporter) Shutdown(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.shutdowns++
+	return nil
+}
+
+func (f *fakeExporter) shutdownCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.shutdowns
+}
+
+func (f *fakeExporter) setFailing(failing bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failing = failing
+}
+
+func (f *fakeExporter) exported() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.names...)
+}
+
+func (f *fakeExporter) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func newTestExporter(t *testing.T, next sdktrace.SpanExporter, opts Opts) *Exporter {
+	t.Helper()
+	if opts.Dir == "" {
+		opts.Dir = t.TempDir()
+	}
+	opts.MinBackoff = time.Millisecond
+	opts.MaxBackoff = 5 * time.Millisecond
+	e, err := New(next, opts)
+	require.NoError(t, err)
+	return e
+}
+
+func spans(names ...string) []sdktrace.ReadOnlySpan {
+	out := make([]sdktrace.ReadOnlySpan, len(names))
+	for i, name := range names {
+		out[i] = tracetest.SpanStub{Name: name}.Snapshot()
+	}
+	return out
+}
+
+func flush(t *testing.T, e *Exporter) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, e.ForceFlush(ctx))
+}
+
+func TestExporter_Order(t *testing.T) {
+	next := &fakeExporter{}
+	e := newTestExporter(t, next, Opts{SegmentBytes: 200})
+
+	var want []string
+	for i := range 20 {
+		name := fmt.Sprintf("span-%d", i)
+		want = append(want, name)
+		require.NoError(t, e.ExportSpans(context.Background(), spans(name)))
+	}
+	flush(t, e)
+	assert.Equal(t, want, next.exported())
+
+	stats := e.Stats()
+	assert.Equal(t, int64(0), stats.QueuedSpans)
+	assert.Equal(t, int64(20), stats.ExportedSpans)
+	assert.Zero(t, stats.DroppedSpans+stats.ExportErrors)
+	require.NoError(t, e.Shutdown(context.Background()))
+
+	// sent segments are deleted
+	files, err := filepath.Glob(filepath.Join(e.opts.Dir, "*"+segmentExt))
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestExporter_RetriesInOrder(t *testing.T) {
+	next := &fakeExporter{failing: true}
+	e := newTestExporter(t, next, Opts{})
+	defer func() { _ = e.Shutdown(context.Background()) }()
+
+	require.NoError(t, e.ExportSpans(context.Background(), spans("a", "b")))
+	require.Eventually(t, func() bool { return next.callCount() >= 3 }, 5*time.Second, time.Millisecond)
+	require.NoError(t, e.ExportSpans(context.Background(), spans("c")))
+
+	stats := e.Stats()
+	assert.Equal(t, int64(3), stats.QueuedSpans)
+	assert.GreaterOrEqual(t, stats.ExportErrors, int64(3))
+	assert.Empty(t, next.exported())
+
+	next.setFailing(false)
+	flush(t, e)
+	assert.Equal(t, []string{"a", "b", "c"}, next.exported())
+	assert.Equal(t, int64(3), e.Stats().ExportedSpans)
+}
+
+func TestExporter_Replay(t *testing.T) {
+	dir := t.TempDir()
+	offline := &fakeExporter{failing: true}
+	e := newTestExporter(t, offline, Opts{Dir: dir, SegmentBytes: 100})
+	require.NoError(t, e.ExportSpans(context.Background(), spans("a")))
+	require.NoError(t, e.ExportSpans(context.Background(), spans("b", "c")))
+	require.NoError(t, e.ExportSpans(context.Background(), spans("d")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.ErrorContains(t, e.Shutdown(ctx), "connection refused")
+	assert.ErrorContains(t, e.ExportSpans(context.Background(), spans("e")), "shut down")
+
+	// the spans are sent when the log is reopened
+	online := &fakeExporter{}
+	e = newTestExporter(t, online, Opts{Dir: dir, SegmentBytes: 100})
+	assert.Equal(t, int64(4), e.Stats().QueuedSpans)
+	require.NoError(t, e.ExportSpans(context.Background(), spans("e")))
+	flush(t, e)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, online.exported())
+	require.NoError(t, e.Shutdown(context.Background()))
+
+	// and only once
+	again := &fakeExporter{}
+	e = newTestExporter(t, again, Opts{Dir: dir})
+	assert.Equal(t, int64(0), e.Stats().QueuedSpans)
+	require.NoError(t, e.Shutdown(context.Background()))
+	assert.Empty(t, again.exported())
+}
+
+func TestExporter_ReplayPartiallySent(t *testing.T) {
+	dir := t.TempDir()
+	next := &fakeExporter{}
+	e := newTestExporter(t, next, Opts{Dir: dir})
+	require.NoError(t, e.ExportSpans(context.Background(), spans("a")))
+	flush(t, e)
+	next.setFailing(true)
+	require.NoError(t, e.ExportSpans(context.Background(), spans("b")))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Error(t, e.Shutdown(ctx))
+
+	reopened := &fakeExporter{}
+	e = newTestExporter(t, reopened, Opts{Dir: dir})
+	flush(t, e)
+	require.NoError(t, e.Shutdown(context.Background()))
+	assert.Equal(t, []string{"b"}, reopened.exported())
+}
+
+func TestExporter_DiskBudget(t *testing.T) {
+	next := &fakeExporter{failing: true}
+	e := newTestExporter(t, next, Opts{MaxBytes: 1000, SegmentBytes: 200})
+	defer func() { _ = e.Shutdown(context.Background()) }()
+
+	for i := range 50 {
+		require.NoError(t, e.ExportSpans(context.Background(), spans(fmt.Sprintf("span-%02d", i))))
+	}
+
+	stats := e.Stats()
+	assert.LessOrEqual(t, stats.QueuedBytes, int64(1000))
+	assert.Positive(t, stats.DroppedSpans)
+	assert.Equal(t, int64(50), stats.QueuedSpans+stats.DroppedSpans+stats.ExportedSpans)
+
+	// the newest spans are kept, in order
+	next.setFailing(false)
+	flush(t, e)
+	exported := next.exported()
+	require.NotEmpty(t, exported)
+	assert.Equal(t, "span-49", exported[len(exported)-1])
+	assert.IsIncreasing(t, exported)
+	assert.Equal(t, int64(50), e.Stats().DroppedSpans+e.Stats().ExportedSpans)
+
+	// a batch that can never fit is dropped
+	big := tracetest.SpanStub{Name: "big", Attributes: []attribute.KeyValue{attribute.String("data", string(make([]byte, 2000)))}}
+	require.NoError(t, e.ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{big.Snapshot()}))
+	assert.Equal(t, int64(51), e.Stats().DroppedSpans+e.Stats().ExportedSpans)
+}
+
+func TestExporter_CorruptTail(t *testing.T) {
+	dir := t.TempDir()
+	next := &fakeExporter{failing: true}
+	e := newTestExporter(t, next, Opts{Dir: dir})
+	require.NoError(t, e.ExportSpans(context.Background(), spans("a")))
+	require.NoError(t, e.ExportSpans(context.Background(), spans("b")))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = e.Shutdown(ctx)
+
+	// simulate a crash in the middle of a write
+	path := e.segmentPath(1)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-5))
+
+	reopened := &fakeExporter{}
+	e = newTestExporter(t, reopened, Opts{Dir: dir})
+	flush(t, e)
+	require.NoError(t, e.Shutdown(context.Background()))
+	assert.Equal(t, []string{"a"}, reopened.exported())
+}
+
+func TestNew_Locked(t *testing.T) {
+	dir := t.TempDir()
+	e := newTestExporter(t, &fakeExporter{}, Opts{Dir: dir})
+
+	// only one exporter can have the log open
+	_, err := New(&fakeExporter{}, Opts{Dir: dir})
+	assert.ErrorContains(t, err, "another exporter")
+
+	require.NoError(t, e.Shutdown(context.Background()))
+	e = newTestExporter(t, &fakeExporter{}, Opts{Dir: dir})
+	require.NoError(t, e.Shutdown(context.Background()))
+}
+
+// blockingExporter blocks exports until release is closed.
+type blockingExporter struct {
+	fakeExporter
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	close(b.started)
+	<-b.release
+	return errors.New("connection reset")
+}
+
+func TestExporter_ShutdownWhileExporting(t *testing.T) {
+	dir := t.TempDir()
+	next := &blockingExporter{started: make(chan struct{}), release: make(chan struct{})}
+	e := newTestExporter(t, next, Opts{Dir: dir})
+	require.NoError(t, e.ExportSpans(context.Background(), spans("a")))
+	<-next.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, e.Shutdown(ctx), context.DeadlineExceeded)
+
+	// the log stays locked until the export returns
+	_, err := New(&fakeExporter{}, Opts{Dir: dir})
+	assert.ErrorContains(t, err, "another exporter")
+	assert.Zero(t, next.shutdownCount())
+	close(next.release)
+	<-e.stopped
+	// then the wrapped exporter is shut down
+	require.Eventually(t, func() bool { return next.shutdownCount() == 1 }, 5*time.Second, time.Millisecond)
+
+	// and the spans are sent when it is reopened
+	sent := &fakeExporter{}
+	var reopened *Exporter
+	require.Eventually(t, func() bool {
+		reopened, err = New(sent, Opts{Dir: dir})
+		return err == nil
+	}, 5*time.Second, time.Millisecond)
+	require.Eventually(t, func() bool { return len(sent.exported()) == 1 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []string{"a"}, sent.exported())
+	require.NoError(t, reopened.Shutdown(context.Background()))
+}
+
+func TestNew_Errors(t *testing.T) {
+	_, err := New(nil, Opts{Dir: t.TempDir()})
+	assert.Error(t, err)
+	_, err = New(&fakeExporter{}, Opts{})
+	assert.Error(t, err)
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("0102030405060708090a0b0c0d0e0f10")
+	spanID, _ := trace.SpanIDFromHex("0102030405060708")
+	parentID, _ := trace.SpanIDFromHex("1112131415161718")
+	state, _ := trace.ParseTraceState("vendor=value")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled, TraceState: state})
+	parent := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: parentID, Remote: true})
+	now := time.Date(2025, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	stub := tracetest.SpanStub{
+		Name:        "chat",
+		SpanContext: sc,
+		Parent:      parent,
+		SpanKind:    trace.SpanKindClient,
+		StartTime:   now,
+		EndTime:     now.Add(time.Second),
+		Attributes: []attribute.KeyValue{
+			attribute.String("braintrust.input_json", `{"q": "hi"}`),
+			attribute.Int64("count", 1<<60),
+			attribute.Float64("score", 0.5),
+			attribute.Float64("inf", math.Inf(1)),
+			attribute.Bool("ok", true),
+			attribute.StringSlice("braintrust.tags", []string{"a", "b"}),
+			attribute.Int64Slice("ints", []int64{1, 2}),
+			attribute.Float64Slice("floats", []float64{1.5}),
+			attribute.BoolSlice("bools", []bool{true, false}),
+		},
+		Events:            []sdktrace.Event{{Name: "exception", Time: now, Attributes: []attribute.KeyValue{attribute.String("exception.message", "boom")}}},
+		Links:             []sdktrace.Link{{SpanContext: parent, Attributes: []attribute.KeyValue{attribute.String("braintrust.link_type", "previous_turn")}}},
+		Status:            sdktrace.Status{Code: codes.Error, Description: "boom"},
+		DroppedAttributes: 1,
+		ChildSpanCount:    2,
+		Resource:          resource.NewWithAttributes("https://schema", attribute.String("service.name", "edge")),
+		InstrumentationScope: instrumentation.Scope{
+			Name:       "braintrust",
+			Version:    "1.0",
+			Attributes: attribute.NewSet(attribute.String("k", "v")),
+		},
+	}
+
+	data, err := encodeSpans([]sdktrace.ReadOnlySpan{stub.Snapshot()})
+	require.NoError(t, err)
+	decoded, err := decodeSpans(data)
+	require.NoError(t, err)
+	require.Len(t, decoded, 1)
+	assert.Equal(t, tracetest.SpanStubFromReadOnlySpan(stub.Snapshot()), tracetest.SpanStubFromReadOnlySpan(decoded[0]))
+}
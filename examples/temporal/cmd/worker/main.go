@@ -5,14 +5,13 @@ import (
 	"log"
 
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.temporal.io/sdk/client"
-	"go.temporal.io/sdk/contrib/opentelemetry"
 	"go.temporal.io/sdk/interceptor"
 	"go.temporal.io/sdk/worker"
 
 	"github.com/braintrustdata/braintrust-x-go/braintrust/trace"
+	"github.com/braintrustdata/braintrust-x-go/braintrust/trace/tracetemporal"
 	temporal "github.com/braintrustdata/braintrust-x-go/examples/temporal"
 )
 
@@ -28,28 +27,12 @@ func main() {
 	// Set the tracer provider globally
 	otel.SetTracerProvider(tp)
 
-	// Configure propagators for distributed tracing
-	// Required to propagate braintrust.parent across process boundaries
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
-		propagation.TraceContext{},
-		propagation.Baggage{},
-	))
-
-	// Get tracer for Temporal
-	tracer := otel.Tracer("temporal-braintrust")
-
-	// Create OpenTelemetry interceptor for Temporal
-	tracingInterceptor, err := opentelemetry.NewTracingInterceptor(opentelemetry.TracerOptions{
-		Tracer: tracer,
-	})
-	if err != nil {
-		log.Fatalln("Unable to create Temporal tracing interceptor:", err)
-	}
-
-	// Create Temporal client with OpenTelemetry interceptor
+	// Create Temporal client with the Braintrust interceptor. It propagates
+	// braintrust.parent to workflows and activities, and workers created from
+	// the client use it too.
 	c, err := client.Dial(client.Options{
 		HostPort:     client.DefaultHostPort,
-		Interceptors: []interceptor.ClientInterceptor{tracingInterceptor},
+		Interceptors: []interceptor.ClientInterceptor{tracetemporal.NewInterceptor()},
 	})
 	if err != nil {
 		log.Fatalln("Unable to create Temporal client:", err)